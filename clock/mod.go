@@ -0,0 +1,40 @@
+package clock
+
+import "time"
+
+// Clock describes the source of time used by the daemons and the timeouts of a peer. It mirrors the
+// functions of the time package, so that the time can be simulated in tests.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// Since returns the time elapsed since t
+	Since(t time.Time) time.Duration
+
+	// After waits for the duration to elapse and then sends the current time on the returned channel
+	After(d time.Duration) <-chan time.Time
+
+	// Sleep pauses the current goroutine for at least the duration d
+	Sleep(d time.Duration)
+
+	// NewTicker returns a new Ticker that sends the current time on its channel after each tick
+	NewTicker(d time.Duration) Ticker
+
+	// AfterFunc waits for the duration to elapse and then calls f in its own goroutine
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Ticker holds a channel that delivers ticks of a clock at intervals.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered
+	C() <-chan time.Time
+
+	// Stop turns off the ticker, no more ticks will be sent
+	Stop()
+}
+
+// Timer represents a single event created by AfterFunc.
+type Timer interface {
+	// Stop prevents the timer from firing, it returns false if the timer has already fired or been stopped
+	Stop() bool
+}
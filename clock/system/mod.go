@@ -0,0 +1,59 @@
+package system
+
+import (
+	"time"
+
+	"go.dedis.ch/cs438/clock"
+)
+
+// NewClock returns a clock that follows the time of the system, it simply calls the time package.
+func NewClock() clock.Clock {
+	return Clock{}
+}
+
+// Clock implements a clock based on the time package.
+//
+// - implements clock.Clock
+type Clock struct{}
+
+// Now implements clock.Clock
+func (Clock) Now() time.Time {
+	return time.Now()
+}
+
+// Since implements clock.Clock
+func (Clock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+// After implements clock.Clock
+func (Clock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Sleep implements clock.Clock
+func (Clock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// NewTicker implements clock.Clock
+func (Clock) NewTicker(d time.Duration) clock.Ticker {
+	return ticker{Ticker: time.NewTicker(d)}
+}
+
+// AfterFunc implements clock.Clock
+func (Clock) AfterFunc(d time.Duration, f func()) clock.Timer {
+	return time.AfterFunc(d, f)
+}
+
+// ticker wraps a time.Ticker
+//
+// - implements clock.Ticker
+type ticker struct {
+	*time.Ticker
+}
+
+// C implements clock.Ticker
+func (t ticker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,226 @@
+package virtual
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"go.dedis.ch/cs438/clock"
+)
+
+// NewClock returns a virtual clock starting at the given time. The time of the clock only moves when it is
+// advanced, the timers are then fired in the order of their deadline.
+func NewClock(start time.Time) *Clock {
+	return &Clock{
+		now:    start,
+		timers: timerHeap{},
+	}
+}
+
+// Clock implements a clock driven by the caller, e.g., a simulation.
+//
+// - implements clock.Clock
+type Clock struct {
+	sync.Mutex
+	now    time.Time
+	seq    uint64    // Breaks the ties between timers with the same deadline, in their order of creation
+	timers timerHeap // The timers that have not fired yet, ordered by deadline
+}
+
+// Now implements clock.Clock
+func (c *Clock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now
+}
+
+// Since implements clock.Clock
+func (c *Clock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// After implements clock.Clock
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.schedule(&timer{c: ch}, d)
+	return ch
+}
+
+// Sleep implements clock.Clock. It returns once the clock has been advanced by d.
+func (c *Clock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// NewTicker implements clock.Clock
+func (c *Clock) NewTicker(d time.Duration) clock.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	t := &timer{c: make(chan time.Time, 1), period: d}
+	c.schedule(t, d)
+	return ticker{timer: t}
+}
+
+// AfterFunc implements clock.Clock
+func (c *Clock) AfterFunc(d time.Duration, f func()) clock.Timer {
+	t := &timer{f: f}
+	c.schedule(t, d)
+	return t
+}
+
+// Next returns the deadline of the next timer, it returns false if there is no timer
+func (c *Clock) Next() (time.Time, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.timers) == 0 {
+		return time.Time{}, false
+	}
+	return c.timers[0].when, true
+}
+
+// Pending returns the number of timers that have not fired yet
+func (c *Clock) Pending() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return len(c.timers)
+}
+
+// Advance moves the clock forward by d, and fires all timers whose deadline is reached
+func (c *Clock) Advance(d time.Duration) {
+	c.AdvanceTo(c.Now().Add(d))
+}
+
+// AdvanceTo moves the clock forward to the given time, and fires all timers whose deadline is reached, in the
+// order of their deadline. The clock never goes backward.
+func (c *Clock) AdvanceTo(t time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	for len(c.timers) > 0 && !c.timers[0].when.After(t) {
+		next := c.timers[0]
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+
+		if next.period > 0 {
+			// A ticker drops the ticks that are not consumed, as the ticker of the time package does
+			select {
+			case next.c <- c.now:
+			default:
+			}
+			next.when = next.when.Add(next.period)
+			heap.Fix(&c.timers, next.index)
+			continue
+		}
+
+		heap.Pop(&c.timers)
+		if next.f != nil {
+			go next.f()
+		} else {
+			next.c <- c.now
+		}
+	}
+
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+// schedule adds the timer to the clock, it fires after d
+func (c *Clock) schedule(t *timer, d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	t.clock = c
+	t.when = c.now.Add(d)
+	t.seq = c.seq
+	c.seq++
+	heap.Push(&c.timers, t)
+}
+
+// remove removes the timer from the clock, it returns false if the timer is not scheduled anymore
+func (c *Clock) remove(t *timer) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if t.index < 0 {
+		return false
+	}
+	heap.Remove(&c.timers, t.index)
+	return true
+}
+
+// timer is a single event or a periodic event of a virtual clock
+//
+// - implements clock.Timer
+type timer struct {
+	clock  *Clock
+	when   time.Time
+	seq    uint64
+	index  int            // The index of the timer inside the heap, -1 once it is removed
+	period time.Duration  // The interval of a ticker, 0 for a single event
+	c      chan time.Time // The channel the time is sent on, nil for AfterFunc
+	f      func()         // The function called by AfterFunc
+}
+
+// Stop implements clock.Timer
+func (t *timer) Stop() bool {
+	return t.clock.remove(t)
+}
+
+// ticker is a periodic event of a virtual clock
+//
+// - implements clock.Ticker
+type ticker struct {
+	*timer
+}
+
+// C implements clock.Ticker
+func (t ticker) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop implements clock.Ticker
+func (t ticker) Stop() {
+	t.clock.remove(t.timer)
+}
+
+// timerHeap orders the timers by deadline, and then by creation
+//
+// - implements heap.Interface
+type timerHeap []*timer
+
+func (h timerHeap) Len() int {
+	return len(h)
+}
+
+func (h timerHeap) Less(i, j int) bool {
+	if h[i].when.Equal(h[j].when) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].when.Before(h[j].when)
+}
+
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x interface{}) {
+	t := x.(*timer)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
@@ -0,0 +1,72 @@
+package virtual
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClock_Timers(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewClock(start)
+
+	after := clock.After(time.Second)
+	var called atomic.Int32
+	timer := clock.AfterFunc(time.Second*2, func() { called.Add(1) })
+	stopped := clock.AfterFunc(time.Second*2, func() { called.Add(10) })
+	require.True(t, stopped.Stop())
+	require.False(t, stopped.Stop())
+	require.Equal(t, 2, clock.Pending())
+
+	next, ok := clock.Next()
+	require.True(t, ok)
+	require.Equal(t, start.Add(time.Second), next)
+
+	clock.Advance(time.Millisecond * 500)
+	select {
+	case <-after:
+		t.Fatal("the timer fired too early")
+	default:
+	}
+
+	clock.Advance(time.Millisecond * 500)
+	require.Equal(t, start.Add(time.Second), <-after)
+
+	clock.Advance(time.Second * 5)
+	require.Eventually(t, func() bool { return called.Load() == 1 }, time.Second, time.Millisecond)
+	require.False(t, timer.Stop())
+	require.Equal(t, start.Add(time.Second*6), clock.Now())
+	require.Equal(t, time.Second*6, clock.Since(start))
+
+	_, ok = clock.Next()
+	require.False(t, ok)
+}
+
+func TestClock_Ticker(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewClock(start)
+
+	ticker := clock.NewTicker(time.Second)
+	clock.Advance(time.Second)
+	require.Equal(t, start.Add(time.Second), <-ticker.C())
+
+	// The ticks that are not consumed are dropped
+	clock.Advance(time.Second * 3)
+	require.Equal(t, start.Add(time.Second*2), <-ticker.C())
+	select {
+	case <-ticker.C():
+		t.Fatal("the ticks should be dropped")
+	default:
+	}
+
+	ticker.Stop()
+	require.Equal(t, 0, clock.Pending())
+	clock.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("the ticker is stopped")
+	default:
+	}
+}
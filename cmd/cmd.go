@@ -5,6 +5,7 @@ import (
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/fatih/color"
 	"go.dedis.ch/cs438/peer"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
 	"log"
 	"os"
 	"time"
@@ -36,14 +37,14 @@ func preJoin(node peer.Peer) bool {
 				log.Fatalf("failed to add peer: %v", err)
 			}
 		case "🗿 join blockchain":
-			err = node.JoinBlockchain(100, time.Second*600)
+			err = node.JoinBlockchain(common.FaucetAllowance, time.Second*600)
 			if err != nil {
 				log.Fatalf("failed to join blockchain: %v", err)
 			}
 		case "🕓 join Chord, used for password cracker":
 			// Check we have a successor or not, if yes, others have joined our Chord, we
-			// can return true, for postJoin actions
-			if node.GetSuccessor() != "" {
+			// can return true, for postJoin actions. A node that left its ring must join again
+			if node.GetSuccessor() != "" && node.GetChordState() == peer.ChordMember {
 				return true
 			}
 			err = joinChord(node)
@@ -60,7 +61,7 @@ func preJoin(node peer.Peer) bool {
 }
 
 // postJoin is the actions allowed after a node joins the Chord ring, it should be able to
-// propose new password cracking tasks
+// propose new password cracking tasks, and leave the ring to join another one
 func postJoin(node peer.Peer) bool {
 	prompt := &survey.Select{
 		Message: "What do you want to do ?",
@@ -70,6 +71,7 @@ func postJoin(node peer.Peer) bool {
 			"🔐 receive password cracking result",
 			"📖 show world state",
 			"📜 print contract status",
+			"🚪 leave Chord, to join another ring",
 			"👋 exit"},
 	}
 	var action string
@@ -97,6 +99,13 @@ func postJoin(node peer.Peer) bool {
 			if err != nil {
 				log.Fatalf("failed to receive password cracking task: %v", err)
 			}
+		case "🚪 leave Chord, to join another ring":
+			err = node.LeaveChord()
+			if err != nil {
+				log.Fatalf("failed to leave Chord: %v", err)
+			}
+			// We have left the ring, go back to preJoin actions to join a ring again
+			return true
 		case "👋 exit":
 			color.HiYellow("=======  Bye 👋")
 			os.Exit(0)
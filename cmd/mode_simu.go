@@ -3,6 +3,7 @@ package cmd
 import (
 	"github.com/fatih/color"
 	"go.dedis.ch/cs438/peer"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
 	"log"
 	"time"
 )
@@ -35,7 +36,7 @@ func SimuUserInterface(nbNodes int) {
 	}
 
 	for _, node := range nodes {
-		err := node.JoinBlockchain(100, time.Second*600)
+		err := node.JoinBlockchain(common.FaucetAllowance, time.Second*600)
 		if err != nil {
 			log.Fatalf("failed to join blockchain: %v", err)
 		}
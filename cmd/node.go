@@ -10,6 +10,7 @@ import (
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/fatih/color"
+	"go.dedis.ch/cs438/clock/system"
 	"go.dedis.ch/cs438/peer"
 	"go.dedis.ch/cs438/peer/impl/blockchain/common"
 	"go.dedis.ch/cs438/registry/standard"
@@ -51,12 +52,30 @@ func nodeDefaultConf(trans transport.Transport) peer.Configuration {
 	config.ChordStabilizeInterval = time.Second * 5
 	config.ChordFixFingerInterval = time.Second * 5
 	config.ChordPingInterval = time.Second * 60
-
-	config.BlockchainAccountAddress = ""
-	config.BlockchainDifficulty = 2
+	config.ChordFingerCandidates = 3
+	config.ChordAuthentication = true
+	config.ChordKeyDifficulty = 16
+	config.Clock = system.NewClock()
+
+	config.DHT = peer.ChordDHT
+	config.KademliaBucketSize = 8
+	config.KademliaTimeout = time.Second * 5
+	config.KademliaRefreshInterval = time.Second * 5
+
+	config.DHashReplicas = 2
+
+	config.BlockchainPrivateKey = nil
+	config.BlockchainDifficulty = 16
+	config.BlockchainRetargetInterval = 16
+	config.BlockchainTargetBlockTime = time.Second * 10
 	config.BlockchainBlockSize = 2
 	config.BlockchainBlockTimeout = time.Second * 5
-	config.BlockchainInitialState = make(map[string]common.State)
+	config.BlockchainInitialState = common.FaucetAllocation(1000000)
+	config.BlockchainBlockReward = 5
+	config.BlockchainTransactionFee = 1
+	config.BlockchainMempoolSize = 1000
+	config.BlockchainInvalidTxTTL = time.Minute
+	config.BlockchainSyncInterval = time.Second * 2
 	config.PasswordHashAlgorithm = crypto.SHA256
 	return config
 }
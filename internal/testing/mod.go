@@ -3,6 +3,7 @@ package testing
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
 	"go.dedis.ch/cs438/peer/impl/blockchain/common"
 
 	"crypto/sha256"
@@ -20,6 +21,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/clock"
+	"go.dedis.ch/cs438/clock/system"
 	"go.dedis.ch/cs438/peer"
 	"go.dedis.ch/cs438/registry"
 	"go.dedis.ch/cs438/registry/standard"
@@ -158,13 +161,32 @@ type configTemplate struct {
 	ChordStabilizeInterval time.Duration
 	ChordFixFingerInterval time.Duration
 	ChordPingInterval      time.Duration
-
-	BlockchainAccountAddress string
-	BlockchainDifficulty     uint
-	BlockchainTXCheckTimeout time.Duration
-	BlockchainBlockSize      uint
-	BlockchainBlockTimeout   time.Duration
-	BlockchainInitialState   map[string]common.State
+	ChordVirtualNodes      int
+	ChordFingerCandidates  int
+	ChordAuthentication    bool
+	ChordKeyDifficulty     uint
+	Clock                  clock.Clock
+
+	DHT                     peer.DHTType
+	KademliaBucketSize      int
+	KademliaTimeout         time.Duration
+	KademliaRefreshInterval time.Duration
+
+	DHashReplicas uint
+
+	BlockchainPrivateKey       *ecdsa.PrivateKey
+	BlockchainDifficulty       uint
+	BlockchainRetargetInterval uint32
+	BlockchainTargetBlockTime  time.Duration
+	BlockchainTXCheckTimeout   time.Duration
+	BlockchainBlockSize        uint
+	BlockchainBlockTimeout     time.Duration
+	BlockchainInitialState     map[string]common.State
+	BlockchainBlockReward      int64
+	BlockchainTransactionFee   int64
+	BlockchainMempoolSize      uint
+	BlockchainInvalidTxTTL     time.Duration
+	BlockchainSyncInterval     time.Duration
 
 	PasswordHashAlgorithm crypto.Hash
 }
@@ -207,12 +229,31 @@ func newConfigTemplate() configTemplate {
 		ChordStabilizeInterval: time.Second * 5,
 		ChordFixFingerInterval: time.Second * 5,
 		ChordPingInterval:      time.Second * 60,
-
-		BlockchainAccountAddress: "",
-		BlockchainDifficulty:     3,
-		BlockchainBlockSize:      5,
-		BlockchainBlockTimeout:   time.Second * 600,
-		BlockchainInitialState:   nil,
+		ChordVirtualNodes:      1,
+		ChordFingerCandidates:  1,
+		ChordAuthentication:    false,
+		ChordKeyDifficulty:     16,
+		Clock:                  system.NewClock(),
+
+		DHT:                     peer.ChordDHT,
+		KademliaBucketSize:      8,
+		KademliaTimeout:         time.Second * 5,
+		KademliaRefreshInterval: time.Second * 5,
+
+		DHashReplicas: 2,
+
+		BlockchainPrivateKey:       nil,
+		BlockchainDifficulty:       24,
+		BlockchainRetargetInterval: 0,
+		BlockchainTargetBlockTime:  0,
+		BlockchainBlockSize:        5,
+		BlockchainBlockTimeout:     time.Second * 600,
+		BlockchainInitialState:     nil,
+		BlockchainBlockReward:      0,
+		BlockchainTransactionFee:   0,
+		BlockchainMempoolSize:      1000,
+		BlockchainInvalidTxTTL:     time.Minute,
+		BlockchainSyncInterval:     0,
 
 		PasswordHashAlgorithm: crypto.SHA256,
 	}
@@ -359,9 +400,80 @@ func WithChordPingInterval(d time.Duration) Option {
 	}
 }
 
-func WithBlockchainAccountAddress(addr string) Option {
+// WithChordVirtualNodes sets a specific number of virtual Chord nodes hosted by the peer
+func WithChordVirtualNodes(n int) Option {
+	return func(ct *configTemplate) {
+		ct.ChordVirtualNodes = n
+	}
+}
+
+// WithChordFingerCandidates sets a specific number of candidate nodes kept for each finger interval
+func WithChordFingerCandidates(n int) Option {
+	return func(ct *configTemplate) {
+		ct.ChordFingerCandidates = n
+	}
+}
+
+// WithChordAuthentication sets whether the Chord membership is authenticated
+func WithChordAuthentication(authentication bool) Option {
+	return func(ct *configTemplate) {
+		ct.ChordAuthentication = authentication
+	}
+}
+
+// WithChordKeyDifficulty sets the number of leading zero bits of the proof of work over a Chord key
+func WithChordKeyDifficulty(bits uint) Option {
+	return func(ct *configTemplate) {
+		ct.ChordKeyDifficulty = bits
+	}
+}
+
+// WithClock sets a specific clock for the Chord daemons and timeouts
+func WithClock(clock clock.Clock) Option {
+	return func(ct *configTemplate) {
+		ct.Clock = clock
+	}
+}
+
+// WithDHT sets the DHT used by the password cracker
+func WithDHT(dht peer.DHTType) Option {
+	return func(ct *configTemplate) {
+		ct.DHT = dht
+	}
+}
+
+// WithKademliaBucketSize sets a specific size of the Kademlia k-buckets
+func WithKademliaBucketSize(n int) Option {
+	return func(ct *configTemplate) {
+		ct.KademliaBucketSize = n
+	}
+}
+
+// WithKademliaTimeout sets a specific Kademlia timeout
+func WithKademliaTimeout(d time.Duration) Option {
+	return func(ct *configTemplate) {
+		ct.KademliaTimeout = d
+	}
+}
+
+// WithKademliaRefreshInterval sets a specific interval of the Kademlia refresh daemon
+func WithKademliaRefreshInterval(d time.Duration) Option {
+	return func(ct *configTemplate) {
+		ct.KademliaRefreshInterval = d
+	}
+}
+
+// WithDHashReplicas sets a specific number of replicas for the DHash entries
+func WithDHashReplicas(n uint) Option {
+	return func(ct *configTemplate) {
+		ct.DHashReplicas = n
+	}
+}
+
+// WithBlockchainPrivateKey sets the private key of the blockchain account, the account address is derived from it
+func WithBlockchainPrivateKey(key *ecdsa.PrivateKey) Option {
 	return func(ct *configTemplate) {
-		ct.BlockchainAccountAddress = addr
+		ct.BlockchainPrivateKey = key
 	}
 }
 
@@ -371,6 +483,15 @@ func WithBlockchainDifficulty(d uint) Option {
 	}
 }
 
+// WithBlockchainRetarget sets the number of blocks after which the difficulty is retargeted, and the time between
+// two blocks that the retargets aim at
+func WithBlockchainRetarget(interval uint32, blockTime time.Duration) Option {
+	return func(ct *configTemplate) {
+		ct.BlockchainRetargetInterval = interval
+		ct.BlockchainTargetBlockTime = blockTime
+	}
+}
+
 func WithBlockchainBlockSize(s uint) Option {
 	return func(ct *configTemplate) {
 		ct.BlockchainBlockSize = s
@@ -389,6 +510,42 @@ func WithBlockchainInitialState(s map[string]common.State) Option {
 	}
 }
 
+// WithBlockchainBlockReward sets the reward paid to the creator of each block
+func WithBlockchainBlockReward(reward int64) Option {
+	return func(ct *configTemplate) {
+		ct.BlockchainBlockReward = reward
+	}
+}
+
+// WithBlockchainTransactionFee sets the fee that the node attaches to its transactions
+func WithBlockchainTransactionFee(fee int64) Option {
+	return func(ct *configTemplate) {
+		ct.BlockchainTransactionFee = fee
+	}
+}
+
+// WithBlockchainMempoolSize sets the maximum number of pending transactions of the miner
+func WithBlockchainMempoolSize(size uint) Option {
+	return func(ct *configTemplate) {
+		ct.BlockchainMempoolSize = size
+	}
+}
+
+// WithBlockchainInvalidTxTTL sets how long the miner retries a transaction that fails to be executed, or holds a
+// transaction that waits for a missing nonce
+func WithBlockchainInvalidTxTTL(d time.Duration) Option {
+	return func(ct *configTemplate) {
+		ct.BlockchainInvalidTxTTL = d
+	}
+}
+
+// WithBlockchainSyncInterval sets the interval at which the node announces the tip of its chain
+func WithBlockchainSyncInterval(d time.Duration) Option {
+	return func(ct *configTemplate) {
+		ct.BlockchainSyncInterval = d
+	}
+}
+
 // WithPasswordHashAlgorithm sets a specific hash algorithm used for password cracker
 func WithPasswordHashAlgorithm(h crypto.Hash) Option {
 	return func(ct *configTemplate) {
@@ -428,11 +585,28 @@ func NewTestNode(t require.TestingT, f peer.Factory, trans transport.Transport,
 	config.ChordStabilizeInterval = template.ChordStabilizeInterval
 	config.ChordFixFingerInterval = template.ChordFixFingerInterval
 	config.ChordPingInterval = template.ChordPingInterval
-	config.BlockchainAccountAddress = template.BlockchainAccountAddress
+	config.ChordVirtualNodes = template.ChordVirtualNodes
+	config.ChordFingerCandidates = template.ChordFingerCandidates
+	config.ChordAuthentication = template.ChordAuthentication
+	config.ChordKeyDifficulty = template.ChordKeyDifficulty
+	config.Clock = template.Clock
+	config.DHT = template.DHT
+	config.KademliaBucketSize = template.KademliaBucketSize
+	config.KademliaTimeout = template.KademliaTimeout
+	config.KademliaRefreshInterval = template.KademliaRefreshInterval
+	config.DHashReplicas = template.DHashReplicas
+	config.BlockchainPrivateKey = template.BlockchainPrivateKey
 	config.BlockchainDifficulty = template.BlockchainDifficulty
+	config.BlockchainRetargetInterval = template.BlockchainRetargetInterval
+	config.BlockchainTargetBlockTime = template.BlockchainTargetBlockTime
 	config.BlockchainBlockSize = template.BlockchainBlockSize
 	config.BlockchainBlockTimeout = template.BlockchainBlockTimeout
 	config.BlockchainInitialState = template.BlockchainInitialState
+	config.BlockchainBlockReward = template.BlockchainBlockReward
+	config.BlockchainTransactionFee = template.BlockchainTransactionFee
+	config.BlockchainMempoolSize = template.BlockchainMempoolSize
+	config.BlockchainInvalidTxTTL = template.BlockchainInvalidTxTTL
+	config.BlockchainSyncInterval = template.BlockchainSyncInterval
 	config.PasswordHashAlgorithm = template.PasswordHashAlgorithm
 
 	node := f(config)
@@ -8,7 +8,8 @@ import (
 
 // IBlockchain is the interface that describes functions of a distributed password cracker
 type IBlockchain interface {
-	// JoinBlockchain informs the blockchain network of the new account
+	// JoinBlockchain informs the blockchain network of the new account, whose balance of common.FaucetAllowance
+	// is drawn from the faucet, or 0 if the account already exists
 	JoinBlockchain(balance int64, timeout time.Duration) error
 
 	// LeaveBlockchain informs the blockchain network of the exit of this account
@@ -38,4 +39,24 @@ type IBlockchain interface {
 
 	// GetChain returns the chain from its miner
 	GetChain() *block.Chain
+
+	// GetTransactionProof returns the proof that the transaction of the given hash is included in a block of the
+	// chain, which can be verified by a third party
+	GetTransactionProof(txHash string) (*block.TransactionProof, error)
+
+	// ProveContractExecution returns the proof that the peer's account has executed the contract whose address is
+	// contractAddr, e.g., to prove to a third party that the peer has cracked the password
+	ProveContractExecution(contractAddr string) (*block.TransactionProof, error)
+
+	// GetAccountProof returns the proof that the account of the given address has a given state, e.g., a given
+	// balance, after the block of the given ID on the chain, which can be verified by a third party
+	GetAccountProof(address string, blockID uint32) (*block.AccountProof, error)
+
+	// GetReceipt returns the receipt of the transaction of the given hash: whether it is included in a block, or why
+	// it failed or was dropped by the peer's miner, and the balance changes it caused
+	GetReceipt(txHash string) (*block.Receipt, error)
+
+	// SubscribeReceipts returns a channel on which the receipts of the transactions are delivered as they are
+	// included, fail or are dropped, and the function that ends the subscription
+	SubscribeReceipts() (<-chan *block.Receipt, func())
 }
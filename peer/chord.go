@@ -1,5 +1,15 @@
 package peer
 
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"go.dedis.ch/cs438/transport"
+	"go.dedis.ch/cs438/types"
+)
+
 // Chord defines the functions for the basic chord operations of a peer.
 type Chord interface {
 	// GetChordID gets the chordID of the current node
@@ -20,9 +30,99 @@ type Chord interface {
 	// JoinChord joins the peer to an existing Chord ring
 	JoinChord(string) error
 
-	// LeaveChord allows the peer to leave a joined Chord ring
+	// LeaveChord allows the peer to leave a joined Chord ring, the peer can join a ring again afterwards
 	LeaveChord() error
 
+	// QueryRange returns the Chord nodes owning the keys [start, end], together with the subrange each of
+	// them owns, in the order of the ring. The range is crossing the boundary of the ring if start > end
+	QueryRange(start uint, end uint) ([]types.ChordRange, error)
+
+	// RouteToKey sends the message to the Chord node owning the key, hop by hop along the finger tables. The
+	// peer hosting the owner processes the message, no routing entry is needed to reach it
+	RouteToKey(key uint, msg transport.Message) error
+
+	// GetChordState gets the membership state of the peer
+	GetChordState() ChordState
+
 	// RingLen returns the number of nodes inside the Chord ring
 	RingLen() uint
+
+	// GetVirtualNodes gets the addresses of all Chord nodes hosted by the peer, the first one is the
+	// primary node, which has the address of the peer
+	GetVirtualNodes() []string
+
+	// RingSnapshot walks the Chord ring from the current node and collects the state of every
+	// node inside the ring
+	RingSnapshot() (RingSnapshot, error)
+}
+
+// ChordState describes the membership of a peer in a Chord ring. A peer starts as the only member of its
+// own ring, and moves along idle -> joining -> member -> leaving -> idle afterwards.
+type ChordState string
+
+const (
+	// ChordIdle is the state of a peer that has left its ring, it does not answer Chord queries
+	ChordIdle ChordState = "idle"
+
+	// ChordJoining is the state of a peer that is joining a ring
+	ChordJoining ChordState = "joining"
+
+	// ChordMember is the state of a peer that is a member of a ring, possibly alone
+	ChordMember ChordState = "member"
+
+	// ChordLeaving is the state of a peer that is leaving its ring
+	ChordLeaving ChordState = "leaving"
+)
+
+// RingSnapshot describes the topology of a Chord ring. Nodes are listed in the order of the walk
+// along the successors, starting from the node that took the snapshot.
+type RingSnapshot struct {
+	// Nodes are the members of the ring
+	Nodes []types.ChordNodeInfo
+
+	// Inconsistencies describes the problems detected in the topology, e.g., broken
+	// predecessor/successor symmetry, gaps or overlaps between the ranges. It is empty if the
+	// ring is consistent
+	Inconsistencies []string
+}
+
+// Consistent returns whether no inconsistency has been detected in the ring
+func (r RingSnapshot) Consistent() bool {
+	return len(r.Inconsistencies) == 0
+}
+
+// JSON exports the ring snapshot as JSON
+func (r RingSnapshot) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "\t")
+}
+
+// DisplayGraph displays the ring snapshot as a graphviz graph. Plain edges point to the
+// successor, dashed edges to the predecessor.
+//
+//	dot -Tpdf -O *.dot
+func (r RingSnapshot) DisplayGraph(out io.Writer) {
+	fmt.Fprint(out, "digraph chord_ring {\n")
+
+	fmt.Fprintf(out, "labelloc=\"t\";")
+	fmt.Fprintf(out, "label = <Chord Ring <font point-size='10'><br/>"+
+		"(generated %s)</font>>;\n\n", time.Now().Format("2 Jan 06 - 15:04:05"))
+	fmt.Fprintf(out, "graph [fontname = \"helvetica\"];\n")
+	fmt.Fprintf(out, "node [fontname = \"helvetica\"];\n")
+	fmt.Fprintf(out, "edge [fontname = \"helvetica\"];\n\n")
+
+	for _, node := range r.Nodes {
+		fmt.Fprintf(out, "\"%s\" [label = \"%s\\nID %d\\n(%d, %d]\"];\n",
+			node.Address, node.Address, node.ChordID, node.RangeStart, node.RangeEnd)
+	}
+
+	for _, node := range r.Nodes {
+		if node.Successor != "" {
+			fmt.Fprintf(out, "\"%s\" -> \"%s\";\n", node.Address, node.Successor)
+		}
+		if node.Predecessor != "" {
+			fmt.Fprintf(out, "\"%s\" -> \"%s\" [style = dashed];\n", node.Address, node.Predecessor)
+		}
+	}
+
+	fmt.Fprint(out, "}\n")
 }
@@ -0,0 +1,11 @@
+package peer
+
+// DHash defines the functions of the distributed key-value store built on top of the Chord ring
+type DHash interface {
+	// Put stores the value under the given key, on the Chord node that owns the key. The entry is
+	// replicated on the successors of the owner
+	Put(key string, value []byte) error
+
+	// Get returns the value stored under the given key, or an error if the key is not found
+	Get(key string) ([]byte, error)
+}
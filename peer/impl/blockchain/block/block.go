@@ -4,11 +4,12 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"go.dedis.ch/cs438/peer/impl/blockchain/common"
 	"go.dedis.ch/cs438/peer/impl/blockchain/transaction"
+	"math/big"
 	"sort"
-	"strconv"
 	"strings"
 )
 
@@ -18,28 +19,41 @@ type Block struct {
 	ID        uint32
 	Creator   common.Address
 
+	// Difficulty is the number of hashes a miner is expected to try to find the proof of work of the block, the
+	// hash of the block must meet its Target
+	Difficulty uint64
+
 	PrevHash  string
 	TXHash    string
 	StateHash string
 	BlockHash string
 
-	TXs   []*transaction.SignedTransaction
-	State common.WorldState
+	TXs []*transaction.SignedTransaction
+
+	// State is the world state after the transactions of the block. It is not sent over the network, a node
+	// rebuilds it by replaying the transactions on the state of the previous block. A chain only keeps the world
+	// states of its last blocks, the world state of an older block is released and the block is pruned.
+	State  common.WorldState
+	pruned bool
+
+	// Receipts are the receipts of the transactions of the block, except the coinbase, in their order. They are not
+	// sent over the network either, they are obtained by the same replay as the world state.
+	Receipts []*Receipt
 }
 
 type TransBlock struct {
-	Timestamp uint64
-	Nonce     uint32
-	ID        uint32
-	Creator   common.Address
+	Timestamp  uint64
+	Nonce      uint32
+	ID         uint32
+	Creator    common.Address
+	Difficulty uint64
 
 	PrevHash  string
 	TXHash    string
 	StateHash string
 	BlockHash string
 
-	TXs        []*transaction.SignedTransaction
-	StateInMap map[string]common.State
+	TXs []*transaction.SignedTransaction
 }
 
 func NewGenesisBlock(initState map[string]common.State) *Block {
@@ -51,7 +65,6 @@ func NewGenesisBlock(initState map[string]common.State) *Block {
 
 	b.PrevHash = strings.Repeat("0", 256/4)
 	b.TXHash = strings.Repeat("0", 256/4)
-	b.StateHash = strings.Repeat("0", 256/4)
 
 	b.TXs = make([]*transaction.SignedTransaction, 0)
 
@@ -63,43 +76,128 @@ func NewGenesisBlock(initState map[string]common.State) *Block {
 		}
 	}
 
+	b.StateHash = b.State.HashCode()
 	b.BlockHash = b.HashCode()
 
 	return &b
 }
 
-// HashCode calculates and returns the hashcode string of this block using all its information
-// This function will also update the field Block.BlockHash
+// HashCode returns the hash of this block in hexadecimal form
 func (b *Block) HashCode() string {
 	return hex.EncodeToString(b.Hash())
 }
 
-// Hash calculates and returns the hash of this block using all its information
-// This function will also update the field Block.BlockHash
+// Hash returns the hash of the header of this block. The header commits to the transactions and the world state
+// through TXHash and StateHash, the roots of the Merkle tree of the transactions and of the state trie.
 func (b *Block) Hash() []byte {
-	h := sha256.New()
-
-	h.Write([]byte(strconv.Itoa(int(b.Timestamp))))
-	h.Write([]byte(strconv.Itoa(int(b.Nonce))))
-	h.Write([]byte(strconv.Itoa(int(b.ID))))
-	h.Write([]byte(b.Creator.String()))
+	hash := sha256.Sum256(b.EncodeHeader())
+	return hash[:]
+}
 
-	h.Write([]byte(b.PrevHash))
-	h.Write([]byte(b.TXHash))
-	h.Write([]byte(b.StateHash))
+// EncodeHeader returns the canonical encoding of the header of this block, i.e., all its fields but the
+// transactions, the world state and the block hash itself
+func (b *Block) EncodeHeader() []byte {
+	e := common.NewEncoder()
+	e.WriteUint(b.Timestamp)
+	e.WriteUint(uint64(b.Nonce))
+	e.WriteUint(uint64(b.ID))
+	e.WriteBytes(b.Creator.Bytes)
+	e.WriteUint(b.Difficulty)
+	e.WriteString(b.PrevHash)
+	e.WriteString(b.TXHash)
+	e.WriteString(b.StateHash)
+	return e.Bytes()
+}
 
+// Encode returns the canonical encoding of this block, which is sent over the network. The world state is not
+// encoded, only its root in the header.
+func (b *Block) Encode() []byte {
+	e := common.NewEncoder()
+	e.WriteBytes(b.EncodeHeader())
+	e.WriteString(b.BlockHash)
+	e.WriteUint(uint64(len(b.TXs)))
 	for _, tx := range b.TXs {
-		h.Write(tx.Hash())
+		e.WriteBytes(tx.Encode())
+	}
+	return e.Bytes()
+}
+
+// DecodeBlock decodes the canonical encoding of a block, with an empty world state
+func DecodeBlock(data []byte) (*Block, error) {
+	d := common.NewDecoder(data)
+	headerBytes := d.ReadBytes()
+	b := Block{BlockHash: d.ReadString(), State: common.NewWorldState()}
+
+	numTXs := d.ReadUint()
+	txsBytes := make([][]byte, 0)
+	for i := uint64(0); i < numTXs; i++ {
+		// nil is only returned on a decoding error
+		txBytes := d.ReadBytes()
+		if txBytes == nil {
+			break
+		}
+		txsBytes = append(txsBytes, txBytes)
+	}
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("invalid block encoding: %v", err)
 	}
 
-	h.Write(b.State.Hash())
+	header, err := decodeHeader(headerBytes)
+	if err != nil {
+		return nil, err
+	}
+	b.Timestamp = header.Timestamp
+	b.Nonce = header.Nonce
+	b.ID = header.ID
+	b.Creator = header.Creator
+	b.Difficulty = header.Difficulty
+	b.PrevHash = header.PrevHash
+	b.TXHash = header.TXHash
+	b.StateHash = header.StateHash
+
+	b.TXs = make([]*transaction.SignedTransaction, 0, len(txsBytes))
+	for _, txBytes := range txsBytes {
+		tx, err := transaction.DecodeSignedTransaction(txBytes)
+		if err != nil {
+			return nil, err
+		}
+		b.TXs = append(b.TXs, &tx)
+	}
 
-	hash := h.Sum(nil)
-	b.BlockHash = hex.EncodeToString(hash)
-	return hash
+	return &b, nil
 }
 
-func (b *Block) ProofOfWork(zeros uint, ctx *context.Context, notifyCh chan struct{}) error {
+// decodeHeader decodes the canonical encoding of a block header into a block without transactions nor world state
+func decodeHeader(data []byte) (*Block, error) {
+	d := common.NewDecoder(data)
+	b := Block{}
+	b.Timestamp = d.ReadUint()
+	b.Nonce = uint32(d.ReadUint())
+	b.ID = uint32(d.ReadUint())
+	b.Creator = common.NewAddress(d.ReadBytes())
+	b.Difficulty = d.ReadUint()
+	b.PrevHash = d.ReadString()
+	b.TXHash = d.ReadString()
+	b.StateHash = d.ReadString()
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("invalid block header encoding: %v", err)
+	}
+	return &b, nil
+}
+
+// ComputeTXHash returns the root of the Merkle tree of the given transactions of a block, in hexadecimal form
+func ComputeTXHash(txs []*transaction.SignedTransaction) string {
+	leaves := make([][]byte, len(txs))
+	for i, tx := range txs {
+		leaves[i] = tx.Hash()
+	}
+	return hex.EncodeToString(MerkleRoot(leaves))
+}
+
+// ProofOfWork searches the nonce for which the hash of this block meets its difficulty, and sets the block hash. It
+// stops early if the context is done or if the block of the same ID has been appended to the chain.
+func (b *Block) ProofOfWork(ctx *context.Context, notifyCh chan struct{}) error {
+	target := Target(b.Difficulty)
 	for {
 		select {
 		case <-(*ctx).Done():
@@ -110,14 +208,8 @@ func (b *Block) ProofOfWork(zeros uint, ctx *context.Context, notifyCh chan stru
 			{
 				b.Nonce++
 				hash := b.Hash()
-				var i uint
-				for i = 0; i < zeros; i++ {
-					if hash[i] != 0 {
-						break
-					}
-				}
-
-				if i == zeros {
+				if new(big.Int).SetBytes(hash).Cmp(target) <= 0 {
+					b.BlockHash = hex.EncodeToString(hash)
 					return nil
 				}
 				continue
@@ -128,26 +220,27 @@ func (b *Block) ProofOfWork(zeros uint, ctx *context.Context, notifyCh chan stru
 
 func (b *Block) GetTransBlock() *TransBlock {
 	return &TransBlock{
-		Timestamp: b.Timestamp,
-		Nonce:     b.Nonce,
-		ID:        b.ID,
-		Creator:   b.Creator,
+		Timestamp:  b.Timestamp,
+		Nonce:      b.Nonce,
+		ID:         b.ID,
+		Creator:    b.Creator,
+		Difficulty: b.Difficulty,
 
-		PrevHash:   b.PrevHash,
-		TXHash:     b.TXHash,
-		StateHash:  b.StateHash,
-		BlockHash:  b.BlockHash,
-		TXs:        b.TXs,
-		StateInMap: b.State.GetSimpleMap(),
+		PrevHash:  b.PrevHash,
+		TXHash:    b.TXHash,
+		StateHash: b.StateHash,
+		BlockHash: b.BlockHash,
+		TXs:       b.TXs,
 	}
 }
 
 func (b *TransBlock) GetBlock() *Block {
 	bb := Block{
-		Timestamp: b.Timestamp,
-		Nonce:     b.Nonce,
-		ID:        b.ID,
-		Creator:   b.Creator,
+		Timestamp:  b.Timestamp,
+		Nonce:      b.Nonce,
+		ID:         b.ID,
+		Creator:    b.Creator,
+		Difficulty: b.Difficulty,
 
 		PrevHash:  b.PrevHash,
 		TXHash:    b.TXHash,
@@ -157,19 +250,36 @@ func (b *TransBlock) GetBlock() *Block {
 		State:     common.NewWorldState(),
 	}
 
-	for k, v := range b.StateInMap {
-		bb.State.Set(k, v)
-	}
-
 	return &bb
 }
 
+// MarshalJSON implements json.Marshaler, a block is sent over the network in its canonical encoding
+func (b TransBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.GetBlock().Encode())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (b *TransBlock) UnmarshalJSON(data []byte) error {
+	var encoding []byte
+	err := json.Unmarshal(data, &encoding)
+	if err != nil {
+		return err
+	}
+	bb, err := DecodeBlock(encoding)
+	if err != nil {
+		return err
+	}
+	*b = *bb.GetTransBlock()
+	return nil
+}
+
 func (b *Block) PrintBlock() string {
 	s := strings.Repeat("=", 100) + "\n"
 	s += fmt.Sprintf("| Block #%d, Hash %s \n", b.ID, b.BlockHash[:8])
 	s += "|" + strings.Repeat("-", 99) + "\n"
 	s += fmt.Sprintf("| Timestamp: %d\n", b.Timestamp)
 	s += fmt.Sprintf("| Nonce: %d\n", b.Nonce)
+	s += fmt.Sprintf("| Difficulty: %d\n", b.Difficulty)
 	s += fmt.Sprintf("| Creator: %s\n", b.Creator.String())
 	s += fmt.Sprintf("| PrevHash: %s\n", b.PrevHash[:8])
 
@@ -178,6 +288,12 @@ func (b *Block) PrintBlock() string {
 		s += fmt.Sprintf("| \t%s\n", tx.String())
 	}
 
+	if b.pruned {
+		s += fmt.Sprintf("| World State: released, StateHash %s\n", b.StateHash[:8])
+		s += strings.Repeat("=", 100) + "\n"
+		return s
+	}
+
 	s += "| World State:\n"
 	stateKeys := b.State.Keys()
 	sort.Strings(stateKeys)
@@ -205,6 +321,7 @@ func (b *TransBlock) String() string {
 	s += strings.Repeat("-", 64) + "\n"
 	s += fmt.Sprintf("Timestamp: %d\n", b.Timestamp)
 	s += fmt.Sprintf("Nonce: %d\n", b.Nonce)
+	s += fmt.Sprintf("Difficulty: %d\n", b.Difficulty)
 	s += fmt.Sprintf("Creator: %s\n", b.Creator.String())
 	s += fmt.Sprintf("PrevHash: %s\n", b.PrevHash)
 
@@ -213,10 +330,7 @@ func (b *TransBlock) String() string {
 		s += fmt.Sprintf("\t%s", tx.String())
 	}
 
-	s += "World State:\n"
-	for key, value := range b.StateInMap {
-		s += fmt.Sprintf("\t%s : %s\n", key, value.String())
-	}
+	s += fmt.Sprintf("StateHash: %s\n", b.StateHash)
 
 	s += strings.Repeat("=", 64) + "\n"
 	return s
@@ -224,26 +338,120 @@ func (b *TransBlock) String() string {
 
 // ValidateBlock validates the correctness of this block
 // It replays all txs within this block on the given prevWorldState
-// and check the hashes
-func (b *Block) ValidateBlock(prevWorldState *common.WorldState) error {
+// and check the hashes, and that the coinbase pays the given block reward and the fees of the block
+func (b *Block) ValidateBlock(prevWorldState *common.WorldState, reward int64) error {
+	_, _, err := b.replay(prevWorldState, reward)
+	return err
+}
+
+// RebuildState validates this block like ValidateBlock, and sets its world state and its receipts to the ones
+// obtained by the replay
+func (b *Block) RebuildState(prevWorldState *common.WorldState, reward int64) error {
+	tmpWorldState, receipts, err := b.replay(prevWorldState, reward)
+	if err != nil {
+		return err
+	}
+
+	b.Receipts = receipts
+
+	b.State = common.NewWorldState()
+	for k, v := range tmpWorldState.GetSimpleMap() {
+		b.State.Set(k, v)
+	}
+	return nil
+}
+
+// GetCoinbase returns the coinbase transaction of this block, which is its last transaction, or nil if the block
+// has none
+func (b *Block) GetCoinbase() *transaction.SignedTransaction {
+	if len(b.TXs) == 0 || b.TXs[len(b.TXs)-1].TX.Type != transaction.CoinbaseTx {
+		return nil
+	}
+	return b.TXs[len(b.TXs)-1]
+}
+
+// verifyCoinbase checks that the coinbase of this block pays the block reward and the fees of the other
+// transactions to the creator of the block. A block without coinbase is only valid if there is nothing to pay.
+func (b *Block) verifyCoinbase(reward int64) error {
+	coinbase := b.GetCoinbase()
+	txs := b.TXs
+	if coinbase != nil {
+		txs = txs[:len(txs)-1]
+	}
+
+	value := reward
+	for _, tx := range txs {
+		if tx.TX.Type == transaction.CoinbaseTx {
+			return fmt.Errorf("coinbase transaction is not the last transaction of the block")
+		}
+		value += tx.TX.Fee
+	}
+
+	if coinbase == nil {
+		if value != 0 {
+			return fmt.Errorf("block has no coinbase transaction but pays %d", value)
+		}
+		return nil
+	}
+	if !coinbase.TX.Dst.Equals(b.Creator) {
+		return fmt.Errorf("coinbase transaction does not pay the creator of the block")
+	}
+	if coinbase.TX.Nonce != int(b.ID) {
+		return fmt.Errorf("coinbase transaction nonce %d does not match block ID %d", coinbase.TX.Nonce, b.ID)
+	}
+	if coinbase.TX.Value != value {
+		return fmt.Errorf("coinbase transaction pays %d, expected %d", coinbase.TX.Value, value)
+	}
+	return nil
+}
+
+// replay checks the hashes of this block, and returns the world state after its txs are replayed on the given
+// prevWorldState, the world state of the previous block, along with the receipts of the txs. The root of the
+// returned world state must be the StateHash of the block.
+func (b *Block) replay(prevWorldState *common.WorldState, reward int64) (*common.WorldState, []*Receipt, error) {
 
 	// Check hashes
 	givenHash := b.BlockHash
 	if givenHash != b.HashCode() {
-		return fmt.Errorf("block hash %s does not match expected hash %s", givenHash, b.HashCode())
+		return nil, nil, fmt.Errorf("block hash %s does not match expected hash %s", givenHash, b.HashCode())
+	}
+	if b.TXHash != ComputeTXHash(b.TXs) {
+		return nil, nil, fmt.Errorf("block TXHash does not match its transactions")
+	}
+
+	err := b.verifyCoinbase(reward)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Replay transactions
+	// Replay transactions, the coinbase is executed last
 	tmpWorldState := (*prevWorldState).Copy()
+	receipts := make([]*Receipt, 0, len(b.TXs))
 	for _, tx := range b.TXs {
-		err := transaction.VerifyAndExecuteTransaction(tx, tmpWorldState)
+		if tx.TX.Type == transaction.CoinbaseTx {
+			err = transaction.ExecuteCoinbaseTransaction(tx, tmpWorldState)
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		prevBalances := balances(tmpWorldState)
+		err = transaction.VerifyAndExecuteTransaction(tx, tmpWorldState)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
+		receipts = append(receipts, &Receipt{
+			TXHash:         tx.HashCode(),
+			Status:         ReceiptIncluded,
+			BlockID:        b.ID,
+			BlockHash:      b.BlockHash,
+			BalanceChanges: balanceChanges(prevBalances, tmpWorldState),
+		})
 	}
 
-	if !tmpWorldState.Equal(&b.State) {
-		return fmt.Errorf("prev state after txs replay does not match block's state")
+	if b.StateHash != tmpWorldState.HashCode() {
+		return nil, nil, fmt.Errorf("block StateHash does not match the state after txs replay")
 	}
-	return nil
+	return tmpWorldState, receipts, nil
 }
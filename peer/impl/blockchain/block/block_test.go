@@ -0,0 +1,253 @@
+package block
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+	"go.dedis.ch/cs438/peer/impl/blockchain/transaction"
+)
+
+// Test_Header_Golden tests the encoding and the hash of a block header against golden vectors, and that hashing
+// a block does not modify it
+func Test_Header_Golden(t *testing.T) {
+	b := Block{
+		Timestamp:  42,
+		Nonce:      7,
+		ID:         1,
+		Creator:    common.NewAddress([]byte{3}),
+		Difficulty: 5,
+		PrevHash:   "00",
+		TXHash:     "11",
+		StateHash:  "22",
+	}
+
+	golden := "03" + // version
+		"000000000000002a" + // timestamp
+		"0000000000000007" + // nonce
+		"0000000000000001" + // ID
+		"0000000000000001" + "03" + // creator
+		"0000000000000005" + // difficulty
+		"0000000000000002" + "3030" + // prev hash
+		"0000000000000002" + "3131" + // TX hash
+		"0000000000000002" + "3232" // state hash
+	require.Equal(t, golden, hex.EncodeToString(b.EncodeHeader()))
+	require.Equal(t, "0649966ed72dc55e376877a8e003637de77e3333c97681eade5861da068f16f7", b.HashCode())
+	require.Empty(t, b.BlockHash)
+}
+
+// newTestBlock creates a valid block on top of the genesis block of the given world state, with one transfer
+func newTestBlock(t *testing.T, genesis *Block) *Block {
+	rawTx := transaction.NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), 3, 1)
+	signedTx, err := rawTx.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+
+	b := Block{
+		Timestamp: 42,
+		ID:        genesis.ID + 1,
+		Creator:   common.QuickAddress(1),
+		PrevHash:  genesis.BlockHash,
+		TXs:       []*transaction.SignedTransaction{&signedTx},
+		State:     *genesis.State.Copy(),
+	}
+	require.NoError(t, transaction.VerifyAndExecuteTransaction(&signedTx, &b.State))
+	b.TXHash = ComputeTXHash(b.TXs)
+	b.StateHash = b.State.HashCode()
+	b.BlockHash = b.HashCode()
+	return &b
+}
+
+// Test_Block_Encode tests that a block sent over the network is decoded to the same valid block, whose world state
+// is rebuilt by replaying its transactions
+func Test_Block_Encode(t *testing.T) {
+	genesis := NewGenesisBlock(common.QuickWorldState(2, 10).GetSimpleMap())
+	b := newTestBlock(t, genesis)
+	require.NoError(t, b.ValidateBlock(&genesis.State, 0))
+
+	decoded, err := DecodeBlock(b.Encode())
+	require.NoError(t, err)
+	require.Equal(t, b.Encode(), decoded.Encode())
+	require.Equal(t, 0, decoded.State.Len())
+	require.NoError(t, decoded.ValidateBlock(&genesis.State, 0))
+	require.NoError(t, decoded.RebuildState(&genesis.State, 0))
+	require.True(t, b.State.Equal(&decoded.State))
+
+	// The state can not be rebuilt on another world state
+	decoded, err = DecodeBlock(b.Encode())
+	require.NoError(t, err)
+	require.Error(t, decoded.RebuildState(common.QuickWorldState(2, 20), 0))
+	require.Equal(t, 0, decoded.State.Len())
+
+	jsonBytes, err := json.Marshal(b.GetTransBlock())
+	require.NoError(t, err)
+	var transBlock TransBlock
+	require.NoError(t, json.Unmarshal(jsonBytes, &transBlock))
+	require.Equal(t, b.Encode(), transBlock.GetBlock().Encode())
+
+	_, err = DecodeBlock(b.Encode()[:len(b.Encode())-1])
+	require.Error(t, err)
+}
+
+// Test_Block_Commitments tests that the header commits to the transactions and the world state of the block
+func Test_Block_Commitments(t *testing.T) {
+	genesis := NewGenesisBlock(common.QuickWorldState(2, 10).GetSimpleMap())
+
+	// A transaction is removed
+	b := newTestBlock(t, genesis)
+	b.TXs = nil
+	require.Error(t, b.ValidateBlock(&genesis.State, 0))
+
+	// The transactions are removed, the replay does not match the state hash anymore
+	b = newTestBlock(t, genesis)
+	b.TXs = nil
+	b.TXHash = ComputeTXHash(b.TXs)
+	b.BlockHash = b.HashCode()
+	b.State = *genesis.State.Copy()
+	require.Error(t, b.ValidateBlock(&genesis.State, 0))
+
+	// The state hash is changed accordingly, the block is valid but has another hash
+	b.StateHash = b.State.HashCode()
+	require.Error(t, b.ValidateBlock(&genesis.State, 0))
+	b.BlockHash = b.HashCode()
+	require.NoError(t, b.ValidateBlock(&genesis.State, 0))
+	require.NotEqual(t, newTestBlock(t, genesis).BlockHash, b.BlockHash)
+}
+
+// Test_Block_Coinbase tests that the coinbase of a block pays exactly the block reward and the fees of its
+// transactions to its creator
+func Test_Block_Coinbase(t *testing.T) {
+	genesis := NewGenesisBlock(common.QuickWorldState(2, 10).GetSimpleMap())
+
+	rawTx := transaction.NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), 3, 1)
+	rawTx.Fee = 2
+	signedTx, err := rawTx.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+
+	newBlock := func(coinbases ...transaction.SignedTransaction) *Block {
+		b := Block{
+			Timestamp: 42,
+			ID:        genesis.ID + 1,
+			Creator:   common.QuickAddress(1),
+			PrevHash:  genesis.BlockHash,
+			TXs:       []*transaction.SignedTransaction{&signedTx},
+			State:     *genesis.State.Copy(),
+		}
+		require.NoError(t, transaction.VerifyAndExecuteTransaction(&signedTx, &b.State))
+		for i := range coinbases {
+			require.NoError(t, transaction.ExecuteCoinbaseTransaction(&coinbases[i], &b.State))
+			b.TXs = append(b.TXs, &coinbases[i])
+		}
+		b.TXHash = ComputeTXHash(b.TXs)
+		b.StateHash = b.State.HashCode()
+		b.BlockHash = b.HashCode()
+		return &b
+	}
+
+	b := newBlock(transaction.NewCoinbaseTX(common.QuickAddress(1), 7, 1))
+	require.NotNil(t, b.GetCoinbase())
+	require.NoError(t, b.RebuildState(&genesis.State, 5))
+	state1, _ := b.State.Get(common.QuickAddress(1).String())
+	require.EqualValues(t, 12, state1.Balance)
+
+	// The coinbase pays another reward
+	require.Error(t, b.ValidateBlock(&genesis.State, 0))
+	require.Error(t, b.ValidateBlock(&genesis.State, 6))
+
+	// The coinbase pays another account, or is bound to another block
+	b = newBlock(transaction.NewCoinbaseTX(common.QuickAddress(2), 7, 1))
+	require.Error(t, b.ValidateBlock(&genesis.State, 5))
+	b = newBlock(transaction.NewCoinbaseTX(common.QuickAddress(1), 7, 2))
+	require.Error(t, b.ValidateBlock(&genesis.State, 5))
+
+	// The block has two coinbases
+	coinbase := transaction.NewCoinbaseTX(common.QuickAddress(1), 7, 1)
+	b = newBlock(coinbase, coinbase)
+	require.Error(t, b.ValidateBlock(&genesis.State, 5))
+
+	// The block has no coinbase, the fees are not paid
+	b = newBlock()
+	require.Nil(t, b.GetCoinbase())
+	require.Error(t, b.ValidateBlock(&genesis.State, 0))
+}
+
+// Test_Block_Negative_Value tests that the replay of a block rejects a signed transfer of a negative value, even if
+// the block commits to the world state where the destination is drained by the sender
+func Test_Block_Negative_Value(t *testing.T) {
+	genesis := NewGenesisBlock(common.QuickWorldState(2, 10).GetSimpleMap())
+
+	rawTx := transaction.NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), -5, 1)
+	signedTx, err := rawTx.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+	coinbase := transaction.NewCoinbaseTX(common.QuickAddress(1), 0, 1)
+
+	b := Block{
+		Timestamp: 42,
+		ID:        genesis.ID + 1,
+		Creator:   common.QuickAddress(1),
+		PrevHash:  genesis.BlockHash,
+		TXs:       []*transaction.SignedTransaction{&signedTx, &coinbase},
+		State:     *genesis.State.Copy(),
+	}
+	require.Error(t, transaction.VerifyAndExecuteTransaction(&signedTx, &b.State))
+
+	// The forger commits to the state the transfer would have led to
+	state1, _ := b.State.Get(common.QuickAddress(1).String())
+	state2, _ := b.State.Get(common.QuickAddress(2).String())
+	state1.Balance, state1.Nonce = 15, 1
+	state2.Balance = 5
+	b.State.Set(common.QuickAddress(1).String(), state1)
+	b.State.Set(common.QuickAddress(2).String(), state2)
+	b.TXHash = ComputeTXHash(b.TXs)
+	b.StateHash = b.State.HashCode()
+	b.BlockHash = b.HashCode()
+
+	require.Error(t, b.ValidateBlock(&genesis.State, 0))
+	require.Error(t, b.RebuildState(&genesis.State, 0))
+}
+
+// Test_Block_Receipts tests that the replay of a block produces the receipts of its transactions, with the balance
+// changes caused by each of them, and that the coinbase has none
+func Test_Block_Receipts(t *testing.T) {
+	genesis := NewGenesisBlock(common.QuickWorldState(2, 10).GetSimpleMap())
+	addr1 := common.QuickAddress(1).String()
+	addr2 := common.QuickAddress(2).String()
+
+	rawTx1 := transaction.NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), 3, 1)
+	rawTx1.Fee = 2
+	signedTx1, err := rawTx1.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+	rawTx2 := transaction.NewTransferTX(common.QuickAddress(2), common.QuickAddress(1), 1, 1)
+	signedTx2, err := rawTx2.Sign(common.QuickKey(2))
+	require.NoError(t, err)
+	coinbase := transaction.NewCoinbaseTX(common.QuickAddress(1), 7, 1)
+
+	b := Block{
+		Timestamp: 42,
+		ID:        genesis.ID + 1,
+		Creator:   common.QuickAddress(1),
+		PrevHash:  genesis.BlockHash,
+		TXs:       []*transaction.SignedTransaction{&signedTx1, &signedTx2, &coinbase},
+		State:     *genesis.State.Copy(),
+	}
+	require.NoError(t, transaction.VerifyAndExecuteTransaction(&signedTx1, &b.State))
+	require.NoError(t, transaction.VerifyAndExecuteTransaction(&signedTx2, &b.State))
+	require.NoError(t, transaction.ExecuteCoinbaseTransaction(&coinbase, &b.State))
+	b.TXHash = ComputeTXHash(b.TXs)
+	b.StateHash = b.State.HashCode()
+	b.BlockHash = b.HashCode()
+
+	require.NoError(t, b.RebuildState(&genesis.State, 5))
+	require.Len(t, b.Receipts, 2)
+
+	require.Equal(t, signedTx1.HashCode(), b.Receipts[0].TXHash)
+	require.Equal(t, ReceiptIncluded, b.Receipts[0].Status)
+	require.Equal(t, b.ID, b.Receipts[0].BlockID)
+	require.Equal(t, b.BlockHash, b.Receipts[0].BlockHash)
+	require.NoError(t, b.Receipts[0].Err())
+	require.Equal(t, map[string]int64{addr1: -5, addr2: 3}, b.Receipts[0].BalanceChanges)
+
+	require.Equal(t, signedTx2.HashCode(), b.Receipts[1].TXHash)
+	require.Equal(t, map[string]int64{addr1: 1, addr2: -1}, b.Receipts[1].BalanceChanges)
+}
@@ -4,20 +4,41 @@ import (
 	"fmt"
 	"go.dedis.ch/cs438/peer/impl/blockchain/common"
 	"go.dedis.ch/cs438/peer/impl/blockchain/transaction"
+	"go.dedis.ch/cs438/storage"
 	"math/rand"
 	"strings"
 	"sync"
 	"time"
 )
 
+// Keys of the blocks of the chain in the blockchain store. They are prefixed not to collide with the blocks of the
+// TLC consensus, which share the store.
+const (
+	chainBlockKeyPrefix = "chain:block:"
+	chainTailKey        = "chain:tail"
+)
+
+// maxBlockTimeDrift is how far in the future of the local clock the timestamp of a block may be. The timestamps
+// drive the retargets of the difficulty, a miner can not lower the difficulty by dating its blocks far ahead.
+const maxBlockTimeDrift = time.Minute
+
+// stateCacheSize is the number of the last blocks of the chain whose world states are kept in memory, along with the
+// one of the genesis block. The world state of an older block is rebuilt on demand by replaying the chain.
+const stateCacheSize = 16
+
 type Chain struct {
 	mu              sync.Mutex
 	address         common.Address
 	GenesisPrevHash string // 0s
-	Difficulty      uint
+	Difficulty      DifficultyPolicy
+	Reward          int64 // reward paid to the creator of each block by its coinbase, on top of the fees
 	Blocks          map[string]*Block
 	Tail            *Block
 	HashToTxs       map[string]*transaction.SignedTransaction
+	HashToReceipts  map[string]*Receipt
+
+	// store persists the blocks appended to the chain, the chain is only in memory if it is nil
+	store storage.Store
 }
 
 func (c *Chain) HasTransactionHash(hash string) bool {
@@ -28,37 +49,150 @@ func (c *Chain) HasTransactionHash(hash string) bool {
 	return ok
 }
 
-func NewChain(addr common.Address, difficulty uint, initState map[string]common.State) *Chain {
+func NewChain(addr common.Address, difficulty DifficultyPolicy, reward int64,
+	initState map[string]common.State) *Chain {
 	c := Chain{
 		mu:              sync.Mutex{},
 		address:         addr,
 		GenesisPrevHash: strings.Repeat("0", 64),
 		Difficulty:      difficulty,
+		Reward:          reward,
 		Blocks:          make(map[string]*Block),
 		Tail:            NewGenesisBlock(initState),
 		HashToTxs:       make(map[string]*transaction.SignedTransaction),
+		HashToReceipts:  make(map[string]*Receipt),
 	}
 	c.Blocks[c.Tail.BlockHash] = c.Tail
 
 	return &c
 }
 
+// LoadChain creates a chain whose blocks are persisted in the given store. The blocks already in the store are
+// reloaded on top of the genesis block, their world states are rebuilt by replaying their transactions and the
+// whole chain is validated. If an error is returned, the chain holds the valid blocks that could be reloaded.
+func LoadChain(addr common.Address, difficulty DifficultyPolicy, reward int64, initState map[string]common.State,
+	store storage.Store) (*Chain, error) {
+	c := NewChain(addr, difficulty, reward, initState)
+	c.store = store
+
+	tailHash := store.Get(chainTailKey)
+	if tailHash == nil {
+		return c, nil
+	}
+
+	// Walk back from the stored tail to the genesis block
+	blocks := make([]*Block, 0)
+	genesis := c.Tail
+	for hash := string(tailHash); hash != genesis.BlockHash; {
+		data := store.Get(chainBlockKeyPrefix + hash)
+		if data == nil {
+			return c, fmt.Errorf("block %s is missing in the store", hash)
+		}
+		b, err := DecodeBlock(data)
+		if err != nil {
+			return c, err
+		}
+		if b.BlockHash != hash {
+			return c, fmt.Errorf("block stored at %s has hash %s", hash, b.BlockHash)
+		}
+		if b.ID == 0 || (len(blocks) > 0 && b.ID+1 != blocks[len(blocks)-1].ID) {
+			return c, fmt.Errorf("stored block %s does not lead to the genesis block", hash)
+		}
+		blocks = append(blocks, b)
+		hash = b.PrevHash
+	}
+
+	// Replay the blocks from the genesis block
+	for i := len(blocks) - 1; i >= 0; i-- {
+		err := c.CheckNewBlock(blocks[i])
+		if err != nil {
+			return c, err
+		}
+		c.mu.Lock()
+		c.appendBlock(blocks[i])
+		c.mu.Unlock()
+	}
+
+	return c, c.ValidateChain()
+}
+
 func (c *Chain) NextBlock() *Block {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	b := c.Tail
+
+	// The timestamp of a block must be after the one of the previous block
+	timestamp := uint64(time.Now().UnixMicro())
+	if timestamp <= b.Timestamp {
+		timestamp = b.Timestamp + 1
+	}
+
 	return &Block{
-		Timestamp: uint64(time.Now().UnixMicro()),
-		Nonce:     rand.Uint32(),
-		ID:        b.ID + 1,
-		Creator:   c.address,
-		PrevHash:  b.BlockHash,
-		TXs:       make([]*transaction.SignedTransaction, 0),
-		State:     common.NewWorldState(),
+		Timestamp:  timestamp,
+		Nonce:      rand.Uint32(),
+		ID:         b.ID + 1,
+		Creator:    c.address,
+		Difficulty: c.nextDifficulty(b),
+		PrevHash:   b.BlockHash,
+		TXs:        make([]*transaction.SignedTransaction, 0),
+		State:      common.NewWorldState(),
 	}
 }
 
+// NextDifficulty returns the difficulty of the block that follows the tail of the chain
+func (c *Chain) NextDifficulty() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.nextDifficulty(c.Tail)
+}
+
+// nextDifficulty returns the difficulty of the block that follows the given block of the chain. The difficulty is
+// retargeted after every Interval blocks, from the time between the first and the last of them, otherwise it is
+// the one of the given block.
+// It must be called under the protection of the mutex of the chain
+func (c *Chain) nextDifficulty(prev *Block) uint64 {
+	if prev.ID == 0 {
+		return c.Difficulty.Initial
+	}
+
+	interval := c.Difficulty.Interval
+	if interval < 2 || c.Difficulty.BlockTime <= 0 || prev.ID%interval != 0 {
+		return prev.Difficulty
+	}
+
+	first := prev
+	for i := uint32(1); i < interval; i++ {
+		first = c.Blocks[first.PrevHash]
+	}
+	span := time.Duration(prev.Timestamp-first.Timestamp) * time.Microsecond
+	expected := time.Duration(interval-1) * c.Difficulty.BlockTime
+	return Retarget(prev.Difficulty, span, expected)
+}
+
+// checkHeader checks that the block is dated after the given previous block and not too far in the future, and
+// that its proof of work meets the difficulty expected after the previous block.
+// It must be called under the protection of the mutex of the chain
+func (c *Chain) checkHeader(b *Block, prev *Block) error {
+	if b.Timestamp <= prev.Timestamp {
+		return fmt.Errorf("block timestamp %d is not after the one of the previous block %d", b.Timestamp,
+			prev.Timestamp)
+	}
+	if time.UnixMicro(int64(b.Timestamp)).After(time.Now().Add(maxBlockTimeDrift)) {
+		return fmt.Errorf("block timestamp %d is too far in the future", b.Timestamp)
+	}
+
+	expected := c.nextDifficulty(prev)
+	if b.Difficulty != expected {
+		return fmt.Errorf("block difficulty %d does not match expected difficulty %d", b.Difficulty, expected)
+	}
+	if !meetsDifficulty(b.Hash(), b.Difficulty) {
+		return fmt.Errorf("block hash %s does not meet difficulty %d", b.BlockHash, b.Difficulty)
+	}
+	return nil
+}
+
 func (c *Chain) CheckNewBlock(b *Block) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -71,7 +205,13 @@ func (c *Chain) CheckNewBlock(b *Block) error {
 		return fmt.Errorf("block's PrevHash mismatch")
 	}
 
-	err := b.ValidateBlock(&c.Tail.State)
+	err := c.checkHeader(b, c.Tail)
+	if err != nil {
+		return err
+	}
+
+	// The world state of a block received from the network is rebuilt from the one of the tail
+	err = b.RebuildState(&c.Tail.State, c.Reward)
 	if err != nil {
 		return err
 	}
@@ -87,14 +227,51 @@ func (c *Chain) AppendBlock(b *Block) error {
 		return fmt.Errorf("block to be appended has a wrong ID")
 	}
 
+	c.appendBlock(b)
+
+	if c.store != nil {
+		c.store.Set(chainBlockKeyPrefix+b.BlockHash, b.Encode())
+		c.store.Set(chainTailKey, []byte(b.BlockHash))
+	}
+
+	return nil
+}
+
+// appendBlock appends the block to the chain in memory.
+// It must be called under the protection of the mutex of the chain
+func (c *Chain) appendBlock(b *Block) {
 	c.Tail = b
 	c.Blocks[b.BlockHash] = b
 
+	// Release the world state of the block that leaves the cache
+	old := b
+	for i := 0; i < stateCacheSize && old != nil; i++ {
+		old = c.Blocks[old.PrevHash]
+	}
+	if old != nil && old.ID > 0 && !old.pruned {
+		old.State = common.NewWorldState()
+		old.pruned = true
+	}
+
+	// The coinbase is not a transaction sent by an account, it is not counted
 	for _, tx := range b.TXs {
+		if tx.TX.Type == transaction.CoinbaseTx {
+			continue
+		}
 		c.HashToTxs[tx.HashCode()] = tx
 	}
+	for _, receipt := range b.Receipts {
+		c.HashToReceipts[receipt.TXHash] = receipt
+	}
+}
 
-	return nil
+// GetReceipt returns the receipt of the transaction of the given hash, if it is included in a block of the chain
+func (c *Chain) GetReceipt(txHash string) (*Receipt, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	receipt, ok := c.HashToReceipts[txHash]
+	return receipt, ok
 }
 
 func (c *Chain) GetBlockCount() int {
@@ -118,6 +295,97 @@ func (c *Chain) GetLastBlock() *Block {
 	return c.Tail
 }
 
+// GetBlockRange returns the blocks of IDs from to to, both included, that are on the chain, in the order of their IDs
+func (c *Chain) GetBlockRange(from uint32, to uint32) []*Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	blocks := make([]*Block, 0)
+	for b := c.Tail; b != nil && b.ID >= from; b = c.Blocks[b.PrevHash] {
+		if b.ID <= to {
+			blocks = append(blocks, b)
+		}
+	}
+
+	// Reverse the blocks, collected from the tail
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	return blocks
+}
+
+// FindTransaction returns the hash of the latest transaction on the chain that matches the given filter
+func (c *Chain) FindTransaction(match func(tx *transaction.SignedTransaction) bool) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for b := c.Tail; b != nil; b = c.Blocks[b.PrevHash] {
+		for i := len(b.TXs) - 1; i >= 0; i-- {
+			if match(b.TXs[i]) {
+				return b.TXs[i].HashCode(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// GetTransactionProof returns the proof that the transaction of the given hash is included in a block of the chain
+func (c *Chain) GetTransactionProof(txHash string) (*TransactionProof, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.HashToTxs[txHash]; !ok {
+		return nil, fmt.Errorf("transaction %s is not on the chain", txHash)
+	}
+
+	for b := c.Tail; b != nil; b = c.Blocks[b.PrevHash] {
+		for i, tx := range b.TXs {
+			if tx.HashCode() == txHash {
+				return NewTransactionProof(b, i)
+			}
+		}
+	}
+	return nil, fmt.Errorf("transaction %s is not found in the blocks of the chain", txHash)
+}
+
+// GetAccountProof returns the proof of the state of the account of the given address in the world state of the
+// block of the given ID on the chain
+func (c *Chain) GetAccountProof(address string, blockID uint32) (*AccountProof, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for b := c.Tail; b != nil; b = c.Blocks[b.PrevHash] {
+		if b.ID == blockID {
+			worldState, err := c.worldState(b)
+			if err != nil {
+				return nil, err
+			}
+			return newAccountProof(b, worldState, address), nil
+		}
+	}
+	return nil, fmt.Errorf("block %d is not on the chain", blockID)
+}
+
+// worldState returns the world state of the given block of the chain. If it has been released, it is rebuilt by
+// replaying the blocks from the last one whose world state is kept.
+// It must be called under the protection of the mutex of the chain
+func (c *Chain) worldState(b *Block) (*common.WorldState, error) {
+	pruned := make([]*Block, 0)
+	for ; b.pruned; b = c.Blocks[b.PrevHash] {
+		pruned = append(pruned, b)
+	}
+
+	worldState := &b.State
+	for i := len(pruned) - 1; i >= 0; i-- {
+		next, _, err := pruned[i].replay(worldState, c.Reward)
+		if err != nil {
+			return nil, err
+		}
+		worldState = next
+	}
+	return worldState, nil
+}
+
 func (c *Chain) PrintChain() string {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -148,34 +416,38 @@ func (c *Chain) PrintChain() string {
 
 // ValidateChain does a full validation on the entire blockchain, which includes
 // 1. hashes check of each block,
-// 2. txs replay of each block,
-// 3. number of blocks on the chain
+// 2. timestamp, difficulty and proof of work check of each block,
+// 3. txs replay of each block, from the world state of the genesis block,
+// 4. number of blocks on the chain
 func (c *Chain) ValidateChain() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	currBlockHash := c.Tail.BlockHash
+	// Walk back from the tail to the genesis block
+	blocks := make([]*Block, 0)
+	for currBlockHash := c.Tail.BlockHash; currBlockHash != c.GenesisPrevHash; {
+		b, ok := c.Blocks[currBlockHash]
+		if !ok {
+			return fmt.Errorf("PrevHash doesn't exist%s", currBlockHash)
+		}
+		blocks = append(blocks, b)
+		currBlockHash = b.PrevHash
+	}
 
 	blockCnt := len(c.Blocks)
-	validated := 0
-
-	for currBlockHash != c.GenesisPrevHash {
-		b := c.Blocks[currBlockHash]
-
-		// Not the first block, do the full validation
-		if b.PrevHash != c.GenesisPrevHash {
-			prevBlock, ok := c.Blocks[b.PrevHash]
-			if !ok {
-				return fmt.Errorf("PrevHash doesn't exist%s", b.PrevHash)
-			}
-			err := b.ValidateBlock(&prevBlock.State)
-			if err != nil {
-				return err
-			}
+	validated := len(blocks)
+
+	// Replay the blocks from the genesis block, the first block is not validated
+	worldState := &blocks[validated-1].State
+	for i := validated - 2; i >= 0; i-- {
+		err := c.checkHeader(blocks[i], blocks[i+1])
+		if err != nil {
+			return err
+		}
+		worldState, _, err = blocks[i].replay(worldState, c.Reward)
+		if err != nil {
+			return err
 		}
-
-		validated++
-		currBlockHash = b.PrevHash
 	}
 
 	if validated != blockCnt {
@@ -0,0 +1,169 @@
+package block
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+	"go.dedis.ch/cs438/peer/impl/blockchain/transaction"
+	"go.dedis.ch/cs438/storage/inmemory"
+)
+
+// appendTestBlock appends a block with one transfer of the given nonce to the chain, and returns the transfer
+func appendTestBlock(t *testing.T, c *Chain, nonce int) *transaction.SignedTransaction {
+	rawTx := transaction.NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), 1, nonce)
+	signedTx, err := rawTx.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+
+	b := c.NextBlock()
+	b.TXs = append(b.TXs, &signedTx)
+	b.State = *c.GetLastBlock().State.Copy()
+	require.NoError(t, transaction.VerifyAndExecuteTransaction(&signedTx, &b.State))
+	b.TXHash = ComputeTXHash(b.TXs)
+	b.StateHash = b.State.HashCode()
+	b.BlockHash = b.HashCode()
+
+	require.NoError(t, c.CheckNewBlock(b))
+	require.NoError(t, c.AppendBlock(b))
+	return &signedTx
+}
+
+// Test_Chain_Reload tests that a chain is reloaded from its store, with the world states rebuilt
+func Test_Chain_Reload(t *testing.T) {
+	initState := common.QuickWorldState(2, 10).GetSimpleMap()
+	store := inmemory.NewPersistency().GetBlockchainStore()
+
+	c, err := LoadChain(common.QuickAddress(1), DifficultyPolicy{}, 0, initState, store)
+	require.NoError(t, err)
+	require.Equal(t, 1, c.GetBlockCount())
+	for nonce := 1; nonce <= 3; nonce++ {
+		appendTestBlock(t, c, nonce)
+	}
+
+	reloaded, err := LoadChain(common.QuickAddress(2), DifficultyPolicy{}, 0, initState, store)
+	require.NoError(t, err)
+	require.Equal(t, 4, reloaded.GetBlockCount())
+	require.Equal(t, 3, reloaded.GetTransactionCount())
+	require.Len(t, reloaded.HashToReceipts, 3)
+	require.Equal(t, c.GetLastBlock().BlockHash, reloaded.GetLastBlock().BlockHash)
+	require.True(t, c.GetLastBlock().State.Equal(&reloaded.GetLastBlock().State))
+
+	// The reloaded chain goes on being persisted
+	appendTestBlock(t, reloaded, 4)
+	reloaded, err = LoadChain(common.QuickAddress(2), DifficultyPolicy{}, 0, initState, store)
+	require.NoError(t, err)
+	require.Equal(t, 5, reloaded.GetBlockCount())
+
+	// The chain of another genesis block is not reloaded
+	reloaded, err = LoadChain(common.QuickAddress(2), DifficultyPolicy{}, 0, common.QuickWorldState(2, 20).GetSimpleMap(), store)
+	require.Error(t, err)
+	require.Equal(t, 1, reloaded.GetBlockCount())
+}
+
+// Test_Chain_Reload_Tampered tests that a tampered stored block is rejected, and that the blocks before it are
+// reloaded
+func Test_Chain_Reload_Tampered(t *testing.T) {
+	initState := common.QuickWorldState(2, 10).GetSimpleMap()
+	store := inmemory.NewPersistency().GetBlockchainStore()
+
+	c, err := LoadChain(common.QuickAddress(1), DifficultyPolicy{}, 0, initState, store)
+	require.NoError(t, err)
+	for nonce := 1; nonce <= 3; nonce++ {
+		appendTestBlock(t, c, nonce)
+	}
+
+	// The transaction of the last block is replaced by another valid one, the block hash is kept
+	tail := c.GetLastBlock()
+	rawTx := transaction.NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), 5, 3)
+	signedTx, err := rawTx.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+	tampered := *tail.GetTransBlock().GetBlock()
+	tampered.TXs = []*transaction.SignedTransaction{&signedTx}
+	store.Set(chainBlockKeyPrefix+tail.BlockHash, tampered.Encode())
+
+	reloaded, err := LoadChain(common.QuickAddress(1), DifficultyPolicy{}, 0, initState, store)
+	require.Error(t, err)
+	require.Equal(t, 3, reloaded.GetBlockCount())
+	require.Equal(t, tail.PrevHash, reloaded.GetLastBlock().BlockHash)
+
+	// A missing block
+	store.Delete(chainBlockKeyPrefix + tail.PrevHash)
+	_, err = LoadChain(common.QuickAddress(1), DifficultyPolicy{}, 0, initState, store)
+	require.Error(t, err)
+}
+
+// Test_Chain_Block_Range tests that the blocks of a range are returned in the order of their IDs
+func Test_Chain_Block_Range(t *testing.T) {
+	c := NewChain(common.QuickAddress(1), DifficultyPolicy{}, 0, common.QuickWorldState(2, 10).GetSimpleMap())
+	for nonce := 1; nonce <= 3; nonce++ {
+		appendTestBlock(t, c, nonce)
+	}
+
+	ids := func(blocks []*Block) []uint32 {
+		res := make([]uint32, len(blocks))
+		for i, b := range blocks {
+			res[i] = b.ID
+		}
+		return res
+	}
+	require.Equal(t, []uint32{0, 1, 2, 3}, ids(c.GetBlockRange(0, 3)))
+	require.Equal(t, []uint32{2, 3}, ids(c.GetBlockRange(2, 10)))
+	require.Equal(t, []uint32{1}, ids(c.GetBlockRange(1, 1)))
+	require.Empty(t, c.GetBlockRange(4, 10))
+	require.Empty(t, c.GetBlockRange(3, 2))
+}
+
+// Test_Chain_Receipts tests that the receipts of the transactions of the appended blocks are found by hash
+func Test_Chain_Receipts(t *testing.T) {
+	c := NewChain(common.QuickAddress(1), DifficultyPolicy{}, 0, common.QuickWorldState(2, 10).GetSimpleMap())
+	tx1 := appendTestBlock(t, c, 1)
+	tx2 := appendTestBlock(t, c, 2)
+
+	receipt, ok := c.GetReceipt(tx2.HashCode())
+	require.True(t, ok)
+	require.Equal(t, ReceiptIncluded, receipt.Status)
+	require.Equal(t, uint32(2), receipt.BlockID)
+	require.Equal(t, c.GetLastBlock().BlockHash, receipt.BlockHash)
+	require.Equal(t, map[string]int64{common.QuickAddress(1).String(): -1, common.QuickAddress(2).String(): 1},
+		receipt.BalanceChanges)
+
+	receipt, ok = c.GetReceipt(tx1.HashCode())
+	require.True(t, ok)
+	require.Equal(t, uint32(1), receipt.BlockID)
+
+	_, ok = c.GetReceipt("unknown")
+	require.False(t, ok)
+}
+
+// Test_Chain_State_Cache tests that the chain only keeps the world states of its last blocks, and that the world
+// state of an older block is rebuilt to prove the state of an account
+func Test_Chain_State_Cache(t *testing.T) {
+	c := NewChain(common.QuickAddress(1), DifficultyPolicy{}, 0, common.QuickWorldState(2, 100).GetSimpleMap())
+	n := stateCacheSize + 4
+	for nonce := 1; nonce <= n; nonce++ {
+		appendTestBlock(t, c, nonce)
+	}
+
+	for _, b := range c.GetBlockRange(0, uint32(n)) {
+		pruned := b.ID > 0 && b.ID <= uint32(n-stateCacheSize)
+		require.Equal(t, pruned, b.pruned)
+		if pruned {
+			require.Equal(t, 0, b.State.Len())
+			_, err := NewAccountProof(b, common.QuickAddress(2).String())
+			require.Error(t, err)
+		} else {
+			require.Equal(t, b.StateHash, b.State.HashCode())
+		}
+	}
+	require.NoError(t, c.ValidateChain())
+
+	for _, blockID := range []uint32{0, 2, uint32(n)} {
+		proof, err := c.GetAccountProof(common.QuickAddress(2).String(), blockID)
+		require.NoError(t, err)
+		require.EqualValues(t, 100+int64(blockID), proof.Proof.State.Balance)
+		require.NoError(t, proof.Verify(0))
+	}
+
+	_, err := c.GetAccountProof(common.QuickAddress(2).String(), uint32(n+1))
+	require.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package block
+
+import (
+	"math"
+	"math/big"
+	"time"
+)
+
+// maxRetargetFactor is the maximum factor by which a retarget raises or lowers the difficulty, so that a window of
+// unusual block times does not swing the difficulty
+const maxRetargetFactor = 4
+
+// maxTarget is the largest hash, every hash meets it
+var maxTarget = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// DifficultyPolicy defines the difficulty of the proof of work of the blocks of a chain. The difficulty of a block is
+// the number of hashes a miner is expected to try to find its proof of work.
+type DifficultyPolicy struct {
+	// Initial is the difficulty of the blocks until the first retarget
+	Initial uint64
+
+	// Interval is the number of blocks after which the difficulty is retargeted, from the time it took to mine
+	// them. The difficulty is never retargeted if it is lower than 2.
+	Interval uint32
+
+	// BlockTime is the time between two blocks that the retargets aim at, the difficulty is never retargeted if it
+	// is not positive
+	BlockTime time.Duration
+}
+
+// DifficultyOfBits returns the difficulty of the target of the given number of leading zero bits, i.e., 2^bits,
+// capped at the maximum difficulty
+func DifficultyOfBits(bits uint) uint64 {
+	if bits >= 64 {
+		return math.MaxUint64
+	}
+	return 1 << bits
+}
+
+// Target returns the target of the given difficulty: a hash meets the difficulty if, read as a big-endian integer,
+// it is not above the target. The target of difficulty d is (2^256-1)/d, difficulties 0 and 1 are met by every hash.
+func Target(difficulty uint64) *big.Int {
+	if difficulty <= 1 {
+		return new(big.Int).Set(maxTarget)
+	}
+	return new(big.Int).Div(maxTarget, new(big.Int).SetUint64(difficulty))
+}
+
+// meetsDifficulty returns true if the hash meets the target of the given difficulty
+func meetsDifficulty(hash []byte, difficulty uint64) bool {
+	return new(big.Int).SetBytes(hash).Cmp(Target(difficulty)) <= 0
+}
+
+// Retarget returns the difficulty that follows a window of blocks of the given difficulty, mined in span while
+// expected was aimed at. The difficulty is scaled by expected/span, by a factor of at most maxRetargetFactor, and
+// is at least 1.
+func Retarget(difficulty uint64, span time.Duration, expected time.Duration) uint64 {
+	if span < 1 {
+		span = 1
+	}
+
+	next := new(big.Int).SetUint64(difficulty)
+	next.Mul(next, big.NewInt(int64(expected)))
+	next.Div(next, big.NewInt(int64(span)))
+
+	lowest := new(big.Int).SetUint64(difficulty / maxRetargetFactor)
+	highest := new(big.Int).Mul(new(big.Int).SetUint64(difficulty), big.NewInt(maxRetargetFactor))
+	if next.Cmp(lowest) < 0 {
+		next = lowest
+	}
+	if next.Cmp(highest) > 0 {
+		next = highest
+	}
+
+	if next.Sign() <= 0 {
+		return 1
+	}
+	if !next.IsUint64() {
+		return math.MaxUint64
+	}
+	return next.Uint64()
+}
@@ -0,0 +1,149 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+)
+
+// Test_Difficulty_Target tests that the target of a difficulty of bits is met by the hashes with as many leading
+// zero bits
+func Test_Difficulty_Target(t *testing.T) {
+	hash := func(prefix ...byte) []byte {
+		return append(prefix, bytes.Repeat([]byte{0xff}, 32-len(prefix))...)
+	}
+
+	require.True(t, meetsDifficulty(hash(), 0))
+	require.True(t, meetsDifficulty(hash(), 1))
+	require.False(t, meetsDifficulty(hash(), 2))
+
+	require.True(t, meetsDifficulty(hash(0x00), DifficultyOfBits(8)))
+	require.False(t, meetsDifficulty(hash(0x01), DifficultyOfBits(8)))
+	require.True(t, meetsDifficulty(hash(0x00, 0x0f), DifficultyOfBits(12)))
+	require.False(t, meetsDifficulty(hash(0x00, 0x1f), DifficultyOfBits(12)))
+
+	// A difficulty between two powers of two is met by less hashes than the lower one
+	require.True(t, meetsDifficulty(hash(0x7f), DifficultyOfBits(1)))
+	require.False(t, meetsDifficulty(hash(0x7f), 3))
+	require.True(t, meetsDifficulty(hash(0x55, 0x00), 3))
+
+	require.Equal(t, uint64(math.MaxUint64), DifficultyOfBits(64))
+}
+
+// Test_Difficulty_Retarget tests that a retarget scales the difficulty by the ratio of the expected time to the
+// actual one, within its bounds
+func Test_Difficulty_Retarget(t *testing.T) {
+	require.Equal(t, uint64(2000), Retarget(1000, time.Second*5, time.Second*10))
+	require.Equal(t, uint64(500), Retarget(1000, time.Second*20, time.Second*10))
+	require.Equal(t, uint64(1000), Retarget(1000, time.Second*10, time.Second*10))
+
+	// The factor is bounded
+	require.Equal(t, uint64(4000), Retarget(1000, 0, time.Second*10))
+	require.Equal(t, uint64(250), Retarget(1000, time.Hour, time.Second*10))
+
+	// The difficulty stays positive and does not overflow
+	require.Equal(t, uint64(1), Retarget(1, time.Hour, time.Second))
+	require.Equal(t, uint64(1), Retarget(0, time.Second, time.Second))
+	require.Equal(t, uint64(math.MaxUint64), Retarget(math.MaxUint64/2, time.Second, time.Second*10))
+}
+
+// Test_Chain_Retarget_Hash_Rate tests that the difficulty of a chain converges to the one that makes a simulated
+// hash rate mine a block every BlockTime, and follows a change of the hash rate
+func Test_Chain_Retarget_Hash_Rate(t *testing.T) {
+	// The window is long enough for the time it took to mine it not to vary too much between windows
+	policy := DifficultyPolicy{Initial: 1, Interval: 16, BlockTime: time.Second * 10}
+	c := NewChain(common.QuickAddress(1), policy, 0, common.QuickWorldState(2, 10).GetSimpleMap())
+	ctx := context.Background()
+
+	// The simulated clock advances by the time the hash rate takes to try the hashes of each proof of work, the
+	// next block is dated when the previous one is found
+	clock := uint64(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixMicro())
+	mine := func(hashRate uint64, blocks int) (avgDifficulty uint64, avgBlockTime time.Duration) {
+		var difficulties, elapsed uint64
+		for i := 0; i < blocks; i++ {
+			prev := c.GetLastBlock()
+			b := c.NextBlock()
+			b.Timestamp = clock
+			b.Nonce = 0
+			b.State = *prev.State.Copy()
+			b.TXHash = ComputeTXHash(b.TXs)
+			b.StateHash = b.State.HashCode()
+			require.NoError(t, b.ProofOfWork(&ctx, make(chan struct{})))
+			require.NoError(t, c.CheckNewBlock(b))
+			require.NoError(t, c.AppendBlock(b))
+
+			micros := uint64(b.Nonce) * uint64(time.Second/time.Microsecond) / hashRate
+			clock += micros
+			difficulties += b.Difficulty
+			elapsed += micros
+		}
+		return difficulties / uint64(blocks), time.Duration(elapsed/uint64(blocks)) * time.Microsecond
+	}
+
+	// The difficulty rises from 1 to about 50 hashes/s * 10s
+	mine(50, 96)
+	difficulty, blockTime := mine(50, 160)
+	require.InDelta(t, 500, float64(difficulty), 150)
+	require.InDelta(t, float64(policy.BlockTime), float64(blockTime), float64(policy.BlockTime)*0.3)
+
+	// The hash rate is multiplied by 4, the blocks are mined faster until the difficulty catches up
+	mine(200, 96)
+	difficulty, blockTime = mine(200, 160)
+	require.InDelta(t, 2000, float64(difficulty), 600)
+	require.InDelta(t, float64(policy.BlockTime), float64(blockTime), float64(policy.BlockTime)*0.3)
+
+	require.NoError(t, c.ValidateChain())
+}
+
+// Test_Chain_Check_Header tests that a block is rejected if it is not dated after the previous block, or if it
+// does not meet the expected difficulty
+func Test_Chain_Check_Header(t *testing.T) {
+	policy := DifficultyPolicy{Initial: DifficultyOfBits(8), Interval: 2, BlockTime: time.Second}
+	c := NewChain(common.QuickAddress(1), policy, 0, common.QuickWorldState(2, 10).GetSimpleMap())
+	ctx := context.Background()
+
+	mine := func(change func(b *Block)) *Block {
+		prev := c.GetLastBlock()
+		b := c.NextBlock()
+		b.State = *prev.State.Copy()
+		b.TXHash = ComputeTXHash(b.TXs)
+		b.StateHash = b.State.HashCode()
+		change(b)
+		require.NoError(t, b.ProofOfWork(&ctx, make(chan struct{})))
+		return b
+	}
+
+	b := mine(func(b *Block) {})
+	require.Equal(t, DifficultyOfBits(8), b.Difficulty)
+	require.NoError(t, c.CheckNewBlock(b))
+	require.NoError(t, c.AppendBlock(b))
+
+	// The difficulty is not the expected one
+	require.Error(t, c.CheckNewBlock(mine(func(b *Block) { b.Difficulty = DifficultyOfBits(4) })))
+
+	// The proof of work does not meet the difficulty
+	b = mine(func(b *Block) {})
+	for meetsDifficulty(b.Hash(), b.Difficulty) {
+		b.Nonce++
+	}
+	b.BlockHash = b.HashCode()
+	require.Error(t, c.CheckNewBlock(b))
+
+	// The block is dated before the previous one, or too far in the future
+	require.Error(t, c.CheckNewBlock(mine(func(b *Block) { b.Timestamp = c.GetLastBlock().Timestamp })))
+	require.Error(t, c.CheckNewBlock(mine(func(b *Block) {
+		b.Timestamp = uint64(time.Now().Add(time.Hour).UnixMicro())
+	})))
+
+	// The block following the interval is retargeted, the two blocks have been mined faster than a second apart
+	b = mine(func(b *Block) {})
+	require.NoError(t, c.CheckNewBlock(b))
+	require.NoError(t, c.AppendBlock(b))
+	require.Equal(t, DifficultyOfBits(8)*maxRetargetFactor, c.NextDifficulty())
+	require.NoError(t, c.ValidateChain())
+}
@@ -0,0 +1,235 @@
+package block
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+)
+
+// Prefixes of the hashed nodes of a Merkle tree, so that a leaf can not be passed off as an inner node
+const (
+	merkleLeafPrefix  byte = 0x00
+	merkleInnerPrefix byte = 0x01
+)
+
+// MerkleStep is a step of a Merkle proof, from a node to its parent
+type MerkleStep struct {
+	// Sibling is the hash of the sibling of the node
+	Sibling []byte
+
+	// Left is true if the sibling is the left child of the parent
+	Left bool
+}
+
+// MerkleProof proves that a leaf is part of a Merkle tree, it is the path from the leaf to the root
+type MerkleProof struct {
+	Leaf  []byte
+	Steps []MerkleStep
+}
+
+func merkleLeaf(leaf []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(leaf)
+	return h.Sum(nil)
+}
+
+func merkleInner(left []byte, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleInnerPrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleLevels returns all the levels of the Merkle tree of the given leaves, from the hashed leaves to the root.
+// A node without sibling is promoted to the next level as is, rather than paired with itself, so that two lists of
+// leaves never have the same root.
+func merkleLevels(leaves [][]byte) [][][]byte {
+	level := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = merkleLeaf(leaf)
+	}
+
+	levels := [][][]byte{level}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, merkleInner(level[i], level[i+1]))
+			}
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels
+}
+
+// MerkleRoot returns the root of the Merkle tree of the given leaves, the root of an empty tree is the hash of
+// nothing
+func MerkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		root := sha256.Sum256(nil)
+		return root[:]
+	}
+	levels := merkleLevels(leaves)
+	return levels[len(levels)-1][0]
+}
+
+// NewMerkleProof returns the proof that the leaf at the given index is part of the Merkle tree of the leaves
+func NewMerkleProof(leaves [][]byte, index int) (*MerkleProof, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf %d out of the %d leaves", index, len(leaves))
+	}
+
+	proof := MerkleProof{Leaf: leaves[index], Steps: make([]MerkleStep, 0)}
+	levels := merkleLevels(leaves)
+	for _, level := range levels[:len(levels)-1] {
+		if index%2 == 1 {
+			proof.Steps = append(proof.Steps, MerkleStep{Sibling: level[index-1], Left: true})
+		} else if index+1 < len(level) {
+			proof.Steps = append(proof.Steps, MerkleStep{Sibling: level[index+1], Left: false})
+		}
+		index /= 2
+	}
+	return &proof, nil
+}
+
+// Root returns the root of the Merkle tree computed from the leaf and the steps of the proof
+func (p *MerkleProof) Root() []byte {
+	node := merkleLeaf(p.Leaf)
+	for _, step := range p.Steps {
+		if step.Left {
+			node = merkleInner(step.Sibling, node)
+		} else {
+			node = merkleInner(node, step.Sibling)
+		}
+	}
+	return node
+}
+
+// TransactionProof proves that a transaction is included in a block. The header of the block lets a third party
+// check the hash and the proof of work of the block, and the Merkle root of its transactions. The third party must
+// still know that the block is on the chain, e.g., from its hash.
+type TransactionProof struct {
+	// TXHash is the hash of the transaction, i.e., the leaf of the Merkle tree
+	TXHash []byte
+
+	// Header is the canonical encoding of the header of the block
+	Header []byte
+
+	BlockID   uint32
+	BlockHash string
+
+	Proof MerkleProof
+}
+
+// NewTransactionProof returns the proof that the transaction at the given index is included in the block
+func NewTransactionProof(b *Block, index int) (*TransactionProof, error) {
+	leaves := make([][]byte, len(b.TXs))
+	for i, tx := range b.TXs {
+		leaves[i] = tx.Hash()
+	}
+
+	proof, err := NewMerkleProof(leaves, index)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TransactionProof{
+		TXHash:    leaves[index],
+		Header:    b.EncodeHeader(),
+		BlockID:   b.ID,
+		BlockHash: b.BlockHash,
+		Proof:     *proof,
+	}, nil
+}
+
+// verifyHeader checks that the header is the one of the block of the given ID and hash, and has a valid proof of
+// work for a difficulty of at least the given one. It returns the decoded header.
+func verifyHeader(headerBytes []byte, blockID uint32, blockHash string, minDifficulty uint64) (*Block, error) {
+	hash := sha256.Sum256(headerBytes)
+	if hex.EncodeToString(hash[:]) != blockHash {
+		return nil, fmt.Errorf("header does not match the block hash %s", blockHash)
+	}
+
+	header, err := decodeHeader(headerBytes)
+	if err != nil {
+		return nil, err
+	}
+	if header.Difficulty < minDifficulty {
+		return nil, fmt.Errorf("difficulty %d of block %s is below %d", header.Difficulty, blockHash, minDifficulty)
+	}
+	if !meetsDifficulty(hash[:], header.Difficulty) {
+		return nil, fmt.Errorf("invalid proof of work of block %s", blockHash)
+	}
+	if header.ID != blockID {
+		return nil, fmt.Errorf("header is the one of block %d instead of %d", header.ID, blockID)
+	}
+	return header, nil
+}
+
+// Verify checks that the header is the one of the block and has a valid proof of work for a difficulty of at least
+// the given one, and that the Merkle proof leads from the transaction to the TXHash of the header
+func (p *TransactionProof) Verify(minDifficulty uint64) error {
+	header, err := verifyHeader(p.Header, p.BlockID, p.BlockHash, minDifficulty)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(p.Proof.Leaf, p.TXHash) {
+		return fmt.Errorf("proof is not the one of the transaction")
+	}
+	if hex.EncodeToString(p.Proof.Root()) != header.TXHash {
+		return fmt.Errorf("transaction is not included in block %s", p.BlockHash)
+	}
+	return nil
+}
+
+// AccountProof proves that an account has a given state, e.g., a given balance, in the world state after a block,
+// or that it does not exist. Like a TransactionProof, the third party must still know that the block is on the
+// chain.
+type AccountProof struct {
+	// Header is the canonical encoding of the header of the block
+	Header []byte
+
+	BlockID   uint32
+	BlockHash string
+
+	Proof common.StateProof
+}
+
+// NewAccountProof returns the proof of the state of the account of the given address in the world state of the
+// block. The world state of a block pruned by its chain has been released, its proof must be obtained from the chain.
+func NewAccountProof(b *Block, address string) (*AccountProof, error) {
+	if b.pruned {
+		return nil, fmt.Errorf("world state of block %d has been released", b.ID)
+	}
+	return newAccountProof(b, &b.State, address), nil
+}
+
+// newAccountProof returns the proof of the state of the account of the given address in the given world state of
+// the block
+func newAccountProof(b *Block, worldState *common.WorldState, address string) *AccountProof {
+	return &AccountProof{
+		Header:    b.EncodeHeader(),
+		BlockID:   b.ID,
+		BlockHash: b.BlockHash,
+		Proof:     *worldState.Prove(address),
+	}
+}
+
+// Verify checks that the header is the one of the block and has a valid proof of work for a difficulty of at least
+// the given one, and that the state proof leads from the account to the StateHash of the header
+func (p *AccountProof) Verify(minDifficulty uint64) error {
+	header, err := verifyHeader(p.Header, p.BlockID, p.BlockHash, minDifficulty)
+	if err != nil {
+		return err
+	}
+	return p.Proof.Verify(header.StateHash)
+}
@@ -0,0 +1,132 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+)
+
+func newLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaf := sha256.Sum256([]byte(fmt.Sprintf("leaf %d", i)))
+		leaves[i] = leaf[:]
+	}
+	return leaves
+}
+
+// Test_Merkle_Root tests the root of small trees against their definition
+func Test_Merkle_Root(t *testing.T) {
+	leaves := newLeaves(3)
+	l0, l1, l2 := merkleLeaf(leaves[0]), merkleLeaf(leaves[1]), merkleLeaf(leaves[2])
+
+	empty := sha256.Sum256(nil)
+	require.Equal(t, empty[:], MerkleRoot(nil))
+	require.Equal(t, l0, MerkleRoot(leaves[:1]))
+	require.Equal(t, merkleInner(l0, l1), MerkleRoot(leaves[:2]))
+
+	// The odd node is promoted, not paired with itself
+	require.Equal(t, merkleInner(merkleInner(l0, l1), l2), MerkleRoot(leaves))
+	require.NotEqual(t, MerkleRoot(leaves), MerkleRoot(append(leaves, leaves[2])))
+
+	// A leaf can not be passed off as an inner node
+	require.NotEqual(t, MerkleRoot(leaves[:2]), MerkleRoot([][]byte{append(l0, l1...)}))
+}
+
+// Test_Merkle_Proof tests that the proof of every leaf leads to the root, for trees of several sizes
+func Test_Merkle_Proof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		leaves := newLeaves(n)
+		root := MerkleRoot(leaves)
+
+		for i := 0; i < n; i++ {
+			proof, err := NewMerkleProof(leaves, i)
+			require.NoError(t, err)
+			require.Equal(t, root, proof.Root(), "leaf %d of %d", i, n)
+
+			// The proof does not hold for another leaf
+			forged := *proof
+			forged.Leaf = newLeaves(n + 1)[n]
+			require.False(t, bytes.Equal(root, forged.Root()))
+		}
+
+		_, err := NewMerkleProof(leaves, n)
+		require.Error(t, err)
+	}
+}
+
+// Test_Transaction_Proof tests that a third party can verify that a transaction is included in a block, and that a
+// tampered proof is rejected
+func Test_Transaction_Proof(t *testing.T) {
+	genesis := NewGenesisBlock(common.QuickWorldState(2, 10).GetSimpleMap())
+	b := newTestBlock(t, genesis)
+	b.Difficulty = DifficultyOfBits(8)
+	ctx := context.Background()
+	require.NoError(t, b.ProofOfWork(&ctx, make(chan struct{})))
+
+	proof, err := NewTransactionProof(b, 0)
+	require.NoError(t, err)
+	require.Equal(t, b.TXs[0].Hash(), proof.TXHash)
+	require.NoError(t, proof.Verify(DifficultyOfBits(8)))
+
+	// The difficulty of the block is below the required one
+	require.Error(t, proof.Verify(DifficultyOfBits(32)))
+
+	// The header is not the one of the block
+	forged := *proof
+	forged.BlockHash = hex.EncodeToString(make([]byte, 32))
+	require.Error(t, forged.Verify(0))
+
+	// The proof is the one of another transaction
+	forged = *proof
+	other := sha256.Sum256([]byte("other"))
+	forged.TXHash = other[:]
+	require.Error(t, forged.Verify(1))
+	forged.Proof.Leaf = other[:]
+	require.Error(t, forged.Verify(1))
+
+	_, err = NewTransactionProof(b, 1)
+	require.Error(t, err)
+}
+
+// Test_Account_Proof tests that a third party can verify the balance of an account after a block, and that a
+// tampered proof is rejected
+func Test_Account_Proof(t *testing.T) {
+	genesis := NewGenesisBlock(common.QuickWorldState(2, 10).GetSimpleMap())
+	b := newTestBlock(t, genesis)
+	b.Difficulty = DifficultyOfBits(8)
+	ctx := context.Background()
+	require.NoError(t, b.ProofOfWork(&ctx, make(chan struct{})))
+
+	proof, err := NewAccountProof(b, common.QuickAddress(2).String())
+	require.NoError(t, err)
+	require.True(t, proof.Proof.Found)
+	require.EqualValues(t, 13, proof.Proof.State.Balance)
+	require.NoError(t, proof.Verify(1))
+
+	// The balance before the transfer is not the one after the block
+	forged := *proof
+	forged.Proof.State.Balance = 10
+	require.Error(t, forged.Verify(1))
+
+	// The proof is the one of the genesis block
+	forged = *proof
+	forged.Proof = *genesis.State.Prove(common.QuickAddress(2).String())
+	require.Error(t, forged.Verify(1))
+
+	// The header is not the one of the block
+	forged = *proof
+	forged.BlockID = 0
+	require.Error(t, forged.Verify(1))
+
+	absent, err := NewAccountProof(b, common.QuickAddress(3).String())
+	require.NoError(t, err)
+	require.False(t, absent.Proof.Found)
+	require.NoError(t, absent.Verify(1))
+}
@@ -0,0 +1,116 @@
+package block
+
+import (
+	"fmt"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+	"sort"
+	"strings"
+)
+
+// Status of a transaction in its receipt
+const (
+	// ReceiptIncluded means that the transaction has been executed in a block appended to the chain
+	ReceiptIncluded = iota
+	// ReceiptInvalid means that the transaction failed to be executed by the miner of the node, which retries it
+	// until it has been invalid for longer than the TTL of invalid transactions
+	ReceiptInvalid
+	// ReceiptDropped means that the transaction has been dropped by the miner of the node, e.g., because its nonce
+	// has been used by another transaction or it has been invalid for too long. It is only included if another
+	// miner includes it.
+	ReceiptDropped
+)
+
+// Receipt is the outcome of the processing of a transaction
+type Receipt struct {
+	TXHash string
+	Status int
+
+	// BlockID is the ID of the block that includes the transaction, or the ID of the block the miner was preparing
+	// when the transaction failed or was dropped
+	BlockID uint32
+	// BlockHash is the hash of the block that includes the transaction, it is empty if it is not included
+	BlockHash string
+
+	// Error is the reason why the transaction failed or was dropped
+	Error string
+
+	// BalanceChanges are the changes of the balances of the accounts caused by the transaction : address -> change.
+	// The fee is part of the change of the balance of the source account.
+	BalanceChanges map[string]int64
+}
+
+// NewFailureReceipt returns the receipt of a transaction that failed or was dropped while the block of the given
+// ID was prepared
+func NewFailureReceipt(txHash string, status int, blockID uint32, err error) *Receipt {
+	return &Receipt{
+		TXHash:         txHash,
+		Status:         status,
+		BlockID:        blockID,
+		Error:          err.Error(),
+		BalanceChanges: make(map[string]int64),
+	}
+}
+
+// Final returns true if the status of the receipt does not change unless the transaction is included by another
+// miner, i.e., if the transaction is included or dropped
+func (r *Receipt) Final() bool {
+	return r.Status != ReceiptInvalid
+}
+
+// Err returns nil if the transaction is included, and the reason why it is not otherwise
+func (r *Receipt) Err() error {
+	switch r.Status {
+	case ReceiptIncluded:
+		return nil
+	case ReceiptInvalid:
+		return fmt.Errorf("transaction %s is invalid: %s", r.TXHash, r.Error)
+	default:
+		return fmt.Errorf("transaction %s is dropped: %s", r.TXHash, r.Error)
+	}
+}
+
+func (r *Receipt) String() string {
+	status := "included"
+	switch r.Status {
+	case ReceiptInvalid:
+		status = "invalid"
+	case ReceiptDropped:
+		status = "dropped"
+	}
+
+	changes := make([]string, 0, len(r.BalanceChanges))
+	for addr, change := range r.BalanceChanges {
+		changes = append(changes, fmt.Sprintf("%s:%+d", addr, change))
+	}
+	sort.Strings(changes)
+
+	return fmt.Sprintf("{tx:%s status:%s block:%d hash:%s error:%q changes:[%s]}",
+		r.TXHash, status, r.BlockID, r.BlockHash, r.Error, strings.Join(changes, " "))
+}
+
+// balances returns the balances of the accounts of the world state : address -> balance
+func balances(worldState *common.WorldState) map[string]int64 {
+	result := make(map[string]int64)
+	for _, key := range worldState.Keys() {
+		state, _ := worldState.Get(key)
+		result[key] = state.Balance
+	}
+	return result
+}
+
+// balanceChanges returns the non-zero differences between the balances of the world state and the given previous
+// balances
+func balanceChanges(prevBalances map[string]int64, worldState *common.WorldState) map[string]int64 {
+	changes := make(map[string]int64)
+	for addr, balance := range balances(worldState) {
+		if change := balance - prevBalances[addr]; change != 0 {
+			changes[addr] = change
+		}
+	}
+	for addr, balance := range prevBalances {
+		if _, ok := worldState.Get(addr); !ok && balance != 0 {
+			changes[addr] = -balance
+		}
+	}
+	return changes
+}
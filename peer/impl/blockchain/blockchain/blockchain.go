@@ -3,9 +3,11 @@ package blockchain
 import (
 	"context"
 	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"fmt"
 	"os"
-	"strings"
 	"sync"
 	"time"
 
@@ -20,9 +22,15 @@ import (
 	"go.dedis.ch/cs438/peer/impl/contract/impl"
 	"go.dedis.ch/cs438/peer/impl/message"
 	"go.dedis.ch/cs438/storage"
+	"go.dedis.ch/cs438/transport"
 	"go.dedis.ch/cs438/types"
+	"golang.org/x/xerrors"
 )
 
+// accountKeyKey is the key of the persisted private key of the account inside the blockchain store, next to the
+// blocks of the chain
+const accountKeyKey = "account:key"
+
 type Blockchain struct {
 	logger   zerolog.Logger
 	message  *message.Message
@@ -33,12 +41,13 @@ type Blockchain struct {
 	address common.Address
 
 	// nonce is number of transactions this account has sent
-	nonce int
+	nonce   int
+	nonceMu sync.Mutex
 
-	// numContract is the number of contracts this account has published
+	// numContract is the number of contracts this account has published, it is protected by nonceMu
 	numContract int
 
-	// submittedTxs keeps record of all submitted txs
+	// submittedTxs keeps record of all submitted txs, it is protected by nonceMu
 	submittedTxs map[string]*transaction.SignedTransaction
 
 	ctx    context.Context
@@ -55,35 +64,64 @@ func NewBlockchain(conf *peer.Configuration, message *message.Message,
 	d.message = message
 	d.peerConf = message.GetConf()
 
-	// Set the blockchain address
-	// Currently, the blockchain address is set to be the port number of the node's network address for simplicity
-	socketAddr := strings.Split(conf.Socket.GetAddress(), ":")
-	if len(socketAddr) != 2 {
-		panic(fmt.Errorf("invalid socket address to generate blockchain address: %s", conf.Socket.GetAddress()))
+	// The key pair of the account signs all transactions sent by the node, it is loaded from the storage unless it
+	// is given, so that the node keeps its account across restarts
+	privateKey := conf.BlockchainPrivateKey
+	if privateKey == nil {
+		var err error
+		privateKey, err = loadKey(storage.GetBlockchainStore())
+		if err != nil {
+			panic(fmt.Errorf("failed to load the key pair of the blockchain account: %v", err))
+		}
 	}
-	d.address = common.Address{HexString: socketAddr[1]}
-	if len(d.peerConf.BlockchainAccountAddress) != 0 && d.peerConf.BlockchainAccountAddress != socketAddr[1] {
-		panic(fmt.Errorf(
-			"BlockchainAccountAddress is given but doesn't match the port number of the socket address: "+
-				"%s and %s",
-			d.peerConf.BlockchainAccountAddress,
-			conf.Socket.GetAddress()))
+	d.privateKey = privateKey
+	d.publicKey = &privateKey.PublicKey
+
+	// The blockchain address is derived from the public key
+	address, err := common.KeyToAddress(d.publicKey)
+	if err != nil {
+		panic(fmt.Errorf("failed to derive the blockchain address: %v", err))
 	}
+	d.address = address
 
 	// Overwrite the BlockchainAccountAddress in the configuration
-	conf.BlockchainAccountAddress = socketAddr[1]
+	conf.BlockchainAccountAddress = d.address.String()
 
 	d.nonce = 0
 	d.numContract = 0
 	d.submittedTxs = make(map[string]*transaction.SignedTransaction)
 	d.logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr}).With().Str("account", d.address.String()).Logger()
 	d.miner = miner.NewMiner(conf, message, consensus, storage)
-	d.publicKey = nil
-	d.privateKey = nil
+
+	message.GetConf().MessageRegistry.RegisterMessageCallback(types.DeclarationChallengeMessage{},
+		d.execDeclarationChallengeMessage)
+
+	// Recover the nonce and the published contracts of the account from the reloaded chain
+	d.resetNonce()
 
 	return &d
 }
 
+// loadKey returns the private key of the account persisted inside the blockchain store, a new key is generated and
+// persisted if there is none yet
+func loadKey(store storage.Store) (*ecdsa.PrivateKey, error) {
+	keyBytes := store.Get(accountKeyKey)
+	if keyBytes != nil {
+		return x509.ParseECPrivateKey(keyBytes)
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err = x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	store.Set(accountKeyKey, keyBytes)
+	return privateKey, nil
+}
+
 func (a *Blockchain) Start() {
 	a.logger.Debug().Msg("starting Blockchain")
 	a.ctx, a.cancel = context.WithCancel(context.Background())
@@ -110,7 +148,9 @@ func (a *Blockchain) broadcastTransaction(signedTx *transaction.SignedTransactio
 		return err
 	}
 
+	a.nonceMu.Lock()
 	a.submittedTxs[signedTx.HashCode()] = signedTx
+	a.nonceMu.Unlock()
 
 	a.logger.Debug().
 		Int("type", signedTx.TX.Type).
@@ -126,12 +166,33 @@ func (a *Blockchain) broadcastTransaction(signedTx *transaction.SignedTransactio
 	return nil
 }
 
+// receiptRecheckInterval is the interval at which the receipt of a submitted transaction is looked up, in case its
+// delivery to the subscription is missed
+const receiptRecheckInterval = time.Second
+
+// checkTransaction waits for the receipt of the submitted transaction. It returns nil once the transaction is
+// included in a block of the chain, and an error if the miner of the node drops the transaction or if the timeout
+// is reached. An invalid transaction is waited for, it may become valid before it is dropped.
 func (a *Blockchain) checkTransaction(signedTx *transaction.SignedTransaction, timeout time.Duration) error {
-	// Now it check if the transaction is confirmed by only querying the blockchain of itself.
+	txHash := signedTx.HashCode()
+
+	// The subscription is made before the lookup, so that no receipt is missed in between
+	receipts, unsubscribe := a.miner.SubscribeReceipts()
+	defer unsubscribe()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// The receipts are not delivered to a full subscription, so that the receipt is also looked up periodically
+	recheck := time.NewTicker(receiptRecheckInterval)
+	defer recheck.Stop()
 
-	start := time.Now()
-	for {
-		if time.Since(start) > timeout {
+	receipt, ok := a.miner.GetReceipt(txHash)
+	for !ok || !receipt.Final() {
+		select {
+		case <-recheck.C:
+			receipt, ok = a.miner.GetReceipt(txHash)
+		case <-timer.C:
 			a.logger.Debug().
 				Int("type", signedTx.TX.Type).
 				Str("src", signedTx.TX.Src.String()).
@@ -143,14 +204,31 @@ func (a *Blockchain) checkTransaction(signedTx *transaction.SignedTransaction, t
 				Str("data", signedTx.TX.Data).
 				Msg("submitted transaction verification timeout")
 
+			// The nonce of the transaction is given back, so that the transactions sent afterwards are not held
+			// behind it by the miners
+			a.resetNonce()
+
+			if ok {
+				return fmt.Errorf("transaction verification timeout: %w", receipt.Err())
+			}
 			return fmt.Errorf("transaction verification timeout")
+		case r := <-receipts:
+			if r.TXHash == txHash {
+				receipt, ok = r, true
+			}
 		}
+	}
 
-		if a.miner.HasTransaction(signedTx) {
-			break
-		} else {
-			time.Sleep(10 * time.Millisecond)
-		}
+	if receipt.Status != block.ReceiptIncluded {
+		a.logger.Debug().
+			Int("type", signedTx.TX.Type).
+			Str("src", signedTx.TX.Src.String()).
+			Int("nonce", signedTx.TX.Nonce).
+			Str("reason", receipt.Error).
+			Msg("submitted transaction dropped")
+
+		a.resetNonce()
+		return receipt.Err()
 	}
 
 	a.logger.Debug().
@@ -162,13 +240,98 @@ func (a *Blockchain) checkTransaction(signedTx *transaction.SignedTransaction, t
 		Uint64("timestamp", signedTx.TX.Timestamp).
 		//Str("code", string(signedTx.TX.Code)).
 		Str("data", signedTx.TX.Data).
+		Uint32("blockID", receipt.BlockID).
 		Msg("submitted transaction verified")
 
 	return nil
 }
 
+// nextNonce returns the nonce of the next transaction sent by the account. The nonce of the account in the world
+// state is adopted if it is ahead, e.g., after a restart of the node, since only the chain knows how many
+// transactions the account has sent.
+func (a *Blockchain) nextNonce() int {
+	a.nonceMu.Lock()
+	defer a.nonceMu.Unlock()
+
+	worldState := a.miner.GetWorldState()
+	state, ok := worldState.Get(a.GetAccountAddress())
+	if ok && state.Nonce > a.nonce {
+		a.nonce = state.Nonce
+	}
+	a.nonce++
+	return a.nonce
+}
+
+// nextFee returns the fee of a transaction of the given nonce. If a transaction of the same nonce has already been
+// submitted, e.g., it is stuck in the mempools after a timeout, the fee is raised above its fee so that the new
+// transaction replaces it.
+func (a *Blockchain) nextFee(nonce int) int64 {
+	a.nonceMu.Lock()
+	defer a.nonceMu.Unlock()
+
+	fee := a.peerConf.BlockchainTransactionFee
+	for _, tx := range a.submittedTxs {
+		if tx.TX.Nonce == nonce && tx.TX.Fee >= fee {
+			fee = tx.TX.Fee + 1
+		}
+	}
+	return fee
+}
+
+// nextContractAddress returns the address of the next contract published by the account, which is the one its
+// deployment must use. The number of contracts in the world state is adopted if it is ahead, as for the nonce.
+func (a *Blockchain) nextContractAddress() common.Address {
+	a.nonceMu.Lock()
+	defer a.nonceMu.Unlock()
+
+	worldState := a.miner.GetWorldState()
+	numContract := worldState.CountContracts(a.address)
+	if numContract > a.numContract {
+		a.numContract = numContract
+	}
+	a.numContract++
+	return common.ContractAddress(a.address, a.numContract)
+}
+
+// resetNonce goes back to the nonce of the account in the world state, it gives back the nonces of the transactions
+// that have not been executed, and the addresses of the contracts that have not been deployed.
+func (a *Blockchain) resetNonce() {
+	a.nonceMu.Lock()
+	defer a.nonceMu.Unlock()
+
+	worldState := a.miner.GetWorldState()
+	a.numContract = worldState.CountContracts(a.address)
+	state, ok := worldState.Get(a.GetAccountAddress())
+	if ok {
+		a.nonce = state.Nonce
+	} else {
+		a.nonce = 0
+	}
+}
+
+// JoinBlockchain declares the account of the node and binds it to the network address of the node. The balance is
+// either common.FaucetAllowance, drawn from the faucet of the genesis block, or 0 to only bind the network address
+// of an account that already exists, e.g., in the genesis block. The miners of the other nodes accept the
+// declaration once the node has answered their challenge with the key of the account.
 func (a *Blockchain) JoinBlockchain(balance int64, timeout time.Duration) error {
-	err := a.TransferMoney(a.address, balance, timeout)
+	if balance != 0 && balance != common.FaucetAllowance {
+		return fmt.Errorf("an account can only draw the allowance %d from the faucet, not %d",
+			common.FaucetAllowance, balance)
+	}
+
+	rawTx := transaction.NewAccountDeclarationTX(a.address, balance, a.peerConf.Socket.GetAddress(), a.nextNonce())
+
+	signedTx, err := rawTx.Sign(a.privateKey)
+	if err != nil {
+		return err
+	}
+
+	err = a.broadcastTransaction(&signedTx)
+	if err != nil {
+		return err
+	}
+
+	err = a.checkTransaction(&signedTx, timeout)
 	if err != nil {
 		return err
 	}
@@ -178,6 +341,46 @@ func (a *Blockchain) JoinBlockchain(balance int64, timeout time.Duration) error
 	return nil
 }
 
+// execDeclarationChallengeMessage proves to a miner that this node holds the key of the account that it declared
+// along with its network address. A challenge for another account is refused, so that another key can not take the
+// network address of this node.
+func (a *Blockchain) execDeclarationChallengeMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	challengeMsg, ok := msg.(*types.DeclarationChallengeMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	if challengeMsg.Account != a.address.String() {
+		a.logger.Warn().
+			Str("peer", pkt.Header.Source).
+			Str("declaredAccount", challengeMsg.Account).
+			Msg("refuse to prove the declaration of another account with the network address of the node")
+		return nil
+	}
+
+	signature, err := transaction.SignChallenge(a.privateKey, a.peerConf.Socket.GetAddress(), challengeMsg.Nonce)
+	if err != nil {
+		a.logger.Error().Err(err).Msg("fail to sign the declaration challenge")
+		return nil
+	}
+	replyMsg := types.DeclarationChallengeReplyMessage{RequestID: challengeMsg.RequestID, Signature: signature}
+	replyTransMsg, err := a.peerConf.MessageRegistry.MarshalMessage(replyMsg)
+	if err != nil {
+		return err
+	}
+
+	// The miner may not be in the routing table yet, the reply goes back through the relay of the challenge
+	err = a.message.Unicast(pkt.Header.Source, replyTransMsg)
+	if err != nil {
+		err = a.message.SendDirectMsg(pkt.Header.RelayedBy, pkt.Header.Source, replyTransMsg)
+	}
+	if err != nil {
+		a.logger.Debug().Err(err).Str("peer", pkt.Header.Source).Msg("fail to answer the declaration challenge")
+	}
+	return nil
+}
+
 func (a *Blockchain) LeaveBlockchain() error {
 	// Nothing to do for leaving the blockchain
 	// Do not rejoin!
@@ -188,17 +391,20 @@ func (a *Blockchain) LeaveBlockchain() error {
 
 func (a *Blockchain) TransferMoney(dst common.Address, amount int64, timeout time.Duration) error {
 	balance := a.GetBalance()
+	fee := a.peerConf.BlockchainTransactionFee
 
 	// 0. For non-declaration transaction, do you have enough money?
-	if dst.String() != a.address.String() && balance < amount {
-		a.logger.Debug().Int64("balance", balance).Int64("debit", amount).
+	if dst.String() != a.address.String() && balance < amount+fee {
+		a.logger.Debug().Int64("balance", balance).Int64("debit", amount).Int64("fee", fee).
 			Msg("no enough balance for TransferMoney")
 		return fmt.Errorf("TransferMoney failed : don't have enough balance")
 	}
 
-	// 1. Generate a transaction with type TRANSFER_TX
-	a.nonce++
-	rawTx := transaction.NewTransferTX(a.address, dst, amount, a.nonce)
+	// 1. Generate a transaction with type TRANSFER_TX, a declaration pays no fee
+	rawTx := transaction.NewTransferTX(a.address, dst, amount, a.nextNonce())
+	if dst.String() != a.address.String() {
+		rawTx.Fee = a.nextFee(rawTx.Nonce)
+	}
 
 	// 2. Sign the transaction
 	signedTx, err := rawTx.Sign(a.privateKey)
@@ -225,8 +431,9 @@ func (a *Blockchain) ProposeContract(hash string, _ string,
 	reward int64, recipient string, timeout time.Duration) (string, error) {
 	// First check if the publisher has enough balance
 	balance := a.GetBalance()
-	if balance < reward {
-		a.logger.Debug().Int64("balance", balance).Int64("reward", reward).
+	fee := a.peerConf.BlockchainTransactionFee
+	if balance < reward+fee {
+		a.logger.Debug().Int64("balance", balance).Int64("reward", reward).Int64("fee", fee).
 			Msg("no enough balance for ProposeContract")
 		return "", fmt.Errorf("ProposeContract failed : don't have enough balance")
 	}
@@ -240,19 +447,17 @@ func (a *Blockchain) ProposeContract(hash string, _ string,
 	plainContract := impl.BuildPlainContract(hash, recipient, reward)
 
 	// Create a contract instance
-	a.numContract++
-	contractAddress := fmt.Sprintf("%s_%d", a.address.String(), a.numContract)
+	contractAddress := a.nextContractAddress()
 	contract := impl.NewContract(
-		contractAddress,      // ID
-		"crack pwd contract", // name
-		plainContract,        // plain_code
-		a.address.String(),   // publisher
-		recipient,            // finisher
+		contractAddress.String(), // ID
+		"crack pwd contract",     // name
+		plainContract,            // plain_code
+		a.address.String(),       // publisher
+		recipient,                // finisher
 	)
 
-	a.nonce++
-	rawTx := transaction.NewContractDeploymentTX(a.address,
-		common.StringToAddress(contractAddress), reward, contract, a.nonce)
+	rawTx := transaction.NewContractDeploymentTX(a.address, contractAddress, reward, contract, a.nextNonce())
+	rawTx.Fee = a.nextFee(rawTx.Nonce)
 
 	// Sign the transaction
 	signedTx, err := rawTx.Sign(a.privateKey)
@@ -272,14 +477,18 @@ func (a *Blockchain) ProposeContract(hash string, _ string,
 		return "", err
 	}
 
-	return contractAddress, nil
+	return contractAddress.String(), nil
 }
 
 func (a *Blockchain) ExecuteContract(password string, hash string, salt string,
 	contractAddr string, timeout time.Duration) error {
-	a.nonce++
-	rawTx := transaction.NewContractExecutionTX(a.address,
-		common.StringToAddress(contractAddr), password, hash, salt, a.nonce)
+	contractAddress, err := common.ParseAddress(contractAddr)
+	if err != nil {
+		return err
+	}
+
+	rawTx := transaction.NewContractExecutionTX(a.address, contractAddress, password, hash, salt, a.nextNonce())
+	rawTx.Fee = a.nextFee(rawTx.Nonce)
 
 	// Sign the transaction
 	signedTx, err := rawTx.Sign(a.privateKey)
@@ -302,10 +511,66 @@ func (a *Blockchain) ExecuteContract(password string, hash string, salt string,
 	return nil
 }
 
+// GetTransactionProof returns the proof that the transaction of the given hash is included in a block of the chain
+func (a *Blockchain) GetTransactionProof(txHash string) (*block.TransactionProof, error) {
+	return a.miner.GetChain().GetTransactionProof(txHash)
+}
+
+// ProveContractExecution returns the proof that the account has executed the contract of the given address, i.e.,
+// that its ContractExecuteTx is included in a block of the chain
+func (a *Blockchain) ProveContractExecution(contractAddr string) (*block.TransactionProof, error) {
+	contractAddress, err := common.ParseAddress(contractAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	txHash, ok := a.miner.GetChain().FindTransaction(func(tx *transaction.SignedTransaction) bool {
+		return tx.TX.Type == transaction.ContractExecuteTx && tx.TX.Src.Equals(a.address) &&
+			tx.TX.Dst.Equals(contractAddress)
+	})
+	if !ok {
+		return nil, fmt.Errorf("no execution of contract %s by account %s on the chain", contractAddr,
+			a.address.String())
+	}
+	return a.GetTransactionProof(txHash)
+}
+
+// GetReceipt returns the receipt of the transaction of the given hash, i.e., whether it is included in a block or
+// why it failed or was dropped by the miner of the node, along with the balance changes it caused
+func (a *Blockchain) GetReceipt(txHash string) (*block.Receipt, error) {
+	receipt, ok := a.miner.GetReceipt(txHash)
+	if !ok {
+		return nil, fmt.Errorf("no receipt for transaction %s", txHash)
+	}
+	return receipt, nil
+}
+
+// SubscribeReceipts returns a channel on which the receipts of the transactions are delivered as they are included,
+// fail or are dropped, along with the function that ends the subscription
+func (a *Blockchain) SubscribeReceipts() (<-chan *block.Receipt, func()) {
+	return a.miner.SubscribeReceipts()
+}
+
+// GetAccountProof returns the proof of the state of the account of the given address, e.g., of its balance, in the
+// world state after the block of the given ID on the chain
+func (a *Blockchain) GetAccountProof(address string, blockID uint32) (*block.AccountProof, error) {
+	return a.miner.GetChain().GetAccountProof(address, blockID)
+}
+
 func (a *Blockchain) GetAccountAddress() string {
 	return a.address.String()
 }
 
+// GetAccountOf returns the address of the account bound to the given network address in the world state
+func (a *Blockchain) GetAccountOf(networkAddress string) (string, error) {
+	worldState := a.miner.GetWorldState()
+	account, ok := worldState.FindNetworkAddress(networkAddress)
+	if !ok {
+		return "", fmt.Errorf("no account is bound to network address %s", networkAddress)
+	}
+	return account, nil
+}
+
 func (a *Blockchain) GetBalance() int64 {
 	worldState := a.miner.GetWorldState()
 	state, ok := worldState.Get(a.GetAccountAddress())
@@ -1,29 +1,101 @@
 package common
 
 import (
+	"bytes"
+	"crypto/ecdsa"
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 )
 
+// AddressLength is the number of bytes of an account address
+const AddressLength = 20
+
+// Address is the address of an account. The address of an externally owned account is derived from its public
+// key, as in Ethereum, and the address of a contract account from the address of its publisher.
 type Address struct {
-	//Addr      [8]byte
-	HexString string
+	Bytes []byte
+}
+
+// FaucetAddress is the address of the faucet account, whose balance is allocated in the genesis block. An account
+// declaration draws the initial balance of the new account from the faucet instead of creating money. No key is
+// derived to this address, the faucet can not send transactions.
+var FaucetAddress = NewAddress(make([]byte, AddressLength))
+
+// FaucetAllowance is the balance that an account draws from the faucet with its declaration. It is the same for all
+// the accounts, so that one declaration can not drain the faucet.
+const FaucetAllowance int64 = 10
+
+// NewAddress creates an address from its bytes
+func NewAddress(b []byte) Address {
+	cpy := make([]byte, len(b))
+	copy(cpy, b)
+	return Address{Bytes: cpy}
 }
 
-func (a *Address) String() string {
-	return a.HexString
+// ParseAddress parses the hexadecimal form of an address, as returned by String
+func ParseAddress(s string) (Address, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return Address{}, fmt.Errorf("invalid address %s: %v", s, err)
+	}
+	if len(b) != 0 && len(b) != AddressLength {
+		return Address{}, fmt.Errorf("invalid address %s: %d bytes instead of %d", s, len(b), AddressLength)
+	}
+	return Address{Bytes: b}, nil
 }
 
-func (a *Address) Hash() []byte {
+// PublicKeyToAddress derives the address of an account from its public key in PKIX, ASN.1 DER form, it is the
+// last AddressLength bytes of the hash of the key
+func PublicKeyToAddress(publicKey []byte) Address {
+	hash := sha256.Sum256(publicKey)
+	return NewAddress(hash[len(hash)-AddressLength:])
+}
+
+// KeyToAddress derives the address of the account of the given public key
+func KeyToAddress(publicKey *ecdsa.PublicKey) (Address, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return Address{}, err
+	}
+	return PublicKeyToAddress(publicKeyBytes), nil
+}
+
+// ContractAddress derives the address of the n-th contract published by the given account
+func ContractAddress(publisher Address, n int) Address {
+	var nBytes [8]byte
+	binary.BigEndian.PutUint64(nBytes[:], uint64(n))
+
 	hash := sha256.New()
-	hash.Write([]byte(a.HexString))
-	return hash.Sum(nil)
+	hash.Write(publisher.Bytes)
+	hash.Write(nBytes[:])
+	sum := hash.Sum(nil)
+	return NewAddress(sum[len(sum)-AddressLength:])
 }
 
-func (a *Address) HashCode() string {
-	return hex.EncodeToString(a.Hash())
+// IsEmpty returns true if the address has no bytes, e.g., a missing contract address
+func (a Address) IsEmpty() bool {
+	return len(a.Bytes) == 0
+}
+
+// Equals returns true if both addresses have the same bytes
+func (a Address) Equals(other Address) bool {
+	return bytes.Equal(a.Bytes, other.Bytes)
+}
+
+// String returns the hexadecimal form of the address, which is the key of the account in the world state
+func (a Address) String() string {
+	return hex.EncodeToString(a.Bytes)
 }
 
-func StringToAddress(s string) Address {
-	return Address{HexString: s}
+func (a Address) Hash() []byte {
+	hash := sha256.New()
+	hash.Write(a.Bytes)
+	return hash.Sum(nil)
+}
+
+func (a Address) HashCode() string {
+	return hex.EncodeToString(a.Hash())
 }
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// EncodingVersion is the version of the canonical encoding. It is the first byte of every encoded transaction,
+// block and state, so that the encoding can evolve without ambiguity. It must be increased whenever the layout of an
+// encoding changes, since the hashes and the signatures are computed on it.
+const EncodingVersion byte = 3
+
+// Encoder builds the canonical binary encoding of the blockchain structures: integers are written in 8 bytes big
+// endian, and variable-length fields are prefixed with their length. The fields of a structure are written in a
+// fixed order, so that equal structures always have the same encoding.
+type Encoder struct {
+	buf bytes.Buffer
+}
+
+// NewEncoder creates an encoder, the version of the encoding is written first
+func NewEncoder() *Encoder {
+	e := Encoder{}
+	e.buf.WriteByte(EncodingVersion)
+	return &e
+}
+
+// WriteUint writes an unsigned integer
+func (e *Encoder) WriteUint(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+// WriteInt writes a signed integer, in two's complement
+func (e *Encoder) WriteInt(v int64) {
+	e.WriteUint(uint64(v))
+}
+
+// WriteBytes writes a variable-length field
+func (e *Encoder) WriteBytes(b []byte) {
+	e.WriteUint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+// WriteString writes a variable-length string
+func (e *Encoder) WriteString(s string) {
+	e.WriteBytes([]byte(s))
+}
+
+// Bytes returns the encoding
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// Decoder reads an encoding built by an Encoder. The first error is kept, and the following reads return zero
+// values, so that a structure can be decoded field by field and the error checked once at the end.
+type Decoder struct {
+	data []byte
+	err  error
+}
+
+// NewDecoder creates a decoder of the given encoding, after checking its version
+func NewDecoder(data []byte) *Decoder {
+	d := Decoder{}
+	if len(data) == 0 {
+		d.err = fmt.Errorf("empty encoding")
+		return &d
+	}
+	if data[0] != EncodingVersion {
+		d.err = fmt.Errorf("unsupported encoding version %d, expected %d", data[0], EncodingVersion)
+		return &d
+	}
+	d.data = data[1:]
+	return &d
+}
+
+// ReadUint reads an unsigned integer
+func (d *Decoder) ReadUint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) < 8 {
+		d.err = fmt.Errorf("truncated encoding, %d bytes left to read an integer", len(d.data))
+		return 0
+	}
+	v := binary.BigEndian.Uint64(d.data[:8])
+	d.data = d.data[8:]
+	return v
+}
+
+// ReadInt reads a signed integer
+func (d *Decoder) ReadInt() int64 {
+	return int64(d.ReadUint())
+}
+
+// ReadBytes reads a variable-length field, a copy of the bytes is returned. It returns nil on an error only.
+func (d *Decoder) ReadBytes() []byte {
+	n := d.ReadUint()
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.data)) < n {
+		d.err = fmt.Errorf("truncated encoding, %d bytes left to read %d bytes", len(d.data), n)
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.data[:n])
+	d.data = d.data[n:]
+	return b
+}
+
+// ReadString reads a variable-length string
+func (d *Decoder) ReadString() string {
+	return string(d.ReadBytes())
+}
+
+// Err returns the first error of the decoding, or an error if some bytes have not been read
+func (d *Decoder) Err() error {
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.data) != 0 {
+		return fmt.Errorf("%d trailing bytes after the encoding", len(d.data))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package common
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_Encoder_Golden tests the layout of the encoding against a golden vector
+func Test_Encoder_Golden(t *testing.T) {
+	e := NewEncoder()
+	e.WriteUint(1)
+	e.WriteInt(-1)
+	e.WriteBytes([]byte{0xab, 0xcd})
+	e.WriteString("go")
+
+	golden := "03" + // version
+		"0000000000000001" + // 1
+		"ffffffffffffffff" + // -1
+		"0000000000000002" + "abcd" + // bytes
+		"0000000000000002" + "676f" // "go"
+	require.Equal(t, golden, hex.EncodeToString(e.Bytes()))
+
+	d := NewDecoder(e.Bytes())
+	require.EqualValues(t, 1, d.ReadUint())
+	require.EqualValues(t, -1, d.ReadInt())
+	require.Equal(t, []byte{0xab, 0xcd}, d.ReadBytes())
+	require.Equal(t, "go", d.ReadString())
+	require.NoError(t, d.Err())
+}
+
+// Test_Decoder_Invalid tests that a truncated, trailing or unknown encoding is rejected
+func Test_Decoder_Invalid(t *testing.T) {
+	e := NewEncoder()
+	e.WriteString("go")
+	encoding := e.Bytes()
+
+	// Truncated
+	d := NewDecoder(encoding[:len(encoding)-1])
+	require.Nil(t, d.ReadBytes())
+	require.Error(t, d.Err())
+
+	// Trailing bytes
+	d = NewDecoder(append(append([]byte{}, encoding...), 0))
+	require.Equal(t, "go", d.ReadString())
+	require.Error(t, d.Err())
+
+	// Unknown version
+	unknown := append([]byte{}, encoding...)
+	unknown[0] = EncodingVersion + 1
+	d = NewDecoder(unknown)
+	require.Equal(t, "", d.ReadString())
+	require.Error(t, d.Err())
+
+	require.Error(t, NewDecoder(nil).Err())
+}
+
+// Test_State_Encode tests the encoding and the hash of a state against golden vectors
+func Test_State_Encode(t *testing.T) {
+	state := State{
+		Nonce:          2,
+		Balance:        10,
+		Contract:       []byte{1},
+		Tasks:          map[string][2]string{"h2": {"p2", "s2"}, "h1": {"p1", "s1"}},
+		NetworkAddress: "127.0.0.1:1",
+	}
+
+	golden := "03" +
+		"0000000000000002" + // nonce
+		"000000000000000a" + // balance
+		"0000000000000000" + // code hash
+		"0000000000000001" + "01" + // contract
+		"0000000000000000" + // storage root
+		"0000000000000002" + // tasks, in the order of their hashes
+		"00000000000000026831" + "00000000000000027031" + "00000000000000027331" +
+		"00000000000000026832" + "00000000000000027032" + "00000000000000027332" +
+		"000000000000000b" + "3132372e302e302e313a31" // network address
+	require.Equal(t, golden, hex.EncodeToString(state.Encode()))
+	require.Equal(t, "11e9d6d7ae618d58fafebe843f337173da69b4e79dcc2a0c16153ed9432ec9bf", state.HashCode())
+
+	decoded, err := DecodeState(state.Encode())
+	require.NoError(t, err)
+	require.True(t, state.Equals(decoded))
+	require.Equal(t, state.Encode(), decoded.Encode())
+
+	_, err = DecodeState(state.Encode()[:10])
+	require.Error(t, err)
+}
+
+// Test_WorldState_Encode tests the hash of a world state, the root of the trie over the encodings of its states,
+// against a golden vector, and that a world state rebuilt from its states is equal with the same hash
+func Test_WorldState_Encode(t *testing.T) {
+	worldState := QuickWorldState(3, 10)
+	state, _ := worldState.Get(QuickAddress(2).String())
+	state.NetworkAddress = "127.0.0.1:2"
+	worldState.Set(QuickAddress(2).String(), state)
+	require.Equal(t, "458cc75f43159601b7a4a6b12ed94d3a86e6766006a36fb48ae397f018ad25cf", worldState.HashCode())
+
+	rebuilt := NewWorldState()
+	for key, state := range worldState.GetSimpleMap() {
+		rebuilt.Set(key, state)
+	}
+	require.True(t, worldState.Equal(&rebuilt))
+	require.Equal(t, worldState.HashCode(), rebuilt.HashCode())
+
+	state.Balance++
+	rebuilt.Set(QuickAddress(2).String(), state)
+	require.False(t, worldState.Equal(&rebuilt))
+	require.NotEqual(t, worldState.HashCode(), rebuilt.HashCode())
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"sort"
 )
 
 type State struct {
@@ -32,6 +33,11 @@ type State struct {
 	// Tasks – The map that keeps record of all password-cracking tasks that have been executed by this account.
 	// hash -> [password, salt]
 	Tasks map[string][2]string
+
+	// NetworkAddress – The network address of the peer owning an externally owned account, it is bound by the
+	// account declaration transaction. A network address is bound to one account at most.
+	// It is empty for contract accounts, and for accounts that have not declared any network address.
+	NetworkAddress string
 }
 
 func (a *State) String() string {
@@ -44,10 +50,58 @@ func (a *State) String() string {
 	return s
 }
 
+// Encode returns the canonical encoding of the state. The tasks are encoded in the order of their hashes.
+func (a *State) Encode() []byte {
+	e := NewEncoder()
+	e.WriteInt(int64(a.Nonce))
+	e.WriteInt(a.Balance)
+	e.WriteString(a.CodeHash)
+	e.WriteBytes(a.Contract)
+	e.WriteString(a.StorageRoot)
+
+	hashes := make([]string, 0, len(a.Tasks))
+	for k := range a.Tasks {
+		hashes = append(hashes, k)
+	}
+	sort.Strings(hashes)
+	e.WriteUint(uint64(len(hashes)))
+	for _, k := range hashes {
+		e.WriteString(k)
+		e.WriteString(a.Tasks[k][0])
+		e.WriteString(a.Tasks[k][1])
+	}
+
+	e.WriteString(a.NetworkAddress)
+	return e.Bytes()
+}
+
+// DecodeState decodes the canonical encoding of a state
+func DecodeState(data []byte) (State, error) {
+	d := NewDecoder(data)
+	state := State{}
+	state.Nonce = int(d.ReadInt())
+	state.Balance = d.ReadInt()
+	state.CodeHash = d.ReadString()
+	state.Contract = d.ReadBytes()
+	state.StorageRoot = d.ReadString()
+
+	numTasks := d.ReadUint()
+	state.Tasks = make(map[string][2]string)
+	for i := uint64(0); i < numTasks && d.err == nil; i++ {
+		k := d.ReadString()
+		state.Tasks[k] = [2]string{d.ReadString(), d.ReadString()}
+	}
+
+	state.NetworkAddress = d.ReadString()
+	if err := d.Err(); err != nil {
+		return State{}, fmt.Errorf("invalid state encoding: %v", err)
+	}
+	return state, nil
+}
+
 func (a *State) Hash() []byte {
-	hash := sha256.New()
-	hash.Write([]byte(a.String()))
-	return hash.Sum(nil)
+	hash := sha256.Sum256(a.Encode())
+	return hash[:]
 }
 
 func (a *State) HashCode() string {
@@ -82,6 +136,10 @@ func (a *State) Equals(other State) bool {
 		return false
 	}
 
+	if a.NetworkAddress != other.NetworkAddress {
+		return false
+	}
+
 	if len(a.Tasks) != len(other.Tasks) {
 		return false
 	}
@@ -105,6 +163,7 @@ func (a *State) Copy() State {
 	cpy.Balance = a.Balance
 	cpy.CodeHash = a.CodeHash
 	cpy.StorageRoot = a.StorageRoot
+	cpy.NetworkAddress = a.NetworkAddress
 
 	cpy.Contract = make([]byte, len(a.Contract))
 	copy(cpy.Contract, a.Contract)
@@ -0,0 +1,199 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// The world state is authenticated by a sparse Merkle tree of depth 256. The leaf of an account is at the path
+// given by the bits of the hash of its address, and an empty subtree hashes to zeros at any depth, so that only
+// the paths of the existing accounts are computed.
+const trieDepth = sha256.Size * 8
+
+// Prefixes of the hashed nodes of the trie, so that a leaf can not be passed off as an inner node
+const (
+	trieLeafPrefix  byte = 0x00
+	trieInnerPrefix byte = 0x01
+)
+
+var emptyTrieNode = make([]byte, sha256.Size)
+
+type trieLeaf struct {
+	path []byte
+	hash []byte
+}
+
+func triePath(address string) []byte {
+	path := sha256.Sum256([]byte(address))
+	return path[:]
+}
+
+func trieLeafHash(path []byte, state *State) []byte {
+	h := sha256.New()
+	h.Write([]byte{trieLeafPrefix})
+	h.Write(path)
+	h.Write(state.Encode())
+	return h.Sum(nil)
+}
+
+func trieInnerHash(left []byte, right []byte) []byte {
+	if bytes.Equal(left, emptyTrieNode) && bytes.Equal(right, emptyTrieNode) {
+		return emptyTrieNode
+	}
+	h := sha256.New()
+	h.Write([]byte{trieInnerPrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// pathBit returns the bit of the path at the given depth, the most significant bit first
+func pathBit(path []byte, depth int) byte {
+	return (path[depth/8] >> (7 - depth%8)) & 1
+}
+
+// splitLeaves splits leaves sorted by path into the leaves of the left and the right subtrees at the given depth
+func splitLeaves(leaves []trieLeaf, depth int) ([]trieLeaf, []trieLeaf) {
+	i := sort.Search(len(leaves), func(i int) bool {
+		return pathBit(leaves[i].path, depth) == 1
+	})
+	return leaves[:i], leaves[i:]
+}
+
+// subtrieRoot returns the root of the subtree at the given depth that holds the given leaves, sorted by path
+func subtrieRoot(leaves []trieLeaf, depth int) []byte {
+	if len(leaves) == 0 {
+		return emptyTrieNode
+	}
+	if depth == trieDepth {
+		return leaves[0].hash
+	}
+	left, right := splitLeaves(leaves, depth)
+	return trieInnerHash(subtrieRoot(left, depth+1), subtrieRoot(right, depth+1))
+}
+
+// trieLeaves returns the leaves of all accounts sorted by path.
+// It must be called under the protection of the mutex of the world state
+func (m *WorldState) trieLeaves() []trieLeaf {
+	leaves := make([]trieLeaf, 0, len(m.m))
+	for k, v := range m.m {
+		state := v
+		path := triePath(k)
+		leaves = append(leaves, trieLeaf{path: path, hash: trieLeafHash(path, &state)})
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		return bytes.Compare(leaves[i].path, leaves[j].path) < 0
+	})
+	return leaves
+}
+
+// Root returns the root of the state trie of the world state
+func (m *WorldState) Root() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return subtrieRoot(m.trieLeaves(), 0)
+}
+
+// StateProof proves the state of an account in the world state of a given root, or that the account does not
+// exist in it
+type StateProof struct {
+	Address string
+
+	// Found is false if the proof is a proof of absence
+	Found bool
+	State State
+
+	// Bitmap marks the siblings that are not empty along the path, from the root to the leaf. Only those siblings
+	// are in Siblings.
+	Bitmap   []byte
+	Siblings [][]byte
+}
+
+// Prove returns the proof of the state of the account of the given address, or of its absence
+func (m *WorldState) Prove(address string) *StateProof {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	proof := StateProof{
+		Address:  address,
+		Bitmap:   make([]byte, trieDepth/8),
+		Siblings: make([][]byte, 0),
+	}
+	state, ok := m.m[address]
+	if ok {
+		proof.Found = true
+		proof.State = state.Copy()
+	}
+
+	path := triePath(address)
+	leaves := m.trieLeaves()
+	for depth := 0; depth < trieDepth && len(leaves) > 0; depth++ {
+		left, right := splitLeaves(leaves, depth)
+		sibling := right
+		leaves = left
+		if pathBit(path, depth) == 1 {
+			sibling = left
+			leaves = right
+		}
+
+		siblingRoot := subtrieRoot(sibling, depth+1)
+		if !bytes.Equal(siblingRoot, emptyTrieNode) {
+			proof.Bitmap[depth/8] |= 1 << (7 - depth%8)
+			proof.Siblings = append(proof.Siblings, siblingRoot)
+		}
+	}
+
+	return &proof
+}
+
+// Root returns the root of the state trie computed from the state and the siblings of the proof
+func (p *StateProof) Root() ([]byte, error) {
+	if len(p.Bitmap) != trieDepth/8 {
+		return nil, fmt.Errorf("invalid bitmap of %d bytes", len(p.Bitmap))
+	}
+
+	path := triePath(p.Address)
+	node := emptyTrieNode
+	if p.Found {
+		node = trieLeafHash(path, &p.State)
+	}
+
+	next := len(p.Siblings) - 1
+	for depth := trieDepth - 1; depth >= 0; depth-- {
+		sibling := emptyTrieNode
+		if pathBit(p.Bitmap, depth) == 1 {
+			if next < 0 {
+				return nil, fmt.Errorf("missing siblings in the proof")
+			}
+			sibling = p.Siblings[next]
+			next--
+		}
+
+		if pathBit(path, depth) == 1 {
+			node = trieInnerHash(sibling, node)
+		} else {
+			node = trieInnerHash(node, sibling)
+		}
+	}
+
+	if next != -1 {
+		return nil, fmt.Errorf("%d unused siblings in the proof", next+1)
+	}
+	return node, nil
+}
+
+// Verify checks that the proof leads to the given root of a state trie, in hexadecimal form
+func (p *StateProof) Verify(root string) error {
+	computed, err := p.Root()
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(computed) != root {
+		return fmt.Errorf("state of account %s does not match the root %s", p.Address, root)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test_State_Trie_Root tests that the root of the state trie depends on the accounts and their states only
+func Test_State_Trie_Root(t *testing.T) {
+	empty := NewWorldState()
+	require.Equal(t, emptyTrieNode, empty.Root())
+
+	require.NotEqual(t, emptyTrieNode, QuickWorldState(1, 10).Root())
+
+	worldState := QuickWorldState(3, 10)
+	reversed := NewWorldState()
+	for i := 3; i >= 1; i-- {
+		state, _ := worldState.Get(QuickAddress(i).String())
+		reversed.Set(QuickAddress(i).String(), state)
+	}
+	require.Equal(t, worldState.Root(), reversed.Root())
+	require.Equal(t, worldState.HashCode(), hex.EncodeToString(worldState.Root()))
+
+	state, _ := reversed.Get(QuickAddress(2).String())
+	state.Balance++
+	reversed.Set(QuickAddress(2).String(), state)
+	require.NotEqual(t, worldState.Root(), reversed.Root())
+
+	reversed.Delete(QuickAddress(2).String())
+	require.NotEqual(t, worldState.Root(), reversed.Root())
+}
+
+// Test_State_Proof tests that the state of every account, and the absence of an account, can be proved against the
+// root, and that a tampered proof is rejected
+func Test_State_Proof(t *testing.T) {
+	worldState := QuickWorldState(5, 10)
+	root := worldState.HashCode()
+
+	for i := 1; i <= 5; i++ {
+		proof := worldState.Prove(QuickAddress(i).String())
+		require.True(t, proof.Found)
+		require.EqualValues(t, 10, proof.State.Balance)
+		require.NoError(t, proof.Verify(root))
+
+		// Another balance
+		forged := *proof
+		forged.State.Balance = 11
+		require.Error(t, forged.Verify(root))
+
+		// The account is claimed to be absent
+		forged = *proof
+		forged.Found = false
+		require.Error(t, forged.Verify(root))
+
+		// A sibling is missing
+		forged = *proof
+		forged.Siblings = proof.Siblings[1:]
+		require.Error(t, forged.Verify(root))
+	}
+
+	absent := worldState.Prove(QuickAddress(6).String())
+	require.False(t, absent.Found)
+	require.NoError(t, absent.Verify(root))
+
+	// The account is claimed to exist
+	absent.Found = true
+	require.Error(t, absent.Verify(root))
+
+	// The proof does not hold for another world state
+	proof := worldState.Prove(QuickAddress(1).String())
+	require.Error(t, proof.Verify(QuickWorldState(4, 10).HashCode()))
+}
@@ -1,9 +1,10 @@
 package common
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"sort"
 	"sync"
@@ -58,26 +59,9 @@ func (m *WorldState) Copy() *WorldState {
 	return &cp
 }
 
+// Hash returns the root of the state trie of the world state
 func (m *WorldState) Hash() []byte {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Sort the keys
-	keys := make([]string, 0, len(m.m))
-	for k := range m.m {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	h := sha256.New()
-	for _, k := range keys {
-		v := m.m[k]
-		kv, _ := json.Marshal(v)
-		h.Write([]byte(k))
-		h.Write(kv)
-	}
-
-	return h.Sum(nil)
+	return m.Root()
 }
 
 func (m *WorldState) HashCode() string {
@@ -129,10 +113,33 @@ func (m *WorldState) Equal(other *WorldState) bool {
 	return true
 }
 
+// QuickKey returns the deterministic private key of the i-th account of QuickWorldState, starting from 1, so
+// that a test can run a node owning that account
+func QuickKey(i int) *ecdsa.PrivateKey {
+	for counter := 0; ; counter++ {
+		seed := sha256.Sum256([]byte(fmt.Sprintf("quick account %d %d", i, counter)))
+		privateKey, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), seed[:])
+		if err == nil {
+			return privateKey
+		}
+	}
+}
+
+// QuickAddress returns the address of the i-th account of QuickWorldState, starting from 1
+func QuickAddress(i int) Address {
+	address, err := KeyToAddress(&QuickKey(i).PublicKey)
+	if err != nil {
+		panic(err)
+	}
+	return address
+}
+
+// QuickWorldState creates a world state with the given number of accounts and the same balance for each account,
+// the address of the i-th account is QuickAddress(i)
 func QuickWorldState(accounts int, balance int64) *WorldState {
 	worldState := NewWorldState()
 	for i := 0; i < accounts; i++ {
-		worldState.Set(fmt.Sprintf("%d", i+1), State{
+		worldState.Set(QuickAddress(i+1).String(), State{
 			Nonce:       0,
 			Balance:     balance,
 			Contract:    make([]byte, 0),
@@ -144,6 +151,42 @@ func QuickWorldState(accounts int, balance int64) *WorldState {
 	return &worldState
 }
 
+// FaucetAllocation returns a genesis allocation where the faucet is the only account, with the given balance
+func FaucetAllocation(balance int64) map[string]State {
+	return map[string]State{
+		FaucetAddress.String(): {
+			Balance: balance,
+			Tasks:   make(map[string][2]string),
+		},
+	}
+}
+
+// CountContracts returns the number of contracts published by the given account, i.e., the index of the last one
+// since the n-th contract is deployed at ContractAddress(publisher, n) after the previous ones
+func (m *WorldState) CountContracts(publisher Address) int {
+	n := 0
+	for {
+		_, ok := m.Get(ContractAddress(publisher, n+1).String())
+		if !ok {
+			return n
+		}
+		n++
+	}
+}
+
+// FindNetworkAddress returns the address of the account bound to the given network address, if any
+func (m *WorldState) FindNetworkAddress(networkAddress string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, v := range m.m {
+		if v.NetworkAddress == networkAddress {
+			return k, true
+		}
+	}
+	return "", false
+}
+
 func (m *WorldState) Print() string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
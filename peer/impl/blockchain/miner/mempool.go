@@ -0,0 +1,298 @@
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.dedis.ch/cs438/clock"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+	"go.dedis.ch/cs438/peer/impl/blockchain/transaction"
+)
+
+// maxNonceGap is how far ahead of the nonce of its account a transaction may be, the transactions in between must
+// arrive before it can be processed
+const maxNonceGap = 64
+
+// maxAccountTxs is the maximum number of transactions of an account in the mempool
+const maxAccountTxs = 32
+
+var (
+	// errMempoolFull is returned for a transaction that does not pay more than the transactions the full mempool
+	// could evict
+	errMempoolFull = errors.New("mempool full")
+
+	// errUnderpriced is returned for a transaction replacing a pending one of the same nonce without a higher fee
+	errUnderpriced = errors.New("replacement transaction underpriced")
+
+	// errNonceGap is returned for a transaction too far ahead of the nonce of its account
+	errNonceGap = errors.New("nonce too far ahead")
+
+	// errAccountFull is returned for a transaction of an account that has too many transactions in the mempool
+	errAccountFull = errors.New("too many transactions of the account")
+
+	// errUnaffordable is returned for a transaction whose sender can not pay it on top of its pending transactions
+	errUnaffordable = errors.New("insufficient balance")
+
+	// errReplaced is the reason why a transaction replaced by one of the same nonce is dropped
+	errReplaced = errors.New("replaced by a transaction of a higher fee")
+
+	// errEvicted is the reason why a transaction evicted from the full mempool is dropped
+	errEvicted = errors.New("evicted from the full mempool")
+
+	// errExpired is the reason why a transaction that has been invalid for longer than the TTL is dropped
+	errExpired = errors.New("invalid for longer than the TTL")
+
+	// errHeldExpired is the reason why a transaction that has been waiting for a missing nonce of its account for
+	// longer than the TTL is dropped
+	errHeldExpired = errors.New("held for longer than the TTL")
+)
+
+// droppedTx is a transaction dropped from the mempool, along with the reason why
+type droppedTx struct {
+	tx     *transaction.SignedTransaction
+	reason error
+}
+
+// poolEntry is a transaction of the mempool
+type poolEntry struct {
+	tx *transaction.SignedTransaction
+
+	// addedAt is the time the transaction was added to the mempool
+	addedAt time.Time
+
+	// invalidSince is the first time the transaction failed to be executed, it is zero if it has never failed
+	invalidSince time.Time
+
+	// failed is true if the transaction has failed to be executed since the last round
+	failed bool
+
+	// lastErr is the error of the last failed execution of the transaction
+	lastErr error
+}
+
+// mempool holds the transactions that are not yet included in a block. The transactions of an account are indexed
+// by their nonce, there is at most one of them per nonce. The next transaction to process is the one of the highest
+// fee among the transactions that follow the nonces of their accounts.
+// It is not thread-safe, the miner uses it under the protection of its mutex.
+type mempool struct {
+	// txs are the transactions of each account : src -> (nonce -> entry)
+	txs map[string]map[int]*poolEntry
+
+	// size is the number of transactions in the mempool
+	size int
+
+	// maxSize is the maximum number of transactions, there is no limit if it is 0
+	maxSize uint
+
+	// invalidTTL is how long a transaction that fails to be executed, or that waits for a missing nonce of its account,
+	// is kept before it is dropped
+	invalidTTL time.Duration
+
+	clock clock.Clock
+}
+
+func newMempool(maxSize uint, invalidTTL time.Duration, clock clock.Clock) *mempool {
+	return &mempool{
+		txs:        make(map[string]map[int]*poolEntry),
+		maxSize:    maxSize,
+		invalidTTL: invalidTTL,
+		clock:      clock,
+	}
+}
+
+// Len returns the number of transactions in the mempool
+func (p *mempool) Len() int {
+	return p.size
+}
+
+// Add adds a transaction to the mempool, given the world state of the tail of the chain. The transaction is rejected
+// if it is too far ahead of the nonce of its account, if its account has too many transactions in the mempool, or
+// if the balance of its sender does not cover it on top of its other transactions. A transaction of the same account
+// and nonce is replaced if the new one pays a higher fee. If the mempool is full, the transaction of the lowest fee
+// that ends the transactions of its account is evicted, unless the new transaction does not pay more. It returns the
+// replaced or evicted transaction, if any.
+func (p *mempool) Add(tx *transaction.SignedTransaction, worldState *common.WorldState) (*droppedTx, error) {
+	src := tx.TX.Src.String()
+
+	old, ok := p.txs[src][tx.TX.Nonce]
+	if ok && old.tx.HashCode() == tx.HashCode() {
+		return nil, nil
+	}
+
+	err := p.checkAccount(tx, worldState)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		if tx.TX.Fee <= old.tx.TX.Fee {
+			return nil, fmt.Errorf("%w: fee %d does not exceed fee %d of nonce %d of account %s", errUnderpriced,
+				tx.TX.Fee, old.tx.TX.Fee, tx.TX.Nonce, src)
+		}
+		p.txs[src][tx.TX.Nonce] = &poolEntry{tx: tx, addedAt: p.clock.Now()}
+		return &droppedTx{tx: old.tx, reason: errReplaced}, nil
+	}
+
+	var dropped *droppedTx
+	if p.maxSize > 0 && uint(p.size) >= p.maxSize {
+		evicted := p.evictionCandidate()
+		if evicted == nil || evicted.TX.Fee >= tx.TX.Fee {
+			return nil, fmt.Errorf("%w: %d transactions pay at least fee %d", errMempoolFull, p.size, tx.TX.Fee)
+		}
+		p.remove(evicted.TX.Src.String(), evicted.TX.Nonce)
+		dropped = &droppedTx{tx: evicted, reason: errEvicted}
+	}
+
+	if p.txs[src] == nil {
+		p.txs[src] = make(map[int]*poolEntry)
+	}
+	p.txs[src][tx.TX.Nonce] = &poolEntry{tx: tx, addedAt: p.clock.Now()}
+	p.size++
+	return dropped, nil
+}
+
+// checkAccount checks that the transaction is not too far ahead of the nonce of its account, that its account has
+// room for it, and that its sender can pay it on top of its other transactions, except the one it replaces
+func (p *mempool) checkAccount(tx *transaction.SignedTransaction, worldState *common.WorldState) error {
+	src := tx.TX.Src.String()
+	state, _ := worldState.Get(src)
+
+	if tx.TX.Nonce > state.Nonce+maxNonceGap {
+		return fmt.Errorf("%w: nonce %d of account %s at nonce %d", errNonceGap, tx.TX.Nonce, src, state.Nonce)
+	}
+
+	// The transactions of used nonces are dropped at the next round, they are not counted
+	pending := 0
+	debit := tx.Debit()
+	for nonce, entry := range p.txs[src] {
+		if nonce > state.Nonce && nonce != tx.TX.Nonce {
+			pending++
+			debit += entry.tx.Debit()
+		}
+	}
+	if pending >= maxAccountTxs {
+		return fmt.Errorf("%w: %d transactions of account %s", errAccountFull, pending, src)
+	}
+	if debit > state.Balance {
+		return fmt.Errorf("%w: account %s has %d but its transactions debit %d", errUnaffordable, src,
+			state.Balance, debit)
+	}
+	return nil
+}
+
+// evictionCandidate returns the transaction of the lowest fee among the last transactions of the accounts, so that
+// an eviction leaves no gap in the nonces of an account
+func (p *mempool) evictionCandidate() *transaction.SignedTransaction {
+	var candidate *transaction.SignedTransaction
+	for _, entries := range p.txs {
+		var last *transaction.SignedTransaction
+		for _, entry := range entries {
+			if last == nil || entry.tx.TX.Nonce > last.TX.Nonce {
+				last = entry.tx
+			}
+		}
+		if candidate == nil || last.TX.Fee < candidate.TX.Fee ||
+			(last.TX.Fee == candidate.TX.Fee && last.TX.Timestamp > candidate.TX.Timestamp) {
+			candidate = last
+		}
+	}
+	return candidate
+}
+
+// Next returns the transaction to process on the given world state, i.e., the one of the highest fee among the
+// transactions that follow the nonces of their accounts in the world state. Ties are broken by the timestamp. The
+// transactions that have failed since the last round are skipped, as well as the following ones of their accounts.
+// It returns nil if there is no such transaction. The transaction stays in the mempool until it is removed.
+func (p *mempool) Next(worldState *common.WorldState) *transaction.SignedTransaction {
+	var next *poolEntry
+	for src, entries := range p.txs {
+		nonce := 1
+		state, ok := worldState.Get(src)
+		if ok {
+			nonce = state.Nonce + 1
+		}
+
+		entry, ok := entries[nonce]
+		if !ok || entry.failed {
+			continue
+		}
+		if next == nil || entry.tx.TX.Fee > next.tx.TX.Fee ||
+			(entry.tx.TX.Fee == next.tx.TX.Fee && entry.tx.TX.Timestamp < next.tx.TX.Timestamp) {
+			next = entry
+		}
+	}
+	if next == nil {
+		return nil
+	}
+	return next.tx
+}
+
+// Remove removes a transaction from the mempool, e.g., once it has been executed
+func (p *mempool) Remove(tx *transaction.SignedTransaction) {
+	entry, ok := p.txs[tx.TX.Src.String()][tx.TX.Nonce]
+	if ok && entry.tx.HashCode() == tx.HashCode() {
+		p.remove(tx.TX.Src.String(), tx.TX.Nonce)
+	}
+}
+
+// Fail marks a transaction of the mempool that has failed to be executed with the given error, it is skipped until
+// the next round. It is dropped once it has been failing for longer than the TTL of invalid transactions.
+func (p *mempool) Fail(tx *transaction.SignedTransaction, err error) {
+	entry, ok := p.txs[tx.TX.Src.String()][tx.TX.Nonce]
+	if !ok || entry.tx.HashCode() != tx.HashCode() {
+		return
+	}
+	if entry.invalidSince.IsZero() {
+		entry.invalidSince = p.clock.Now()
+	}
+	entry.failed = true
+	entry.lastErr = err
+}
+
+// NewRound starts a new round of processing on the given world state, i.e., on the state of the tail of the chain.
+// The transactions whose nonces have been used are dropped, as well as the ones that have been invalid for longer
+// than the TTL and the ones held behind a missing nonce of their account for longer than the TTL since they were
+// added. The other failed transactions can be processed again. It returns the dropped transactions.
+func (p *mempool) NewRound(worldState *common.WorldState) []droppedTx {
+	dropped := make([]droppedTx, 0)
+	for src, entries := range p.txs {
+		state, _ := worldState.Get(src)
+
+		// The transactions after the first missing nonce are held until it arrives
+		missing := state.Nonce + 1
+		for entries[missing] != nil {
+			missing++
+		}
+
+		for nonce, entry := range entries {
+			switch {
+			case nonce <= state.Nonce:
+				dropped = append(dropped, droppedTx{tx: entry.tx,
+					reason: fmt.Errorf("%w: nonce %d of account %s", transaction.ErrStaleNonce, nonce, src)})
+			case !entry.invalidSince.IsZero() && p.clock.Since(entry.invalidSince) > p.invalidTTL:
+				dropped = append(dropped, droppedTx{tx: entry.tx, reason: fmt.Errorf("%w: %v", errExpired, entry.lastErr)})
+			case nonce > missing && p.clock.Since(entry.addedAt) > p.invalidTTL:
+				dropped = append(dropped, droppedTx{tx: entry.tx,
+					reason: fmt.Errorf("%w: nonce %d of account %s is missing", errHeldExpired, missing, src)})
+			default:
+				entry.failed = false
+				continue
+			}
+			p.remove(src, nonce)
+		}
+	}
+	return dropped
+}
+
+// remove removes the transaction of the given account and nonce
+func (p *mempool) remove(src string, nonce int) {
+	if _, ok := p.txs[src][nonce]; !ok {
+		return
+	}
+	delete(p.txs[src], nonce)
+	if len(p.txs[src]) == 0 {
+		delete(p.txs, src)
+	}
+	p.size--
+}
@@ -0,0 +1,228 @@
+package miner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/clock/system"
+	"go.dedis.ch/cs438/clock/virtual"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+	"go.dedis.ch/cs438/peer/impl/blockchain/transaction"
+)
+
+// newPoolTx signs a transfer of account i with the given nonce and fee
+func newPoolTx(t *testing.T, i int, nonce int, fee int64) *transaction.SignedTransaction {
+	rawTx := transaction.NewTransferTX(common.QuickAddress(i), common.QuickAddress(i%3+1), 1, nonce)
+	rawTx.Fee = fee
+	signedTx, err := rawTx.Sign(common.QuickKey(i))
+	require.NoError(t, err)
+	return &signedTx
+}
+
+// add adds a transaction to the mempool, and returns the transaction it replaced or evicted
+func add(t *testing.T, p *mempool, worldState *common.WorldState, tx *transaction.SignedTransaction) *droppedTx {
+	dropped, err := p.Add(tx, worldState)
+	require.NoError(t, err)
+	return dropped
+}
+
+// execute executes the next transaction of the mempool on the world state, and returns it
+func execute(t *testing.T, p *mempool, worldState *common.WorldState) *transaction.SignedTransaction {
+	tx := p.Next(worldState)
+	require.NotNil(t, tx)
+	require.NoError(t, transaction.VerifyAndExecuteTransaction(tx, worldState))
+	p.Remove(tx)
+	return tx
+}
+
+// Test_Mempool_Priority tests that the transactions are processed by decreasing fee, in the order of the nonces of
+// each account
+func Test_Mempool_Priority(t *testing.T) {
+	worldState := common.QuickWorldState(3, 10)
+	p := newMempool(0, time.Minute, system.NewClock())
+
+	tx11 := newPoolTx(t, 1, 1, 1)
+	tx12 := newPoolTx(t, 1, 2, 5)
+	tx21 := newPoolTx(t, 2, 1, 3)
+	tx31 := newPoolTx(t, 3, 1, 0)
+	for _, tx := range []*transaction.SignedTransaction{tx12, tx31, tx21, tx11} {
+		require.Nil(t, add(t, p, worldState, tx))
+	}
+	require.Nil(t, add(t, p, worldState, tx11))
+	require.Equal(t, 4, p.Len())
+
+	// The fee of the second transaction of account 1 does not make it jump ahead of the first one
+	require.Equal(t, tx21, execute(t, p, worldState))
+	require.Equal(t, tx11, execute(t, p, worldState))
+	require.Equal(t, tx12, execute(t, p, worldState))
+	require.Equal(t, tx31, execute(t, p, worldState))
+	require.Nil(t, p.Next(worldState))
+	require.Equal(t, 0, p.Len())
+
+	// A transaction ahead of the nonce of its account is held until its predecessor arrives
+	tx14 := newPoolTx(t, 1, 4, 1)
+	require.Nil(t, add(t, p, worldState, tx14))
+	require.Nil(t, p.Next(worldState))
+	tx13 := newPoolTx(t, 1, 3, 0)
+	require.Nil(t, add(t, p, worldState, tx13))
+	require.Equal(t, tx13, execute(t, p, worldState))
+	require.Equal(t, tx14, execute(t, p, worldState))
+}
+
+// Test_Mempool_Replace tests that a pending transaction is only replaced by a transaction of the same nonce that
+// pays a higher fee
+func Test_Mempool_Replace(t *testing.T) {
+	worldState := common.QuickWorldState(3, 10)
+	p := newMempool(0, time.Minute, system.NewClock())
+
+	stuck := newPoolTx(t, 1, 1, 1)
+	require.Nil(t, add(t, p, worldState, stuck))
+
+	_, err := p.Add(newPoolTx(t, 1, 1, 1), worldState)
+	require.ErrorIs(t, err, errUnderpriced)
+	_, err = p.Add(newPoolTx(t, 1, 1, 0), worldState)
+	require.ErrorIs(t, err, errUnderpriced)
+
+	replacement := newPoolTx(t, 1, 1, 2)
+	require.Equal(t, &droppedTx{tx: stuck, reason: errReplaced}, add(t, p, worldState, replacement))
+	require.Equal(t, 1, p.Len())
+	require.Equal(t, replacement, p.Next(worldState))
+
+	// The replaced transaction is not removed in place of its replacement
+	p.Remove(stuck)
+	require.Equal(t, 1, p.Len())
+}
+
+// Test_Mempool_Eviction tests that a full mempool evicts the last transaction of the account of the lowest fee,
+// and rejects a transaction that does not pay more
+func Test_Mempool_Eviction(t *testing.T) {
+	worldState := common.QuickWorldState(3, 10)
+	p := newMempool(3, time.Minute, system.NewClock())
+
+	tx11 := newPoolTx(t, 1, 1, 0)
+	tx12 := newPoolTx(t, 1, 2, 4)
+	tx21 := newPoolTx(t, 2, 1, 2)
+	for _, tx := range []*transaction.SignedTransaction{tx11, tx12, tx21} {
+		require.Nil(t, add(t, p, worldState, tx))
+	}
+
+	// The lowest fee is the one of tx11, but evicting it would leave tx12 stuck, tx21 is evicted instead
+	_, err := p.Add(newPoolTx(t, 3, 1, 2), worldState)
+	require.ErrorIs(t, err, errMempoolFull)
+	tx31 := newPoolTx(t, 3, 1, 3)
+	require.Equal(t, &droppedTx{tx: tx21, reason: errEvicted}, add(t, p, worldState, tx31))
+	require.Equal(t, 3, p.Len())
+
+	require.Equal(t, tx31, execute(t, p, worldState))
+	require.Equal(t, tx11, execute(t, p, worldState))
+	require.Equal(t, tx12, execute(t, p, worldState))
+	require.Nil(t, p.Next(worldState))
+}
+
+// Test_Mempool_Invalid tests that a failed transaction is skipped until the next round, that it is dropped once
+// it has been failing for longer than the TTL, and that the transactions of used nonces are dropped
+func Test_Mempool_Invalid(t *testing.T) {
+	worldState := common.QuickWorldState(3, 10)
+	clock := virtual.NewClock(time.Now())
+	p := newMempool(0, time.Millisecond*100, clock)
+
+	// Account 4 does not exist, the transfer to it fails
+	rawTx := transaction.NewTransferTX(common.QuickAddress(1), common.QuickAddress(4), 1, 1)
+	invalid, err := rawTx.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+	tx21 := newPoolTx(t, 2, 1, 0)
+	require.Nil(t, add(t, p, worldState, &invalid))
+	require.Nil(t, add(t, p, worldState, tx21))
+
+	require.Equal(t, &invalid, p.Next(worldState))
+	err = transaction.VerifyAndExecuteTransaction(&invalid, worldState)
+	require.Error(t, err)
+	p.Fail(&invalid, err)
+	require.Equal(t, tx21, execute(t, p, worldState))
+	require.Nil(t, p.Next(worldState))
+
+	// The next round retries it, the executed transaction is not part of it anymore
+	require.Empty(t, p.NewRound(worldState))
+	require.Equal(t, &invalid, p.Next(worldState))
+	p.Fail(&invalid, err)
+
+	clock.Advance(time.Millisecond * 150)
+	dropped := p.NewRound(worldState)
+	require.Len(t, dropped, 1)
+	require.Equal(t, &invalid, dropped[0].tx)
+	require.ErrorIs(t, dropped[0].reason, errExpired)
+	require.Contains(t, dropped[0].reason.Error(), err.Error())
+	require.Equal(t, 0, p.Len())
+
+	// A transaction whose nonce has been used by another one is dropped
+	require.Nil(t, add(t, p, worldState, newPoolTx(t, 2, 1, 5)))
+	require.Nil(t, add(t, p, worldState, newPoolTx(t, 2, 2, 0)))
+	dropped = p.NewRound(worldState)
+	require.Len(t, dropped, 1)
+	require.ErrorIs(t, dropped[0].reason, transaction.ErrStaleNonce)
+	require.Equal(t, 1, p.Len())
+}
+
+// Test_Mempool_Account_Limits tests that the transactions of an account are rejected when they are too far ahead of
+// its nonce, when the account has too many of them, or when its balance does not cover them
+func Test_Mempool_Account_Limits(t *testing.T) {
+	worldState := common.QuickWorldState(3, 10)
+	p := newMempool(0, time.Minute, system.NewClock())
+
+	_, err := p.Add(newPoolTx(t, 1, maxNonceGap+1, 0), worldState)
+	require.ErrorIs(t, err, errNonceGap)
+
+	// Each transfer debits its fee and its value, i.e., 2
+	for nonce := 1; nonce <= 5; nonce++ {
+		require.Nil(t, add(t, p, worldState, newPoolTx(t, 1, nonce, 1)))
+	}
+	_, err = p.Add(newPoolTx(t, 1, 6, 1), worldState)
+	require.ErrorIs(t, err, errUnaffordable)
+	_, err = p.Add(newPoolTx(t, 1, 5, 2), worldState)
+	require.ErrorIs(t, err, errUnaffordable)
+	require.Equal(t, 5, p.Len())
+
+	worldState = common.QuickWorldState(3, 1000)
+	for nonce := 1; nonce <= maxAccountTxs; nonce++ {
+		require.Nil(t, add(t, p, worldState, newPoolTx(t, 2, nonce, 0)))
+	}
+	_, err = p.Add(newPoolTx(t, 2, maxAccountTxs+1, 0), worldState)
+	require.ErrorIs(t, err, errAccountFull)
+
+	// A replacement does not count as an additional transaction
+	require.NotNil(t, add(t, p, worldState, newPoolTx(t, 2, maxAccountTxs, 1)))
+	require.Equal(t, 5+maxAccountTxs, p.Len())
+}
+
+// Test_Mempool_Held tests that a transaction waiting for a missing nonce of its account is dropped once it has been
+// held for longer than the TTL since it was added, while the transactions that can be processed are kept
+func Test_Mempool_Held(t *testing.T) {
+	worldState := common.QuickWorldState(3, 10)
+	clock := virtual.NewClock(time.Now())
+	p := newMempool(0, time.Millisecond*100, clock)
+
+	tx11 := newPoolTx(t, 1, 1, 0)
+	tx13 := newPoolTx(t, 1, 3, 0)
+	require.Nil(t, add(t, p, worldState, tx11))
+	require.Nil(t, add(t, p, worldState, tx13))
+
+	clock.Advance(time.Millisecond * 50)
+	tx23 := newPoolTx(t, 2, 3, 0)
+	require.Nil(t, add(t, p, worldState, tx23))
+	require.Empty(t, p.NewRound(worldState))
+
+	// The TTL of the held transaction of account 2 is measured from when it was added
+	clock.Advance(time.Millisecond * 60)
+	dropped := p.NewRound(worldState)
+	require.Len(t, dropped, 1)
+	require.Equal(t, tx13, dropped[0].tx)
+	require.ErrorIs(t, dropped[0].reason, errHeldExpired)
+	require.Equal(t, 2, p.Len())
+
+	clock.Advance(time.Millisecond * 50)
+	dropped = p.NewRound(worldState)
+	require.Len(t, dropped, 1)
+	require.Equal(t, tx23, dropped[0].tx)
+	require.Equal(t, tx11, execute(t, p, worldState))
+}
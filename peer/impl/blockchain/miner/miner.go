@@ -2,6 +2,7 @@ package miner
 
 import (
 	"context"
+	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"go.dedis.ch/cs438/peer"
@@ -30,18 +31,31 @@ type Miner struct {
 	chain         *block.Chain
 	tmpWorldState common.WorldState
 
-	// Txs that are not verified and executed
-	txPending common.SafeQueue[*transaction.SignedTransaction]
+	// Txs that are not yet verified and executed, including the ones that are currently invalid and the ones whose
+	// nonce is ahead of the next nonce of their account
+	txPool *mempool
 
 	// Txs that are verified and executed. These txs will be included in the next block.
 	txProcessed common.SafeQueue[*transaction.SignedTransaction]
 
-	// Txs that are currently invalid. These txs will be processed again later.
-	txInvalid common.SafeQueue[*transaction.SignedTransaction]
+	// receipts are the receipts of the txs that failed or were dropped by this miner : txHash -> receipt. The
+	// receipts of the txs included in blocks are kept by the chain.
+	receipts map[string]*block.Receipt
+
+	// receiptSubs are the channels of the subscriptions to the receipts : subscription ID -> channel
+	receiptSubs    map[int]chan *block.Receipt
+	nextReceiptSub int
 
 	// blockBuffer is a buffer map for blocks that are still not appended : block.id -> (blockHash -> block)
 	blockBuffer map[uint32]map[string]*block.Block
 
+	// challenges are the reply channels of the pending declaration challenges : requestID -> chan []byte
+	challenges sync.Map
+
+	// syncTarget is the ID of the last block requested to catch up with a peer, at syncTime
+	syncTarget uint32
+	syncTime   time.Time
+
 	// blockNotificationCh is a map from blockID to its corresponding channel,
 	// used to notify and terminate unnecessary block forming and mining
 	blockNotificationCh map[int]chan struct{}
@@ -61,21 +75,45 @@ func NewMiner(conf *peer.Configuration, message *message.Message,
 	m.consensus = consensus
 	m.blockNameStorage = storage
 
-	m.address = common.Address{HexString: message.GetConf().BlockchainAccountAddress}
-	m.chain = block.NewChain(m.address, m.GetConf().BlockchainDifficulty, m.GetConf().BlockchainInitialState)
+	address, err := common.ParseAddress(message.GetConf().BlockchainAccountAddress)
+	if err != nil {
+		panic(fmt.Errorf("invalid BlockchainAccountAddress: %v", err))
+	}
+	m.address = address
 	m.logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr}).With().Str("account", m.address.String()).Logger()
 
+	// The chain is persisted in the blockchain store, the blocks of a previous run are reloaded
+	difficulty := block.DifficultyPolicy{
+		Initial:   block.DifficultyOfBits(m.GetConf().BlockchainDifficulty),
+		Interval:  m.GetConf().BlockchainRetargetInterval,
+		BlockTime: m.GetConf().BlockchainTargetBlockTime,
+	}
+	m.chain, err = block.LoadChain(m.address, difficulty, m.GetConf().BlockchainBlockReward,
+		m.GetConf().BlockchainInitialState, storage.GetBlockchainStore())
+	if err != nil {
+		m.logger.Error().Err(err).Uint32("tailID", m.chain.Tail.ID).Msg("fail to reload the whole stored chain")
+	}
+
 	m.tmpWorldState = common.NewWorldState()
 
-	m.txPending = common.NewSafeQueue[*transaction.SignedTransaction]()
+	m.txPool = newMempool(m.GetConf().BlockchainMempoolSize, m.GetConf().BlockchainInvalidTxTTL,
+		m.GetConf().Clock)
 	m.txProcessed = common.NewSafeQueue[*transaction.SignedTransaction]()
-	m.txInvalid = common.NewSafeQueue[*transaction.SignedTransaction]()
+	m.receipts = make(map[string]*block.Receipt)
+	m.receiptSubs = make(map[int]chan *block.Receipt)
 	m.blockBuffer = make(map[uint32]map[string]*block.Block)
 	m.blockNotificationCh = make(map[int]chan struct{})
-	m.blockNotificationCh[1] = make(chan struct{})
+	m.blockNotificationCh[int(m.chain.Tail.ID+1)] = make(chan struct{})
 
 	m.message.GetConf().MessageRegistry.RegisterMessageCallback(types.TransactionMessage{}, m.execTransactionMessage)
 	m.message.GetConf().MessageRegistry.RegisterMessageCallback(types.BlockMessage{}, m.execBlockMessage)
+	m.message.GetConf().MessageRegistry.RegisterMessageCallback(types.ChainTipMessage{}, m.execChainTipMessage)
+	m.message.GetConf().MessageRegistry.RegisterMessageCallback(types.BlockRangeRequestMessage{},
+		m.execBlockRangeRequestMessage)
+	m.message.GetConf().MessageRegistry.RegisterMessageCallback(types.BlockRangeReplyMessage{},
+		m.execBlockRangeReplyMessage)
+	m.message.GetConf().MessageRegistry.RegisterMessageCallback(types.DeclarationChallengeReplyMessage{},
+		m.execDeclarationChallengeReplyMessage)
 	m.wg = sync.WaitGroup{}
 
 	return &m
@@ -89,6 +127,11 @@ func (m *Miner) Start() {
 	m.wg.Add(1)
 	go m.txProcessingDaemon()
 
+	if m.conf.BlockchainSyncInterval > 0 {
+		m.wg.Add(1)
+		go m.chainSyncDaemon()
+	}
+
 	m.logger.Debug().Msg("started miner")
 }
 
@@ -1,9 +1,11 @@
 package miner
 
 import (
+	"errors"
 	"fmt"
 	"go.dedis.ch/cs438/peer/impl/blockchain/block"
 	"go.dedis.ch/cs438/peer/impl/blockchain/transaction"
+	"go.dedis.ch/cs438/transport"
 	"go.dedis.ch/cs438/types"
 	"sort"
 	"time"
@@ -35,9 +37,10 @@ func (m *Miner) txProcessingDaemon() {
 
 			// 4. Proof of work
 			start := time.Now()
-			m.logger.Debug().Uint32("blockID", preparingBlockID).Msg("block formed, begin Proof of Work...")
+			m.logger.Debug().Uint32("blockID", preparingBlockID).Uint64("difficulty", b.Difficulty).
+				Msg("block formed, begin Proof of Work...")
 
-			err := b.ProofOfWork(m.GetConf().BlockchainDifficulty, m.GetContext(), notifyCh)
+			err := b.ProofOfWork(m.GetContext(), notifyCh)
 			if err != nil {
 				m.revertBlock(b)
 				m.logger.Debug().Uint32("blockID", preparingBlockID).Str("reason", err.Error()).Msg("Proof of Work failed")
@@ -97,16 +100,16 @@ func (m *Miner) processTxs(notifyCh chan struct{}) {
 	}
 }
 
-// processOneTx retrieve one transaction from miner's txPending and verify and execute it
+// processOneTx retrieve the next transaction from miner's txPool and verify and execute it
 func (m *Miner) processOneTx() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.txPending.IsEmpty() {
+	tx := m.txPool.Next(&m.tmpWorldState)
+	if tx == nil {
 		return
 	}
 
-	tx := m.txPending.Dequeue()
 	err := transaction.VerifyAndExecuteTransaction(tx, &(m.tmpWorldState))
 
 	if err == nil {
@@ -120,6 +123,7 @@ func (m *Miner) processOneTx() {
 			m.logger.Debug().Msg("peer leaved")
 		}
 
+		m.txPool.Remove(tx)
 		m.txProcessed.Enqueue(tx)
 		m.logger.Debug().
 			Int("nextBlockID", int(m.chain.Tail.ID+1)).
@@ -132,8 +136,19 @@ func (m *Miner) processOneTx() {
 			//Str("code", tx.TX.Code).
 			Str("data", tx.TX.Data).
 			Msg("enqueue a confirmed transaction")
+	} else if errors.Is(err, transaction.ErrStaleNonce) {
+		// The nonce has already been used, the transaction can never be executed
+		m.txPool.Remove(tx)
+		m.recordFailure(tx, block.ReceiptDropped, err)
+		m.logger.Debug().
+			Err(err).
+			Str("src", tx.TX.Src.String()).
+			Int("nonce", tx.TX.Nonce).
+			Msg("discard a transaction with a stale nonce")
 	} else {
-		m.txInvalid.Enqueue(tx)
+		// The transaction may become valid later, e.g., once its destination account is declared
+		m.txPool.Fail(tx, err)
+		m.recordFailure(tx, block.ReceiptInvalid, err)
 		m.logger.Debug().
 			Err(err).
 			Int("nextBlockID", int(m.chain.Tail.ID+1)).
@@ -162,68 +177,96 @@ func (m *Miner) formBlock(preparingBlockID uint32) *block.Block {
 	b := m.chain.NextBlock()
 
 	// Add all processed txs
+	fees := int64(0)
 	for !m.txProcessed.IsEmpty() {
 		tx := m.txProcessed.Dequeue()
 		b.TXs = append(b.TXs, tx)
+		fees += tx.TX.Fee
 	}
 
 	b.State = *m.tmpWorldState.Copy()
 
+	// The coinbase pays the block reward and the fees to this miner
+	value := m.chain.Reward + fees
+	if value > 0 {
+		coinbase := transaction.NewCoinbaseTX(m.address, value, b.ID)
+		err := transaction.ExecuteCoinbaseTransaction(&coinbase, &b.State)
+		if err != nil {
+			m.logger.Error().Err(err).Msg("fail to execute the coinbase transaction")
+			return nil
+		}
+		b.TXs = append(b.TXs, &coinbase)
+	}
+
+	// The header commits to the transactions and the world state, it is the part covered by the proof of work
+	b.TXHash = block.ComputeTXHash(b.TXs)
+	b.StateHash = b.State.HashCode()
+
 	return b
 }
 
 // cleanTxPool will clean the transaction pool based on current blockchain.
 // It must be called under an outlier protection of mutex
 func (m *Miner) cleanTxPool() {
-
-	tmp := make([]*transaction.SignedTransaction, 0)
-
-	for !m.txPending.IsEmpty() {
-		tmp = append(tmp, m.txPending.Dequeue())
-	}
+	// The processed txs that have not been included in a block are processed again
 	for !m.txProcessed.IsEmpty() {
-		tmp = append(tmp, m.txProcessed.Dequeue())
-	}
-	for !m.txInvalid.IsEmpty() {
-		tmp = append(tmp, m.txInvalid.Dequeue())
-	}
-
-	cleaned := make([]*transaction.SignedTransaction, 0)
-	for _, tx := range tmp {
+		tx := m.txProcessed.Dequeue()
 		if !m.chain.HasTransactionHash(tx.HashCode()) {
-			cleaned = append(cleaned, tx)
+			m.addToTxPool(tx)
 		}
 	}
 
-	// Sort the cleaned txs based on their timestamp and nonce
-	sort.Slice(cleaned, func(i, j int) bool {
-		if cleaned[i].TX.Src.String() == cleaned[j].TX.Src.String() {
-			return cleaned[i].TX.Nonce < cleaned[j].TX.Nonce
-		}
-		return cleaned[i].TX.Timestamp < cleaned[j].TX.Timestamp
-	})
-
-	// Put all cleaned txs back to txPending
-	for _, tx := range cleaned {
-		m.txPending.Enqueue(tx)
+	// The txs whose nonces have been used on the chain, and the ones that are invalid for too long, are dropped
+	dropped := m.txPool.NewRound(&m.chain.Tail.State)
+	for _, d := range dropped {
+		m.recordFailure(d.tx, block.ReceiptDropped, d.reason)
 	}
 
 	m.resetTmpWorldState()
 
 	m.logger.Debug().
-		Uint("#txPending", m.txPending.Len()).
+		Int("#txPool", m.txPool.Len()).
+		Int("#dropped", len(dropped)).
 		Int("nextBlockID", int(m.chain.Tail.ID+1)).
 		Msg("transaction pool cleaned")
 }
 
+// addToTxPool adds a transaction to the transaction pool, it may be rejected if the pool is full, if it does not
+// pay more than the pending transaction of the same nonce, or if its account can not have it pending on the state of
+// the tail of the chain. The rejected, replaced and evicted txs are dropped.
+// It must be called under an outlier protection of mutex
+func (m *Miner) addToTxPool(tx *transaction.SignedTransaction) {
+	dropped, err := m.txPool.Add(tx, &m.chain.Tail.State)
+	if err != nil {
+		m.logger.Debug().Err(err).
+			Str("src", tx.TX.Src.String()).
+			Int("nonce", tx.TX.Nonce).
+			Int64("fee", tx.TX.Fee).
+			Msg("drop a transaction rejected by the mempool")
+		m.recordFailure(tx, block.ReceiptDropped, err)
+		return
+	}
+	if dropped != nil {
+		m.logger.Debug().Err(dropped.reason).
+			Str("src", dropped.tx.TX.Src.String()).
+			Int("nonce", dropped.tx.TX.Nonce).
+			Int64("fee", dropped.tx.TX.Fee).
+			Msg("drop a transaction of the mempool")
+		m.recordFailure(dropped.tx, block.ReceiptDropped, dropped.reason)
+	}
+}
+
 func (m *Miner) revertBlock(b *block.Block) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Put all processed txs in this block back to txPending
+	// Put all processed txs in this block back to txPool, the coinbase is formed again with the next block
 	for _, tx := range b.TXs {
+		if tx.TX.Type == transaction.CoinbaseTx {
+			continue
+		}
 		if !m.chain.HasTransactionHash(tx.HashCode()) {
-			m.txPending.Enqueue(tx)
+			m.addToTxPool(tx)
 		}
 	}
 }
@@ -241,13 +284,24 @@ func (m *Miner) IsBlockBuffered(nextID uint32) bool {
 	return false
 }
 
-func (m *Miner) processBlock(blockMsg *types.BlockMessage) {
+func (m *Miner) processBlock(blockMsg *types.BlockMessage, pkt transport.Packet) {
 	// m.mu.Lock() must be done by the caller
 
 	// Recover the real block from TransBlock
 	b := blockMsg.TransBlock.GetBlock()
 
-	// Add the new block to the buffer
+	// The blocks between the tail and the received block are missing, request them from its sender
+	if b.ID > m.chain.Tail.ID+1 && pkt.Header.Source != m.message.GetConf().Socket.GetAddress() {
+		m.requestBlocks(pkt.Header.Source, pkt.Header.RelayedBy, m.chain.Tail.ID+1, b.ID-1)
+	}
+
+	m.bufferBlock(b)
+	m.blockAppendingLoop()
+}
+
+// bufferBlock adds the received block to the buffer of the blocks that are not yet appended.
+// It must be called under an outlier protection of mutex
+func (m *Miner) bufferBlock(b *block.Block) {
 	if _, ok := m.blockBuffer[b.ID]; !ok {
 		m.blockBuffer[b.ID] = make(map[string]*block.Block)
 	}
@@ -262,8 +316,6 @@ func (m *Miner) processBlock(blockMsg *types.BlockMessage) {
 		Int("#conflictBlocks", len(m.blockBuffer[b.ID])).
 		Int("#tx", len(b.TXs)).
 		Msgf("buffered a received block")
-
-	m.blockAppendingLoop()
 }
 
 func (m *Miner) blockAppendingLoop() {
@@ -341,30 +393,44 @@ func (m *Miner) blockAppendingLoop() {
 			continue
 		}
 		// Try to append the next block
-		err := m.chain.CheckNewBlock(nextBlock)
-		if err != nil {
-			m.logger.Debug().Err(err).
-				Uint32("blockID", nextBlock.ID).
-				Str("creator", nextBlock.Creator.String()).
-				Str("blockHash", nextBlock.BlockHash[:10]).
-				Str("prevHash", nextBlock.PrevHash[:10]).
-				Uint64("timestamp", nextBlock.Timestamp).
-				Int("#tx", len(nextBlock.TXs)).Msg("appending block failed")
-			return
-		}
-		// Append the new block
-		err = m.chain.AppendBlock(nextBlock)
+		err := m.appendNextBlock(nextBlock)
 		if err != nil {
 			return
 		}
-		m.logger.Debug().
-			Uint32("blockID", nextBlock.ID).Str("creator", nextBlock.Creator.String()).
-			Str("blockHash", nextBlock.BlockHash[:10]).Str("prevHash", nextBlock.PrevHash[:10]).
-			Uint64("timestamp", nextBlock.Timestamp).Int("#tx", len(nextBlock.TXs)).
-			Msg("new block appended")
-		// Notify the completion of this block
-		close(m.blockNotificationCh[int(nextBlock.ID)])
-		// Create the channel for the next block
-		m.blockNotificationCh[int(nextBlock.ID+1)] = make(chan struct{})
 	}
 }
+
+// appendNextBlock checks and appends the block that follows the tail of the chain, and notifies its completion.
+// It must be called under an outlier protection of mutex
+func (m *Miner) appendNextBlock(nextBlock *block.Block) error {
+	err := m.chain.CheckNewBlock(nextBlock)
+	if err != nil {
+		m.logger.Debug().Err(err).
+			Uint32("blockID", nextBlock.ID).
+			Str("creator", nextBlock.Creator.String()).
+			Str("blockHash", nextBlock.BlockHash[:10]).
+			Str("prevHash", nextBlock.PrevHash[:10]).
+			Uint64("timestamp", nextBlock.Timestamp).
+			Int("#tx", len(nextBlock.TXs)).Msg("appending block failed")
+		return err
+	}
+	// Append the new block
+	err = m.chain.AppendBlock(nextBlock)
+	if err != nil {
+		return err
+	}
+	m.logger.Debug().
+		Uint32("blockID", nextBlock.ID).Str("creator", nextBlock.Creator.String()).
+		Str("blockHash", nextBlock.BlockHash[:10]).Str("prevHash", nextBlock.PrevHash[:10]).
+		Uint64("timestamp", nextBlock.Timestamp).Int("#tx", len(nextBlock.TXs)).
+		Msg("new block appended")
+	// Deliver the receipts of the transactions of the block
+	for _, receipt := range nextBlock.Receipts {
+		m.publishReceipt(receipt)
+	}
+	// Notify the completion of this block
+	close(m.blockNotificationCh[int(nextBlock.ID)])
+	// Create the channel for the next block
+	m.blockNotificationCh[int(nextBlock.ID+1)] = make(chan struct{})
+	return nil
+}
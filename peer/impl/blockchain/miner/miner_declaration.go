@@ -0,0 +1,90 @@
+package miner
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/xid"
+	"go.dedis.ch/cs438/peer/impl/blockchain/block"
+	"go.dedis.ch/cs438/peer/impl/blockchain/transaction"
+	"go.dedis.ch/cs438/types"
+)
+
+// declarationChallengeTimeout is how long a miner waits for the peer at the network address bound by a declaration
+// to answer its challenge
+const declarationChallengeTimeout = 5 * time.Second
+
+// errUnprovenDeclaration is the reason why a declaration whose network address is not proven to be the one of its
+// account is dropped
+var errUnprovenDeclaration = errors.New("network address not proven to belong to the account")
+
+// admitDeclaration adds an account join declaration that binds a network address to the mempool, once the peer at
+// the network address has proven that it holds the key of the account. Otherwise, any key could take the network
+// address of another peer first, and the rewards sent to the account of that address. A miner only includes the
+// declarations it has verified.
+func (m *Miner) admitDeclaration(tx *transaction.SignedTransaction, relay string) {
+	defer m.wg.Done()
+
+	err := m.challengeDeclaration(tx, relay)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		m.logger.Warn().Err(err).
+			Str("src", tx.TX.Src.String()).
+			Str("networkAddress", tx.NetworkBinding()).
+			Msg("drop an unproven account join declaration")
+		m.recordFailure(tx, block.ReceiptDropped, err)
+		return
+	}
+	m.addToTxPool(tx)
+}
+
+// challengeDeclaration sends a random nonce to the network address bound by the declaration, and checks that the
+// reply is signed with the key of the declared account. The declarations of the network address of this node are
+// checked against its own account.
+func (m *Miner) challengeDeclaration(tx *transaction.SignedTransaction, relay string) error {
+	networkAddress := tx.NetworkBinding()
+	if networkAddress == m.GetConf().Socket.GetAddress() {
+		if !tx.TX.Src.Equals(m.address) {
+			return fmt.Errorf("%w: %s is the address of account %s", errUnprovenDeclaration, networkAddress,
+				m.address.String())
+		}
+		return nil
+	}
+
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	challengeMsg := types.DeclarationChallengeMessage{
+		RequestID: xid.New().String(),
+		Account:   tx.TX.Src.String(),
+		Nonce:     nonce,
+	}
+
+	// The reply channel receives the signature of the challenged peer, if any
+	replyChan := make(chan []byte, 1)
+	m.challenges.Store(challengeMsg.RequestID, replyChan)
+	defer m.challenges.Delete(challengeMsg.RequestID)
+
+	err = m.sendPeerMessage(networkAddress, relay, challengeMsg)
+	if err != nil {
+		return fmt.Errorf("%w: fail to challenge %s: %v", errUnprovenDeclaration, networkAddress, err)
+	}
+
+	select {
+	case signature := <-replyChan:
+		err = tx.VerifyChallenge(nonce, signature)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errUnprovenDeclaration, err)
+		}
+		return nil
+	case <-m.GetConf().Clock.After(declarationChallengeTimeout):
+		return fmt.Errorf("%w: %s did not answer the challenge", errUnprovenDeclaration, networkAddress)
+	}
+}
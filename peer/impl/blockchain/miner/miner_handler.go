@@ -1,12 +1,13 @@
 package miner
 
 import (
+	"go.dedis.ch/cs438/peer/impl/blockchain/block"
 	"go.dedis.ch/cs438/transport"
 	"go.dedis.ch/cs438/types"
 	"golang.org/x/xerrors"
 )
 
-func (m *Miner) execTransactionMessage(msg types.Message, _ transport.Packet) error {
+func (m *Miner) execTransactionMessage(msg types.Message, pkt transport.Packet) error {
 	/* cast the message to its actual type. You assume it is the right type. */
 	txMsg, ok := msg.(*types.TransactionMessage)
 	if !ok {
@@ -14,16 +15,30 @@ func (m *Miner) execTransactionMessage(msg types.Message, _ transport.Packet) er
 	}
 
 	// Verify the signature upon receiving the signed TransactionMessage
+	err := txMsg.SignedTX.Verify()
+	if err != nil {
+		m.logger.Debug().Err(err).Str("src", txMsg.SignedTX.TX.Src.String()).
+			Msg("drop a transaction with an invalid signature")
+		return nil
+	}
+
+	// The peer at the network address bound by a declaration must prove that it holds the key of the account, the
+	// challenge is not awaited here since its reply is received by the same listening loop
+	if txMsg.SignedTX.NetworkBinding() != "" {
+		m.wg.Add(1)
+		go m.admitDeclaration(&txMsg.SignedTX, pkt.Header.RelayedBy)
+		return nil
+	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.txPending.Enqueue(&txMsg.SignedTX)
+	m.addToTxPool(&txMsg.SignedTX)
 
 	return nil
 }
 
-func (m *Miner) execBlockMessage(msg types.Message, _ transport.Packet) error {
+func (m *Miner) execBlockMessage(msg types.Message, pkt transport.Packet) error {
 	/* cast the message to its actual type. You assume it is the right type. */
 	blockMsg, ok := msg.(*types.BlockMessage)
 	if !ok {
@@ -33,7 +48,89 @@ func (m *Miner) execBlockMessage(msg types.Message, _ transport.Packet) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.processBlock(blockMsg)
+	m.processBlock(blockMsg, pkt)
+
+	return nil
+}
+
+func (m *Miner) execChainTipMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	tipMsg, ok := msg.(*types.ChainTipMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The chain of the neighbor is longer, request the missing blocks
+	if tipMsg.Height > m.chain.Tail.ID {
+		m.requestBlocks(pkt.Header.Source, pkt.Header.RelayedBy, m.chain.Tail.ID+1, tipMsg.Height)
+	}
+
+	return nil
+}
+
+func (m *Miner) execBlockRangeRequestMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	requestMsg, ok := msg.(*types.BlockRangeRequestMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	// An inverted range would wrap around to a range of the maximum size
+	if requestMsg.To < requestMsg.From {
+		m.logger.Warn().
+			Str("peer", pkt.Header.Source).
+			Uint32("from", requestMsg.From).
+			Uint32("to", requestMsg.To).
+			Msg("received an inverted block range request")
+		return nil
+	}
+
+	to := requestMsg.To
+	if to-requestMsg.From >= maxSyncBlocks {
+		to = requestMsg.From + maxSyncBlocks - 1
+	}
+
+	replyMsg := types.BlockRangeReplyMessage{TransBlocks: make([]block.TransBlock, 0)}
+	for _, b := range m.chain.GetBlockRange(requestMsg.From, to) {
+		replyMsg.TransBlocks = append(replyMsg.TransBlocks, *b.GetTransBlock())
+	}
+
+	return m.sendPeerMessage(pkt.Header.Source, pkt.Header.RelayedBy, replyMsg)
+}
+
+func (m *Miner) execBlockRangeReplyMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	replyMsg, ok := msg.(*types.BlockRangeReplyMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.processBlockRange(replyMsg, pkt)
+
+	return nil
+}
+
+func (m *Miner) execDeclarationChallengeReplyMessage(msg types.Message, _ transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	replyMsg, ok := msg.(*types.DeclarationChallengeReplyMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	replyChan, ok := m.challenges.Load(replyMsg.RequestID)
+	if !ok {
+		return nil
+	}
+	select {
+	case replyChan.(chan []byte) <- replyMsg.Signature:
+	default:
+	}
 
 	return nil
 }
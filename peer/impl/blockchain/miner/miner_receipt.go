@@ -0,0 +1,83 @@
+package miner
+
+import (
+	"go.dedis.ch/cs438/peer/impl/blockchain/block"
+	"go.dedis.ch/cs438/peer/impl/blockchain/transaction"
+)
+
+// receiptBufferSize is the capacity of the channel of a receipt subscription. A receipt is not delivered to a
+// subscriber whose channel is full, so that a slow subscriber does not block the miner. Such a subscriber must look
+// the receipt up with GetReceipt.
+const receiptBufferSize = 64
+
+// GetReceipt returns the receipt of the transaction of the given hash. The receipt of a transaction included in the
+// chain is the one of the chain, otherwise it is the last receipt of its failure in this miner, if any.
+func (m *Miner) GetReceipt(txHash string) (*block.Receipt, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	receipt, ok := m.chain.GetReceipt(txHash)
+	if ok {
+		return receipt, true
+	}
+	receipt, ok = m.receipts[txHash]
+	return receipt, ok
+}
+
+// SubscribeReceipts returns a channel on which the receipts are delivered as soon as the transactions are included
+// in an appended block, fail or are dropped, along with the function that ends the subscription. The delivery is
+// best-effort: the receipts published while the channel is full are missed, but they remain available by GetReceipt.
+func (m *Miner) SubscribeReceipts() (<-chan *block.Receipt, func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextReceiptSub
+	m.nextReceiptSub++
+	ch := make(chan *block.Receipt, receiptBufferSize)
+	m.receiptSubs[id] = ch
+
+	unsubscribe := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if _, ok := m.receiptSubs[id]; ok {
+			delete(m.receiptSubs, id)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// publishReceipt keeps the receipt of a failed transaction and delivers the receipt to the subscribers.
+// It must be called under an outlier protection of mutex
+func (m *Miner) publishReceipt(receipt *block.Receipt) {
+	if receipt.Status == block.ReceiptIncluded {
+		delete(m.receipts, receipt.TXHash)
+	} else {
+		m.receipts[receipt.TXHash] = receipt
+	}
+
+	for _, ch := range m.receiptSubs {
+		select {
+		case ch <- receipt:
+		default:
+		}
+	}
+}
+
+// recordFailure publishes the receipt of a transaction that failed or has been dropped with the given error, unless
+// the transaction is already included in the chain. A transaction that keeps failing for the same reason is only
+// published once.
+// It must be called under an outlier protection of mutex
+func (m *Miner) recordFailure(tx *transaction.SignedTransaction, status int, err error) {
+	hash := tx.HashCode()
+	if m.chain.HasTransactionHash(hash) {
+		return
+	}
+
+	last, ok := m.receipts[hash]
+	if ok && last.Status == status && last.Error == err.Error() {
+		return
+	}
+	m.publishReceipt(block.NewFailureReceipt(hash, status, m.chain.Tail.ID+1, err))
+}
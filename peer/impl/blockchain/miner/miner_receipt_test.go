@@ -0,0 +1,38 @@
+package miner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/peer/impl/blockchain/block"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+)
+
+// A subscriber whose channel is full misses the receipts published afterwards, but can still look them up
+func Test_Receipt_Full_Subscription(t *testing.T) {
+	m := &Miner{
+		chain: block.NewChain(common.QuickAddress(1), block.DifficultyPolicy{}, 0,
+			common.QuickWorldState(2, 10).GetSimpleMap()),
+		receipts:    make(map[string]*block.Receipt),
+		receiptSubs: make(map[int]chan *block.Receipt),
+	}
+
+	receipts, unsubscribe := m.SubscribeReceipts()
+	defer unsubscribe()
+
+	hashes := make([]string, receiptBufferSize+10)
+	for i := range hashes {
+		tx := newPoolTx(t, 1, i, 1)
+		hashes[i] = tx.HashCode()
+		m.recordFailure(tx, block.ReceiptDropped, fmt.Errorf("dropped %d", i))
+	}
+
+	require.Len(t, receipts, receiptBufferSize)
+	for i, hash := range hashes {
+		receipt, ok := m.GetReceipt(hash)
+		require.True(t, ok)
+		require.Equal(t, block.ReceiptDropped, receipt.Status)
+		require.Equal(t, fmt.Sprintf("dropped %d", i), receipt.Error)
+	}
+}
@@ -0,0 +1,136 @@
+package miner
+
+import (
+	"fmt"
+	"time"
+
+	"go.dedis.ch/cs438/transport"
+	"go.dedis.ch/cs438/types"
+)
+
+// maxSyncBlocks is the maximum number of blocks of a block range request, a lagging miner requests the next blocks
+// once it has appended them
+const maxSyncBlocks = 32
+
+// syncRequestTimeout is how long a miner waits for the blocks it has requested before requesting them again
+const syncRequestTimeout = 2 * time.Second
+
+// chainSyncDaemon announces the tip of the chain to the neighbors at every BlockchainSyncInterval
+func (m *Miner) chainSyncDaemon() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.GetConf().BlockchainSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.announceTip()
+		}
+	}
+}
+
+func (m *Miner) announceTip() {
+	tail := m.chain.GetLastBlock()
+	tipMsg := types.ChainTipMessage{Height: tail.ID, Hash: tail.BlockHash}
+	tipTransMsg, err := m.GetConf().MessageRegistry.MarshalMessage(tipMsg)
+	if err != nil {
+		m.logger.Error().Err(err).Msg("fail to marshal chain tip message")
+		return
+	}
+
+	for neighbor := range m.message.DirectNeighbor(map[string]struct{}{}) {
+		err = m.message.SendDirectMsg(neighbor, neighbor, tipTransMsg)
+		if err != nil {
+			m.logger.Debug().Err(err).Str("neighbor", neighbor).Msg("fail to announce the chain tip")
+		}
+	}
+}
+
+// requestBlocks requests the blocks of IDs from to to from the given peer, at most maxSyncBlocks of them. The
+// request is skipped if the same blocks have been requested less than syncRequestTimeout ago.
+// It must be called under an outlier protection of mutex
+func (m *Miner) requestBlocks(dest string, relay string, from uint32, to uint32) {
+	if to-from >= maxSyncBlocks {
+		to = from + maxSyncBlocks - 1
+	}
+	if to <= m.syncTarget && time.Since(m.syncTime) < syncRequestTimeout {
+		return
+	}
+	m.syncTarget = to
+	m.syncTime = time.Now()
+
+	m.logger.Debug().
+		Str("peer", dest).
+		Uint32("from", from).
+		Uint32("to", to).
+		Msg("chain is lagging, request the missing blocks")
+
+	err := m.sendPeerMessage(dest, relay, types.BlockRangeRequestMessage{From: from, To: to})
+	if err != nil {
+		m.logger.Debug().Err(err).Str("peer", dest).Msg("fail to request the missing blocks")
+	}
+}
+
+// sendPeerMessage sends a message to the given peer, e.g., of the sync protocol, directly through the given relay if
+// the peer is not in the routing table
+func (m *Miner) sendPeerMessage(dest string, relay string, msg types.Message) error {
+	transMsg, err := m.GetConf().MessageRegistry.MarshalMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	err = m.message.Unicast(dest, transMsg)
+	if err != nil {
+		return m.message.SendDirectMsg(relay, dest, transMsg)
+	}
+	return nil
+}
+
+// processBlockRange buffers the received blocks that follow the tail of the chain. Like a broadcast block, a block
+// of the range is only appended once the consensus has decided it, the peer may serve a fork. A block that conflicts
+// with the decision of the consensus known by this node is rejected.
+// It must be called under an outlier protection of mutex
+func (m *Miner) processBlockRange(replyMsg *types.BlockRangeReplyMessage, pkt transport.Packet) {
+	tailID := m.chain.Tail.ID
+	for _, transBlock := range replyMsg.TransBlocks {
+		b := transBlock.GetBlock()
+		if b.ID <= m.chain.Tail.ID {
+			continue
+		}
+		decided := m.blockNameStorage.GetNamingStore().Get(fmt.Sprintf("%d", b.ID))
+		if decided != nil && string(decided) != b.BlockHash {
+			m.logger.Warn().
+				Str("peer", pkt.Header.Source).
+				Uint32("blockID", b.ID).
+				Str("blockHash", b.BlockHash[:10]).
+				Str("decidedBlockHash", string(decided)[:10]).
+				Msg("received a block that conflicts with the decided one")
+			continue
+		}
+		m.bufferBlock(b)
+	}
+
+	// The decided blocks are appended, the others are proposed to the consensus
+	m.blockAppendingLoop()
+	appended := m.chain.Tail.ID - tailID
+
+	m.logger.Debug().
+		Str("peer", pkt.Header.Source).
+		Int("#blocks", len(replyMsg.TransBlocks)).
+		Uint32("#appended", appended).
+		Uint32("tailID", m.chain.Tail.ID).
+		Msg("received the missing blocks")
+
+	if appended == 0 {
+		return
+	}
+
+	// The peer may have more blocks than a single reply holds
+	m.syncTarget = 0
+	if len(replyMsg.TransBlocks) == maxSyncBlocks {
+		m.requestBlocks(pkt.Header.Source, pkt.Header.RelayedBy, m.chain.Tail.ID+1, m.chain.Tail.ID+maxSyncBlocks)
+	}
+}
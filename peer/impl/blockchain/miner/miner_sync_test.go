@@ -0,0 +1,79 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/peer/impl/blockchain/block"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+	"go.dedis.ch/cs438/peer/impl/blockchain/transaction"
+	"go.dedis.ch/cs438/storage/inmemory"
+	"go.dedis.ch/cs438/transport"
+	"go.dedis.ch/cs438/types"
+)
+
+// newSyncMiner creates a miner that only processes the block ranges
+func newSyncMiner() *Miner {
+	m := &Miner{
+		logger: zerolog.Nop(),
+		chain: block.NewChain(common.QuickAddress(1), block.DifficultyPolicy{}, 0,
+			common.QuickWorldState(2, 10).GetSimpleMap()),
+		blockNameStorage:    inmemory.NewPersistency(),
+		receipts:            make(map[string]*block.Receipt),
+		receiptSubs:         make(map[int]chan *block.Receipt),
+		blockBuffer:         make(map[uint32]map[string]*block.Block),
+		blockNotificationCh: make(map[int]chan struct{}),
+	}
+	m.blockNotificationCh[int(m.chain.Tail.ID+1)] = make(chan struct{})
+	return m
+}
+
+// newRangeBlock creates a valid block that follows the tail of the chain, with a transfer of the given value
+func newRangeBlock(t *testing.T, c *block.Chain, value int64) *block.Block {
+	rawTx := transaction.NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), value, 1)
+	signedTx, err := rawTx.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+
+	b := c.NextBlock()
+	b.TXs = append(b.TXs, &signedTx)
+	b.State = *c.GetLastBlock().State.Copy()
+	require.NoError(t, transaction.VerifyAndExecuteTransaction(&signedTx, &b.State))
+	b.TXHash = block.ComputeTXHash(b.TXs)
+	b.StateHash = b.State.HashCode()
+	b.BlockHash = b.HashCode()
+	return b
+}
+
+// A block of a range reply that conflicts with the decision of the consensus is not appended
+func Test_Sync_Conflicting_Range(t *testing.T) {
+	m := newSyncMiner()
+
+	decided := newRangeBlock(t, m.chain, 1)
+	conflicting := newRangeBlock(t, m.chain, 2)
+	require.NoError(t, m.chain.CheckNewBlock(conflicting))
+	m.blockNameStorage.GetNamingStore().Set("1", []byte(decided.BlockHash))
+
+	pkt := transport.Packet{Header: &transport.Header{Source: "peer"}}
+	m.processBlockRange(&types.BlockRangeReplyMessage{
+		TransBlocks: []block.TransBlock{*conflicting.GetTransBlock()},
+	}, pkt)
+	require.Equal(t, uint32(0), m.chain.Tail.ID)
+	require.NotContains(t, m.blockBuffer[1], conflicting.BlockHash)
+
+	m.processBlockRange(&types.BlockRangeReplyMessage{
+		TransBlocks: []block.TransBlock{*decided.GetTransBlock()},
+	}, pkt)
+	require.Equal(t, uint32(1), m.chain.Tail.ID)
+	require.Equal(t, decided.BlockHash, m.chain.Tail.BlockHash)
+}
+
+// An inverted block range request is not served, it would wrap around to a range of the maximum size
+func Test_Sync_Inverted_Range_Request(t *testing.T) {
+	m := newSyncMiner()
+
+	// The miner has no message module, serving the request would panic
+	pkt := transport.Packet{Header: &transport.Header{Source: "peer"}}
+	err := m.execBlockRangeRequestMessage(&types.BlockRangeRequestMessage{From: 5, To: 2}, pkt)
+	require.NoError(t, err)
+}
@@ -1,6 +1,7 @@
 package transaction
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -8,9 +9,38 @@ import (
 	"go.dedis.ch/cs438/peer/impl/contract/impl"
 )
 
+var (
+	// ErrStaleNonce is returned for a transaction whose nonce has already been used by its account, it is a replay
+	// or conflicts with an executed transaction, it can never be executed
+	ErrStaleNonce = errors.New("stale nonce")
+
+	// ErrFutureNonce is returned for a transaction whose nonce is ahead of the next nonce of its account, it can be
+	// executed once the transactions with the missing nonces have been executed
+	ErrFutureNonce = errors.New("future nonce")
+)
+
 // VerifyAndExecuteTransaction verify and execute a transaction on a given world state
 func VerifyAndExecuteTransaction(tx *SignedTransaction, worldState *common.WorldState) error {
-	var err error
+	err := tx.Verify()
+	if err != nil {
+		return err
+	}
+
+	err = verifyNonce(tx, worldState)
+	if err != nil {
+		return err
+	}
+
+	err = verifyValue(tx)
+	if err != nil {
+		return err
+	}
+
+	err = verifyFee(tx, worldState)
+	if err != nil {
+		return err
+	}
+
 	switch tx.TX.Type {
 	case TransferTx:
 		err = executeTransferTx(tx, worldState)
@@ -18,26 +48,157 @@ func VerifyAndExecuteTransaction(tx *SignedTransaction, worldState *common.World
 		err = executeContractDeploymentTx(tx, worldState)
 	case ContractExecuteTx:
 		err = executeContractExecutionTx(tx, worldState)
+	case CoinbaseTx:
+		err = fmt.Errorf("coinbase transaction is only valid as the last transaction of a block")
 	default:
-		panic("Unknown transaction type")
+		err = fmt.Errorf("unknown transaction type %d", tx.TX.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The transaction is executed, its nonce is used and its fee is paid
+	srcState, _ := worldState.Get(tx.TX.Src.String())
+	srcState.Nonce = tx.TX.Nonce
+	srcState.Balance -= tx.TX.Fee
+	worldState.Set(tx.TX.Src.String(), srcState)
+
+	return nil
+}
+
+// ExecuteCoinbaseTransaction executes the coinbase transaction of a block on a given world state, the creator of
+// the block is credited, and its account is created if it does not exist yet. The value of the coinbase is checked
+// by the validation of the block.
+func ExecuteCoinbaseTransaction(tx *SignedTransaction, worldState *common.WorldState) error {
+	if tx.TX.Type != CoinbaseTx {
+		return fmt.Errorf("transaction of type %d is not a coinbase transaction", tx.TX.Type)
+	}
+	if tx.TX.Value < 0 {
+		return fmt.Errorf("invalid coinbase transaction, negative value %d", tx.TX.Value)
+	}
+
+	creatorState, ok := worldState.Get(tx.TX.Dst.String())
+	if !ok {
+		creatorState = common.State{Tasks: make(map[string][2]string)}
+	}
+	creatorState.Balance += tx.TX.Value
+	worldState.Set(tx.TX.Dst.String(), creatorState)
+
+	return nil
+}
+
+// verifyValue checks that the transaction does not carry a negative value, which would credit its source with the
+// value of the destination. The only negative value is -1 for the leave declaration of an account.
+func verifyValue(tx *SignedTransaction) error {
+	if tx.TX.Value >= 0 {
+		return nil
+	}
+	if tx.TX.Type == TransferTx && tx.TX.Src.Equals(tx.TX.Dst) && tx.TX.Value == -1 {
+		return nil
+	}
+	return fmt.Errorf("invalid transaction, negative value %d", tx.TX.Value)
+}
+
+// verifyFee checks that the sender can pay the fee of the transaction on top of the value it debits, before the
+// transaction is executed. A new account can not pay a fee for its declaration.
+func verifyFee(tx *SignedTransaction, worldState *common.WorldState) error {
+	if tx.TX.Fee < 0 {
+		return fmt.Errorf("invalid transaction, negative fee %d", tx.TX.Fee)
+	}
+	if tx.TX.Fee == 0 {
+		return nil
+	}
+
+	srcState, ok := worldState.Get(tx.TX.Src.String())
+	if !ok {
+		return fmt.Errorf("TX src not found in the world state, it can not pay the fee")
+	}
+
+	debit := tx.Debit()
+	if srcState.Balance < debit {
+		return fmt.Errorf("insufficient balance, src has %d but tries to debit %d with a fee of %d",
+			srcState.Balance, debit, tx.TX.Fee)
+	}
+	return nil
+}
+
+// Debit returns the amount debited from the sender by the transaction, i.e., its fee and the value it transfers or
+// gives to a new contract. A declaration draws its value from the faucet, it does not debit the sender.
+func (tx *SignedTransaction) Debit() int64 {
+	debit := tx.TX.Fee
+	if tx.TX.Type == ContractDeployTx || (tx.TX.Type == TransferTx && !tx.TX.Src.Equals(tx.TX.Dst)) {
+		debit += tx.TX.Value
+	}
+	return debit
+}
+
+// verifyNonce checks that the transaction is the next one sent from its account, i.e., that its nonce follows the
+// nonce of the account. The first transaction of an account, including its declaration, has nonce 1.
+func verifyNonce(tx *SignedTransaction, worldState *common.WorldState) error {
+	expected := 1
+	srcState, ok := worldState.Get(tx.TX.Src.String())
+	if ok {
+		expected = srcState.Nonce + 1
 	}
 
-	return err
+	if tx.TX.Nonce < expected {
+		return fmt.Errorf("%w: nonce %d of account %s, expected %d", ErrStaleNonce,
+			tx.TX.Nonce, tx.TX.Src.String(), expected)
+	}
+	if tx.TX.Nonce > expected {
+		return fmt.Errorf("%w: nonce %d of account %s, expected %d", ErrFutureNonce,
+			tx.TX.Nonce, tx.TX.Src.String(), expected)
+	}
+	return nil
 }
 
 func executeTransferTx(tx *SignedTransaction, worldState *common.WorldState) error {
 	// Check if the transaction is an account join declaration transaction (i.e. Src == Dst && Value >= 0)
 	if tx.TX.Src.String() == tx.TX.Dst.String() && tx.TX.Value >= 0 {
 
-		_, ok := (*worldState).Get(tx.TX.Src.String())
+		// The network address is bound to one account at most
+		networkAddress := tx.TX.Data
+		if networkAddress != "" {
+			owner, found := worldState.FindNetworkAddress(networkAddress)
+			if found && owner != tx.TX.Src.String() {
+				return fmt.Errorf("invalid account join declaration transaction, network address %s is bound to %s",
+					networkAddress, owner)
+			}
+		}
+
+		// The declaration draws the allowance of the account from the faucet, or only binds the network address
+		if tx.TX.Value != 0 && tx.TX.Value != common.FaucetAllowance {
+			return fmt.Errorf("invalid account join declaration transaction, balance %d is not the allowance %d",
+				tx.TX.Value, common.FaucetAllowance)
+		}
+
+		srcState, ok := (*worldState).Get(tx.TX.Src.String())
 		if ok {
-			return fmt.Errorf("invalid account join declaration transaction, account already exists")
+			// An account that has already sent a transaction can only bind its network address, an account that
+			// has only been credited so far, e.g., by the coinbase of a block it mined, can also draw its allowance
+			if networkAddress == "" || (tx.TX.Value != 0 && srcState.Nonce != 0) {
+				return fmt.Errorf("invalid account join declaration transaction, account already exists")
+			}
+		} else {
+			srcState = common.State{Tasks: make(map[string][2]string)}
 		}
 
-		(*worldState).Set(tx.TX.Src.String(), common.State{
-			Nonce:   0,
-			Balance: tx.TX.Value,
-		})
+		if tx.TX.Value > 0 {
+			faucetState, found := worldState.Get(common.FaucetAddress.String())
+			if !found {
+				return fmt.Errorf("invalid account join declaration transaction, no faucet in the world state")
+			}
+			if faucetState.Balance < tx.TX.Value {
+				return fmt.Errorf("invalid account join declaration transaction, faucet has %d but %d is requested",
+					faucetState.Balance, tx.TX.Value)
+			}
+			faucetState.Balance -= tx.TX.Value
+			worldState.Set(common.FaucetAddress.String(), faucetState)
+		}
+
+		srcState.Balance += tx.TX.Value
+		srcState.NetworkAddress = networkAddress
+		(*worldState).Set(tx.TX.Src.String(), srcState)
 
 		return nil
 	}
@@ -63,16 +224,7 @@ func executeTransferTx(tx *SignedTransaction, worldState *common.WorldState) err
 		return fmt.Errorf("TX dst not found in the world state")
 	}
 
-	// 1. Verify nonce
-	//if tx.TX.Nonce != srcState.Nonce+1 {
-	//	return fmt.Errorf("invalid nonce %d, which should be %d", tx.TX.Nonce, srcState.Nonce+1)
-	//}
-	//
-	//// Nonce verified, update the state
-	//srcState.Nonce++
-	//m.tmpWorldState.Set(tx.TX.Src.String(), srcState)
-
-	// 2. Check balance
+	// Check balance, the nonce has been verified before
 	if srcState.Balance < tx.TX.Value {
 		return fmt.Errorf("insufficient balance, src has %d but tries to debit %d", srcState.Balance, tx.TX.Value)
 	}
@@ -91,6 +243,16 @@ func executeContractDeploymentTx(tx *SignedTransaction, worldState *common.World
 		return fmt.Errorf("invalid contract deployment transaction")
 	}
 
+	// The contract is deployed at the address of the next contract of the publisher, which is not used yet
+	expected := common.ContractAddress(tx.TX.Src, worldState.CountContracts(tx.TX.Src)+1)
+	if !tx.TX.Dst.Equals(expected) {
+		return fmt.Errorf("invalid contract deployment transaction, contract address %s, expected %s",
+			tx.TX.Dst.String(), expected.String())
+	}
+	if _, ok := worldState.Get(tx.TX.Dst.String()); ok {
+		return fmt.Errorf("invalid contract deployment transaction, account %s already exists", tx.TX.Dst.String())
+	}
+
 	// Check if the publisher has enough balance to pay the deposit
 	srcState, ok := (*worldState).Get(tx.TX.Src.String())
 	if !ok {
@@ -189,6 +351,9 @@ func executeContractExecutionTx(tx *SignedTransaction, worldState *common.WorldS
 		receiver = *actions[0].Params[1].String
 		reward = int64(*actions[0].Params[0].Number)
 	}
+	if reward < 0 {
+		return fmt.Errorf("unable to execute action, negative reward %d", reward)
+	}
 
 	// Transfer the money
 	receiverState, ok2 := worldState.Get(receiver)
@@ -1,12 +1,17 @@
 package transaction
 
 import (
+	"bytes"
 	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"go.dedis.ch/cs438/peer/impl/blockchain/common"
 	"go.dedis.ch/cs438/peer/impl/contract"
+	"strings"
 	"time"
 )
 
@@ -28,6 +33,10 @@ const (
 	// A transaction that interacts with a deployed smart contract.
 	// In this case, 'dest' address is the smart contract address
 	ContractExecuteTx = iota
+
+	// CoinbaseTx is the type of the transaction paying the block reward and the fees of the block to its creator
+	// It is the last transaction of a block, it is not signed, and its nonce is the ID of the block
+	CoinbaseTx = iota
 )
 
 type Transaction struct {
@@ -50,6 +59,10 @@ type Transaction struct {
 	// Value is the amount of Cracker to transfer
 	Value int64
 
+	// Fee is the amount of Cracker paid by Src to the creator of the block including this transaction, on top of
+	// Value
+	Fee int64
+
 	// Data is an optional field to include arbitrary data
 	// For CONTRACT_EXECUTION_TX, Data field is interpreted by the smart contract code as the execution argument
 	Data string
@@ -58,11 +71,6 @@ type Transaction struct {
 	// Only used for CONTRACT_DEPLOYMENT_TX
 	Contract []byte
 
-	// Signature from the sender
-	// This is generated when the sender's private key signs the transaction
-	// and confirms the sender has authorized this transaction
-	Signature string
-
 	// timestamp given by the sender
 	Timestamp uint64
 
@@ -70,10 +78,18 @@ type Transaction struct {
 	Comment string
 }
 
+// SignedTransaction is a transaction signed by its sender
 type SignedTransaction struct {
-	TX        Transaction
+	TX Transaction
+
+	// Signature is the ECDSA signature of TXHash, in ASN.1 DER form
 	Signature []byte
-	TXHash    []byte
+
+	// TXHash is the hash of the canonical encoding of TX
+	TXHash []byte
+
+	// PublicKey is the public key of the sender, in PKIX, ASN.1 DER form
+	PublicKey []byte
 }
 
 func NewTransferTX(src common.Address, dst common.Address, amount int64, nonce int) Transaction {
@@ -87,6 +103,22 @@ func NewTransferTX(src common.Address, dst common.Address, amount int64, nonce i
 	}
 }
 
+// NewAccountDeclarationTX creates an account declaration transaction, which creates the account of src with the
+// given balance and binds it to the network address of its peer. The balance is either 0 or common.FaucetAllowance,
+// drawn from the faucet. If the account already exists, e.g., in the genesis block, the transaction binds the
+// network address, and only draws the allowance if the account has not sent any transaction yet.
+func NewAccountDeclarationTX(src common.Address, balance int64, networkAddress string, nonce int) Transaction {
+	return Transaction{
+		Type:      TransferTx,
+		Src:       src,
+		Dst:       src,
+		Value:     balance,
+		Timestamp: uint64(time.Now().UnixMicro()),
+		Nonce:     nonce,
+		Data:      networkAddress,
+	}
+}
+
 func NewContractDeploymentTX(src common.Address, contractAddr common.Address, reward int64,
 	contract contract.SmartContract, nonce int) Transaction {
 	contractBytes, _ := contract.Marshal()
@@ -114,6 +146,22 @@ func NewContractExecutionTX(src common.Address, contractAddr common.Address,
 	}
 }
 
+// NewCoinbaseTX creates the coinbase transaction of a block, which pays the given value to the creator of the
+// block. It is not signed, its hash is set so that it is identified like the other transactions.
+func NewCoinbaseTX(creator common.Address, value int64, blockID uint32) SignedTransaction {
+	rawTx := Transaction{
+		Type:  CoinbaseTx,
+		Dst:   creator,
+		Value: value,
+		Nonce: int(blockID),
+	}
+	txHash := sha256.Sum256(rawTx.Encode())
+	return SignedTransaction{
+		TX:     rawTx,
+		TXHash: txHash[:],
+	}
+}
+
 func (tx *SignedTransaction) String() string {
 	str := ""
 	str += fmt.Sprintf("type:%d, ", tx.TX.Type)
@@ -121,27 +169,200 @@ func (tx *SignedTransaction) String() string {
 	str += fmt.Sprintf("Dst:%s, ", tx.TX.Dst.String())
 	str += fmt.Sprintf("Nonce:%d, ", tx.TX.Nonce)
 	str += fmt.Sprintf("Value:%d, ", tx.TX.Value)
+	str += fmt.Sprintf("Fee:%d, ", tx.TX.Fee)
 	str += fmt.Sprintf("Data:%s, ", tx.TX.Data)
 	str += fmt.Sprintf("Contract:%s, ", string(tx.TX.Contract))
-	str += fmt.Sprintf("Signature:%s, ", tx.TX.Signature)
+	str += fmt.Sprintf("Signature:%x, ", tx.Signature)
 	str += fmt.Sprintf("Timestamp:%d, ", tx.TX.Timestamp)
 	str += fmt.Sprintf("Comment:%s, ", tx.TX.Comment)
 
 	return str
 }
 
-func (tx *Transaction) Sign(_ *ecdsa.PrivateKey) (SignedTransaction, error) {
+// Encode returns the canonical encoding of the transaction, which is the one hashed and signed by the sender.
+// The fields are encoded in their declaration order.
+func (tx *Transaction) Encode() []byte {
+	e := common.NewEncoder()
+	e.WriteUint(uint64(tx.Type))
+	e.WriteBytes(tx.Dst.Bytes)
+	e.WriteBytes(tx.Src.Bytes)
+	e.WriteInt(int64(tx.Nonce))
+	e.WriteInt(tx.Value)
+	e.WriteInt(tx.Fee)
+	e.WriteString(tx.Data)
+	e.WriteBytes(tx.Contract)
+	e.WriteUint(tx.Timestamp)
+	e.WriteString(tx.Comment)
+	return e.Bytes()
+}
+
+// DecodeTransaction decodes the canonical encoding of a transaction
+func DecodeTransaction(data []byte) (Transaction, error) {
+	d := common.NewDecoder(data)
+	tx := Transaction{}
+	tx.Type = int(d.ReadUint())
+	tx.Dst = common.NewAddress(d.ReadBytes())
+	tx.Src = common.NewAddress(d.ReadBytes())
+	tx.Nonce = int(d.ReadInt())
+	tx.Value = d.ReadInt()
+	tx.Fee = d.ReadInt()
+	tx.Data = d.ReadString()
+	tx.Contract = d.ReadBytes()
+	tx.Timestamp = d.ReadUint()
+	tx.Comment = d.ReadString()
+	if err := d.Err(); err != nil {
+		return Transaction{}, fmt.Errorf("invalid transaction encoding: %v", err)
+	}
+	return tx, nil
+}
+
+// Encode returns the canonical encoding of the signed transaction, which is sent over the network
+func (tx *SignedTransaction) Encode() []byte {
+	e := common.NewEncoder()
+	e.WriteBytes(tx.TX.Encode())
+	e.WriteBytes(tx.Signature)
+	e.WriteBytes(tx.TXHash)
+	e.WriteBytes(tx.PublicKey)
+	return e.Bytes()
+}
+
+// DecodeSignedTransaction decodes the canonical encoding of a signed transaction
+func DecodeSignedTransaction(data []byte) (SignedTransaction, error) {
+	d := common.NewDecoder(data)
+	txBytes := d.ReadBytes()
+	signedTx := SignedTransaction{
+		Signature: d.ReadBytes(),
+		TXHash:    d.ReadBytes(),
+		PublicKey: d.ReadBytes(),
+	}
+	if err := d.Err(); err != nil {
+		return SignedTransaction{}, fmt.Errorf("invalid signed transaction encoding: %v", err)
+	}
+
+	tx, err := DecodeTransaction(txBytes)
+	if err != nil {
+		return SignedTransaction{}, err
+	}
+	signedTx.TX = tx
+	return signedTx, nil
+}
+
+// MarshalJSON implements json.Marshaler, a signed transaction is sent over the network in its canonical encoding
+func (tx SignedTransaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tx.Encode())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (tx *SignedTransaction) UnmarshalJSON(data []byte) error {
+	var encoding []byte
+	err := json.Unmarshal(data, &encoding)
+	if err != nil {
+		return err
+	}
+	*tx, err = DecodeSignedTransaction(encoding)
+	return err
+}
+
+// Sign signs the transaction with the private key of its sender
+func (tx *Transaction) Sign(privateKey *ecdsa.PrivateKey) (SignedTransaction, error) {
+	if privateKey == nil {
+		return SignedTransaction{}, fmt.Errorf("no private key to sign the transaction")
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return SignedTransaction{}, err
+	}
+
+	txHash := sha256.Sum256(tx.Encode())
+	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, txHash[:])
+	if err != nil {
+		return SignedTransaction{}, err
+	}
+
 	return SignedTransaction{
 		TX:        *tx,
-		Signature: nil,
-		TXHash:    nil,
+		Signature: signature,
+		TXHash:    txHash[:],
+		PublicKey: publicKey,
 	}, nil
 }
 
+// Verify checks that TXHash is the hash of the transaction, that it is signed by the private key of PublicKey,
+// and that PublicKey is the key of the sender, i.e., that the address of the sender is derived from it
+func (tx *SignedTransaction) Verify() error {
+	txHash := sha256.Sum256(tx.TX.Encode())
+	if !bytes.Equal(txHash[:], tx.TXHash) {
+		return fmt.Errorf("transaction hash does not match the transaction")
+	}
+
+	publicKey, err := tx.publicKey()
+	if err != nil {
+		return err
+	}
+
+	if !ecdsa.VerifyASN1(publicKey, tx.TXHash, tx.Signature) {
+		return fmt.Errorf("invalid transaction signature")
+	}
+
+	if !common.PublicKeyToAddress(tx.PublicKey).Equals(tx.TX.Src) {
+		return fmt.Errorf("transaction is not signed by the owner of account %s", tx.TX.Src.String())
+	}
+	return nil
+}
+
+// publicKey parses the public key of the sender
+func (tx *SignedTransaction) publicKey() (*ecdsa.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(tx.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not an ECDSA key")
+	}
+	return publicKey, nil
+}
+
+// NetworkBinding returns the network address that the transaction binds to its sender, i.e., the network address
+// of an account join declaration, or "" if it binds none
+func (tx *SignedTransaction) NetworkBinding() string {
+	if tx.TX.Type != TransferTx || !tx.TX.Src.Equals(tx.TX.Dst) || tx.TX.Value < 0 {
+		return ""
+	}
+	return tx.TX.Data
+}
+
+// SignChallenge signs the nonce of a declaration challenge, received at the given network address, with the private
+// key of the declared account
+func SignChallenge(privateKey *ecdsa.PrivateKey, networkAddress string, nonce []byte) ([]byte, error) {
+	digest := challengeDigest(networkAddress, nonce)
+	return ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+}
+
+// VerifyChallenge checks that the nonce of a challenge sent to the network address bound by the declaration is
+// signed by the key of its sender, i.e., that the peer at the network address holds the key of the account
+func (tx *SignedTransaction) VerifyChallenge(nonce []byte, signature []byte) error {
+	publicKey, err := tx.publicKey()
+	if err != nil {
+		return err
+	}
+	digest := challengeDigest(tx.NetworkBinding(), nonce)
+	if !ecdsa.VerifyASN1(publicKey, digest[:], signature) {
+		return fmt.Errorf("invalid challenge signature")
+	}
+	return nil
+}
+
+func challengeDigest(networkAddress string, nonce []byte) [32]byte {
+	return sha256.Sum256([]byte(strings.Join([]string{"declaration", networkAddress, hex.EncodeToString(nonce)}, "|")))
+}
+
+// Hash returns the hash of the canonical encoding of the transaction, which identifies the transaction. The
+// signature is not part of it, so that the same transaction with another valid signature is not executed twice.
 func (tx *SignedTransaction) Hash() []byte {
-	hash := sha256.New()
-	hash.Write([]byte(tx.String()))
-	return hash.Sum(nil)
+	hash := sha256.Sum256(tx.TX.Encode())
+	return hash[:]
 }
 
 func (tx *SignedTransaction) HashCode() string {
@@ -0,0 +1,478 @@
+package transaction
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+	"go.dedis.ch/cs438/peer/impl/contract/impl"
+)
+
+// newTestKey generates a key pair for a test account
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return privateKey
+}
+
+// Test_Sign_Verify tests that a signed transaction is verified, and that a tampered or unsigned one is not
+func Test_Sign_Verify(t *testing.T) {
+	key := newTestKey(t)
+	src, err := common.KeyToAddress(&key.PublicKey)
+	require.NoError(t, err)
+
+	rawTx := NewTransferTX(src, common.QuickAddress(2), 3, 1)
+	_, err = rawTx.Sign(nil)
+	require.Error(t, err)
+
+	signedTx, err := rawTx.Sign(key)
+	require.NoError(t, err)
+	require.NoError(t, signedTx.Verify())
+
+	// The value is changed after the signature
+	tampered := signedTx
+	tampered.TX.Value = 10
+	require.Error(t, tampered.Verify())
+
+	// The hash is recomputed as well, but the signature does not match it
+	rehashed := tampered.TX
+	forged, err := rehashed.Sign(newTestKey(t))
+	require.NoError(t, err)
+	tampered.TXHash = forged.TXHash
+	require.Error(t, tampered.Verify())
+
+	// The signature is missing
+	unsigned := signedTx
+	unsigned.Signature = nil
+	require.Error(t, unsigned.Verify())
+
+	// The public key is missing
+	anonymous := signedTx
+	anonymous.PublicKey = nil
+	require.Error(t, anonymous.Verify())
+
+	// The transaction is correctly signed, but not by the owner of the sender's account
+	rawTx = NewTransferTX(common.QuickAddress(1), src, 3, 1)
+	forged, err = rawTx.Sign(key)
+	require.NoError(t, err)
+	require.Error(t, forged.Verify())
+}
+
+// Test_Declaration_Challenge tests that only the key of the declared account answers the challenge sent to the
+// network address of the declaration
+func Test_Declaration_Challenge(t *testing.T) {
+	rawTx := NewAccountDeclarationTX(common.QuickAddress(1), 0, "127.0.0.1:1", 1)
+	declaration, err := rawTx.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:1", declaration.NetworkBinding())
+
+	nonce := []byte("nonce")
+	signature, err := SignChallenge(common.QuickKey(1), "127.0.0.1:1", nonce)
+	require.NoError(t, err)
+	require.NoError(t, declaration.VerifyChallenge(nonce, signature))
+	require.Error(t, declaration.VerifyChallenge([]byte("other nonce"), signature))
+
+	// The peer at another network address, or with another key, does not prove the declaration
+	signature, err = SignChallenge(common.QuickKey(1), "127.0.0.1:2", nonce)
+	require.NoError(t, err)
+	require.Error(t, declaration.VerifyChallenge(nonce, signature))
+	signature, err = SignChallenge(common.QuickKey(2), "127.0.0.1:1", nonce)
+	require.NoError(t, err)
+	require.Error(t, declaration.VerifyChallenge(nonce, signature))
+
+	// A transfer binds no network address
+	rawTx = NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), 3, 1)
+	transfer, err := rawTx.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+	require.Empty(t, transfer.NetworkBinding())
+}
+
+// Test_Encode tests that the encoding covers every field of the transaction
+func Test_Encode(t *testing.T) {
+	rawTx := NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), 3, 1)
+	encoding := rawTx.Encode()
+	require.Equal(t, encoding, rawTx.Encode())
+
+	for _, modify := range []func(tx *Transaction){
+		func(tx *Transaction) { tx.Type = ContractExecuteTx },
+		func(tx *Transaction) { tx.Dst = common.QuickAddress(3) },
+		func(tx *Transaction) { tx.Src = common.QuickAddress(3) },
+		func(tx *Transaction) { tx.Nonce++ },
+		func(tx *Transaction) { tx.Value++ },
+		func(tx *Transaction) { tx.Fee++ },
+		func(tx *Transaction) { tx.Data = "data" },
+		func(tx *Transaction) { tx.Contract = []byte("contract") },
+		func(tx *Transaction) { tx.Timestamp++ },
+		func(tx *Transaction) { tx.Comment = "comment" },
+	} {
+		modified := rawTx
+		modify(&modified)
+		require.NotEqual(t, encoding, modified.Encode())
+	}
+
+	// Moving bytes from a field to the next one changes the encoding
+	tx1 := rawTx
+	tx1.Data, tx1.Comment = "ab", "c"
+	tx2 := rawTx
+	tx2.Data, tx2.Comment = "a", "bc"
+	require.NotEqual(t, tx1.Encode(), tx2.Encode())
+}
+
+// Test_Encode_Golden tests the encoding and the hash of a transaction against golden vectors
+func Test_Encode_Golden(t *testing.T) {
+	rawTx := Transaction{
+		Type:      TransferTx,
+		Dst:       common.NewAddress([]byte{2, 2}),
+		Src:       common.NewAddress([]byte{1, 1}),
+		Nonce:     1,
+		Value:     3,
+		Data:      "d",
+		Timestamp: 42,
+		Comment:   "c",
+	}
+
+	golden := "03" + // version
+		"0000000000000000" + // type
+		"0000000000000002" + "0202" + // dst
+		"0000000000000002" + "0101" + // src
+		"0000000000000001" + // nonce
+		"0000000000000003" + // value
+		"0000000000000000" + // fee
+		"0000000000000001" + "64" + // data
+		"0000000000000000" + // contract
+		"000000000000002a" + // timestamp
+		"0000000000000001" + "63" // comment
+	require.Equal(t, golden, hex.EncodeToString(rawTx.Encode()))
+
+	signedTx := SignedTransaction{TX: rawTx}
+	require.Equal(t, "a1df3e67340371b7f8ca54a8018e837fbfc31efd6275b6e452216365b3b75399", signedTx.HashCode())
+
+	decoded, err := DecodeTransaction(rawTx.Encode())
+	require.NoError(t, err)
+	require.Equal(t, rawTx.Encode(), decoded.Encode())
+}
+
+// Test_Signed_Encode tests that a signed transaction is decoded to the same verified transaction, from its
+// encoding as well as from its JSON form sent over the network
+func Test_Signed_Encode(t *testing.T) {
+	rawTx := NewContractExecutionTX(common.QuickAddress(1), common.QuickAddress(2), "pwd", "hash", "salt", 1)
+	signedTx, err := rawTx.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+
+	decoded, err := DecodeSignedTransaction(signedTx.Encode())
+	require.NoError(t, err)
+	require.Equal(t, signedTx.Encode(), decoded.Encode())
+	require.Equal(t, signedTx.HashCode(), decoded.HashCode())
+	require.NoError(t, decoded.Verify())
+
+	jsonBytes, err := json.Marshal(signedTx)
+	require.NoError(t, err)
+	var fromJSON SignedTransaction
+	require.NoError(t, json.Unmarshal(jsonBytes, &fromJSON))
+	require.Equal(t, signedTx.Encode(), fromJSON.Encode())
+	require.NoError(t, fromJSON.Verify())
+
+	_, err = DecodeSignedTransaction(signedTx.Encode()[1:])
+	require.Error(t, err)
+
+	// The identifier of the transaction does not depend on its signature
+	resigned, err := rawTx.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+	require.Equal(t, signedTx.HashCode(), resigned.HashCode())
+}
+
+// Test_Execute_Forged tests that a transaction is only executed if it is signed by the owner of the sender's
+// account
+func Test_Execute_Forged(t *testing.T) {
+	attacker := newTestKey(t)
+	worldState := common.QuickWorldState(3, 10)
+
+	transfer := func(key *ecdsa.PrivateKey, src int, dst int, amount int64, nonce int) error {
+		rawTx := NewTransferTX(common.QuickAddress(src), common.QuickAddress(dst), amount, nonce)
+		signedTx, err := rawTx.Sign(key)
+		require.NoError(t, err)
+		return VerifyAndExecuteTransaction(&signedTx, worldState)
+	}
+
+	// The attacker tries to drain the account of the owner
+	require.Error(t, transfer(attacker, 1, 3, 10, 1))
+	require.NoError(t, transfer(common.QuickKey(1), 1, 2, 3, 1))
+	require.Error(t, transfer(common.QuickKey(2), 1, 3, 7, 2))
+	require.NoError(t, transfer(common.QuickKey(1), 1, 3, 7, 2))
+
+	state1, _ := worldState.Get(common.QuickAddress(1).String())
+	state2, _ := worldState.Get(common.QuickAddress(2).String())
+	state3, _ := worldState.Get(common.QuickAddress(3).String())
+	require.EqualValues(t, 0, state1.Balance)
+	require.EqualValues(t, 13, state2.Balance)
+	require.EqualValues(t, 17, state3.Balance)
+
+	// A tampered transaction is rejected even if it is signed by the owner
+	rawTx := NewTransferTX(common.QuickAddress(2), common.QuickAddress(3), 1, 1)
+	signedTx, err := rawTx.Sign(common.QuickKey(2))
+	require.NoError(t, err)
+	signedTx.TX.Value = 13
+	require.Error(t, VerifyAndExecuteTransaction(&signedTx, worldState))
+	state2, _ = worldState.Get(common.QuickAddress(2).String())
+	require.EqualValues(t, 13, state2.Balance)
+}
+
+// Test_Execute_Negative_Value tests that a transaction signed by its sender can not carry a negative value to
+// credit the sender with the balance of the destination, except -1 for the leave declaration
+func Test_Execute_Negative_Value(t *testing.T) {
+	worldState := common.QuickWorldState(2, 10)
+
+	sign := func(rawTx Transaction) *SignedTransaction {
+		signedTx, err := rawTx.Sign(common.QuickKey(1))
+		require.NoError(t, err)
+		return &signedTx
+	}
+
+	require.Error(t, VerifyAndExecuteTransaction(
+		sign(NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), -5, 1)), worldState))
+	require.Error(t, VerifyAndExecuteTransaction(
+		sign(NewTransferTX(common.QuickAddress(1), common.QuickAddress(1), -2, 1)), worldState))
+
+	deployment := NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), -5, 1)
+	deployment.Type = ContractDeployTx
+	deployment.Contract = []byte("{}")
+	require.Error(t, VerifyAndExecuteTransaction(sign(deployment), worldState))
+
+	execution := NewContractExecutionTX(common.QuickAddress(1), common.QuickAddress(2), "a", "b", "c", 1)
+	execution.Value = -5
+	require.Error(t, VerifyAndExecuteTransaction(sign(execution), worldState))
+
+	state1, _ := worldState.Get(common.QuickAddress(1).String())
+	state2, _ := worldState.Get(common.QuickAddress(2).String())
+	require.EqualValues(t, 10, state1.Balance)
+	require.EqualValues(t, 10, state2.Balance)
+	require.Equal(t, 0, state1.Nonce)
+
+	// The leave declaration is the only negative value
+	require.NoError(t, VerifyAndExecuteTransaction(
+		sign(NewTransferTX(common.QuickAddress(1), common.QuickAddress(1), -1, 1)), worldState))
+}
+
+// Test_Execute_Declaration tests that the account declaration binds the network address of the peer to the
+// account, that it draws the allowance of the account from the faucet, and that a network address is bound to one
+// account at most
+func Test_Execute_Declaration(t *testing.T) {
+	allowance := common.FaucetAllowance
+	worldState := common.QuickWorldState(2, 10)
+	worldState.Set(common.FaucetAddress.String(), common.State{Balance: 3*allowance + 5})
+
+	declare := func(i int, balance int64, networkAddress string, nonce int) error {
+		rawTx := NewAccountDeclarationTX(common.QuickAddress(i), balance, networkAddress, nonce)
+		signedTx, err := rawTx.Sign(common.QuickKey(i))
+		require.NoError(t, err)
+		return VerifyAndExecuteTransaction(&signedTx, worldState)
+	}
+
+	// A new account is created with its network address, it can only draw the allowance
+	require.Error(t, declare(3, allowance+1, "127.0.0.1:3", 1))
+	require.Error(t, declare(3, 1, "127.0.0.1:3", 1))
+	require.NoError(t, declare(3, allowance, "127.0.0.1:3", 1))
+	state3, ok := worldState.Get(common.QuickAddress(3).String())
+	require.True(t, ok)
+	require.EqualValues(t, allowance, state3.Balance)
+	require.Equal(t, "127.0.0.1:3", state3.NetworkAddress)
+	faucet, _ := worldState.Get(common.FaucetAddress.String())
+	require.EqualValues(t, 2*allowance+5, faucet.Balance)
+
+	// The account of a miner is created by the coinbase of its block before its declaration, the declaration binds
+	// the network address and draws the allowance
+	coinbase := NewCoinbaseTX(common.QuickAddress(6), 7, 1)
+	require.NoError(t, ExecuteCoinbaseTransaction(&coinbase, worldState))
+	require.NoError(t, declare(6, allowance, "127.0.0.1:6", 1))
+	state6, _ := worldState.Get(common.QuickAddress(6).String())
+	require.EqualValues(t, 7+allowance, state6.Balance)
+	require.Equal(t, "127.0.0.1:6", state6.NetworkAddress)
+	require.Equal(t, 1, state6.Nonce)
+
+	// An account that has sent a transaction can only bind its network address
+	require.Error(t, declare(3, allowance, "127.0.0.1:3", 2))
+	require.Error(t, declare(1, 0, "", 1))
+	require.NoError(t, declare(1, 0, "127.0.0.1:1", 1))
+	require.Error(t, declare(1, allowance, "127.0.0.1:1", 2))
+	state1, _ := worldState.Get(common.QuickAddress(1).String())
+	require.EqualValues(t, 10, state1.Balance)
+	require.Equal(t, "127.0.0.1:1", state1.NetworkAddress)
+
+	// The faucet can not pay more than its balance, an account without balance does not need it
+	require.NoError(t, declare(7, allowance, "127.0.0.1:7", 1))
+	require.Error(t, declare(4, allowance, "127.0.0.1:4", 1))
+	require.NoError(t, declare(5, 0, "127.0.0.1:5", 1))
+	faucet, _ = worldState.Get(common.FaucetAddress.String())
+	require.EqualValues(t, 5, faucet.Balance)
+
+	// The network address of another account cannot be taken
+	require.Error(t, declare(2, 0, "127.0.0.1:1", 1))
+	require.Error(t, declare(4, 0, "127.0.0.1:3", 1))
+
+	account, ok := worldState.FindNetworkAddress("127.0.0.1:1")
+	require.True(t, ok)
+	require.Equal(t, common.QuickAddress(1).String(), account)
+	account, ok = worldState.FindNetworkAddress("127.0.0.1:3")
+	require.True(t, ok)
+	require.Equal(t, common.QuickAddress(3).String(), account)
+	_, ok = worldState.FindNetworkAddress("127.0.0.1:2")
+	require.False(t, ok)
+
+	// An account can move to another network address
+	require.NoError(t, declare(1, 0, "127.0.0.1:11", 2))
+	_, ok = worldState.FindNetworkAddress("127.0.0.1:1")
+	require.False(t, ok)
+}
+
+// Test_Execute_Nonce tests that the transactions of an account are only executed in the order of their nonces
+func Test_Execute_Nonce(t *testing.T) {
+	worldState := common.QuickWorldState(2, 10)
+
+	sign := func(amount int64, nonce int) SignedTransaction {
+		rawTx := NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), amount, nonce)
+		signedTx, err := rawTx.Sign(common.QuickKey(1))
+		require.NoError(t, err)
+		return signedTx
+	}
+
+	// The first transaction of an account has nonce 1
+	tx0 := sign(1, 0)
+	require.ErrorIs(t, VerifyAndExecuteTransaction(&tx0, worldState), ErrStaleNonce)
+	tx2 := sign(1, 2)
+	require.ErrorIs(t, VerifyAndExecuteTransaction(&tx2, worldState), ErrFutureNonce)
+
+	tx1 := sign(1, 1)
+	require.NoError(t, VerifyAndExecuteTransaction(&tx1, worldState))
+	state1, _ := worldState.Get(common.QuickAddress(1).String())
+	require.Equal(t, 1, state1.Nonce)
+
+	// The transaction is replayed
+	require.ErrorIs(t, VerifyAndExecuteTransaction(&tx1, worldState), ErrStaleNonce)
+
+	// The held transaction can now be executed
+	require.NoError(t, VerifyAndExecuteTransaction(&tx2, worldState))
+
+	// A failed transaction does not use its nonce
+	tx3 := sign(100, 3)
+	require.Error(t, VerifyAndExecuteTransaction(&tx3, worldState))
+	tx3 = sign(1, 3)
+	require.NoError(t, VerifyAndExecuteTransaction(&tx3, worldState))
+
+	state1, _ = worldState.Get(common.QuickAddress(1).String())
+	state2, _ := worldState.Get(common.QuickAddress(2).String())
+	require.Equal(t, 3, state1.Nonce)
+	require.EqualValues(t, 7, state1.Balance)
+	require.EqualValues(t, 13, state2.Balance)
+	require.Equal(t, 0, state2.Nonce)
+}
+
+// Test_Execute_Fee tests that the fee is paid by the sender on top of the value, and that a transaction whose fee
+// can not be paid is rejected without any effect
+func Test_Execute_Fee(t *testing.T) {
+	worldState := common.QuickWorldState(2, 10)
+
+	sign := func(amount int64, fee int64, nonce int) SignedTransaction {
+		rawTx := NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), amount, nonce)
+		rawTx.Fee = fee
+		signedTx, err := rawTx.Sign(common.QuickKey(1))
+		require.NoError(t, err)
+		return signedTx
+	}
+
+	tx := sign(3, 2, 1)
+	require.NoError(t, VerifyAndExecuteTransaction(&tx, worldState))
+	state1, _ := worldState.Get(common.QuickAddress(1).String())
+	state2, _ := worldState.Get(common.QuickAddress(2).String())
+	require.EqualValues(t, 5, state1.Balance)
+	require.EqualValues(t, 13, state2.Balance)
+
+	// The value is affordable but not with the fee
+	tx = sign(5, 1, 2)
+	require.Error(t, VerifyAndExecuteTransaction(&tx, worldState))
+	tx = sign(1, -1, 2)
+	require.Error(t, VerifyAndExecuteTransaction(&tx, worldState))
+	state1, _ = worldState.Get(common.QuickAddress(1).String())
+	require.EqualValues(t, 5, state1.Balance)
+	require.Equal(t, 1, state1.Nonce)
+
+	// A new account can not pay the fee of its declaration
+	rawTx := NewAccountDeclarationTX(common.QuickAddress(3), 0, "127.0.0.1:3", 1)
+	rawTx.Fee = 1
+	signedTx, err := rawTx.Sign(common.QuickKey(3))
+	require.NoError(t, err)
+	require.Error(t, VerifyAndExecuteTransaction(&signedTx, worldState))
+}
+
+// Test_Execute_Deployment tests that a contract is only deployed at the address of the next contract of its
+// publisher, so that a deployment can not overwrite an account
+func Test_Execute_Deployment(t *testing.T) {
+	worldState := common.QuickWorldState(2, 10)
+	publisher := common.QuickAddress(1)
+
+	deploy := func(contractAddr common.Address, nonce int) error {
+		contract := impl.NewContract(contractAddr.String(), "test", impl.BuildPlainContract("00", "", 1),
+			publisher.String(), "")
+		rawTx := NewContractDeploymentTX(publisher, contractAddr, 1, contract, nonce)
+		signedTx, err := rawTx.Sign(common.QuickKey(1))
+		require.NoError(t, err)
+		return VerifyAndExecuteTransaction(&signedTx, worldState)
+	}
+
+	// The deployment overwrites another account, or skips the index of the next contract
+	require.Error(t, deploy(common.QuickAddress(2), 1))
+	require.Error(t, deploy(common.ContractAddress(publisher, 2), 1))
+	require.Error(t, deploy(common.ContractAddress(common.QuickAddress(2), 1), 1))
+	state2, _ := worldState.Get(common.QuickAddress(2).String())
+	require.EqualValues(t, 10, state2.Balance)
+	require.Empty(t, state2.Contract)
+
+	require.NoError(t, deploy(common.ContractAddress(publisher, 1), 1))
+	require.Equal(t, 1, worldState.CountContracts(publisher))
+
+	// The first contract can not be deployed again
+	require.Error(t, deploy(common.ContractAddress(publisher, 1), 2))
+	require.NoError(t, deploy(common.ContractAddress(publisher, 2), 2))
+	require.Equal(t, 2, worldState.CountContracts(publisher))
+
+	state1, _ := worldState.Get(publisher.String())
+	require.EqualValues(t, 8, state1.Balance)
+}
+
+// Test_Execute_Coinbase tests that the coinbase credits the creator of the block, and that it is not executed as a
+// transaction sent by an account
+func Test_Execute_Coinbase(t *testing.T) {
+	worldState := common.QuickWorldState(1, 10)
+
+	coinbase := NewCoinbaseTX(common.QuickAddress(1), 5, 1)
+	require.Equal(t, coinbase.TXHash, coinbase.Hash())
+	require.NoError(t, ExecuteCoinbaseTransaction(&coinbase, worldState))
+	state1, _ := worldState.Get(common.QuickAddress(1).String())
+	require.EqualValues(t, 15, state1.Balance)
+	require.Equal(t, 0, state1.Nonce)
+
+	// The account of the creator is created
+	coinbase = NewCoinbaseTX(common.QuickAddress(2), 5, 2)
+	require.NoError(t, ExecuteCoinbaseTransaction(&coinbase, worldState))
+	state2, ok := worldState.Get(common.QuickAddress(2).String())
+	require.True(t, ok)
+	require.EqualValues(t, 5, state2.Balance)
+
+	require.Error(t, VerifyAndExecuteTransaction(&coinbase, worldState))
+	negative := NewCoinbaseTX(common.QuickAddress(2), -1, 3)
+	require.Error(t, ExecuteCoinbaseTransaction(&negative, worldState))
+	transfer := NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), 1, 1)
+	require.Error(t, ExecuteCoinbaseTransaction(&SignedTransaction{TX: transfer}, worldState))
+
+	// A coinbase signed by its creator is not executed as a transaction either
+	rawTx := coinbase.TX
+	rawTx.Src = common.QuickAddress(2)
+	rawTx.Nonce = 1
+	signedTx, err := rawTx.Sign(common.QuickKey(2))
+	require.NoError(t, err)
+	require.Error(t, VerifyAndExecuteTransaction(&signedTx, worldState))
+}
@@ -0,0 +1,271 @@
+package chord
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog/log"
+	"go.dedis.ch/cs438/types"
+	"strings"
+)
+
+// keyPersistKey is the key of the persisted private key of the primary chord node inside the chord store, the key
+// of a virtual node is followed by its suffix
+const keyPersistKey = "key"
+
+// member is a Chord node whose binding between its address and its public key has been verified
+type member struct {
+	credential types.ChordCredential
+	chordID    uint
+}
+
+// initAuthentication loads the key pair of the chord node from the chord store, or generates it on the first
+// start, and creates its credential. The chordID of the node is derived from the public key, the node keeps it
+// across restarts, so that its former neighbours accept it back.
+func (c *Chord) initAuthentication() error {
+	privateKey, err := c.loadKey()
+	if err != nil {
+		return err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	c.privateKey = privateKey
+	c.credential = types.ChordCredential{
+		Address:   c.address,
+		PublicKey: publicKey,
+		Signature: c.sign("credential", c.address),
+		Nonce:     keyProofOfWork(publicKey, c.conf.ChordKeyDifficulty),
+	}
+	c.chordID = c.credentialID(c.credential)
+
+	// We trust ourselves, there is no need to challenge our own address
+	c.members.Store(c.address, member{credential: c.credential, chordID: c.chordID})
+	return nil
+}
+
+// loadKey returns the private key of the chord node persisted inside the chord store, a new key is generated and
+// persisted if there is none yet
+func (c *Chord) loadKey() (*ecdsa.PrivateKey, error) {
+	store := c.conf.Storage.GetChordStore()
+	storeKey := keyPersistKey + strings.TrimPrefix(c.address, c.host)
+
+	keyBytes := store.Get(storeKey)
+	if keyBytes != nil {
+		return x509.ParseECPrivateKey(keyBytes)
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err = x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	store.Set(storeKey, keyBytes)
+	return privateKey, nil
+}
+
+// sign signs the given parts with the private key of the chord node, it returns nil if the authentication is
+// disabled
+func (c *Chord) sign(parts ...string) []byte {
+	if c.privateKey == nil {
+		return nil
+	}
+	digest := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	signature, err := ecdsa.SignASN1(rand.Reader, c.privateKey, digest[:])
+	if err != nil {
+		log.Error().Err(err).Msg(fmt.Sprintf("[%s] sign failed!", c.address))
+	}
+	return signature
+}
+
+// verify verifies the signature of the given parts with the public key in PKIX, ASN.1 DER form
+func verify(publicKey []byte, signature []byte, parts ...string) bool {
+	key, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		return false
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return false
+	}
+	digest := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return ecdsa.VerifyASN1(ecdsaKey, digest[:], signature)
+}
+
+// verifyCredential checks that the credential is signed by the private key of its public key
+func verifyCredential(credential types.ChordCredential) bool {
+	return verify(credential.PublicKey, credential.Signature, "credential", credential.Address)
+}
+
+// keyWorkHash returns the hash of the public key and the nonce of its proof of work
+func keyWorkHash(publicKey []byte, nonce uint64) [sha256.Size]byte {
+	var nonceBytes [8]byte
+	binary.BigEndian.PutUint64(nonceBytes[:], nonce)
+	return sha256.Sum256(append(append([]byte{}, publicKey...), nonceBytes[:]...))
+}
+
+// hasLeadingZeroBits checks that the hash starts with the given number of zero bits
+func hasLeadingZeroBits(hash []byte, bits uint) bool {
+	for i := uint(0); i < bits; i++ {
+		if i/8 >= uint(len(hash)) || hash[i/8]&(0x80>>(i%8)) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// keyProofOfWork finds the first nonce such that the hash of the public key and the nonce has the given number of
+// leading zero bits
+func keyProofOfWork(publicKey []byte, difficulty uint) uint64 {
+	nonce := uint64(0)
+	for {
+		hash := keyWorkHash(publicKey, nonce)
+		if hasLeadingZeroBits(hash[:], difficulty) {
+			return nonce
+		}
+		nonce++
+	}
+}
+
+// verifyKeyWork checks the proof of work over the public key of the credential
+func (c *Chord) verifyKeyWork(credential types.ChordCredential) bool {
+	hash := keyWorkHash(credential.PublicKey, credential.Nonce)
+	return hasLeadingZeroBits(hash[:], c.conf.ChordKeyDifficulty)
+}
+
+// credentialID computes the chordID of the node holding the credential from its public key. The chordID only has
+// ChordBytes bytes, a node can be placed at a chosen chordID by generating about 2^(8*ChordBytes) keys, the proof
+// of work over each key multiplies this cost by 2^ChordKeyDifficulty hashes.
+func (c *Chord) credentialID(credential types.ChordCredential) uint {
+	return c.Name2ID(hex.EncodeToString(credential.PublicKey))
+}
+
+// NodeID returns the chordID of the chord node with the given address. If the authentication is disabled, it
+// is computed from the address. Otherwise, it is derived from the public key of the node, the node should have
+// been verified before, if it is not, the ID computed from the address is returned.
+func (c *Chord) NodeID(address string) uint {
+	if c.conf.ChordAuthentication {
+		m, ok := c.members.Load(address)
+		if ok {
+			return m.(member).chordID
+		}
+	}
+	return c.Name2ID(address)
+}
+
+// getCredential returns the credential of a verified chord node, it returns an empty credential if the
+// authentication is disabled or if the node is unknown
+func (c *Chord) getCredential(address string) types.ChordCredential {
+	if !c.conf.ChordAuthentication {
+		return types.ChordCredential{}
+	}
+	m, ok := c.members.Load(address)
+	if !ok {
+		return types.ChordCredential{}
+	}
+	return m.(member).credential
+}
+
+// verifyMember verifies the binding between the address of a chord node and its credential, before the node is
+// used in a routing pointer. The credential should be signed with its key and carry the proof of work over the
+// key, and the node reachable at the address should prove that it holds the private key, by signing a random challenge. Once verified, the
+// credential is kept until the node leaves the ring. A different credential for the same address replaces it
+// only if the node at the address passes the challenge of the new key, e.g., after a restart without its
+// storage. It always succeeds if the authentication is disabled. It must not be called while holding the locks
+// of the chord node, since it may wait for the reply of the challenged node.
+func (c *Chord) verifyMember(address string, credential types.ChordCredential) bool {
+	if !c.conf.ChordAuthentication {
+		return true
+	}
+	if address == "" || credential.Address != address {
+		return false
+	}
+
+	// If the address is already verified with the same credential, there is nothing to challenge. Our own
+	// credentials are never replaced.
+	m, ok := c.members.Load(address)
+	if ok && (bytes.Equal(m.(member).credential.PublicKey, credential.PublicKey) || c.IsLocal(address)) {
+		return bytes.Equal(m.(member).credential.PublicKey, credential.PublicKey)
+	}
+
+	if !verifyCredential(credential) || !c.verifyKeyWork(credential) || !c.challenge(credential) {
+		log.Warn().Msg(fmt.Sprintf("[%s] rejected the credential of %s", c.address, address))
+		return false
+	}
+
+	c.members.Store(address, member{credential: credential, chordID: c.credentialID(credential)})
+	return true
+}
+
+// forgetMember removes the credential of a chord node that has left the ring, it is verified again if it joins
+// back. Our own credentials are kept.
+func (c *Chord) forgetMember(address string) {
+	if !c.conf.ChordAuthentication || c.IsLocal(address) {
+		return
+	}
+	c.members.Delete(address)
+}
+
+// verifyMessage verifies the signature of a message sent by a verified chord node
+func (c *Chord) verifyMessage(source string, signature []byte, parts ...string) bool {
+	if !c.conf.ChordAuthentication {
+		return true
+	}
+	m, ok := c.members.Load(source)
+	if !ok {
+		return false
+	}
+	return verify(m.(member).credential.PublicKey, signature, parts...)
+}
+
+// challenge sends a random nonce to the address of the credential, and checks that the reply is signed with the
+// private key of the credential
+func (c *Chord) challenge(credential types.ChordCredential) bool {
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return false
+	}
+
+	// Prepare the new chord challenge message
+	chordChallengeMsg := types.ChordChallengeMessage{
+		RequestID: xid.New().String(),
+		Nonce:     nonce,
+		Target:    credential.Address,
+	}
+	chordChallengeMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordChallengeMsg)
+	if err != nil {
+		return false
+	}
+
+	// Prepare a reply channel that receives the reply from the remote peer, if any response is ready
+	replyChan := make(chan []byte, 1)
+	c.challengeChan.Store(chordChallengeMsg.RequestID, replyChan)
+	defer c.challengeChan.Delete(chordChallengeMsg.RequestID)
+
+	// Send the message to the remote peer
+	err = c.sendDirectMsg(credential.Address, chordChallengeMsgTrans)
+	if err != nil {
+		return false
+	}
+
+	// Either we wait until the timeout, or we receive a response from the reply channel
+	select {
+	case signature := <-replyChan:
+		return verify(credential.PublicKey, signature, "challenge", credential.Address, hex.EncodeToString(nonce))
+	case <-c.conf.Clock.After(c.conf.ChordTimeout):
+		return false
+	}
+}
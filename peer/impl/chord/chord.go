@@ -1,34 +1,70 @@
 package chord
 
 import (
+	"crypto/ecdsa"
 	"fmt"
 	"github.com/rs/xid"
 	"github.com/rs/zerolog/log"
 	"go.dedis.ch/cs438/peer"
 	"go.dedis.ch/cs438/peer/impl/message"
+	"go.dedis.ch/cs438/transport"
 	"go.dedis.ch/cs438/types"
 	"golang.org/x/xerrors"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// leaveRetryInterval is the interval a leaving chord node waits before asking again its predecessor to skip it,
+// when the predecessor is leaving as well
+const leaveRetryInterval = time.Millisecond * 100
+
 func NewChord(conf *peer.Configuration, message *message.Message) *Chord {
-	var queryChan, ringLenChan, pingChan sync.Map
-
-	chord := Chord{
-		address:           conf.Socket.GetAddress(),
-		conf:              conf,
-		message:           message,
-		queryChan:         &queryChan,
-		ringLenChan:       &ringLenChan,
-		pingChan:          &pingChan,
-		stopStabilizeChan: make(chan bool, 1),
-		stopFixFingerChan: make(chan bool, 1),
-		stopPingChan:      make(chan bool, 1),
-	}
-	// Compute the ID of this node inside the Chord Ring
-	chord.chordID = chord.Name2ID(chord.address)
+	var queryChan, rangeChan, ringLenChan, ringSnapshotChan, pingChan, challengeChan, leaveChan, rtt, members sync.Map
+
+	numVirtualNodes := conf.ChordVirtualNodes
+	if numVirtualNodes < 1 {
+		numVirtualNodes = 1
+	}
+
+	vnodes := make([]*Chord, numVirtualNodes)
+	for i := range vnodes {
+		vnodes[i] = &Chord{
+			address:           virtualAddress(conf.Socket.GetAddress(), i),
+			host:              conf.Socket.GetAddress(),
+			conf:              conf,
+			message:           message,
+			queryChan:         &queryChan,
+			rangeChan:         &rangeChan,
+			ringLenChan:       &ringLenChan,
+			ringSnapshotChan:  &ringSnapshotChan,
+			pingChan:          &pingChan,
+			challengeChan:     &challengeChan,
+			leaveChan:         &leaveChan,
+			rtt:               &rtt,
+			members:           &members,
+			stopStabilizeChan: make(chan bool, 1),
+			stopFixFingerChan: make(chan bool, 1),
+			stopPingChan:      make(chan bool, 1),
+		}
+		// Compute the ID of this (virtual) node inside the Chord Ring, it is derived from the public key of the
+		// node if the authentication is enabled
+		vnodes[i].chordID = vnodes[i].Name2ID(vnodes[i].address)
+		if conf.ChordAuthentication {
+			err := vnodes[i].initAuthentication()
+			if err != nil {
+				log.Error().Err(err).Msg(fmt.Sprintf("[%s] initAuthentication failed!", vnodes[i].address))
+			}
+		}
+	}
+	for _, vnode := range vnodes {
+		vnode.vnodes = vnodes
+	}
+
+	// The first node is the primary node, it has the address of the peer and it is the one that
+	// receives all chord messages
+	chord := vnodes[0]
 	// Create the initial topology of the chord ring
 	chord.Create()
 
@@ -39,31 +75,60 @@ func NewChord(conf *peer.Configuration, message *message.Message) *Chord {
 	conf.MessageRegistry.RegisterMessageCallback(types.ChordReplyPredecessorMessage{}, chord.execChordReplyPredMessage)
 	conf.MessageRegistry.RegisterMessageCallback(types.ChordNotifyMessage{}, chord.execChordNotifyMessage)
 	conf.MessageRegistry.RegisterMessageCallback(types.ChordRingLenMessage{}, chord.execChordRingLenMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.ChordQueryRangeMessage{}, chord.execChordQueryRangeMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.ChordReplyRangeMessage{}, chord.execChordReplyRangeMessage)
 	conf.MessageRegistry.RegisterMessageCallback(types.ChordClearPredecessorMessage{}, chord.execChordClearPredMessage)
 	conf.MessageRegistry.RegisterMessageCallback(types.ChordSkipSuccessorMessage{}, chord.execChordSkipSuccMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.ChordLeaveReplyMessage{}, chord.execChordLeaveReplyMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.ChordRingSnapshotMessage{}, chord.execChordRingSnapshotMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.ChordRouteMessage{}, chord.execChordRouteMessage)
 	conf.MessageRegistry.RegisterMessageCallback(types.ChordPingMessage{}, chord.execChordPingMessage)
 	conf.MessageRegistry.RegisterMessageCallback(types.ChordPingReplyMessage{}, chord.execChordPingReplyMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.ChordChallengeMessage{}, chord.execChordChallengeMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.ChordChallengeReplyMessage{},
+		chord.execChordChallengeReplyMessage)
 
-	return &chord
+	return chord
 }
 
 type Chord struct {
 	address           string
-	conf              *peer.Configuration // The configuration contains Socket and MessageRegistry
-	message           *message.Message    // Messaging used to communicate among nodes
-	alive             atomic.Int32        // Whether this chord node is alive or not
-	chordID           uint                // ID of this chord node
-	predecessor       string              // predecessor of this node
-	predecessorLock   sync.RWMutex        // The mutex to protect concurrent read write to the predecessor
-	successor         string              // successor of this chord node
-	successorLock     sync.RWMutex        // The mutex to protect concurrent read write to the successor
-	fingerIdx         int                 // Update fingers in round-robin fashion
-	fingers           []string            // Finger tables
-	fingersLock       sync.RWMutex        // Finger table lock
-	queryChan         *sync.Map           // The sync map stores the channel that used for query results
-	ringLenChan       *sync.Map           // The sync map stores the channel that used for the query RingLen
-	pingChan          *sync.Map           // The sync map stores the channel that used for ping results
-	stopStabilizeChan chan bool           // Communication channel about whether we should stop the node
+	host              string                    // The socket address of the peer hosting this chord node
+	vnodes            []*Chord                  // All chord nodes hosted by the peer, vnodes[0] is the primary node
+	conf              *peer.Configuration       // The configuration contains Socket and MessageRegistry
+	message           *message.Message          // Messaging used to communicate among nodes
+	alive             atomic.Int32              // Whether this chord node is alive or not
+	leaving           atomic.Int32              // Whether this chord node is leaving the ring
+	state             peer.ChordState           // The membership state of the peer, only used by the primary node
+	stateLock         sync.Mutex                // The mutex to protect the transitions of the membership state
+	daemonRunning     atomic.Int32              // Whether the daemons are running, only used by the primary node
+	forward           string                    // The node taking over our range once we left, protected by successorLock
+	skipped           string                    // The leaving successor we skipped, protected by successorLock
+	chordID           uint                      // ID of this chord node
+	predecessor       string                    // predecessor of this node
+	predecessorLock   sync.RWMutex              // The mutex to protect concurrent read write to the predecessor
+	successor         string                    // successor of this chord node
+	successorLock     sync.RWMutex              // The mutex to protect concurrent read write to the successor
+	fingerIdx         int                       // Update fingers in round-robin fashion
+	fingers           []string                  // Finger tables
+	candidates        [][]string                // Candidate nodes of each finger interval, protected by fingersLock
+	fingersLock       sync.RWMutex              // Finger table lock
+	queryChan         *sync.Map                 // The sync map stores the channel that used for query results
+	rangeChan         *sync.Map                 // The sync map stores the channel that used for range query results
+	ringLenChan       *sync.Map                 // The sync map stores the channel that used for the query RingLen
+	ringSnapshotChan  *sync.Map                 // The sync map stores the channel that used for the query RingSnapshot
+	pingChan          *sync.Map                 // The sync map stores the channel that used for ping results
+	challengeChan     *sync.Map                 // The sync map stores the channel that used for challenge results
+	leaveChan         *sync.Map                 // The sync map stores the channel that used for leave acknowledgements
+	rtt               *sync.Map                 // The sync map stores the measured round-trip time of each peer
+	members           *sync.Map                 // The sync map stores the verified chord nodes, by address
+	rangeCallbacks    []func([]types.SaltRange) // The callbacks of OnRangeChange, only used by the primary node
+	rangeLock         sync.Mutex                // The mutex to protect the range callbacks
+	privateKey        *ecdsa.PrivateKey         // The private key of the node, if the authentication is enabled
+	credential        types.ChordCredential     // The credential of the node, if the authentication is enabled
+	persisted         []byte                    // The contacts saved in the chord store, only used by the primary node
+	persistLock       sync.Mutex                // The mutex to protect the persisted contacts
+	stopStabilizeChan chan bool                 // Communication channel about whether we should stop the node
 	stopFixFingerChan chan bool
 	stopPingChan      chan bool
 }
@@ -98,20 +163,116 @@ func (c *Chord) GetFingerTable() []string {
 	return fingers
 }
 
-// Create creates a new chord ring topology
+// GetState gets the membership state of the peer
+func (c *Chord) GetState() peer.ChordState {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return c.state
+}
+
+// setState sets the membership state of the peer
+func (c *Chord) setState(state peer.ChordState) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	c.state = state
+}
+
+// alone checks whether all the nodes of the ring are hosted by the peer
+func (c *Chord) alone() bool {
+	for _, vnode := range c.vnodes {
+		successor := vnode.GetSuccessor()
+		if successor != "" && !c.IsLocal(successor) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetVirtualNodes gets the addresses of all chord nodes hosted by the peer, the first one is the
+// primary node, which has the address of the peer
+func (c *Chord) GetVirtualNodes() []string {
+	addresses := make([]string, len(c.vnodes))
+	for i, vnode := range c.vnodes {
+		addresses[i] = vnode.address
+	}
+	return addresses
+}
+
+// Create creates a new chord ring topology. If the peer hosts virtual nodes, they form a ring among
+// themselves, ordered by their chordID
 func (c *Chord) Create() {
-	c.alive.Store(1)
+	c.setState(peer.ChordMember)
+	for _, vnode := range c.vnodes {
+		vnode.alive.Store(1)
+		vnode.reset()
+	}
+
+	if len(c.vnodes) == 1 {
+		return
+	}
+
+	ring := make([]*Chord, len(c.vnodes))
+	copy(ring, c.vnodes)
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].chordID < ring[j].chordID
+	})
+	for i, vnode := range ring {
+		vnode.predecessor = ring[(i-1+len(ring))%len(ring)].address
+		vnode.successor = ring[(i+1)%len(ring)].address
+		vnode.fingers[0] = vnode.successor
+	}
+}
+
+// reset clears the predecessor, the successor and the finger table of the chord node
+func (c *Chord) reset() {
 	c.predecessor = ""
 	c.successor = ""
+	c.forward = ""
+	c.skipped = ""
 	c.fingers = make([]string, c.conf.ChordBytes*8)
+	c.candidates = make([][]string, c.conf.ChordBytes*8)
 	for i := 0; i < c.conf.ChordBytes*8; i++ {
 		c.fingers[i] = ""
 	}
 }
 
 // Join joins an existing chord ring topology, this is done by asking an existing remote
-// node about the successor of the current node's chordID
+// node about the successor of the current node's chordID. All virtual nodes join the ring. The peer
+// should either be alone inside its own ring, or have left its previous ring, in which case the daemons
+// are restarted. If the join fails, the peer goes back to its previous state.
 func (c *Chord) Join(remoteNode string) error {
+	c.stateLock.Lock()
+	previous := c.state
+	if previous != peer.ChordIdle && (previous != peer.ChordMember || !c.alone()) {
+		c.stateLock.Unlock()
+		return xerrors.Errorf("[%s] cannot join a Chord ring while %s of another ring", c.address, previous)
+	}
+	c.state = peer.ChordJoining
+	c.stateLock.Unlock()
+
+	for _, vnode := range c.vnodes {
+		err := vnode.join(remoteNode)
+		if err != nil {
+			if previous == peer.ChordIdle {
+				c.clear(make([]string, len(c.vnodes)))
+				c.setState(peer.ChordIdle)
+			} else {
+				c.Create()
+			}
+			return err
+		}
+	}
+
+	if previous == peer.ChordIdle {
+		c.StartDaemon()
+	}
+	c.setState(peer.ChordMember)
+	c.persist()
+	return nil
+}
+
+// join joins the chord node to an existing chord ring topology
+func (c *Chord) join(remoteNode string) error {
 	c.alive.Store(1)
 	successor, err := c.QuerySuccessor(remoteNode, c.chordID)
 	if err != nil {
@@ -127,11 +288,14 @@ func (c *Chord) Join(remoteNode string) error {
 
 	c.predecessor = ""
 	c.successor = successor
+	c.forward = ""
+	c.skipped = ""
 	c.fingers[0] = successor
 	return nil
 }
 
-// RingLen returns the length of the ring, i.e., the number of nodes inside the ring
+// RingLen returns the length of the ring, i.e., the number of nodes inside the ring. Virtual nodes are
+// counted as distinct nodes
 func (c *Chord) RingLen() uint {
 	c.successorLock.RLock()
 	// If we are the only node inside the Chord ring, returns 1
@@ -145,6 +309,7 @@ func (c *Chord) RingLen() uint {
 		RequestID: xid.New().String(),
 		Source:    c.address,
 		Length:    1,
+		Target:    c.successor,
 	}
 	chordRingLenMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordRingLenMsg)
 	if err != nil {
@@ -157,7 +322,7 @@ func (c *Chord) RingLen() uint {
 	c.ringLenChan.Store(chordRingLenMsg.RequestID, ringLenChan)
 
 	// Send the message to the remote peer
-	err = c.message.SendDirectMsg(c.successor, c.successor, chordRingLenMsgTrans)
+	err = c.sendDirectMsg(c.successor, chordRingLenMsgTrans)
 	if err != nil {
 		log.Error().Err(err).Msg(
 			fmt.Sprintf("[%s] RingLen failed!", c.address))
@@ -170,61 +335,237 @@ func (c *Chord) RingLen() uint {
 		// We receive an answer before the timeout, return the ring length
 		c.ringLenChan.Delete(chordRingLenMsg.RequestID)
 		return ringLen
-	case <-time.After(c.conf.ChordTimeout * time.Duration(c.conf.ChordBytes) * 8):
+	case <-c.conf.Clock.After(c.conf.ChordTimeout * time.Duration(c.conf.ChordBytes) * 8):
 		// Timeout, return 0, to indicate the failure
 		c.ringLenChan.Delete(chordRingLenMsg.RequestID)
 		return 0
 	}
 }
 
-// Leave allows the chord node to leave an existing chord ring gracefully
+// RingSnapshot walks the ring along the successors, starting from this node, and collects the state of
+// every node inside the ring. The inconsistencies of the topology are reported inside the snapshot
+func (c *Chord) RingSnapshot() (peer.RingSnapshot, error) {
+	info := c.nodeInfo()
+	// If we are the only node inside the Chord ring, the snapshot only contains us
+	if info.Successor == "" || info.Successor == c.address {
+		nodes := []types.ChordNodeInfo{info}
+		return peer.RingSnapshot{Nodes: nodes, Inconsistencies: checkRing(nodes)}, nil
+	}
+
+	// If we are not, prepare a new chord ring snapshot message
+	chordRingSnapshotMsg := types.ChordRingSnapshotMessage{
+		RequestID: xid.New().String(),
+		Source:    c.address,
+		Nodes:     []types.ChordNodeInfo{info},
+		Target:    info.Successor,
+	}
+	chordRingSnapshotMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordRingSnapshotMsg)
+	if err != nil {
+		return peer.RingSnapshot{}, err
+	}
+
+	// Prepare a reply channel that receives the reply from the remote peer, if any response is ready
+	ringSnapshotChan := make(chan []types.ChordNodeInfo, 1)
+	c.ringSnapshotChan.Store(chordRingSnapshotMsg.RequestID, ringSnapshotChan)
+	defer c.ringSnapshotChan.Delete(chordRingSnapshotMsg.RequestID)
+
+	// Send the message to the remote peer
+	err = c.sendDirectMsg(info.Successor, chordRingSnapshotMsgTrans)
+	if err != nil {
+		return peer.RingSnapshot{}, err
+	}
+
+	// Either we wait until the timeout, or we receive a response from the reply channel
+	select {
+	case nodes := <-ringSnapshotChan:
+		return peer.RingSnapshot{Nodes: nodes, Inconsistencies: checkRing(nodes)}, nil
+	case <-c.conf.Clock.After(c.conf.ChordTimeout * time.Duration(c.conf.ChordBytes) * 8):
+		return peer.RingSnapshot{}, xerrors.Errorf("Chord timeout when taking the ring snapshot!")
+	}
+}
+
+// Leave allows the chord node to leave an existing chord ring gracefully, together with all virtual
+// nodes hosted by the peer. The neighbours acknowledge the update of their pointers, so that adjacent nodes
+// can leave concurrently. The node leaves even if the handshake fails, the error is then returned, and the
+// stabilization repairs the ring. Once it has left, the peer is idle and can join a ring again.
 func (c *Chord) Leave() error {
-	c.predecessorLock.Lock()
-	defer c.predecessorLock.Unlock()
-	c.successorLock.Lock()
-	defer c.successorLock.Unlock()
-	c.fingersLock.Lock()
-	defer c.fingersLock.Unlock()
+	c.stateLock.Lock()
+	if c.state != peer.ChordMember {
+		c.stateLock.Unlock()
+		return xerrors.Errorf("[%s] cannot leave the Chord ring while %s", c.address, c.state)
+	}
+	c.state = peer.ChordLeaving
+	c.stateLock.Unlock()
 
-	// In order for us to leave, we should inform our successor that it should remove us
-	// from the predecessor field.
-	if c.successor != "" {
-		chordClearPredecessorMsg := types.ChordClearPredecessorMessage{}
-		chordClearPredecessorMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordClearPredecessorMsg)
-		if err != nil {
-			return err
+	// Enter the leave window, from now on, our predecessors cannot skip us until we have left. The
+	// stabilization is stopped, so that we do not notify our successor about us anymore
+	for _, vnode := range c.vnodes {
+		vnode.leaving.Store(1)
+	}
+	c.StopDaemon()
+
+	var leaveErr error
+	for _, vnode := range c.vnodes {
+		err := vnode.leave()
+		if err != nil && leaveErr == nil {
+			leaveErr = err
 		}
-		err = c.message.SendDirectMsg(c.successor, c.successor, chordClearPredecessorMsgTrans)
-		if err != nil {
-			return err
+	}
+
+	// The queries that are still in flight towards us will be forwarded to the successor taking over our range
+	forwards := make([]string, len(c.vnodes))
+	for i, vnode := range c.vnodes {
+		forwards[i] = c.RemoteSuccessor(vnode.address)
+	}
+	c.clear(forwards)
+	c.setState(peer.ChordIdle)
+	c.forget()
+
+	// The leave window ends after the timeout, no query is expected to be in flight towards us anymore
+	c.conf.Clock.AfterFunc(c.conf.ChordTimeout, func() {
+		for _, vnode := range c.vnodes {
+			vnode.successorLock.Lock()
+			if vnode.alive.Load() == 0 {
+				vnode.forward = ""
+			}
+			vnode.successorLock.Unlock()
 		}
+	})
+	return leaveErr
+}
+
+// clear clears the state inside the Chord nodes hosted by the peer once they have left, the queries they
+// receive are forwarded to the given nodes
+func (c *Chord) clear(forwards []string) {
+	for _, vnode := range c.vnodes {
+		vnode.predecessorLock.Lock()
+		defer vnode.predecessorLock.Unlock()
+		vnode.successorLock.Lock()
+		defer vnode.successorLock.Unlock()
+		vnode.fingersLock.Lock()
+		defer vnode.fingersLock.Unlock()
 	}
 
-	// We should also inform our predecessor that it should remove us from the successor
-	// field, and use our successor as the new successor.
-	if c.predecessor != "" {
-		chordSkipSuccessorMsg := types.ChordSkipSuccessorMessage{
-			Successor: c.successor,
+	for i, vnode := range c.vnodes {
+		vnode.predecessor = ""
+		vnode.successor = ""
+		vnode.forward = forwards[i]
+		vnode.skipped = ""
+		for j := 0; j < c.conf.ChordBytes*8; j++ {
+			vnode.fingers[j] = ""
+			vnode.candidates[j] = nil
 		}
-		chordSkipSuccessorMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordSkipSuccessorMsg)
-		if err != nil {
-			return err
+		vnode.alive.Store(0)
+		vnode.leaving.Store(0)
+	}
+}
+
+// leave hands over the range of the sequence of chord nodes hosted by the peer that ends with this node. The
+// remote predecessor of the sequence should skip it, and our remote successor should use that predecessor as
+// its new predecessor. A predecessor refuses to skip us while it is leaving itself, we then wait for it to
+// leave, it updates our predecessor when it does.
+func (c *Chord) leave() error {
+	successor := c.GetSuccessor()
+	if successor == "" || c.IsLocal(successor) {
+		// Either we are alone inside the ring, or our successor is leaving with us
+		return nil
+	}
+
+	var leaveErr error
+	predecessor := ""
+	deadline := c.conf.Clock.Now().Add(c.conf.ChordTimeout)
+	for {
+		first, firstPredecessor := c.sequenceStart()
+		if firstPredecessor == "" {
+			// Our predecessor is unknown, our successor will wait for the notification of its new predecessor
+			break
 		}
-		err = c.message.SendDirectMsg(c.successor, c.predecessor, chordSkipSuccessorMsgTrans)
-		if err != nil {
-			return err
+
+		accepted, err := first.requestLeave(firstPredecessor, func(requestID string) types.Message {
+			return types.ChordSkipSuccessorMessage{
+				RequestID:  requestID,
+				Successor:  successor,
+				Source:     first.address,
+				Target:     firstPredecessor,
+				Credential: c.getCredential(successor),
+				Signature:  first.sign("skipsuccessor", successor, first.address, firstPredecessor),
+			}
+		})
+		if accepted {
+			predecessor = firstPredecessor
+			break
+		}
+		if c.conf.Clock.Now().After(deadline) {
+			leaveErr = xerrors.Errorf("[%s] the predecessor %s does not skip us: %v", c.address,
+				firstPredecessor, err)
+			break
 		}
+		c.conf.Clock.Sleep(leaveRetryInterval)
 	}
 
-	// Clear the state inside the Chord node
-	c.predecessor = ""
-	c.successor = ""
-	for i := 0; i < c.conf.ChordBytes*8; i++ {
-		c.fingers[i] = ""
+	// If our successor is our predecessor as well, it will be alone inside the ring
+	if predecessor == successor {
+		predecessor = ""
+	}
+
+	_, err := c.requestLeave(successor, func(requestID string) types.Message {
+		return types.ChordClearPredecessorMessage{
+			RequestID:   requestID,
+			Predecessor: predecessor,
+			Source:      c.address,
+			Target:      successor,
+			Credential:  c.getCredential(predecessor),
+			Signature:   c.sign("clearpredecessor", predecessor, c.address, successor),
+		}
+	})
+	if err != nil && leaveErr == nil {
+		leaveErr = err
+	}
+	return leaveErr
+}
+
+// sequenceStart returns the first chord node of the sequence of nodes hosted by the peer that ends with this
+// node, together with the predecessor of the sequence, which is empty if it is unknown
+func (c *Chord) sequenceStart() (*Chord, string) {
+	first := c
+	for i := 0; i < len(c.vnodes); i++ {
+		predecessor := first.GetPredecessor()
+		if !c.IsLocal(predecessor) {
+			return first, predecessor
+		}
+		first = c.virtualNode(predecessor)
+	}
+	// All the nodes of the ring are hosted by this peer
+	return first, ""
+}
+
+// requestLeave sends the message built with a new request ID to a neighbour, and waits for its
+// acknowledgement. It returns whether the neighbour accepted to update its pointer
+func (c *Chord) requestLeave(neighbour string, newMsg func(requestID string) types.Message) (bool, error) {
+	requestID := xid.New().String()
+	msgTrans, err := c.conf.MessageRegistry.MarshalMessage(newMsg(requestID))
+	if err != nil {
+		return false, err
+	}
+
+	// Prepare a reply channel that receives the reply from the remote peer, if any response is ready
+	replyChan := make(chan bool, 1)
+	c.leaveChan.Store(requestID, replyChan)
+	defer c.leaveChan.Delete(requestID)
+
+	// Send the message to the remote peer
+	err = c.sendDirectMsg(neighbour, msgTrans)
+	if err != nil {
+		return false, err
+	}
+
+	// Either we wait until the timeout, or we receive a response from the reply channel
+	select {
+	case accepted := <-replyChan:
+		return accepted, nil
+	case <-c.conf.Clock.After(c.conf.ChordTimeout):
+		return false, xerrors.Errorf("Chord timeout when leaving!")
 	}
-	c.alive.Store(0)
-	c.StopDaemon()
-	return nil
 }
 
 // QuerySuccessor queries a remote node or self about the successor of the given key, it can be used
@@ -235,6 +576,7 @@ func (c *Chord) QuerySuccessor(remoteNode string, key uint) (string, error) {
 		RequestID: xid.New().String(),
 		Source:    c.address,
 		Key:       key,
+		Target:    remoteNode,
 	}
 	chordQueryMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordQueryMsg)
 	if err != nil {
@@ -246,7 +588,7 @@ func (c *Chord) QuerySuccessor(remoteNode string, key uint) (string, error) {
 	c.queryChan.Store(chordQueryMsg.RequestID, replyChan)
 
 	// Send the message to the remote peer
-	err = c.message.SendDirectMsg(remoteNode, remoteNode, chordQueryMsgTrans)
+	err = c.sendDirectMsg(remoteNode, chordQueryMsgTrans)
 	if err != nil {
 		return "", err
 	}
@@ -257,9 +599,127 @@ func (c *Chord) QuerySuccessor(remoteNode string, key uint) (string, error) {
 		/* Delete the entry in the query reply channels, and return the result */
 		c.queryChan.Delete(chordQueryMsg.RequestID)
 		return successor, nil
-	case <-time.After(c.conf.ChordTimeout):
+	case <-c.conf.Clock.After(c.conf.ChordTimeout):
 		/* We are timeout here */
 		c.queryChan.Delete(chordQueryMsg.RequestID)
 		return "", xerrors.Errorf("Chord timeout when query successor!")
 	}
 }
+
+// Lookup implements dht.DHT, it returns the peer hosting the chord node that owns the key
+func (c *Chord) Lookup(key uint) (string, error) {
+	owner, err := c.QuerySuccessor(c.address, key)
+	if err != nil {
+		return "", err
+	}
+	return HostAddress(owner), nil
+}
+
+// OnRangeChange implements dht.DHT. The range of the peer is the union of the ranges of all chord nodes it
+// hosts, the callback is called each time the predecessor of one of them changes
+func (c *Chord) OnRangeChange(callback func(ranges []types.SaltRange)) {
+	primary := c.vnodes[0]
+	primary.rangeLock.Lock()
+	defer primary.rangeLock.Unlock()
+	primary.rangeCallbacks = append(primary.rangeCallbacks, callback)
+}
+
+// RouteToKey sends the message to the chord node owning the key, hop by hop along the finger tables. The peer
+// hosting the owner processes the message as if this peer had sent it directly, so that no routing entry is
+// needed for the owner. The message is delivered asynchronously, an error is only returned if the first hop fails.
+func (c *Chord) RouteToKey(key uint, msg transport.Message) error {
+	return c.route(key, "", msg)
+}
+
+// RouteTo sends the message to the given peer through the ring, by routing it to the chordID of the peer. An
+// error is returned if the peer is not a known member of the ring: if the authentication is enabled, it should be
+// a verified member, since its chordID is derived from its key, and in any case it should own its chordID. The
+// message is delivered asynchronously, it is dropped if the peer leaves the ring meanwhile.
+func (c *Chord) RouteTo(dest string, msg transport.Message) error {
+	if c.conf.ChordAuthentication {
+		if _, ok := c.members.Load(dest); !ok {
+			return xerrors.Errorf("[%s] %s is not a verified member of the ring", c.address, dest)
+		}
+	}
+
+	key := c.NodeID(dest)
+	owner, err := c.QuerySuccessor(c.address, key)
+	if err != nil {
+		return err
+	}
+	if owner != dest {
+		return xerrors.Errorf("[%s] %s is not a member of the ring, %s owns its chordID %d",
+			c.address, dest, owner, key)
+	}
+	return c.route(key, dest, msg)
+}
+
+// route starts the routing of the message towards the owner of the key
+func (c *Chord) route(key uint, dest string, msg transport.Message) error {
+	if !c.validRange(key) {
+		return xerrors.Errorf("[%s] invalid key %d", c.address, key)
+	}
+
+	// Once the fingers are correct, each hop at least halves the distance to the key
+	chordRouteMsg := types.ChordRouteMessage{
+		Source:      c.host,
+		Destination: dest,
+		Key:         key,
+		Target:      c.address,
+		TTL:         uint(c.conf.ChordBytes*8) * 2,
+		Msg:         &msg,
+		Credential:  c.credential,
+	}
+	chordRouteMsg.Signature = c.sign(routeParts(&chordRouteMsg)...)
+	if c.owns(key) {
+		return c.deliverRoute(&chordRouteMsg)
+	}
+	return c.forwardRoute(&chordRouteMsg)
+}
+
+// QueryRange returns the chord nodes owning the keys [start, end], together with the subrange each of them
+// owns. The owner of start is queried first, then the query walks along the successors until it reaches the
+// owner of end. The range is crossing the boundary of the ring if start > end.
+func (c *Chord) QueryRange(start uint, end uint) ([]types.ChordRange, error) {
+	if !c.validRange(start) || !c.validRange(end) {
+		return nil, xerrors.Errorf("[%s] invalid range [%d, %d]", c.address, start, end)
+	}
+
+	owner, err := c.QuerySuccessor(c.address, start)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepare the new chord range query message, the owner of start is the first node of the walk
+	chordQueryRangeMsg := types.ChordQueryRangeMessage{
+		RequestID: xid.New().String(),
+		Source:    c.address,
+		Start:     start,
+		End:       end,
+		Ranges:    []types.ChordRange{},
+		Target:    owner,
+	}
+	chordQueryRangeMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordQueryRangeMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepare a reply channel that receives the reply from the remote peer, if any response is ready
+	rangeChan := make(chan []types.ChordRange, 1)
+	c.rangeChan.Store(chordQueryRangeMsg.RequestID, rangeChan)
+	defer c.rangeChan.Delete(chordQueryRangeMsg.RequestID)
+
+	// Send the message to the remote peer
+	err = c.sendDirectMsg(owner, chordQueryRangeMsgTrans)
+	if err != nil {
+		return nil, err
+	}
+
+	// Either we wait until the timeout, or we receive a response from the reply channel
+	select {
+	case ranges := <-rangeChan:
+		return ranges, nil
+	case <-c.conf.Clock.After(c.conf.ChordTimeout * time.Duration(c.conf.ChordBytes) * 8):
+		return nil, xerrors.Errorf("Chord timeout when querying the range [%d, %d]!", start, end)
+	}
+}
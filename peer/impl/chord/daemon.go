@@ -5,24 +5,39 @@ import (
 	"github.com/rs/xid"
 	"github.com/rs/zerolog/log"
 	"go.dedis.ch/cs438/types"
-	"time"
 )
 
-// StartDaemon starts daemon for Chord
+// StartDaemon starts daemon for Chord, every chord node hosted by the peer runs its own daemons. It does
+// nothing if the daemons are already running
 func (c *Chord) StartDaemon() {
-	/* Start the stabilizeDaemon */
-	go c.stabilizeDaemon()
-	/* Start the fixFingerDaemon */
-	go c.fixFingerDaemon()
-	/* Start the pingDaemon */
-	go c.pingDaemon()
+	if !c.daemonRunning.CompareAndSwap(0, 1) {
+		return
+	}
+	for _, vnode := range c.vnodes {
+		/* Start the stabilizeDaemon */
+		go vnode.stabilizeDaemon()
+		/* Start the fixFingerDaemon */
+		go vnode.fixFingerDaemon()
+		/* Start the pingDaemon */
+		go vnode.pingDaemon()
+	}
 }
 
-// StopDaemon stops daemon for Chord
+// StopDaemon stops daemon for Chord, so that they can be started again later. It does nothing if the
+// daemons are not running
 func (c *Chord) StopDaemon() {
-	c.stopStabilizeChan <- true
-	c.stopFixFingerChan <- true
-	c.stopPingChan <- true
+	if !c.daemonRunning.CompareAndSwap(1, 0) {
+		return
+	}
+	for _, vnode := range c.vnodes {
+		// A disabled daemon has already returned, the stop message is left inside the channel
+		for _, stopChan := range []chan bool{vnode.stopStabilizeChan, vnode.stopFixFingerChan, vnode.stopPingChan} {
+			select {
+			case stopChan <- true:
+			default:
+			}
+		}
+	}
 }
 
 // stabilizeDaemon ensures the correctness of the Chord, it sends a QueryPredecessor
@@ -35,7 +50,7 @@ func (c *Chord) stabilizeDaemon() {
 		return
 	}
 
-	ticker := time.NewTicker(c.conf.ChordStabilizeInterval)
+	ticker := c.conf.Clock.NewTicker(c.conf.ChordStabilizeInterval)
 	for {
 		select {
 		case <-c.stopStabilizeChan:
@@ -43,23 +58,29 @@ func (c *Chord) stabilizeDaemon() {
 			// exit from the goroutine
 			ticker.Stop()
 			return
-		case <-ticker.C:
-			chordQueryMsg := types.ChordQueryPredecessorMessage{}
+		case <-ticker.C():
+			c.successorLock.RLock()
+			chordQueryMsg := types.ChordQueryPredecessorMessage{
+				Source: c.address,
+				Target: c.successor,
+			}
 			chordQueryMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordQueryMsg)
 			if err != nil {
 				log.Error().Err(err).Msg(fmt.Sprintf("[%s] stabilizeDaemon MarshalMessage failed!", c.address))
 			}
 
-			c.successorLock.RLock()
 			// If we have a successor, send a query message to it.
 			if c.successor != "" && c.successor != c.address {
-				err = c.message.SendDirectMsg(c.successor, c.successor, chordQueryMsgTrans)
+				err = c.sendDirectMsg(c.successor, chordQueryMsgTrans)
 				if err != nil {
 					log.Error().Err(err).Msg(
 						fmt.Sprintf("[%s] stabilizeDaemon SendDirectMsg with error!", c.address))
 				}
 			}
 			c.successorLock.RUnlock()
+
+			// Save our latest contacts, so that we can rejoin the ring after a restart
+			c.persist()
 		}
 	}
 }
@@ -73,7 +94,7 @@ func (c *Chord) fixFingerDaemon() {
 		return
 	}
 
-	ticker := time.NewTicker(c.conf.ChordFixFingerInterval)
+	ticker := c.conf.Clock.NewTicker(c.conf.ChordFixFingerInterval)
 	for {
 		select {
 		case <-c.stopFixFingerChan:
@@ -81,38 +102,42 @@ func (c *Chord) fixFingerDaemon() {
 			// exit from the goroutine
 			ticker.Stop()
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			// Update our finger table
 			if c.fingerIdx == 0 {
 				// We should only update finger entries that are not the successor
 				c.fingerIdx++
 			}
-			fingerStart, _ := c.fingerStartEnd(c.fingerIdx)
-			successor, err := c.QuerySuccessor(c.address, fingerStart)
+			fingerStart, fingerEnd := c.fingerStartEnd(c.fingerIdx)
+			candidates, err := c.queryCandidates(fingerStart, fingerEnd)
 			if err != nil {
 				log.Error().Err(err).Msg(
 					fmt.Sprintf("[%s] fixFingerDaemon querySuccessor with error for index %d!",
 						c.address, c.fingerIdx))
 			}
 
+			// Route through the candidate with the lowest round-trip time
 			c.fingersLock.Lock()
-			c.fingers[c.fingerIdx] = successor
+			c.candidates[c.fingerIdx] = candidates
+			c.fingers[c.fingerIdx] = c.closestCandidate(candidates)
 			c.fingersLock.Unlock()
 
 			c.fingerIdx = (c.fingerIdx + 1) % len(c.fingers)
+			c.persist()
 		}
 	}
 }
 
-// pingDaemon
+// pingDaemon checks the liveliness of the finger entries and of the finger candidates, and measures their
+// round-trip time, which is used to select the fingers among the candidates
 func (c *Chord) pingDaemon() {
 	if c.conf.ChordPingInterval == 0 {
-		// Fix finger mechanism is disabled
+		// Ping mechanism is disabled
 		return
 	}
 
 	// Check for liveliness of the finger entry, except for the successor
-	checkLiveliness := func(fingerEntry string, fingerIdx int) {
+	checkLiveliness := func(fingerEntry string) {
 		// Prepare the new chord ping message
 		chordPingMsg := types.ChordPingMessage{
 			RequestID: xid.New().String(),
@@ -127,8 +152,11 @@ func (c *Chord) pingDaemon() {
 		replyChan := make(chan bool, 1)
 		c.pingChan.Store(chordPingMsg.RequestID, replyChan)
 
+		defer c.pingChan.Delete(chordPingMsg.RequestID)
+
 		// Send the message to the remote peer
-		err = c.message.SendDirectMsg(fingerEntry, fingerEntry, chordPingMsgTrans)
+		start := c.conf.Clock.Now()
+		err = c.sendDirectMsg(fingerEntry, chordPingMsgTrans)
 		if err != nil {
 			log.Error().Err(err).Msg(
 				fmt.Sprintf("[%s] pingDaemon SendDirectMsg failed!", c.address))
@@ -137,19 +165,23 @@ func (c *Chord) pingDaemon() {
 		// Either we wait until the timeout, or we receive a response from the reply channel
 		select {
 		case <-replyChan:
-			// The entry is still alive, continue
-			return
-		case <-time.After(c.conf.ChordPingInterval):
-			// Timeout, we should set all entries contain expired value to empty
+			// The entry is still alive, record its round-trip time
+			c.recordRTT(fingerEntry, c.conf.Clock.Since(start))
+		case <-c.conf.Clock.After(c.conf.ChordPingInterval):
+			// Timeout, we should set all entries contain expired value to empty, and forget the candidate
+			c.rtt.Delete(HostAddress(fingerEntry))
 			c.fingersLock.Lock()
-			if c.fingers[fingerIdx] == fingerEntry {
-				c.fingers[fingerIdx] = ""
+			for i := 1; i < len(c.fingers); i++ {
+				if c.fingers[i] == fingerEntry {
+					c.fingers[i] = ""
+				}
+				c.candidates[i] = removeCandidate(c.candidates[i], fingerEntry)
 			}
 			c.fingersLock.Unlock()
 		}
 	}
 
-	ticker := time.NewTicker(c.conf.ChordPingInterval)
+	ticker := c.conf.Clock.NewTicker(c.conf.ChordPingInterval)
 	for {
 		select {
 		case <-c.stopPingChan:
@@ -157,14 +189,23 @@ func (c *Chord) pingDaemon() {
 			// exit from the goroutine
 			ticker.Stop()
 			return
-		case <-ticker.C:
+		case <-ticker.C():
+			// Ping every distinct finger entry and finger candidate once
+			entries := make(map[string]struct{})
 			c.fingersLock.RLock()
 			for i := 1; i < len(c.fingers); i++ {
 				if c.fingers[i] != "" {
-					go checkLiveliness(c.fingers[i], i)
+					entries[c.fingers[i]] = struct{}{}
+				}
+				for _, candidate := range c.candidates[i] {
+					entries[candidate] = struct{}{}
 				}
 			}
 			c.fingersLock.RUnlock()
+
+			for entry := range entries {
+				go checkLiveliness(entry)
+			}
 		}
 	}
 }
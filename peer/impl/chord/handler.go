@@ -1,9 +1,11 @@
 package chord
 
 import (
+	"encoding/hex"
 	"go.dedis.ch/cs438/transport"
 	"go.dedis.ch/cs438/types"
 	"golang.org/x/xerrors"
+	"math"
 )
 
 // execChordQuerySuccMessage is the callback function to handle ChordQuerySuccessorMessage
@@ -14,16 +16,30 @@ func (c *Chord) execChordQuerySuccMessage(msg types.Message, pkt transport.Packe
 		return xerrors.Errorf("wrong type: %T", msg)
 	}
 
-	// If we are not alive, even we receive some packets, ignore them
-	if c.alive.Load() == 0 {
+	// Dispatch the message to the chord node it targets, it can be a virtual node hosted by this peer
+	c = c.virtualNode(chordQueryMsg.Target)
+	if c == nil {
 		return nil
 	}
 
+	// If we are not alive, even we receive some packets, ignore them. If we have just left, the query was sent
+	// to us before our neighbours knew about our leave, we forward it to the node taking over our range
+	if c.alive.Load() == 0 {
+		return c.forwardQuery(chordQueryMsg)
+	}
+
 	// The queried key should be within the range of chord bits, if it is, ignore the packet
 	if !c.validRange(chordQueryMsg.Key) {
 		return nil
 	}
 
+	// If the key is within our range, we are the successor of the key. It happens when the query has been
+	// forwarded by a node that has just left our range, the other nodes may still route it through the nodes
+	// that have left otherwise
+	if c.owns(chordQueryMsg.Key) {
+		return c.replySuccessor(chordQueryMsg, c.address)
+	}
+
 	c.successorLock.RLock()
 	defer c.successorLock.RUnlock()
 	c.fingersLock.RLock()
@@ -40,16 +56,7 @@ func (c *Chord) execChordQuerySuccMessage(msg types.Message, pkt transport.Packe
 			replySuccessor = c.address
 		}
 
-		// Prepare the new chord reply message
-		chordReplyMsg := types.ChordReplySuccessorMessage{
-			ReplyPacketID: chordQueryMsg.RequestID,
-			Successor:     replySuccessor,
-		}
-		chordReplyMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordReplyMsg)
-		if err != nil {
-			return err
-		}
-		return c.message.SendDirectMsg(chordQueryMsg.Source, chordQueryMsg.Source, chordReplyMsgTrans)
+		return c.replySuccessor(chordQueryMsg, replySuccessor)
 	}
 
 	// If we are not the predecessor, continue asking other nodes
@@ -58,11 +65,12 @@ func (c *Chord) execChordQuerySuccMessage(msg types.Message, pkt transport.Packe
 
 	// The chord query message should be kept the same as before, but we forward it to the
 	// closest preceding finger node
+	chordQueryMsg.Target = closestPrecedingFinger
 	chordQueryMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordQueryMsg)
 	if err != nil {
 		return err
 	}
-	return c.message.SendDirectMsg(closestPrecedingFinger, closestPrecedingFinger, chordQueryMsgTrans)
+	return c.sendDirectMsg(closestPrecedingFinger, chordQueryMsgTrans)
 
 }
 
@@ -79,6 +87,11 @@ func (c *Chord) execChordReplySuccMessage(msg types.Message, pkt transport.Packe
 		return nil
 	}
 
+	// The successor is used to update our routing pointers, it should be a verified member of the ring
+	if !c.verifyMember(chordReplyMsg.Successor, chordReplyMsg.Credential) {
+		return nil
+	}
+
 	// We receive a reply for our queries. Since the reply is sent directly, we are sure that
 	// we are the correct receptor of the message. Upon receiving the packet, we should notify the thread
 	// that is waiting for our reply by loading the channel from the map and send the successor, if we are
@@ -94,11 +107,17 @@ func (c *Chord) execChordReplySuccMessage(msg types.Message, pkt transport.Packe
 // execChordQueryPredMessage is the callback function to handle ChordQueryPredecessorMessage
 func (c *Chord) execChordQueryPredMessage(msg types.Message, pkt transport.Packet) error {
 	/* cast the message to its actual type. You assume it is the right type. */
-	_, ok := msg.(*types.ChordQueryPredecessorMessage)
+	chordQueryMsg, ok := msg.(*types.ChordQueryPredecessorMessage)
 	if !ok {
 		return xerrors.Errorf("wrong type: %T", msg)
 	}
 
+	// Dispatch the message to the chord node it targets, it can be a virtual node hosted by this peer
+	c = c.virtualNode(chordQueryMsg.Target)
+	if c == nil {
+		return nil
+	}
+
 	// If we are not alive, even we receive some packets, ignore them
 	if c.alive.Load() == 0 {
 		return nil
@@ -110,12 +129,14 @@ func (c *Chord) execChordQueryPredMessage(msg types.Message, pkt transport.Packe
 	predecessor := c.predecessor
 	chordReplyMsg := types.ChordReplyPredecessorMessage{
 		Predecessor: predecessor,
+		Target:      chordQueryMsg.Source,
+		Credential:  c.getCredential(predecessor),
 	}
 	chordReplyMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordReplyMsg)
 	if err != nil {
 		return err
 	}
-	return c.message.SendDirectMsg(pkt.Header.Source, pkt.Header.Source, chordReplyMsgTrans)
+	return c.sendDirectMsg(chordQueryMsg.Source, chordReplyMsgTrans)
 }
 
 // execChordReplyPredMessage is the callback function to handle ChordReplyPredecessorMessage
@@ -126,16 +147,37 @@ func (c *Chord) execChordReplyPredMessage(msg types.Message, pkt transport.Packe
 		return xerrors.Errorf("wrong type: %T", msg)
 	}
 
-	// If we are not alive, even we receive some packets, ignore them
-	if c.alive.Load() == 0 {
+	// Dispatch the message to the chord node it targets, it can be a virtual node hosted by this peer
+	c = c.virtualNode(chordReplyMsg.Target)
+	if c == nil {
+		return nil
+	}
+
+	// If we are not alive, even we receive some packets, ignore them. If we are leaving, the reply comes from a
+	// stabilization started before the leave, we should not notify our successor about us anymore
+	if c.alive.Load() == 0 || c.leaving.Load() == 1 {
 		return nil
 	}
 
+	// The predecessor of our successor may become our successor, it should be a verified member of the ring,
+	// otherwise, we ignore it
+	if chordReplyMsg.Predecessor != "" && !c.verifyMember(chordReplyMsg.Predecessor, chordReplyMsg.Credential) {
+		chordReplyMsg.Predecessor = ""
+	}
+
 	c.successorLock.Lock()
 	defer c.successorLock.Unlock()
 	c.fingersLock.Lock()
 	defer c.fingersLock.Unlock()
 
+	// Our successor may still report a node we skipped, until the node has cleared itself from its predecessor
+	// field, it should not become our successor again
+	if chordReplyMsg.Predecessor == c.skipped {
+		chordReplyMsg.Predecessor = ""
+	} else {
+		c.skipped = ""
+	}
+
 	if chordReplyMsg.Predecessor == "" {
 		// If our successor has no predecessor set, we should directly notify our successor
 	} else {
@@ -143,8 +185,8 @@ func (c *Chord) execChordReplyPredMessage(msg types.Message, pkt transport.Packe
 		// If our successor already has one predecessor, we should check whether our successor has
 		// a new predecessor, and the new predecessor is within the range between our chordID, and
 		// our successor's ID
-		predecessorID := c.Name2ID(chordReplyMsg.Predecessor)
-		successorID := c.Name2ID(c.successor)
+		predecessorID := c.NodeID(chordReplyMsg.Predecessor)
+		successorID := c.NodeID(c.successor)
 		within := false
 
 		if successorID <= c.chordID {
@@ -162,40 +204,60 @@ func (c *Chord) execChordReplyPredMessage(msg types.Message, pkt transport.Packe
 	}
 
 	// Notify our successor the existence of us
-	chordNotifyMsg := types.ChordNotifyMessage{}
+	chordNotifyMsg := types.ChordNotifyMessage{
+		Source:     c.address,
+		Target:     c.successor,
+		Credential: c.credential,
+		Signature:  c.sign("notify", c.address, c.successor),
+	}
 	chordNotifyMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordNotifyMsg)
 	if err != nil {
 		return err
 	}
-	return c.message.SendDirectMsg(c.successor, c.successor, chordNotifyMsgTrans)
+	return c.sendDirectMsg(c.successor, chordNotifyMsgTrans)
 }
 
 // execChordNotifyMessage is the callback function to handle ChordNotifyMessage
 func (c *Chord) execChordNotifyMessage(msg types.Message, pkt transport.Packet) error {
 	/* cast the message to its actual type. You assume it is the right type. */
-	_, ok := msg.(*types.ChordNotifyMessage)
+	chordNotifyMsg, ok := msg.(*types.ChordNotifyMessage)
 	if !ok {
 		return xerrors.Errorf("wrong type: %T", msg)
 	}
 
+	// Dispatch the message to the chord node it targets, it can be a virtual node hosted by this peer
+	c = c.virtualNode(chordNotifyMsg.Target)
+	if c == nil {
+		return nil
+	}
+
 	// If we are not alive, even we receive some packets, ignore them
 	if c.alive.Load() == 0 {
 		return nil
 	}
 
+	// The source becomes our predecessor, and maybe our successor, it should be a verified member of the ring,
+	// and the message should be signed by it
+	if !c.verifyMember(chordNotifyMsg.Source, chordNotifyMsg.Credential) ||
+		!c.verifyMessage(chordNotifyMsg.Source, chordNotifyMsg.Signature, "notify", chordNotifyMsg.Source,
+			chordNotifyMsg.Target) {
+		return nil
+	}
+
 	c.predecessorLock.Lock()
 	defer c.predecessorLock.Unlock()
+	oldPredecessor := c.predecessor
 	update := false
 
 	if c.predecessor == "" {
 		// If we don't have a predecessor yet
-		c.predecessor = pkt.Header.Source
+		c.predecessor = chordNotifyMsg.Source
 		update = true
 	} else {
 		// If we already have a predecessor, check that the new coming one has an ID that is within
 		// the range (oldPredecessorID, chordID)
-		oldPredecessorID := c.Name2ID(c.predecessor)
-		newPredecessorID := c.Name2ID(pkt.Header.Source)
+		oldPredecessorID := c.NodeID(c.predecessor)
+		newPredecessorID := c.NodeID(chordNotifyMsg.Source)
 		within := false
 
 		if c.chordID < oldPredecessorID {
@@ -207,15 +269,16 @@ func (c *Chord) execChordNotifyMessage(msg types.Message, pkt transport.Packet)
 		// If the new predecessor has a key that is between our previous predecessor and us, then we should
 		// update our predecessor to the new predecessor
 		if within {
-			c.predecessor = pkt.Header.Source
+			c.predecessor = chordNotifyMsg.Source
 			update = true
 		}
 	}
 
 	// If we have updated our predecessor, it means the range we are responsible is changed, we should notify
-	// our password cracker about the change
+	// the range callbacks and our DHash about the change
 	if update {
-		c.notifyPasswordCracker()
+		c.notifyRangeChange()
+		c.notifyDHash(oldPredecessor, c.predecessor)
 	}
 
 	// If we haven't had a successor set, we should set our successor to the source
@@ -225,8 +288,8 @@ func (c *Chord) execChordNotifyMessage(msg types.Message, pkt transport.Packet)
 	c.fingersLock.Lock()
 	defer c.fingersLock.Unlock()
 	if c.successor == "" || c.successor == c.address {
-		c.successor = pkt.Header.Source
-		c.fingers[0] = pkt.Header.Source
+		c.successor = chordNotifyMsg.Source
+		c.fingers[0] = chordNotifyMsg.Source
 	}
 
 	return nil
@@ -240,6 +303,12 @@ func (c *Chord) execChordRingLenMessage(msg types.Message, pkt transport.Packet)
 		return xerrors.Errorf("wrong type: %T", msg)
 	}
 
+	// Dispatch the message to the chord node it targets, it can be a virtual node hosted by this peer
+	c = c.virtualNode(chordRingLenMsg.Target)
+	if c == nil {
+		return nil
+	}
+
 	// If we are not alive, even we receive some packets, ignore them
 	if c.alive.Load() == 0 {
 		return nil
@@ -259,37 +328,208 @@ func (c *Chord) execChordRingLenMessage(msg types.Message, pkt transport.Packet)
 	defer c.successorLock.RUnlock()
 	if c.successor != "" && c.successor != c.address {
 		chordRingLenMsg.Length++
+		chordRingLenMsg.Target = c.successor
 		chordRingLenMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordRingLenMsg)
 		if err != nil {
 			return err
 		}
-		return c.message.SendDirectMsg(c.successor, c.successor, chordRingLenMsgTrans)
+		return c.sendDirectMsg(c.successor, chordRingLenMsgTrans)
+	}
+	return nil
+}
+
+// execChordQueryRangeMessage is the callback function to handle ChordQueryRangeMessage
+func (c *Chord) execChordQueryRangeMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	chordQueryRangeMsg, ok := msg.(*types.ChordQueryRangeMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	// Dispatch the message to the chord node it targets, it can be a virtual node hosted by this peer
+	c = c.virtualNode(chordQueryRangeMsg.Target)
+	if c == nil {
+		return nil
+	}
+
+	// If we are not alive, even we receive some packets, ignore them
+	if c.alive.Load() == 0 {
+		return nil
+	}
+
+	// Our subrange starts right after the subrange of our predecessor in the walk, or at the start of the
+	// queried range if we are the first node
+	from := chordQueryRangeMsg.Start
+	ranges := chordQueryRangeMsg.Ranges
+	if len(ranges) > 0 {
+		upperBound := uint(math.Pow(2, float64(c.conf.ChordBytes)*8))
+		from = (ranges[len(ranges)-1].End + 1) % upperBound
+
+		// If we have already been visited, either the range wraps around the ring and we own its end as the first
+		// node of the walk, or the successors form a loop, and we return the partial result to the source
+		for i, node := range ranges {
+			if node.Node == c.address {
+				if i == 0 {
+					chordQueryRangeMsg.Ranges = append(ranges, types.ChordRange{
+						Node:  c.address,
+						Start: from,
+						End:   chordQueryRangeMsg.End,
+					})
+				}
+				return c.replyRange(chordQueryRangeMsg)
+			}
+		}
+	}
+
+	// If we own the end of the range, or we are the only node inside the ring, the walk stops here
+	successor := c.GetSuccessor()
+	if successor == "" || successor == c.address || withinRange(chordQueryRangeMsg.End, from, c.chordID) {
+		chordQueryRangeMsg.Ranges = append(ranges, types.ChordRange{
+			Node:  c.address,
+			Start: from,
+			End:   chordQueryRangeMsg.End,
+		})
+		return c.replyRange(chordQueryRangeMsg)
+	}
+
+	// If we do not, we should add our subrange, and pass this message to our successor
+	chordQueryRangeMsg.Ranges = append(ranges, types.ChordRange{
+		Node:  c.address,
+		Start: from,
+		End:   c.chordID,
+	})
+	chordQueryRangeMsg.Target = successor
+	chordQueryRangeMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordQueryRangeMsg)
+	if err != nil {
+		return err
+	}
+	return c.sendDirectMsg(successor, chordQueryRangeMsgTrans)
+}
+
+// execChordReplyRangeMessage is the callback function to handle ChordReplyRangeMessage
+func (c *Chord) execChordReplyRangeMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	chordReplyRangeMsg, ok := msg.(*types.ChordReplyRangeMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	// If we are still waiting for the result, return it
+	rangeChan, ok := c.rangeChan.Load(chordReplyRangeMsg.ReplyPacketID)
+	if ok {
+		select {
+		case rangeChan.(chan []types.ChordRange) <- chordReplyRangeMsg.Ranges:
+		default:
+			// We already received a reply to this request
+		}
 	}
 	return nil
 }
 
+// execChordRingSnapshotMessage is the callback function to handle ChordRingSnapshotMessage
+func (c *Chord) execChordRingSnapshotMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	chordRingSnapshotMsg, ok := msg.(*types.ChordRingSnapshotMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	// Dispatch the message to the chord node it targets, it can be a virtual node hosted by this peer
+	c = c.virtualNode(chordRingSnapshotMsg.Target)
+	if c == nil {
+		return nil
+	}
+
+	// If we are not alive, even we receive some packets, ignore them
+	if c.alive.Load() == 0 {
+		return nil
+	}
+
+	if chordRingSnapshotMsg.Source == c.address {
+		// If we are the one who initiates the ring snapshot, we should return the results, if we are still
+		// waiting for the result
+		ringSnapshotChan, ok := c.ringSnapshotChan.Load(chordRingSnapshotMsg.RequestID)
+		if ok {
+			ringSnapshotChan.(chan []types.ChordNodeInfo) <- chordRingSnapshotMsg.Nodes
+		}
+		return nil
+	}
+
+	// If we have already been visited, the successors form a loop that does not contain the source, the
+	// walk stops here, and we return the partial snapshot to the source
+	next := chordRingSnapshotMsg.Source
+	visited := false
+	for _, node := range chordRingSnapshotMsg.Nodes {
+		if node.Address == c.address {
+			visited = true
+		}
+	}
+
+	// If we are not, we should add our state to the snapshot, and pass this message to our successor, if we
+	// have any
+	if !visited {
+		info := c.nodeInfo()
+		chordRingSnapshotMsg.Nodes = append(chordRingSnapshotMsg.Nodes, info)
+		if info.Successor != "" && info.Successor != c.address {
+			next = info.Successor
+		}
+	}
+	chordRingSnapshotMsg.Target = next
+	chordRingSnapshotMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordRingSnapshotMsg)
+	if err != nil {
+		return err
+	}
+	return c.sendDirectMsg(next, chordRingSnapshotMsgTrans)
+}
+
 // execChordClearPredMessage is the callback function to handle ChordClearPredecessorMessage
 func (c *Chord) execChordClearPredMessage(msg types.Message, pkt transport.Packet) error {
 	/* cast the message to its actual type. You assume it is the right type. */
-	_, ok := msg.(*types.ChordClearPredecessorMessage)
+	chordClearPredecessorMsg, ok := msg.(*types.ChordClearPredecessorMessage)
 	if !ok {
 		return xerrors.Errorf("wrong type: %T", msg)
 	}
 
-	// If we are not alive, even we receive some packets, ignore them
+	// Dispatch the message to the chord node it targets, it can be a virtual node hosted by this peer
+	c = c.virtualNode(chordClearPredecessorMsg.Target)
+	if c == nil {
+		return nil
+	}
+
+	// If we are not alive, even we receive some packets, ignore them. A leaving node still accepts the
+	// message, since its predecessor may leave concurrently
 	if c.alive.Load() == 0 {
 		return nil
 	}
 
+	// The message should be signed by the leaving node, and the new predecessor, if any, should be a verified
+	// member of the ring
+	accepted := c.verifyMessage(chordClearPredecessorMsg.Source, chordClearPredecessorMsg.Signature,
+		"clearpredecessor", chordClearPredecessorMsg.Predecessor, chordClearPredecessorMsg.Source,
+		chordClearPredecessorMsg.Target) && (chordClearPredecessorMsg.Predecessor == "" ||
+		c.verifyMember(chordClearPredecessorMsg.Predecessor, chordClearPredecessorMsg.Credential))
+
 	// If our predecessor matches the pkt source, we are the correct receptor of the message, then
-	// we should set our predecessor field to Nil, and wait for the NotifyMessage for new update
-	c.predecessorLock.Lock()
-	defer c.predecessorLock.Unlock()
-	if c.predecessor == pkt.Header.Source {
-		c.predecessor = ""
+	// we should replace our predecessor by the predecessor of the leaving node. If it is unknown, we wait
+	// for the NotifyMessage for new update
+	if accepted {
+		c.predecessorLock.Lock()
+		accepted = c.predecessor == chordClearPredecessorMsg.Source
+		if accepted {
+			c.predecessor = chordClearPredecessorMsg.Predecessor
+			if c.predecessor != "" {
+				// Our range grows, the entries of the leaving node are already replicated on us
+				c.notifyRangeChange()
+			}
+		}
+		c.predecessorLock.Unlock()
+	}
+	if accepted {
+		// The clear predecessor message is the last one sent by the leaving node
+		c.forgetMember(chordClearPredecessorMsg.Source)
 	}
 
-	return nil
+	return c.replyLeave(chordClearPredecessorMsg.Source, chordClearPredecessorMsg.RequestID, accepted)
 }
 
 // execChordSkipSuccMessage is the callback function to handle ChordSkipSuccessorMessage
@@ -300,21 +540,59 @@ func (c *Chord) execChordSkipSuccMessage(msg types.Message, pkt transport.Packet
 		return xerrors.Errorf("wrong type: %T", msg)
 	}
 
+	// Dispatch the message to the chord node it targets, it can be a virtual node hosted by this peer
+	c = c.virtualNode(chordSkipSuccessorMsg.Target)
+	if c == nil {
+		return nil
+	}
+
 	// If we are not alive, even we receive some packets, ignore them
 	if c.alive.Load() == 0 {
 		return nil
 	}
 
+	// If we are leaving as well, we refuse to skip our successor, it will ask again once we have left and
+	// its predecessor has been updated. The message should be signed by the leaving node, and the new
+	// successor should be a verified member of the ring
+	accepted := c.leaving.Load() == 0 &&
+		c.verifyMessage(chordSkipSuccessorMsg.Source, chordSkipSuccessorMsg.Signature, "skipsuccessor",
+			chordSkipSuccessorMsg.Successor, chordSkipSuccessorMsg.Source, chordSkipSuccessorMsg.Target) &&
+		c.verifyMember(chordSkipSuccessorMsg.Successor, chordSkipSuccessorMsg.Credential)
+
 	// If our successor matches the pkt source, we are the correct receptor of the message, then
 	// we should update our successor to the new successor
-	c.successorLock.Lock()
-	defer c.successorLock.Unlock()
-	c.fingersLock.Lock()
-	defer c.fingersLock.Unlock()
+	if accepted {
+		c.successorLock.Lock()
+		c.fingersLock.Lock()
+		accepted = c.successor == chordSkipSuccessorMsg.Source
+		if accepted {
+			c.successor = chordSkipSuccessorMsg.Successor
+			c.fingers[0] = chordSkipSuccessorMsg.Successor
+			c.skipped = chordSkipSuccessorMsg.Source
+		}
+		c.fingersLock.Unlock()
+		c.successorLock.Unlock()
+	}
+
+	return c.replyLeave(chordSkipSuccessorMsg.Source, chordSkipSuccessorMsg.RequestID, accepted)
+}
+
+// execChordLeaveReplyMessage is the callback function to handle ChordLeaveReplyMessage
+func (c *Chord) execChordLeaveReplyMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	chordLeaveReplyMsg, ok := msg.(*types.ChordLeaveReplyMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
 
-	if c.successor == pkt.Header.Source {
-		c.successor = chordSkipSuccessorMsg.Successor
-		c.fingers[0] = chordSkipSuccessorMsg.Successor
+	// The leaving node is still waiting for the acknowledgement, even if it is not alive anymore
+	leaveChan, ok := c.leaveChan.Load(chordLeaveReplyMsg.ReplyPacketID)
+	if ok {
+		select {
+		case leaveChan.(chan bool) <- chordLeaveReplyMsg.Accepted:
+		default:
+			// We already received a reply to this request
+		}
 	}
 
 	return nil
@@ -364,3 +642,97 @@ func (c *Chord) execChordPingReplyMessage(msg types.Message, pkt transport.Packe
 
 	return nil
 }
+
+// execChordChallengeMessage is the callback function to handle ChordChallengeMessage
+func (c *Chord) execChordChallengeMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	chordChallengeMsg, ok := msg.(*types.ChordChallengeMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	// Dispatch the message to the chord node it targets, it can be a virtual node hosted by this peer
+	c = c.virtualNode(chordChallengeMsg.Target)
+	if c == nil || c.privateKey == nil {
+		return nil
+	}
+
+	// Prove that we hold the private key of our credential by signing the nonce together with our address
+	chordChallengeReplyMsg := types.ChordChallengeReplyMessage{
+		ReplyPacketID: chordChallengeMsg.RequestID,
+		Signature:     c.sign("challenge", c.address, hex.EncodeToString(chordChallengeMsg.Nonce)),
+	}
+	chordChallengeReplyMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordChallengeReplyMsg)
+	if err != nil {
+		return err
+	}
+	return c.message.SendDirectMsg(pkt.Header.Source, pkt.Header.Source, chordChallengeReplyMsgTrans)
+}
+
+// execChordChallengeReplyMessage is the callback function to handle ChordChallengeReplyMessage
+func (c *Chord) execChordChallengeReplyMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	chordChallengeReplyMsg, ok := msg.(*types.ChordChallengeReplyMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	challengeChan, ok := c.challengeChan.Load(chordChallengeReplyMsg.ReplyPacketID)
+	if ok {
+		select {
+		case challengeChan.(chan []byte) <- chordChallengeReplyMsg.Signature:
+		default:
+			// We already received a reply to this challenge
+		}
+	}
+
+	return nil
+}
+
+// execChordRouteMessage is the callback function to handle ChordRouteMessage
+func (c *Chord) execChordRouteMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	chordRouteMsg, ok := msg.(*types.ChordRouteMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	// Dispatch the message to the chord node it targets, it can be a virtual node hosted by this peer
+	c = c.virtualNode(chordRouteMsg.Target)
+	if c == nil {
+		return nil
+	}
+
+	// If we have just left, the message was sent to us before our neighbours knew about our leave, we forward
+	// it to the node taking over our range
+	if c.alive.Load() == 0 {
+		c.successorLock.RLock()
+		forward := c.forward
+		c.successorLock.RUnlock()
+		if forward == "" {
+			return nil
+		}
+
+		chordRouteMsg.Target = forward
+		chordRouteMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordRouteMsg)
+		if err != nil {
+			return err
+		}
+		return c.sendDirectMsg(forward, chordRouteMsgTrans)
+	}
+
+	if !c.validRange(chordRouteMsg.Key) {
+		return nil
+	}
+
+	// The predecessor of the key has designated us as the owner, or we know that we own the key
+	if chordRouteMsg.Final || c.owns(chordRouteMsg.Key) {
+		return c.deliverRoute(chordRouteMsg)
+	}
+
+	if chordRouteMsg.TTL == 0 {
+		return xerrors.Errorf("[%s] routed message to key %d dropped, its TTL expired", c.address, chordRouteMsg.Key)
+	}
+	chordRouteMsg.TTL--
+	return c.forwardRoute(chordRouteMsg)
+}
@@ -0,0 +1,120 @@
+package chord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"go.dedis.ch/cs438/peer"
+	"golang.org/x/xerrors"
+)
+
+// persistKey is the key of the persisted contacts inside the chord store
+const persistKey = "contacts"
+
+// persistedContacts describes the remote chord nodes we knew as a member of a ring, they are the entry points
+// to rejoin the ring after a restart
+type persistedContacts struct {
+	// Successors are the successors of the chord nodes hosted by the peer, they are tried first
+	Successors []string
+
+	// Fingers are the other entries of the finger tables, from the closest to the farthest one
+	Fingers []string
+}
+
+// persist saves the successors and the fingers of all chord nodes hosted by the peer inside the chord store,
+// if they have changed since the last time. Nothing is saved unless the peer is a member of a ring, so that a
+// peer that has left does not rejoin its previous ring after a restart.
+func (c *Chord) persist() {
+	primary := c.vnodes[0]
+	primary.persistLock.Lock()
+	defer primary.persistLock.Unlock()
+
+	if primary.GetState() != peer.ChordMember {
+		return
+	}
+
+	contacts := persistedContacts{
+		Successors: make([]string, 0, len(c.vnodes)),
+		Fingers:    make([]string, 0),
+	}
+	seen := make(map[string]struct{})
+	add := func(list []string, address string) []string {
+		if address == "" || c.IsLocal(address) {
+			return list
+		}
+		if _, ok := seen[address]; ok {
+			return list
+		}
+		seen[address] = struct{}{}
+		return append(list, address)
+	}
+
+	for _, vnode := range c.vnodes {
+		contacts.Successors = add(contacts.Successors, vnode.GetSuccessor())
+	}
+	for _, vnode := range c.vnodes {
+		for _, finger := range vnode.GetFingerTable() {
+			contacts.Fingers = add(contacts.Fingers, finger)
+		}
+	}
+	if len(contacts.Successors) == 0 && len(contacts.Fingers) == 0 {
+		// We are alone inside our ring, we keep the contacts of the ring we were a member of before, if any
+		return
+	}
+
+	contactsByte, err := json.Marshal(contacts)
+	if err != nil {
+		log.Error().Err(err).Msg(fmt.Sprintf("[%s] persist Marshal failed!", c.address))
+		return
+	}
+	if bytes.Equal(contactsByte, primary.persisted) {
+		return
+	}
+	c.conf.Storage.GetChordStore().Set(persistKey, contactsByte)
+	primary.persisted = contactsByte
+}
+
+// forget deletes the persisted contacts, once the peer has left its ring
+func (c *Chord) forget() {
+	primary := c.vnodes[0]
+	primary.persistLock.Lock()
+	defer primary.persistLock.Unlock()
+
+	c.conf.Storage.GetChordStore().Delete(persistKey)
+	primary.persisted = nil
+}
+
+// Rejoin rejoins the ring the peer was a member of before a restart, through the contacts persisted inside the
+// chord store. The successors are tried first, then the fingers, until the join succeeds through one of them.
+// It does nothing if no contact has been persisted, e.g., if the peer was alone or has left its ring.
+func (c *Chord) Rejoin() error {
+	contactsByte := c.conf.Storage.GetChordStore().Get(persistKey)
+	if contactsByte == nil {
+		return nil
+	}
+
+	var contacts persistedContacts
+	err := json.Unmarshal(contactsByte, &contacts)
+	if err != nil {
+		return xerrors.Errorf("[%s] failed to read the persisted contacts: %v", c.address, err)
+	}
+
+	var joinErr error
+	for _, contact := range append(contacts.Successors, contacts.Fingers...) {
+		if c.IsLocal(contact) {
+			continue
+		}
+		state := c.GetState()
+		if state != peer.ChordIdle && (state != peer.ChordMember || !c.alone()) {
+			// The peer has joined a ring by other means in the meantime
+			return nil
+		}
+
+		joinErr = c.Join(contact)
+		if joinErr == nil {
+			return nil
+		}
+	}
+	return xerrors.Errorf("[%s] failed to rejoin the ring through any persisted contact: %v", c.address, joinErr)
+}
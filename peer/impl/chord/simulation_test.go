@@ -0,0 +1,248 @@
+package chord
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/clock/virtual"
+	"go.dedis.ch/cs438/peer"
+	"go.dedis.ch/cs438/peer/impl/message"
+	"go.dedis.ch/cs438/registry/standard"
+	"go.dedis.ch/cs438/storage/inmemory"
+	"go.dedis.ch/cs438/transport"
+	"go.dedis.ch/cs438/transport/channel"
+	"go.dedis.ch/cs438/types"
+)
+
+const simLatency = time.Millisecond * 10
+const simStabilizeInterval = time.Second
+const simFixFingerInterval = time.Millisecond * 250
+
+// simMaxConvergence bounds the virtual time the stabilization takes to repair the successors and predecessors
+// after a wave of concurrent joins or leaves. The nodes arriving between the same pair of members are inserted
+// one stabilization after another, hence a bound of several intervals.
+const simMaxConvergence = simStabilizeInterval * 16
+
+// simulation runs chord nodes on a simulated network, in virtual time
+type simulation struct {
+	t     *testing.T
+	rng   *rand.Rand
+	clock *virtual.Clock
+	net   *channel.Simulation
+	ids   map[uint]bool // The IDs already taken inside the ring
+}
+
+func newSimulation(t *testing.T) *simulation {
+	clock := virtual.NewClock(time.Unix(0, 0))
+	return &simulation{
+		t:     t,
+		rng:   rand.New(rand.NewSource(1)),
+		clock: clock,
+		net:   channel.NewSimulation(clock, simLatency),
+		ids:   make(map[uint]bool),
+	}
+}
+
+// newNode creates a chord node whose ID is not taken yet, and starts its daemons
+func (s *simulation) newNode() *Chord {
+	conf := &peer.Configuration{
+		MessageRegistry:        standard.NewRegistry(),
+		Storage:                inmemory.NewPersistency(),
+		Clock:                  s.clock,
+		ChordBytes:             2,
+		ChordTimeout:           time.Second * 5,
+		ChordStabilizeInterval: simStabilizeInterval,
+		ChordFixFingerInterval: simFixFingerInterval,
+	}
+
+	// The ring only has 2^16 IDs, the addresses whose ID is taken are skipped
+	var address string
+	for {
+		address = fmt.Sprintf("10.%d.%d.%d:%d", s.rng.Intn(256), s.rng.Intn(256), s.rng.Intn(256),
+			1024+s.rng.Intn(60000))
+		id := (&Chord{conf: conf}).Name2ID(address)
+		if !s.ids[id] {
+			s.ids[id] = true
+			break
+		}
+	}
+
+	socket, err := s.net.CreateSocket(address)
+	require.NoError(s.t, err)
+	conf.Socket = socket
+
+	node := NewChord(conf, message.NewMessage(conf))
+
+	// The DHash is not part of the simulation
+	ignore := func(types.Message, transport.Packet) error { return nil }
+	conf.MessageRegistry.RegisterMessageCallback(types.DHashUpdRangeMessage{}, ignore)
+
+	s.net.Handle(address, func(pkt transport.Packet) {
+		// The errors of the handlers are logged by the peer, the packet is simply dropped
+		_ = conf.MessageRegistry.ProcessPacket(pkt)
+	})
+	node.StartDaemon()
+
+	return node
+}
+
+// run calls f on each node concurrently, and runs the simulation until all calls have returned
+func (s *simulation) run(nodes []*Chord, f func(i int, node *Chord) error) {
+	var done atomic.Int32
+	var errsLock sync.Mutex
+	errs := make([]error, 0)
+
+	for i, node := range nodes {
+		go func(i int, node *Chord) {
+			defer done.Add(1)
+			err := f(i, node)
+			if err != nil {
+				errsLock.Lock()
+				errs = append(errs, err)
+				errsLock.Unlock()
+			}
+		}(i, node)
+	}
+
+	ok := s.net.RunUntil(func() bool { return int(done.Load()) == len(nodes) }, time.Minute)
+	require.True(s.t, ok)
+	require.Empty(s.t, errs)
+}
+
+// join makes the nodes join the ring concurrently, each of them through a random member
+func (s *simulation) join(nodes []*Chord, members []*Chord) {
+	via := make([]string, len(nodes))
+	for i := range nodes {
+		via[i] = members[s.rng.Intn(len(members))].address
+	}
+	s.run(nodes, func(i int, node *Chord) error {
+		return node.Join(via[i])
+	})
+}
+
+// converge runs the simulation until the successors and predecessors of all members form the ring, it returns
+// the virtual time it took
+func (s *simulation) converge(members []*Chord) time.Duration {
+	start := s.clock.Now()
+	ok := s.net.RunUntil(func() bool { return converged(members) }, time.Minute*10)
+	require.True(s.t, ok)
+	return s.clock.Since(start)
+}
+
+// checkLookups looks up random keys from random members, and checks that the owner of each key is found
+func (s *simulation) checkLookups(members []*Chord, numLookups int) {
+	sorted := sortRing(members)
+	from := make([]*Chord, numLookups)
+	keys := make([]uint, numLookups)
+	for i := range keys {
+		from[i] = members[s.rng.Intn(len(members))]
+		keys[i] = uint(s.rng.Intn(int(math.Pow(2, 16))))
+	}
+
+	results := make([]string, numLookups)
+	s.run(from, func(i int, node *Chord) error {
+		successor, err := node.QuerySuccessor(node.address, keys[i])
+		results[i] = successor
+		return err
+	})
+
+	for i, key := range keys {
+		owner := sorted[sort.Search(len(sorted), func(j int) bool { return sorted[j].chordID >= key })%len(sorted)]
+		require.Equal(s.t, owner.address, results[i], "lookup of key %d from %s", key, from[i].address)
+	}
+}
+
+// sortRing returns the nodes ordered by chordID
+func sortRing(nodes []*Chord) []*Chord {
+	sorted := make([]*Chord, len(nodes))
+	copy(sorted, nodes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].chordID < sorted[j].chordID })
+	return sorted
+}
+
+// converged checks that the successor and the predecessor of every node are its neighbours inside the ring
+func converged(nodes []*Chord) bool {
+	sorted := sortRing(nodes)
+	for i, node := range sorted {
+		successor := sorted[(i+1)%len(sorted)]
+		predecessor := sorted[(i+len(sorted)-1)%len(sorted)]
+		if node.GetSuccessor() != successor.address || node.GetPredecessor() != predecessor.address {
+			return false
+		}
+	}
+	return true
+}
+
+// Test_Chord_Simulation_Large_Ring builds a ring of 512 nodes in virtual time, by doubling its size at each wave
+// of concurrent joins, and checks that the stabilization converges within a bounded number of intervals and
+// that the lookups find the owner of the keys. Then 64 members leave while 64 new nodes join, and the ring must
+// converge again.
+func Test_Chord_Simulation_Large_Ring(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the simulation of a large ring is skipped in short mode")
+	}
+
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer zerolog.SetGlobalLevel(level)
+
+	s := newSimulation(t)
+
+	members := []*Chord{s.newNode()}
+	for len(members) < 512 {
+		wave := make([]*Chord, len(members))
+		for i := range wave {
+			wave[i] = s.newNode()
+		}
+		s.join(wave, members)
+		members = append(members, wave...)
+
+		elapsed := s.converge(members)
+		t.Logf("%d nodes converged in %v", len(members), elapsed)
+		require.LessOrEqual(t, elapsed, simMaxConvergence)
+	}
+
+	// Let the fingers be fixed, 16 fingers are refreshed one after another
+	s.net.Run(simFixFingerInterval * 16 * 2)
+	s.checkLookups(members, 200)
+
+	// Churn: some members leave while new nodes join
+	s.rng.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	leaving, staying := members[:64], members[64:]
+	joining := make([]*Chord, 64)
+	for i := range joining {
+		joining[i] = s.newNode()
+	}
+	via := make([]string, len(joining))
+	for i := range joining {
+		via[i] = staying[s.rng.Intn(len(staying))].address
+	}
+
+	churn := append(append([]*Chord{}, leaving...), joining...)
+	s.run(churn, func(i int, node *Chord) error {
+		if i < len(leaving) {
+			return node.Leave()
+		}
+		return node.Join(via[i-len(leaving)])
+	})
+	members = append(staying, joining...)
+
+	elapsed := s.converge(members)
+	t.Logf("the ring converged in %v after the churn", elapsed)
+	require.LessOrEqual(t, elapsed, simMaxConvergence)
+
+	s.net.Run(simFixFingerInterval * 16 * 2)
+	s.checkLookups(members, 200)
+
+	for _, node := range members {
+		node.StopDaemon()
+	}
+}
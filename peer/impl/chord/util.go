@@ -2,13 +2,20 @@ package chord
 
 import (
 	"crypto"
+	"fmt"
 	"github.com/rs/zerolog/log"
 	"go.dedis.ch/cs438/transport"
 	"go.dedis.ch/cs438/types"
+	"golang.org/x/xerrors"
 	"math"
 	"math/big"
+	"strings"
+	"time"
 )
 
+// virtualSep separates the socket address of the peer and the index of a virtual chord node it hosts
+const virtualSep = "#"
+
 // validRange checks that a given key is within a valid range, the value of the key is valid if
 // it is greater than or equal to 0, and it is lower than the upperBound, the upperBound is
 // defined by the ChordBytes inside the configuration
@@ -42,7 +49,7 @@ func (c *Chord) isPredecessor(key uint) bool {
 		return true
 	}
 
-	successorID := c.Name2ID(c.successor)
+	successorID := c.NodeID(c.successor)
 	if successorID <= c.chordID {
 		// If the successorID is smaller than our chordID, it means we are crossing the boundary of the
 		// ring. For example, the successorID = 2, and c.chordID = 15, and the ring has length = 16. Since
@@ -54,6 +61,16 @@ func (c *Chord) isPredecessor(key uint) bool {
 	return c.chordID < key && key <= successorID
 }
 
+// owns checks whether the key is within our range (predecessor, chordID], it returns false if our predecessor
+// is not known yet
+func (c *Chord) owns(key uint) bool {
+	predecessor := c.GetPredecessor()
+	if predecessor == "" || predecessor == c.address {
+		return false
+	}
+	return key == c.chordID || withinRing(key, c.NodeID(predecessor), c.chordID)
+}
+
 // fingerStartEnd computes the interval of a finger, it returns two uint, indicates the start and end. The
 // finger interval is [start, end)
 func (c *Chord) fingerStartEnd(idx int) (uint, uint) {
@@ -70,7 +87,7 @@ func (c *Chord) closestPrecedingFinger(key uint) string {
 		// If c.chordID == key, then we should return the first non-empty entry we encountered during
 		// the lookup.
 		if c.fingers[i] != "" {
-			fingerID := c.Name2ID(c.fingers[i])
+			fingerID := c.NodeID(c.fingers[i])
 			within := false
 
 			if key < c.chordID {
@@ -87,29 +104,446 @@ func (c *Chord) closestPrecedingFinger(key uint) string {
 	return ""
 }
 
-// notifyPasswordCracker notifies the password cracker the change of predecessor of the node, i.e., the password
-// cracker should change the pre-compute dictionary they are storing
-func (c *Chord) notifyPasswordCracker() {
-	newPredecessor := c.predecessor
-	start := c.Name2ID(newPredecessor)
-	updatePasswordCracker := func() {
-		passwordCrackerUpdDictRangeMsg := types.PasswordCrackerUpdDictRangeMessage{
-			Start: start,
-			End:   c.chordID,
+// withinRange checks whether the key is within the closed interval [start, end] of the ring, the interval is
+// crossing the boundary of the ring if start > end, and it only contains start if start == end
+func withinRange(key uint, start uint, end uint) bool {
+	if start == end {
+		return key == start
+	}
+	return key == start || key == end || withinRing(key, start, end)
+}
+
+// withinFinger checks whether the key is within the finger interval [start, end)
+func withinFinger(key uint, start uint, end uint) bool {
+	return key == start || withinRing(key, start, end)
+}
+
+// queryCandidates queries the candidate nodes of the finger interval [start, end), i.e., up to
+// ChordFingerCandidates consecutive nodes whose IDs fall into the interval, starting from the successor of
+// start. If the successor of start is not within the interval, it is the only candidate.
+func (c *Chord) queryCandidates(start uint, end uint) ([]string, error) {
+	successor, err := c.QuerySuccessor(c.address, start)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []string{successor}
+
+	upperBound := uint(math.Pow(2, float64(c.conf.ChordBytes)*8))
+	for len(candidates) < c.conf.ChordFingerCandidates {
+		successorID := c.NodeID(successor)
+		if !withinFinger(successorID, start, end) {
+			break
+		}
+
+		// The next candidate is the successor of the last one, if it is still within the interval
+		next, err := c.QuerySuccessor(c.address, (successorID+1)%upperBound)
+		if err != nil {
+			return candidates, err
+		}
+		if next == "" || next == candidates[0] || !withinFinger(c.NodeID(next), start, end) {
+			break
+		}
+		candidates = append(candidates, next)
+		successor = next
+	}
+	return candidates, nil
+}
+
+// closestCandidate returns the candidate with the lowest round-trip time. The candidates whose round-trip
+// time is not measured yet come after the measured ones, and ties keep the order of the candidates, so that
+// the successor of the start of the interval is preferred. It returns an empty string if there is no candidate
+func (c *Chord) closestCandidate(candidates []string) string {
+	closest := ""
+	var closestRTT time.Duration
+	closestKnown := false
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		rtt, known := c.getRTT(candidate)
+		if closest == "" || (known && (!closestKnown || rtt < closestRTT)) {
+			closest = candidate
+			closestRTT = rtt
+			closestKnown = known
+		}
+	}
+	return closest
+}
+
+// removeCandidate removes the given node from the candidates
+func removeCandidate(candidates []string, address string) []string {
+	res := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate != address {
+			res = append(res, candidate)
+		}
+	}
+	return res
+}
+
+// recordRTT records a round-trip time measured with the peer hosting the given chord node. The recorded value
+// is smoothed with the previous measurements, with a weight of 1/2 for the new one, so that a transient
+// congestion is quickly forgotten
+func (c *Chord) recordRTT(address string, rtt time.Duration) {
+	host := HostAddress(address)
+	prev, ok := c.rtt.Load(host)
+	if ok {
+		rtt = (prev.(time.Duration) + rtt) / 2
+	}
+	c.rtt.Store(host, rtt)
+}
+
+// getRTT returns the round-trip time measured with the peer hosting the given chord node, if any
+func (c *Chord) getRTT(address string) (time.Duration, bool) {
+	rtt, ok := c.rtt.Load(HostAddress(address))
+	if !ok {
+		return 0, false
+	}
+	return rtt.(time.Duration), true
+}
+
+// nodeInfo returns the current state of the chord node, as it is collected in a ring snapshot
+func (c *Chord) nodeInfo() types.ChordNodeInfo {
+	info := types.ChordNodeInfo{
+		Address:     c.address,
+		ChordID:     c.chordID,
+		Predecessor: c.GetPredecessor(),
+		Successor:   c.GetSuccessor(),
+		RangeStart:  c.chordID,
+		RangeEnd:    c.chordID,
+	}
+	if info.Predecessor != "" {
+		info.RangeStart = c.NodeID(info.Predecessor)
+	}
+	return info
+}
+
+// withinRing checks whether the key is within the open interval (start, end) of the ring, the interval is
+// crossing the boundary of the ring if start >= end
+func withinRing(key uint, start uint, end uint) bool {
+	if start < end {
+		return start < key && key < end
+	}
+	return start < key || key < end
+}
+
+// checkRing detects the inconsistencies of a ring snapshot, the nodes are given in the order of the walk
+// along the successors. It checks that the walk returns to the first node, that the predecessor and the
+// successor of neighbouring nodes are symmetric, and that the ranges of the nodes neither leave a gap nor
+// overlap.
+func checkRing(nodes []types.ChordNodeInfo) []string {
+	inconsistencies := make([]string, 0)
+	if len(nodes) == 0 {
+		return append(inconsistencies, "the ring is empty")
+	}
+
+	// A single node owns the whole ring, it should not point to any other node
+	if len(nodes) == 1 {
+		node := nodes[0]
+		if node.Successor != "" && node.Successor != node.Address {
+			inconsistencies = append(inconsistencies,
+				fmt.Sprintf("%s is alone in the ring but has successor %s", node.Address, node.Successor))
+		}
+		if node.Predecessor != "" && node.Predecessor != node.Address {
+			inconsistencies = append(inconsistencies,
+				fmt.Sprintf("%s is alone in the ring but has predecessor %s", node.Address, node.Predecessor))
+		}
+		return inconsistencies
+	}
+
+	last := nodes[len(nodes)-1]
+	if last.Successor != nodes[0].Address {
+		inconsistencies = append(inconsistencies,
+			fmt.Sprintf("the walk does not return to %s, it stops at %s whose successor is %q",
+				nodes[0].Address, last.Address, last.Successor))
+	}
+
+	for i, node := range nodes {
+		prev := nodes[(i-1+len(nodes))%len(nodes)]
+		if prev.Successor != node.Address {
+			// The walk does not close, there is no neighbouring relation between the last and the first node
+			continue
+		}
+
+		// Symmetry of the predecessor and the successor
+		if node.Predecessor != prev.Address {
+			inconsistencies = append(inconsistencies,
+				fmt.Sprintf("%s is the successor of %s, but its predecessor is %q",
+					node.Address, prev.Address, node.Predecessor))
+		}
+
+		// The range of the node should start right after the range of its predecessor
+		if node.Predecessor == "" {
+			inconsistencies = append(inconsistencies,
+				fmt.Sprintf("%s has no predecessor, its range is unknown", node.Address))
+		} else if node.RangeStart != prev.RangeEnd {
+			if withinRing(node.RangeStart, prev.RangeEnd, node.RangeEnd) {
+				inconsistencies = append(inconsistencies,
+					fmt.Sprintf("gap between %s and %s: keys (%d, %d] are not owned",
+						prev.Address, node.Address, prev.RangeEnd, node.RangeStart))
+			} else {
+				inconsistencies = append(inconsistencies,
+					fmt.Sprintf("overlap between %s and %s: %s starts its range at %d",
+						prev.Address, node.Address, node.Address, node.RangeStart))
+			}
+		}
+	}
+	return inconsistencies
+}
+
+// virtualAddress computes the address of the idx-th chord node hosted by the peer with the given socket
+// address. The primary node (idx = 0) has the socket address of the peer, the virtual nodes have the socket
+// address suffixed by their index, e.g., 127.0.0.1:1#2
+func virtualAddress(host string, idx int) string {
+	if idx == 0 {
+		return host
+	}
+	return fmt.Sprintf("%s%s%d", host, virtualSep, idx)
+}
+
+// HostAddress returns the socket address of the peer hosting the given chord node, i.e., it removes
+// the virtual node suffix of the address, if any
+func HostAddress(address string) string {
+	return strings.Split(address, virtualSep)[0]
+}
+
+// virtualNode returns the chord node hosted by this peer that has the given address, an empty address
+// designates the primary node. It returns nil if the peer does not host such a node
+func (c *Chord) virtualNode(address string) *Chord {
+	if address == "" {
+		return c.vnodes[0]
+	}
+	for _, vnode := range c.vnodes {
+		if vnode.address == address {
+			return vnode
+		}
+	}
+	return nil
+}
+
+// sendDirectMsg sends the message to the peer hosting the given chord node
+func (c *Chord) sendDirectMsg(address string, msg transport.Message) error {
+	host := HostAddress(address)
+	return c.message.SendDirectMsg(host, host, msg)
+}
+
+// replyLeave acknowledges the leave request of a neighbour, telling it whether we updated our pointer
+func (c *Chord) replyLeave(neighbour string, requestID string, accepted bool) error {
+	chordLeaveReplyMsg := types.ChordLeaveReplyMessage{
+		ReplyPacketID: requestID,
+		Accepted:      accepted,
+	}
+	chordLeaveReplyMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordLeaveReplyMsg)
+	if err != nil {
+		return err
+	}
+	return c.sendDirectMsg(neighbour, chordLeaveReplyMsgTrans)
+}
+
+// replyRange replies to the source of the range query with the subranges collected during the walk
+func (c *Chord) replyRange(chordQueryRangeMsg *types.ChordQueryRangeMessage) error {
+	chordReplyRangeMsg := types.ChordReplyRangeMessage{
+		ReplyPacketID: chordQueryRangeMsg.RequestID,
+		Ranges:        chordQueryRangeMsg.Ranges,
+	}
+	chordReplyRangeMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordReplyRangeMsg)
+	if err != nil {
+		return err
+	}
+	return c.sendDirectMsg(chordQueryRangeMsg.Source, chordReplyRangeMsgTrans)
+}
+
+// replySuccessor replies to the source of the query with the successor of the queried key
+func (c *Chord) replySuccessor(chordQueryMsg *types.ChordQuerySuccessorMessage, successor string) error {
+	chordReplyMsg := types.ChordReplySuccessorMessage{
+		ReplyPacketID: chordQueryMsg.RequestID,
+		Successor:     successor,
+		Credential:    c.getCredential(successor),
+	}
+	chordReplyMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordReplyMsg)
+	if err != nil {
+		return err
+	}
+	return c.sendDirectMsg(chordQueryMsg.Source, chordReplyMsgTrans)
+}
+
+// forwardQuery forwards a query that reached the chord node after it left the ring to the node taking over its
+// range. The query is dropped if the leave window is over, the querying node will time out.
+func (c *Chord) forwardQuery(chordQueryMsg *types.ChordQuerySuccessorMessage) error {
+	c.successorLock.RLock()
+	forward := c.forward
+	c.successorLock.RUnlock()
+	if forward == "" {
+		return nil
+	}
+
+	chordQueryMsg.Target = forward
+	chordQueryMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordQueryMsg)
+	if err != nil {
+		return err
+	}
+	return c.sendDirectMsg(forward, chordQueryMsgTrans)
+}
+
+// forwardRoute forwards a routed message to the next hop towards the owner of its key: our successor if we are
+// the predecessor of the key, the closest preceding finger otherwise. The message is delivered to us if we are
+// alone in the ring.
+func (c *Chord) forwardRoute(chordRouteMsg *types.ChordRouteMessage) error {
+	c.successorLock.RLock()
+	c.fingersLock.RLock()
+	successor := c.successor
+	next := ""
+	if chordRouteMsg.Key == c.chordID {
+		next = c.address
+	} else if c.isPredecessor(chordRouteMsg.Key) {
+		next = successor
+		chordRouteMsg.Final = true
+	} else {
+		next = c.closestPrecedingFinger(chordRouteMsg.Key)
+		if next == "" || next == c.address {
+			next = successor
+		}
+	}
+	c.fingersLock.RUnlock()
+	c.successorLock.RUnlock()
+
+	if next == "" || next == c.address {
+		return c.deliverRoute(chordRouteMsg)
+	}
+
+	chordRouteMsg.Target = next
+	chordRouteMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(chordRouteMsg)
+	if err != nil {
+		return err
+	}
+	return c.sendDirectMsg(next, chordRouteMsgTrans)
+}
+
+// deliverRoute processes the payload of a routed message, as if its source had sent it directly to us. A
+// message for a given peer is dropped if we own the key instead of it. If the authentication is enabled, the
+// source should be a verified member of the ring and the message should be signed by it, so that the payload can
+// not be processed as if it had been sent by another peer, the message is dropped otherwise.
+func (c *Chord) deliverRoute(chordRouteMsg *types.ChordRouteMessage) error {
+	if chordRouteMsg.Destination != "" && chordRouteMsg.Destination != c.host {
+		return xerrors.Errorf("[%s] routed message for %s reached the owner of its key instead",
+			c.address, chordRouteMsg.Destination)
+	}
+	if chordRouteMsg.Msg == nil || !c.verifyMember(chordRouteMsg.Source, chordRouteMsg.Credential) ||
+		!c.verifyMessage(chordRouteMsg.Source, chordRouteMsg.Signature, routeParts(chordRouteMsg)...) {
+		log.Warn().Msg(fmt.Sprintf("[%s] rejected a routed message from %s, its source is not authenticated",
+			c.address, chordRouteMsg.Source))
+		return nil
+	}
+
+	header := transport.NewHeader(chordRouteMsg.Source, c.host, c.host, 0)
+	localPkt := transport.Packet{Header: &header, Msg: chordRouteMsg.Msg}
+	return c.conf.MessageRegistry.ProcessPacket(localPkt)
+}
+
+// routeParts returns the parts of a routed message signed by its source. The parts updated by the hops along the
+// route are not signed.
+func routeParts(chordRouteMsg *types.ChordRouteMessage) []string {
+	return []string{"route", chordRouteMsg.Source, chordRouteMsg.Destination, fmt.Sprint(chordRouteMsg.Key),
+		chordRouteMsg.Msg.Type, string(chordRouteMsg.Msg.Payload)}
+}
+
+// notifyRangeChange notifies the callbacks registered with OnRangeChange, e.g., the password cracker, about the
+// change of predecessor of the node. The range of the peer is the union of the ranges of all chord nodes it hosts.
+func (c *Chord) notifyRangeChange() {
+	updateRange := func() {
+		ranges := make([]types.SaltRange, 0, len(c.vnodes))
+		for _, vnode := range c.vnodes {
+			predecessor := vnode.GetPredecessor()
+			if predecessor == "" {
+				continue
+			}
+			ranges = append(ranges, types.SaltRange{Start: c.NodeID(predecessor), End: vnode.chordID})
+		}
+		if len(ranges) == 0 {
+			// None of our predecessors is known, e.g., while we rejoin the ring after a restart, the range is
+			// unknown rather than empty and the callbacks keep the previous one
+			return
+		}
+
+		primary := c.vnodes[0]
+		primary.rangeLock.Lock()
+		callbacks := append([]func([]types.SaltRange){}, primary.rangeCallbacks...)
+		primary.rangeLock.Unlock()
+
+		for _, callback := range callbacks {
+			callback(ranges)
+		}
+	}
+	go updateRange()
+}
+
+// notifyDHash notifies the DHash the change of predecessor of the node, i.e., the DHash should hand over the
+// entries that are now owned by the new predecessor
+func (c *Chord) notifyDHash(oldPredecessor string, newPredecessor string) {
+	updateDHash := func() {
+		dHashUpdRangeMsg := types.DHashUpdRangeMessage{
+			Node:           c.address,
+			OldPredecessor: oldPredecessor,
+			NewPredecessor: newPredecessor,
 		}
-		passwordCrackerUpdDictRangeMsgTrans, err :=
-			c.conf.MessageRegistry.MarshalMessage(passwordCrackerUpdDictRangeMsg)
+		dHashUpdRangeMsgTrans, err := c.conf.MessageRegistry.MarshalMessage(dHashUpdRangeMsg)
 		if err != nil {
-			log.Error().Err(err).Msg("updatePasswordCracker Marshal")
+			log.Error().Err(err).Msg("updateDHash Marshal")
 		}
 
-		// Process message locally, it will update the password_cracker module
-		header := transport.NewHeader(c.address, c.address, c.address, 0)
-		localPkt := transport.Packet{Header: &header, Msg: &passwordCrackerUpdDictRangeMsgTrans}
+		// Process message locally, it will update the dhash module
+		header := transport.NewHeader(c.host, c.host, c.host, 0)
+		localPkt := transport.Packet{Header: &header, Msg: &dHashUpdRangeMsgTrans}
 		err = c.conf.MessageRegistry.ProcessPacket(localPkt)
 		if err != nil {
-			log.Error().Err(err).Msg("updatePasswordCracker ProcessPacket")
+			log.Error().Err(err).Msg("updateDHash ProcessPacket")
+		}
+	}
+	go updateDHash()
+}
+
+// LocalOwner returns the chord node hosted by this peer that owns the given key, i.e., the node whose range
+// (predecessor, chordID] contains the key. It returns an empty string if the key is owned by a remote node, or
+// if the range of the owner is not known yet
+func (c *Chord) LocalOwner(key uint) string {
+	for _, vnode := range c.vnodes {
+		if vnode.GetSuccessor() == "" || vnode.GetSuccessor() == vnode.address {
+			// We are the only node inside the ring, we own all keys
+			return vnode.address
+		}
+		predecessor := vnode.GetPredecessor()
+		if predecessor == "" {
+			continue
+		}
+		if key == vnode.chordID || withinRing(key, c.NodeID(predecessor), vnode.chordID) {
+			return vnode.address
+		}
+	}
+	return ""
+}
+
+// RemoteSuccessor returns the first successor of the given chord node hosted by this peer, which is not hosted
+// by this peer. It returns an empty string if there is no such successor, e.g., all nodes of the ring are
+// hosted by this peer
+func (c *Chord) RemoteSuccessor(address string) string {
+	successor := address
+	for i := 0; i < len(c.vnodes); i++ {
+		vnode := c.virtualNode(successor)
+		if vnode == nil {
+			return successor
 		}
+		successor = vnode.GetSuccessor()
+		if successor == "" {
+			return ""
+		}
+	}
+	if c.virtualNode(successor) != nil {
+		return ""
 	}
-	go updatePasswordCracker()
+	return successor
+}
+
+// IsLocal checks whether the given chord node is hosted by this peer
+func (c *Chord) IsLocal(address string) bool {
+	return address != "" && c.virtualNode(address) != nil
 }
@@ -1,11 +1,17 @@
 package chord
 
 import (
+	"encoding/hex"
 	"fmt"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/cs438/peer"
+	"go.dedis.ch/cs438/storage"
+	"go.dedis.ch/cs438/storage/inmemory"
+	"go.dedis.ch/cs438/types"
 	"math"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Test_Valid_Range tests the validRange function
@@ -200,3 +206,249 @@ func Test_Closest_Preceding_Finger(t *testing.T) {
 		require.Equal(t, c.fingers[7], c.closestPrecedingFinger((203+i)%256))
 	}
 }
+
+// Test_Virtual_Address tests the virtualAddress and HostAddress functions
+func Test_Virtual_Address(t *testing.T) {
+	host := "127.0.0.1:1"
+
+	// The primary node has the address of the peer
+	require.Equal(t, host, virtualAddress(host, 0))
+	require.Equal(t, host, HostAddress(host))
+
+	// Virtual nodes have distinct addresses, but they are all hosted by the same peer
+	seen := map[string]struct{}{}
+	for i := 1; i < 8; i++ {
+		address := virtualAddress(host, i)
+		require.Equal(t, fmt.Sprintf("127.0.0.1:1#%d", i), address)
+		require.Equal(t, host, HostAddress(address))
+
+		_, ok := seen[address]
+		require.False(t, ok)
+		seen[address] = struct{}{}
+	}
+}
+
+// Test_Check_Ring tests the checkRing function, on a consistent ring and on rings with broken symmetry, gaps
+// and overlaps
+func Test_Check_Ring(t *testing.T) {
+	ring := func() []types.ChordNodeInfo {
+		return []types.ChordNodeInfo{
+			{Address: "A", ChordID: 10, Predecessor: "C", Successor: "B", RangeStart: 200, RangeEnd: 10},
+			{Address: "B", ChordID: 100, Predecessor: "A", Successor: "C", RangeStart: 10, RangeEnd: 100},
+			{Address: "C", ChordID: 200, Predecessor: "B", Successor: "A", RangeStart: 100, RangeEnd: 200},
+		}
+	}
+
+	// A single node and a consistent ring
+	require.Empty(t, checkRing([]types.ChordNodeInfo{{Address: "A", ChordID: 10, RangeStart: 10, RangeEnd: 10}}))
+	require.Empty(t, checkRing(ring()))
+
+	// The walk does not return to the first node
+	nodes := ring()
+	nodes[2].Successor = "B"
+	require.Len(t, checkRing(nodes), 1)
+
+	// Broken symmetry, the predecessor of B points to C, which makes the ranges of B and C overlap
+	nodes = ring()
+	nodes[1].Predecessor = "C"
+	nodes[1].RangeStart = 200
+	inconsistencies := checkRing(nodes)
+	require.Len(t, inconsistencies, 2)
+	require.Contains(t, inconsistencies[1], "overlap")
+
+	// Gap, the predecessor of C is unknown to the ring, keys (100, 150] are not owned
+	nodes = ring()
+	nodes[2].Predecessor = "D"
+	nodes[2].RangeStart = 150
+	inconsistencies = checkRing(nodes)
+	require.Len(t, inconsistencies, 2)
+	require.Contains(t, inconsistencies[1], "gap")
+
+	// No predecessor, the range is unknown
+	nodes = ring()
+	nodes[0].Predecessor = ""
+	nodes[0].RangeStart = nodes[0].RangeEnd
+	require.Len(t, checkRing(nodes), 2)
+}
+
+// Test_Closest_Candidate tests the closestCandidate function, and the recording of the round-trip time
+func Test_Closest_Candidate(t *testing.T) {
+	c := Chord{}
+	c.rtt = &sync.Map{}
+
+	candidates := []string{"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3#1"}
+
+	// Without any measurement, the first candidate is preferred
+	require.Equal(t, "", c.closestCandidate(nil))
+	require.Equal(t, "127.0.0.1:1", c.closestCandidate(candidates))
+
+	// A measured candidate is preferred over the unknown ones
+	c.recordRTT("127.0.0.1:2", time.Millisecond*80)
+	require.Equal(t, "127.0.0.1:2", c.closestCandidate(candidates))
+
+	// The round-trip time is measured per peer, virtual nodes share the one of their host
+	c.recordRTT("127.0.0.1:3", time.Millisecond*10)
+	require.Equal(t, "127.0.0.1:3#1", c.closestCandidate(candidates))
+
+	// The measurements are smoothed
+	c.recordRTT("127.0.0.1:2", time.Millisecond)
+	rtt, ok := c.getRTT("127.0.0.1:2")
+	require.True(t, ok)
+	require.Equal(t, (time.Millisecond*80+time.Millisecond)/2, rtt)
+	require.Equal(t, "127.0.0.1:3#1", c.closestCandidate(candidates))
+
+	// The removed candidates are not considered anymore
+	candidates = removeCandidate(candidates, "127.0.0.1:3#1")
+	require.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, candidates)
+	require.Equal(t, "127.0.0.1:2", c.closestCandidate(candidates))
+}
+
+// Test_Within_Finger tests the withinFinger function
+func Test_Within_Finger(t *testing.T) {
+	require.True(t, withinFinger(10, 10, 20))
+	require.True(t, withinFinger(19, 10, 20))
+	require.False(t, withinFinger(20, 10, 20))
+	require.False(t, withinFinger(9, 10, 20))
+
+	// The interval is crossing the boundary of the ring
+	require.True(t, withinFinger(250, 250, 4))
+	require.True(t, withinFinger(0, 250, 4))
+	require.False(t, withinFinger(4, 250, 4))
+	require.False(t, withinFinger(100, 250, 4))
+}
+
+// Test_Within_Range tests the withinRange function
+func Test_Within_Range(t *testing.T) {
+	require.True(t, withinRange(10, 10, 20))
+	require.True(t, withinRange(20, 10, 20))
+	require.False(t, withinRange(21, 10, 20))
+	require.False(t, withinRange(9, 10, 20))
+	require.True(t, withinRange(10, 10, 10))
+	require.False(t, withinRange(11, 10, 10))
+
+	// The interval is crossing the boundary of the ring
+	require.True(t, withinRange(250, 250, 4))
+	require.True(t, withinRange(0, 250, 4))
+	require.True(t, withinRange(4, 250, 4))
+	require.False(t, withinRange(100, 250, 4))
+}
+
+// Test_Authentication tests the credentials and the signatures of the authenticated membership
+func Test_Authentication(t *testing.T) {
+	newNode := func(address string, storage storage.Storage) *Chord {
+		c := &Chord{}
+		c.conf = &peer.Configuration{ChordBytes: 1, ChordAuthentication: true, ChordKeyDifficulty: 8,
+			Storage: storage}
+		c.address = address
+		c.host = address
+		c.vnodes = []*Chord{c}
+		c.members = &sync.Map{}
+		require.NoError(t, c.initAuthentication())
+		return c
+	}
+	storage1 := inmemory.NewPersistency()
+	c1 := newNode("127.0.0.1:1", storage1)
+	c2 := newNode("127.0.0.1:2", inmemory.NewPersistency())
+
+	// The key is persisted, the node keeps its chordID after a restart
+	restarted := newNode("127.0.0.1:1", storage1)
+	require.Equal(t, c1.credential.PublicKey, restarted.credential.PublicKey)
+	require.Equal(t, c1.GetChordID(), restarted.GetChordID())
+
+	// The chordID is derived from the public key, not from the address
+	require.True(t, verifyCredential(c1.credential))
+	require.Equal(t, c1.Name2ID(hex.EncodeToString(c1.credential.PublicKey)), c1.GetChordID())
+	require.Equal(t, c1.GetChordID(), c1.NodeID(c1.address))
+
+	// A credential cannot be reused for another address
+	stolen := c1.credential
+	stolen.Address = c2.address
+	require.False(t, verifyCredential(stolen))
+	require.False(t, c1.verifyMember(c2.address, c1.credential))
+
+	// The node knows itself, a different key for its address is rejected
+	require.True(t, c1.verifyMember(c1.address, c1.credential))
+	forged := c2.credential
+	forged.Address = c1.address
+	forged.Signature = c2.sign("credential", c1.address)
+	require.True(t, verifyCredential(forged))
+	require.False(t, c1.verifyMember(c1.address, forged))
+
+	// The credential carries the proof of work over its key, a credential without it is rejected
+	require.True(t, c2.verifyKeyWork(c2.credential))
+	noWork := c2.credential
+	noWork.Nonce = 0
+	for c2.verifyKeyWork(noWork) {
+		noWork.Nonce++
+	}
+	require.False(t, c1.verifyMember(c2.address, noWork))
+
+	// Messages are only accepted from verified nodes, with a valid signature
+	signature := c2.sign("notify", c2.address, c1.address)
+	require.False(t, c1.verifyMessage(c2.address, signature, "notify", c2.address, c1.address))
+	c1.members.Store(c2.address, member{credential: c2.credential, chordID: c2.GetChordID()})
+	require.True(t, c1.verifyMessage(c2.address, signature, "notify", c2.address, c1.address))
+	require.False(t, c1.verifyMessage(c2.address, signature, "notify", c2.address, "127.0.0.1:3"))
+	require.Equal(t, c2.GetChordID(), c1.NodeID(c2.address))
+
+	// The credential of a node that has left is forgotten, the node itself is never forgotten
+	c1.forgetMember(c2.address)
+	require.False(t, c1.verifyMessage(c2.address, signature, "notify", c2.address, c1.address))
+	c1.forgetMember(c1.address)
+	require.True(t, c1.verifyMember(c1.address, c1.credential))
+
+	// Without authentication, nothing is signed and everything is accepted
+	c3 := Chord{}
+	c3.conf = &peer.Configuration{ChordBytes: 1}
+	require.Nil(t, c3.sign("notify"))
+	require.True(t, c3.verifyMember("127.0.0.1:1", types.ChordCredential{}))
+	require.True(t, c3.verifyMessage("127.0.0.1:1", nil, "notify"))
+	require.Equal(t, c3.Name2ID("127.0.0.1:1"), c3.NodeID("127.0.0.1:1"))
+}
+
+// Test_Key_Proof_Of_Work tests that the proof of work over a key is the first nonce whose hash with the key has
+// the number of leading zero bits of the difficulty
+func Test_Key_Proof_Of_Work(t *testing.T) {
+	require.True(t, hasLeadingZeroBits([]byte{0x00, 0x1f}, 11))
+	require.False(t, hasLeadingZeroBits([]byte{0x00, 0x1f}, 12))
+	require.True(t, hasLeadingZeroBits([]byte{0xff}, 0))
+	require.False(t, hasLeadingZeroBits([]byte{0x00}, 9))
+
+	publicKey := []byte("public key")
+	for _, difficulty := range []uint{0, 4, 8, 12} {
+		nonce := keyProofOfWork(publicKey, difficulty)
+		hash := keyWorkHash(publicKey, nonce)
+		require.True(t, hasLeadingZeroBits(hash[:], difficulty))
+		for n := uint64(0); n < nonce; n++ {
+			hash = keyWorkHash(publicKey, n)
+			require.False(t, hasLeadingZeroBits(hash[:], difficulty))
+		}
+	}
+
+	// The chordID only depends on the key, the nonce can not be chosen to place the node
+	c := Chord{}
+	c.conf = &peer.Configuration{ChordBytes: 1}
+	credential := types.ChordCredential{PublicKey: publicKey}
+	chordID := c.credentialID(credential)
+	credential.Nonce++
+	require.Equal(t, chordID, c.credentialID(credential))
+}
+
+// Test_Owns tests the owns function
+func Test_Owns(t *testing.T) {
+	c := Chord{}
+	c.conf = &peer.Configuration{ChordBytes: 1}
+	c.address = "127.0.0.1:1"
+	c.chordID = 10
+
+	// Without any predecessor, we cannot tell our range
+	require.False(t, c.owns(10))
+
+	c.predecessor = "127.0.0.1:2"
+	predecessorID := c.Name2ID(c.predecessor)
+	for i := uint(0); i < 256; i++ {
+		require.Equal(t, i == c.chordID || withinRing(i, predecessorID, c.chordID), c.owns(i))
+	}
+	require.True(t, c.owns(c.chordID))
+	require.False(t, c.owns(predecessorID))
+}
@@ -0,0 +1,171 @@
+package dhash
+
+import (
+	"github.com/rs/xid"
+	"go.dedis.ch/cs438/peer"
+	"go.dedis.ch/cs438/peer/impl/chord"
+	"go.dedis.ch/cs438/peer/impl/message"
+	"go.dedis.ch/cs438/types"
+	"golang.org/x/xerrors"
+	"sync"
+)
+
+func NewDHash(conf *peer.Configuration, message *message.Message, chord *chord.Chord) *DHash {
+	var putChan, getChan sync.Map
+	dHash := DHash{
+		address: conf.Socket.GetAddress(),
+		conf:    conf,
+		message: message,
+		chord:   chord,
+		putChan: &putChan,
+		getChan: &getChan,
+	}
+
+	/* DHash callbacks */
+	conf.MessageRegistry.RegisterMessageCallback(types.DHashPutMessage{}, dHash.execDHashPutMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.DHashPutReplyMessage{}, dHash.execDHashPutReplyMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.DHashGetMessage{}, dHash.execDHashGetMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.DHashGetReplyMessage{}, dHash.execDHashGetReplyMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.DHashStoreMessage{}, dHash.execDHashStoreMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.DHashUpdRangeMessage{}, dHash.execDHashUpdRangeMessage)
+	return &dHash
+}
+
+type DHash struct {
+	address string
+	conf    *peer.Configuration // The configuration contains Socket and MessageRegistry
+	message *message.Message    // Messaging used to communicate among nodes
+	chord   *chord.Chord        // chord used to find the owner of a key
+	putChan *sync.Map           // The sync map stores the channel that used for put acknowledgements
+	getChan *sync.Map           // The sync map stores the channel that used for get results
+}
+
+// Put stores the value under the given key, on the chord node that owns the key
+func (d *DHash) Put(key string, value []byte) error {
+	return d.PutAt(d.chord.Name2ID(key), key, value)
+}
+
+// PutAt stores the value under the given key, on the chord node that owns the given ID instead of the hash
+// of the key. It allows to place an entry next to the data it describes, e.g., on the owner of a salt
+func (d *DHash) PutAt(id uint, key string, value []byte) error {
+	entry := types.DHashEntry{
+		Key:   key,
+		ID:    id,
+		Value: value,
+	}
+
+	// Query Chord to find the owner of the key
+	owner, err := d.chord.QuerySuccessor(d.address, entry.ID)
+	if err != nil {
+		return err
+	}
+
+	// Prepare the put request to the owner
+	dHashPutMsg := types.DHashPutMessage{
+		RequestID: xid.New().String(),
+		Source:    d.address,
+		Target:    owner,
+		Entry:     entry,
+	}
+	dHashPutMsgTrans, err := d.conf.MessageRegistry.MarshalMessage(dHashPutMsg)
+	if err != nil {
+		return err
+	}
+
+	// Prepare a reply channel that receives the acknowledgement from the owner
+	replyChan := make(chan bool, 1)
+	d.putChan.Store(dHashPutMsg.RequestID, replyChan)
+	defer d.putChan.Delete(dHashPutMsg.RequestID)
+
+	// The owner may be a virtual node, the request is sent to the peer hosting it
+	host := chord.HostAddress(owner)
+	err = d.message.SendDirectMsg(host, host, dHashPutMsgTrans)
+	if err != nil {
+		return err
+	}
+
+	// Either we wait until the timeout, or we receive a response from the reply channel
+	select {
+	case <-replyChan:
+		return nil
+	case <-d.conf.Clock.After(d.conf.ChordTimeout):
+		return xerrors.Errorf("DHash timeout when putting key %s!", key)
+	}
+}
+
+// Get returns the value stored under the given key, it is returned by the chord node that owns the key
+func (d *DHash) Get(key string) ([]byte, error) {
+	return d.GetAt(d.chord.Name2ID(key), key)
+}
+
+// GetAt returns the value stored under the given key, on the chord node that owns the given ID, it is the
+// counterpart of PutAt
+func (d *DHash) GetAt(id uint, key string) ([]byte, error) {
+	// Query Chord to find the owner of the key
+	owner, err := d.chord.QuerySuccessor(d.address, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepare the get request to the owner
+	dHashGetMsg := types.DHashGetMessage{
+		RequestID: xid.New().String(),
+		Source:    d.address,
+		Key:       key,
+	}
+	dHashGetMsgTrans, err := d.conf.MessageRegistry.MarshalMessage(dHashGetMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepare a reply channel that receives the reply from the owner
+	replyChan := make(chan types.DHashGetReplyMessage, 1)
+	d.getChan.Store(dHashGetMsg.RequestID, replyChan)
+	defer d.getChan.Delete(dHashGetMsg.RequestID)
+
+	// The owner may be a virtual node, the request is sent to the peer hosting it
+	host := chord.HostAddress(owner)
+	err = d.message.SendDirectMsg(host, host, dHashGetMsgTrans)
+	if err != nil {
+		return nil, err
+	}
+
+	// Either we wait until the timeout, or we receive a response from the reply channel
+	select {
+	case reply := <-replyChan:
+		if !reply.Found {
+			return nil, xerrors.Errorf("DHash key %s not found!", key)
+		}
+		return reply.Value, nil
+	case <-d.conf.Clock.After(d.conf.ChordTimeout):
+		return nil, xerrors.Errorf("DHash timeout when getting key %s!", key)
+	}
+}
+
+// Leave hands over the entries owned by the chord nodes hosted by this peer to their successors, it should be
+// called before the chord nodes leave the ring. Entries are sent together with the number of replicas, so
+// that the replication degree is restored after the leave
+func (d *DHash) Leave() error {
+	handover := make(map[string][]types.DHashEntry)
+	for _, entry := range d.entries() {
+		owner := d.chord.LocalOwner(entry.ID)
+		if owner == "" {
+			// We only store a replica of this entry, its owner is a remote node
+			continue
+		}
+		successor := d.chord.RemoteSuccessor(owner)
+		if successor == "" {
+			// We are the only peer inside the ring, the entries are lost
+			continue
+		}
+		handover[successor] = append(handover[successor], entry)
+	}
+
+	for successor, entries := range handover {
+		err := d.sendEntries(successor, entries, d.conf.DHashReplicas+1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
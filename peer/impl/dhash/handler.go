@@ -0,0 +1,157 @@
+package dhash
+
+import (
+	"go.dedis.ch/cs438/peer/impl/chord"
+	"go.dedis.ch/cs438/transport"
+	"go.dedis.ch/cs438/types"
+	"golang.org/x/xerrors"
+)
+
+// execDHashPutMessage is the callback function to handle DHashPutMessage
+func (d *DHash) execDHashPutMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	dHashPutMsg, ok := msg.(*types.DHashPutMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	// We are the owner of the key, store the entry and replicate it on our successors
+	d.storeEntry(dHashPutMsg.Entry)
+	successor := d.chord.RemoteSuccessor(dHashPutMsg.Target)
+	if successor != "" && d.conf.DHashReplicas > 0 {
+		err := d.sendEntries(successor, []types.DHashEntry{dHashPutMsg.Entry}, d.conf.DHashReplicas)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Acknowledge the put request
+	dHashPutReplyMsg := types.DHashPutReplyMessage{
+		ReplyPacketID: dHashPutMsg.RequestID,
+	}
+	dHashPutReplyMsgTrans, err := d.conf.MessageRegistry.MarshalMessage(dHashPutReplyMsg)
+	if err != nil {
+		return err
+	}
+	return d.message.SendDirectMsg(dHashPutMsg.Source, dHashPutMsg.Source, dHashPutReplyMsgTrans)
+}
+
+// execDHashPutReplyMessage is the callback function to handle DHashPutReplyMessage
+func (d *DHash) execDHashPutReplyMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	dHashPutReplyMsg, ok := msg.(*types.DHashPutReplyMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	putChan, ok := d.putChan.Load(dHashPutReplyMsg.ReplyPacketID)
+	if ok {
+		putChan.(chan bool) <- true
+	}
+	return nil
+}
+
+// execDHashGetMessage is the callback function to handle DHashGetMessage
+func (d *DHash) execDHashGetMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	dHashGetMsg, ok := msg.(*types.DHashGetMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	dHashGetReplyMsg := types.DHashGetReplyMessage{
+		ReplyPacketID: dHashGetMsg.RequestID,
+	}
+	entry, ok := d.loadEntry(dHashGetMsg.Key)
+	if ok {
+		dHashGetReplyMsg.Found = true
+		dHashGetReplyMsg.Value = entry.Value
+	}
+	dHashGetReplyMsgTrans, err := d.conf.MessageRegistry.MarshalMessage(dHashGetReplyMsg)
+	if err != nil {
+		return err
+	}
+	return d.message.SendDirectMsg(dHashGetMsg.Source, dHashGetMsg.Source, dHashGetReplyMsgTrans)
+}
+
+// execDHashGetReplyMessage is the callback function to handle DHashGetReplyMessage
+func (d *DHash) execDHashGetReplyMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	dHashGetReplyMsg, ok := msg.(*types.DHashGetReplyMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	getChan, ok := d.getChan.Load(dHashGetReplyMsg.ReplyPacketID)
+	if ok {
+		getChan.(chan types.DHashGetReplyMessage) <- *dHashGetReplyMsg
+	}
+	return nil
+}
+
+// execDHashStoreMessage is the callback function to handle DHashStoreMessage
+func (d *DHash) execDHashStoreMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	dHashStoreMsg, ok := msg.(*types.DHashStoreMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	for _, entry := range dHashStoreMsg.Entries {
+		d.storeEntry(entry)
+	}
+
+	// If more copies are needed, pass the entries to our successor, unless the replication went around the ring
+	if dHashStoreMsg.Replicas <= 1 {
+		return nil
+	}
+	successor := d.chord.RemoteSuccessor(dHashStoreMsg.Target)
+	if successor == "" || chord.HostAddress(successor) == dHashStoreMsg.Origin {
+		return nil
+	}
+	dHashStoreMsg.Target = successor
+	dHashStoreMsg.Replicas--
+	dHashStoreMsgTrans, err := d.conf.MessageRegistry.MarshalMessage(dHashStoreMsg)
+	if err != nil {
+		return err
+	}
+	host := chord.HostAddress(successor)
+	return d.message.SendDirectMsg(host, host, dHashStoreMsgTrans)
+}
+
+// execDHashUpdRangeMessage is the callback function to handle DHashUpdRangeMessage
+func (d *DHash) execDHashUpdRangeMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	dHashUpdRangeMsg, ok := msg.(*types.DHashUpdRangeMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	// If the new predecessor is hosted by this peer as well, it shares our store
+	if dHashUpdRangeMsg.NewPredecessor == "" || d.chord.IsLocal(dHashUpdRangeMsg.NewPredecessor) {
+		return nil
+	}
+
+	// The new predecessor now owns the keys (oldPredecessor, newPredecessor], if we did not know our old
+	// predecessor, it owns all the keys that are not within our new range (newPredecessor, node]
+	newPredecessorID := d.chord.NodeID(dHashUpdRangeMsg.NewPredecessor)
+	nodeID := d.chord.NodeID(dHashUpdRangeMsg.Node)
+	entries := make([]types.DHashEntry, 0)
+	for _, entry := range d.entries() {
+		moved := false
+		if dHashUpdRangeMsg.OldPredecessor == "" {
+			moved = !inRange(entry.ID, newPredecessorID, nodeID)
+		} else {
+			moved = inRange(entry.ID, d.chord.NodeID(dHashUpdRangeMsg.OldPredecessor), newPredecessorID)
+		}
+		if moved {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// We keep our copy of the entries, since we are the successor of the new owner, it is a replica
+	return d.sendEntries(dHashUpdRangeMsg.NewPredecessor, entries, 1)
+}
@@ -0,0 +1,76 @@
+package dhash
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/rs/zerolog/log"
+	"go.dedis.ch/cs438/peer/impl/chord"
+	"go.dedis.ch/cs438/types"
+)
+
+// inRange checks whether the key is within the range (start, end] of the ring, the range is crossing the
+// boundary of the ring if start >= end, and it covers the whole ring if start == end
+func inRange(key uint, start uint, end uint) bool {
+	if start < end {
+		return start < key && key <= end
+	}
+	return start < key || key <= end
+}
+
+// storeEntry stores the entry inside the DHash store, the key is hex-encoded so that it can be used by any store
+func (d *DHash) storeEntry(entry types.DHashEntry) {
+	entryByte, err := json.Marshal(entry)
+	if err != nil {
+		log.Error().Err(err).Msg("DHash storeEntry Marshal")
+		return
+	}
+	d.conf.Storage.GetDHashStore().Set(hex.EncodeToString([]byte(entry.Key)), entryByte)
+}
+
+// loadEntry loads the entry of the given key from the DHash store, it returns false if the key is not found
+func (d *DHash) loadEntry(key string) (types.DHashEntry, bool) {
+	var entry types.DHashEntry
+	entryByte := d.conf.Storage.GetDHashStore().Get(hex.EncodeToString([]byte(key)))
+	if entryByte == nil {
+		return entry, false
+	}
+	err := json.Unmarshal(entryByte, &entry)
+	if err != nil {
+		log.Error().Err(err).Msg("DHash loadEntry Unmarshal")
+		return entry, false
+	}
+	return entry, true
+}
+
+// entries returns all entries inside the DHash store
+func (d *DHash) entries() []types.DHashEntry {
+	entries := make([]types.DHashEntry, 0)
+	d.conf.Storage.GetDHashStore().ForEach(func(key string, val []byte) bool {
+		var entry types.DHashEntry
+		err := json.Unmarshal(val, &entry)
+		if err != nil {
+			log.Error().Err(err).Msg("DHash entries Unmarshal")
+			return true
+		}
+		entries = append(entries, entry)
+		return true
+	})
+	return entries
+}
+
+// sendEntries hands over the entries to the given chord node, which stores the given number of copies on
+// itself and its successors
+func (d *DHash) sendEntries(target string, entries []types.DHashEntry, replicas uint) error {
+	dHashStoreMsg := types.DHashStoreMessage{
+		Origin:   d.address,
+		Target:   target,
+		Entries:  entries,
+		Replicas: replicas,
+	}
+	dHashStoreMsgTrans, err := d.conf.MessageRegistry.MarshalMessage(dHashStoreMsg)
+	if err != nil {
+		return err
+	}
+	host := chord.HostAddress(target)
+	return d.message.SendDirectMsg(host, host, dHashStoreMsgTrans)
+}
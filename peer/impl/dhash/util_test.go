@@ -0,0 +1,61 @@
+package dhash
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/peer"
+	"go.dedis.ch/cs438/storage/inmemory"
+	"go.dedis.ch/cs438/types"
+	"testing"
+)
+
+// Test_In_Range tests the inRange function
+func Test_In_Range(t *testing.T) {
+	// Normal range (10, 20]
+	require.False(t, inRange(10, 10, 20))
+	require.True(t, inRange(11, 10, 20))
+	require.True(t, inRange(20, 10, 20))
+	require.False(t, inRange(21, 10, 20))
+
+	// Range crossing the boundary of the ring (250, 4]
+	require.True(t, inRange(255, 250, 4))
+	require.True(t, inRange(0, 250, 4))
+	require.True(t, inRange(4, 250, 4))
+	require.False(t, inRange(5, 250, 4))
+	require.False(t, inRange(250, 250, 4))
+
+	// Range covering the whole ring
+	for i := uint(0); i < 256; i++ {
+		require.True(t, inRange(i, 7, 7))
+	}
+}
+
+// Test_Store_Entry tests the entries are correctly stored and loaded from the DHash store, whatever the key
+func Test_Store_Entry(t *testing.T) {
+	d := DHash{}
+	d.conf = &peer.Configuration{}
+	d.conf.Storage = inmemory.NewPersistency()
+
+	keys := []string{"apple", "dir/file", ""}
+	for i, key := range keys {
+		d.storeEntry(types.DHashEntry{Key: key, ID: uint(i), Value: []byte(key + "-value")})
+	}
+	require.Equal(t, len(keys), d.conf.Storage.GetDHashStore().Len())
+	require.Len(t, d.entries(), len(keys))
+
+	for i, key := range keys {
+		entry, ok := d.loadEntry(key)
+		require.True(t, ok)
+		require.Equal(t, uint(i), entry.ID)
+		require.Equal(t, []byte(key+"-value"), entry.Value)
+	}
+
+	_, ok := d.loadEntry("banana")
+	require.False(t, ok)
+
+	// Storing the same key twice overwrites the value
+	d.storeEntry(types.DHashEntry{Key: "apple", ID: 0, Value: []byte("pie")})
+	entry, ok := d.loadEntry("apple")
+	require.True(t, ok)
+	require.Equal(t, []byte("pie"), entry.Value)
+	require.Equal(t, len(keys), d.conf.Storage.GetDHashStore().Len())
+}
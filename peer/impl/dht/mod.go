@@ -0,0 +1,16 @@
+package dht
+
+import "go.dedis.ch/cs438/types"
+
+// DHT describes a distributed hash table, it maps each key of the key space to the peer responsible for it. The
+// key space is the space of the salts, its size is defined by ChordBytes inside the configuration.
+//
+// - implemented by chord.Chord and kademlia.Kademlia
+type DHT interface {
+	// Lookup returns the address of the peer owning the given key
+	Lookup(key uint) (string, error)
+
+	// OnRangeChange registers a callback that is called with the ranges of keys owned by the peer, each time
+	// they change. The callback is called in its own goroutine.
+	OnRangeChange(callback func(ranges []types.SaltRange))
+}
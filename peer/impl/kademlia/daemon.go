@@ -0,0 +1,40 @@
+package kademlia
+
+// StartDaemon starts the refresh daemon of the node. It does nothing if the daemon is already running
+func (k *Kademlia) StartDaemon() {
+	if !k.daemonRunning.CompareAndSwap(0, 1) {
+		return
+	}
+	go k.refreshDaemon()
+}
+
+// StopDaemon stops the refresh daemon of the node. It does nothing if the daemon is not running
+func (k *Kademlia) StopDaemon() {
+	if !k.daemonRunning.CompareAndSwap(1, 0) {
+		return
+	}
+	select {
+	case k.stopRefreshChan <- true:
+	default:
+	}
+}
+
+// refreshDaemon refreshes the k-buckets at a fixed interval, so that the nodes that joined after us are
+// discovered even if they have not contacted us, and the dead contacts are evicted
+func (k *Kademlia) refreshDaemon() {
+	if k.conf.KademliaRefreshInterval == 0 {
+		// Refresh mechanism is disabled
+		return
+	}
+
+	ticker := k.conf.Clock.NewTicker(k.conf.KademliaRefreshInterval)
+	for {
+		select {
+		case <-k.stopRefreshChan:
+			ticker.Stop()
+			return
+		case <-ticker.C():
+			k.refresh()
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package kademlia
+
+import (
+	"go.dedis.ch/cs438/transport"
+	"go.dedis.ch/cs438/types"
+	"golang.org/x/xerrors"
+)
+
+// execKademliaFindNodeMessage is the callback function to handle KademliaFindNodeMessage
+func (k *Kademlia) execKademliaFindNodeMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	findNodeMsg, ok := msg.(*types.KademliaFindNodeMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	// Every node we hear from is a candidate contact, this is how the nodes learn about the new ones
+	k.update(pkt.Header.Source)
+
+	contacts := k.closest(findNodeMsg.Key, k.bucketSize)
+	findNodeReplyMsg := types.KademliaFindNodeReplyMessage{
+		ReplyPacketID: findNodeMsg.RequestID,
+		Contacts:      make([]string, len(contacts)),
+	}
+	for i, c := range contacts {
+		findNodeReplyMsg.Contacts[i] = c.address
+	}
+	findNodeReplyMsgTrans, err := k.conf.MessageRegistry.MarshalMessage(findNodeReplyMsg)
+	if err != nil {
+		return err
+	}
+	return k.message.SendDirectMsg(pkt.Header.Source, pkt.Header.Source, findNodeReplyMsgTrans)
+}
+
+// execKademliaFindNodeReplyMessage is the callback function to handle KademliaFindNodeReplyMessage
+func (k *Kademlia) execKademliaFindNodeReplyMessage(msg types.Message, pkt transport.Packet) error {
+	/* cast the message to its actual type. You assume it is the right type. */
+	findNodeReplyMsg, ok := msg.(*types.KademliaFindNodeReplyMessage)
+	if !ok {
+		return xerrors.Errorf("wrong type: %T", msg)
+	}
+
+	k.update(pkt.Header.Source)
+
+	// Pass the contacts to the lookup waiting for them, unless it has timed out
+	replyChan, ok := k.queryChan.Load(findNodeReplyMsg.ReplyPacketID)
+	if !ok {
+		return nil
+	}
+	select {
+	case replyChan.(chan []string) <- findNodeReplyMsg.Contacts:
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package kademlia
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog/log"
+	"go.dedis.ch/cs438/peer"
+	"go.dedis.ch/cs438/peer/impl/message"
+	"go.dedis.ch/cs438/types"
+	"golang.org/x/xerrors"
+)
+
+// alpha is the number of nodes a lookup queries in parallel
+const alpha = 3
+
+// NewKademlia creates the Kademlia node of the peer, it knows no other node until it joins a network
+func NewKademlia(conf *peer.Configuration, message *message.Message) *Kademlia {
+	var queryChan sync.Map
+
+	bucketSize := conf.KademliaBucketSize
+	if bucketSize < 1 {
+		bucketSize = 1
+	}
+
+	kademlia := Kademlia{
+		address:         conf.Socket.GetAddress(),
+		conf:            conf,
+		message:         message,
+		bucketSize:      bucketSize,
+		buckets:         make([][]contact, conf.ChordBytes*8),
+		queryChan:       &queryChan,
+		stopRefreshChan: make(chan bool, 1),
+	}
+	// The ID of the node lives in the same key space as the salts, it is derived from its address as the chordID
+	kademlia.id = kademlia.Name2ID(kademlia.address)
+
+	/* Kademlia callbacks */
+	conf.MessageRegistry.RegisterMessageCallback(types.KademliaFindNodeMessage{}, kademlia.execKademliaFindNodeMessage)
+	conf.MessageRegistry.RegisterMessageCallback(types.KademliaFindNodeReplyMessage{},
+		kademlia.execKademliaFindNodeReplyMessage)
+
+	return &kademlia
+}
+
+// Kademlia is a node of a Kademlia network. The distance between two keys is their XOR, and a key is owned
+// by the node whose ID is the closest to it. Each node keeps a k-bucket per bit of the key space: the bucket i
+// holds up to bucketSize contacts whose distance is within [2^i, 2^(i+1)).
+//
+// - implements dht.DHT
+type Kademlia struct {
+	address           string
+	conf              *peer.Configuration       // The configuration contains Socket and MessageRegistry
+	message           *message.Message          // Messaging used to communicate among nodes
+	id                uint                      // ID of this node inside the key space
+	bucketSize        int                       // The maximum number of contacts of a k-bucket
+	buckets           [][]contact               // The k-buckets, each of them is sorted from the least recently seen
+	bucketsLock       sync.RWMutex              // The mutex to protect the k-buckets
+	queryChan         *sync.Map                 // The sync map stores the channel that used for find node results
+	rangeCallbacks    []func([]types.SaltRange) // The callbacks of OnRangeChange
+	rangeLock         sync.Mutex                // The mutex to protect the range callbacks
+	notifiedRanges    []types.SaltRange         // The ranges the callbacks have been notified with
+	notificationsLock sync.Mutex                // The mutex to serialize the notifications of the callbacks
+	daemonRunning     atomic.Int32              // Whether the refresh daemon is running
+	stopRefreshChan   chan bool                 // Communication channel about whether we should stop the daemon
+}
+
+// contact is a node known by a Kademlia node
+type contact struct {
+	address string
+	id      uint
+}
+
+// GetID gets the ID of the node
+func (k *Kademlia) GetID() uint {
+	return k.id
+}
+
+// GetBuckets gets the addresses of the contacts of each k-bucket
+func (k *Kademlia) GetBuckets() [][]string {
+	k.bucketsLock.RLock()
+	defer k.bucketsLock.RUnlock()
+
+	buckets := make([][]string, len(k.buckets))
+	for i, bucket := range k.buckets {
+		buckets[i] = make([]string, len(bucket))
+		for j, c := range bucket {
+			buckets[i][j] = c.address
+		}
+	}
+	return buckets
+}
+
+// Join joins an existing Kademlia network through the given node. The node looks up its own ID, which fills
+// the k-buckets close to it and announces it to its future neighbours, and then refreshes all its k-buckets.
+func (k *Kademlia) Join(remoteNode string) error {
+	if remoteNode == k.address {
+		return xerrors.Errorf("[%s] cannot join the Kademlia network through itself", k.address)
+	}
+
+	// The remote node must answer for the join to succeed, its reply adds it to our k-buckets
+	_, err := k.findNode(remoteNode, k.id)
+	if err != nil {
+		return err
+	}
+
+	k.refresh()
+	return nil
+}
+
+// Lookup implements dht.DHT. It iteratively queries the closest nodes it knows about the key, alpha of them in
+// parallel, until none of the closest nodes found so far knows a closer one. The closest node is the owner.
+func (k *Kademlia) Lookup(key uint) (string, error) {
+	if !k.validRange(key) {
+		return "", xerrors.Errorf("[%s] invalid key %d", k.address, key)
+	}
+
+	shortlist := k.closest(key, k.bucketSize)
+	queried := map[string]bool{k.address: true}
+	for {
+		// Query the closest nodes that have not been queried yet
+		batch := make([]contact, 0, alpha)
+		for _, c := range shortlist {
+			if len(batch) == alpha {
+				break
+			}
+			if !queried[c.address] {
+				batch = append(batch, c)
+				queried[c.address] = true
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		type result struct {
+			address  string
+			contacts []string
+			err      error
+		}
+		results := make(chan result, len(batch))
+		for _, c := range batch {
+			go func(address string) {
+				contacts, err := k.findNode(address, key)
+				results <- result{address: address, contacts: contacts, err: err}
+			}(c.address)
+		}
+
+		// The nodes that did not answer are removed from the shortlist, the new contacts are added to it
+		known := make(map[string]bool, len(shortlist))
+		for _, c := range shortlist {
+			known[c.address] = true
+		}
+		failed := make(map[string]bool)
+		for range batch {
+			r := <-results
+			if r.err != nil {
+				failed[r.address] = true
+				continue
+			}
+			for _, address := range r.contacts {
+				if !known[address] {
+					known[address] = true
+					shortlist = append(shortlist, contact{address: address, id: k.Name2ID(address)})
+				}
+			}
+		}
+
+		alive := shortlist[:0]
+		for _, c := range shortlist {
+			if !failed[c.address] {
+				alive = append(alive, c)
+			}
+		}
+		shortlist = sortByDistance(alive, key)
+		if len(shortlist) > k.bucketSize {
+			shortlist = shortlist[:k.bucketSize]
+		}
+	}
+
+	return shortlist[0].address, nil
+}
+
+// OnRangeChange implements dht.DHT, the ranges are computed again each time a contact is added to the k-buckets
+// or removed from them
+func (k *Kademlia) OnRangeChange(callback func(ranges []types.SaltRange)) {
+	k.rangeLock.Lock()
+	defer k.rangeLock.Unlock()
+	k.rangeCallbacks = append(k.rangeCallbacks, callback)
+}
+
+// findNode queries a remote node about the contacts it knows that are the closest to the key. If the remote
+// node does not answer, it is removed from the k-buckets.
+func (k *Kademlia) findNode(remoteNode string, key uint) ([]string, error) {
+	// Prepare the new find node message
+	findNodeMsg := types.KademliaFindNodeMessage{
+		RequestID: xid.New().String(),
+		Key:       key,
+	}
+	findNodeMsgTrans, err := k.conf.MessageRegistry.MarshalMessage(findNodeMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepare a reply channel that receives the reply from the remote peer, if any response is ready
+	replyChan := make(chan []string, 1)
+	k.queryChan.Store(findNodeMsg.RequestID, replyChan)
+	defer k.queryChan.Delete(findNodeMsg.RequestID)
+
+	// Send the message to the remote peer
+	err = k.message.SendDirectMsg(remoteNode, remoteNode, findNodeMsgTrans)
+	if err != nil {
+		k.remove(remoteNode)
+		return nil, err
+	}
+
+	// Either we wait until the timeout, or we receive a response from the reply channel
+	select {
+	case contacts := <-replyChan:
+		return contacts, nil
+	case <-k.conf.Clock.After(k.conf.KademliaTimeout):
+		k.remove(remoteNode)
+		return nil, xerrors.Errorf("[%s] Kademlia timeout when finding node %d from %s", k.address, key, remoteNode)
+	}
+}
+
+// refresh looks up the ID of the node, and then a random key in each k-bucket
+func (k *Kademlia) refresh() {
+	keys := []uint{k.id}
+	for i := range k.buckets {
+		keys = append(keys, k.randomKey(i))
+	}
+
+	for _, key := range keys {
+		_, err := k.Lookup(key)
+		if err != nil {
+			log.Error().Err(err).Msg(fmt.Sprintf("[%s] refresh Lookup failed!", k.address))
+		}
+	}
+}
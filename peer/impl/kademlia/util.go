@@ -0,0 +1,210 @@
+package kademlia
+
+import (
+	"crypto"
+	"math/big"
+	"math/bits"
+	"math/rand"
+	"sort"
+
+	"go.dedis.ch/cs438/types"
+)
+
+// validRange checks that a given key is within the key space, whose size is defined by the ChordBytes inside
+// the configuration
+func (k *Kademlia) validRange(key uint) bool {
+	return key < uint(1)<<(k.conf.ChordBytes*8)
+}
+
+// Name2ID computes from the address to the ID of a node, with the given ChordBytes limit. It is the same
+// function as the one of Chord, so that both DHTs split the key space among the same IDs.
+func (k *Kademlia) Name2ID(name string) uint {
+	h := crypto.SHA256.New()
+	h.Write([]byte(name))
+	hashSlice := h.Sum(nil)
+
+	hashSlice = hashSlice[:k.conf.ChordBytes]
+	return uint(big.NewInt(0).SetBytes(hashSlice).Uint64())
+}
+
+// bucketIndex returns the index of the k-bucket of the given ID, i.e., the position of the highest bit of its
+// distance to us. It returns -1 for our own ID.
+func (k *Kademlia) bucketIndex(id uint) int {
+	return bits.Len(k.id^id) - 1
+}
+
+// update records that we have heard from the given node. A known contact is moved to the tail of its
+// k-bucket, a new one is appended if the k-bucket is not full. Otherwise, the new contact is dropped: the
+// contacts that have been alive for a long time are more likely to remain alive, the dead ones are evicted
+// once they fail to answer.
+func (k *Kademlia) update(address string) {
+	id := k.Name2ID(address)
+	idx := k.bucketIndex(id)
+	if address == k.address || idx < 0 {
+		// A node sharing our ID cannot be placed in a k-bucket, both of us own the same keys
+		return
+	}
+
+	k.bucketsLock.Lock()
+	bucket := k.buckets[idx]
+	for i, c := range bucket {
+		if c.address == address {
+			k.buckets[idx] = append(append(bucket[:i:i], bucket[i+1:]...), c)
+			k.bucketsLock.Unlock()
+			return
+		}
+	}
+	if len(bucket) >= k.bucketSize {
+		k.bucketsLock.Unlock()
+		return
+	}
+	k.buckets[idx] = append(bucket, contact{address: address, id: id})
+	k.bucketsLock.Unlock()
+
+	k.notifyRangeChange()
+}
+
+// remove removes the given node from the k-buckets, e.g., once it failed to answer
+func (k *Kademlia) remove(address string) {
+	idx := k.bucketIndex(k.Name2ID(address))
+	if idx < 0 {
+		return
+	}
+
+	k.bucketsLock.Lock()
+	bucket := k.buckets[idx]
+	for i, c := range bucket {
+		if c.address == address {
+			k.buckets[idx] = append(bucket[:i:i], bucket[i+1:]...)
+			k.bucketsLock.Unlock()
+
+			k.notifyRangeChange()
+			return
+		}
+	}
+	k.bucketsLock.Unlock()
+}
+
+// closest returns the n nodes we know that are the closest to the key, including ourselves
+func (k *Kademlia) closest(key uint, n int) []contact {
+	k.bucketsLock.RLock()
+	contacts := []contact{{address: k.address, id: k.id}}
+	for _, bucket := range k.buckets {
+		contacts = append(contacts, bucket...)
+	}
+	k.bucketsLock.RUnlock()
+
+	contacts = sortByDistance(contacts, key)
+	if len(contacts) > n {
+		contacts = contacts[:n]
+	}
+	return contacts
+}
+
+// sortByDistance sorts the contacts by XOR distance to the key, the contacts at the same distance share the
+// same ID and are sorted by address
+func sortByDistance(contacts []contact, key uint) []contact {
+	sort.Slice(contacts, func(i, j int) bool {
+		di, dj := contacts[i].id^key, contacts[j].id^key
+		if di == dj {
+			return contacts[i].address < contacts[j].address
+		}
+		return di < dj
+	})
+	return contacts
+}
+
+// randomKey returns a random key of the k-bucket idx, i.e., a key that shares the bits of our ID above idx and
+// differs from it at bit idx
+func (k *Kademlia) randomKey(idx int) uint {
+	distance := uint(1)<<idx | uint(rand.Int63n(int64(1)<<idx))
+	return k.id ^ distance
+}
+
+// ownedRanges returns the ranges of keys we own: our ID and some keys of the k-buckets without any contact.
+// Once a k-bucket has a contact, that contact is closer than us to all keys of the k-bucket. The keys of an empty
+// k-bucket are shared with the contacts of the lower k-buckets, which have the same bits as us above it: the
+// closest one to a key is the one whose lower bits are the closest. The key space is split among the nodes as
+// long as every node knows a contact in each k-bucket that contains a node, and all the nodes of its lower
+// k-buckets.
+func (k *Kademlia) ownedRanges() []types.SaltRange {
+	upperBound := uint(1) << (k.conf.ChordBytes * 8)
+
+	k.bucketsLock.RLock()
+	defer k.bucketsLock.RUnlock()
+
+	ranges := []types.SaltRange{{Start: (k.id + upperBound - 1) % upperBound, End: k.id}}
+	owns := func(key uint, idx int) bool {
+		for _, bucket := range k.buckets[:idx] {
+			for _, c := range bucket {
+				if c.id^key < k.id^key {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	for idx, bucket := range k.buckets {
+		if len(bucket) > 0 {
+			continue
+		}
+
+		// The keys of the k-bucket are [low, low + 2^idx), the consecutive keys we own are merged into a range
+		// (Start, End], which excludes its start
+		low := (k.id ^ uint(1)<<idx) &^ (uint(1)<<idx - 1)
+		high := low + uint(1)<<idx
+		first := high
+		for key := low; key <= high; key++ {
+			if key < high && owns(key, idx) {
+				if first == high {
+					first = key
+				}
+				continue
+			}
+			if first != high {
+				ranges = append(ranges, types.SaltRange{Start: (first + upperBound - 1) % upperBound, End: key - 1})
+				first = high
+			}
+		}
+	}
+	return ranges
+}
+
+// notifyRangeChange notifies the callbacks registered with OnRangeChange, e.g., the password cracker, about the
+// change of the ranges we own. The notifications are serialized, and each of them reads the latest ranges, so
+// that the callbacks end with the latest ranges even if the k-buckets change concurrently.
+func (k *Kademlia) notifyRangeChange() {
+	updateRange := func() {
+		k.notificationsLock.Lock()
+		defer k.notificationsLock.Unlock()
+
+		ranges := k.ownedRanges()
+		if sameRanges(ranges, k.notifiedRanges) {
+			return
+		}
+		k.notifiedRanges = ranges
+
+		k.rangeLock.Lock()
+		callbacks := append([]func([]types.SaltRange){}, k.rangeCallbacks...)
+		k.rangeLock.Unlock()
+
+		for _, callback := range callbacks {
+			callback(ranges)
+		}
+	}
+	go updateRange()
+}
+
+// sameRanges checks whether two lists of ranges are equal
+func sameRanges(a []types.SaltRange, b []types.SaltRange) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,155 @@
+package kademlia
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/peer"
+	"go.dedis.ch/cs438/types"
+)
+
+// newTestKademlia creates a Kademlia node that is not connected to any network
+func newTestKademlia(address string, chordBytes int, bucketSize int) *Kademlia {
+	k := &Kademlia{
+		address:    address,
+		conf:       &peer.Configuration{ChordBytes: chordBytes},
+		bucketSize: bucketSize,
+		buckets:    make([][]contact, chordBytes*8),
+	}
+	k.id = k.Name2ID(address)
+	return k
+}
+
+// inRanges checks whether the key belongs to one of the ranges (Start, End]
+func inRanges(key uint, ranges []types.SaltRange) bool {
+	for _, r := range ranges {
+		if r.Start < r.End {
+			if r.Start < key && key <= r.End {
+				return true
+			}
+		} else if r.Start < key || key <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// Test_Bucket_Index tests the bucketIndex function
+func Test_Bucket_Index(t *testing.T) {
+	k := newTestKademlia("127.0.0.1:1", 1, 8)
+	k.id = 0b10110000
+
+	require.Equal(t, -1, k.bucketIndex(0b10110000))
+	require.Equal(t, 0, k.bucketIndex(0b10110001))
+	require.Equal(t, 3, k.bucketIndex(0b10111111))
+	require.Equal(t, 4, k.bucketIndex(0b10100000))
+	require.Equal(t, 7, k.bucketIndex(0b00110000))
+
+	for idx := 0; idx < 8; idx++ {
+		for i := 0; i < 10; i++ {
+			require.Equal(t, idx, k.bucketIndex(k.randomKey(idx)))
+		}
+	}
+}
+
+// Test_Update_Remove tests that the k-buckets are sorted from the least recently seen contact, that a full
+// k-bucket keeps its contacts, and that the contacts can be removed
+func Test_Update_Remove(t *testing.T) {
+	k := newTestKademlia("127.0.0.1:0", 1, 2)
+
+	// Group the addresses by k-bucket, until a k-bucket has 3 of them
+	byBucket := make(map[int][]string)
+	var idx int
+	for i := 1; ; i++ {
+		address := fmt.Sprintf("127.0.0.1:%d", i)
+		idx = k.bucketIndex(k.Name2ID(address))
+		if idx < 0 {
+			continue
+		}
+		byBucket[idx] = append(byBucket[idx], address)
+		if len(byBucket[idx]) == 3 {
+			break
+		}
+	}
+	a, b, c := byBucket[idx][0], byBucket[idx][1], byBucket[idx][2]
+
+	k.update(a)
+	k.update(b)
+	require.Equal(t, []string{a, b}, k.GetBuckets()[idx])
+
+	// a has been seen again, it moves to the tail
+	k.update(a)
+	require.Equal(t, []string{b, a}, k.GetBuckets()[idx])
+
+	// The k-bucket is full, c is dropped
+	k.update(c)
+	require.Equal(t, []string{b, a}, k.GetBuckets()[idx])
+
+	k.remove(b)
+	k.update(c)
+	require.Equal(t, []string{a, c}, k.GetBuckets()[idx])
+
+	// We are never our own contact
+	k.update(k.address)
+	for _, bucket := range k.GetBuckets() {
+		require.NotContains(t, bucket, k.address)
+	}
+}
+
+// Test_Closest tests that the closest function sorts the contacts by XOR distance, including ourselves
+func Test_Closest(t *testing.T) {
+	k := newTestKademlia("127.0.0.1:0", 1, 20)
+	for i := 1; i <= 20; i++ {
+		k.update(fmt.Sprintf("127.0.0.1:%d", i))
+	}
+
+	for key := uint(0); key < 256; key++ {
+		closest := k.closest(key, 5)
+		require.Len(t, closest, 5)
+		for i := 1; i < len(closest); i++ {
+			require.LessOrEqual(t, closest[i-1].id^key, closest[i].id^key)
+		}
+	}
+	require.Equal(t, k.address, k.closest(k.id, 1)[0].address)
+}
+
+// Test_Owned_Ranges tests that a node alone owns the whole key space, and that the nodes knowing a contact in
+// each non-empty k-bucket split the key space among them, each key being owned by the closest node
+func Test_Owned_Ranges(t *testing.T) {
+	alone := newTestKademlia("127.0.0.1:0", 1, 8)
+	for key := uint(0); key < 256; key++ {
+		require.True(t, inRanges(key, alone.ownedRanges()))
+	}
+
+	// Build nodes with distinct IDs, each of them knows all the others, up to the size of the k-buckets
+	nodes := make([]*Kademlia, 0)
+	ids := make(map[uint]bool)
+	for i := 1; len(nodes) < 20; i++ {
+		node := newTestKademlia(fmt.Sprintf("127.0.0.1:%d", i), 1, 2)
+		if !ids[node.id] {
+			ids[node.id] = true
+			nodes = append(nodes, node)
+		}
+	}
+	for _, n1 := range nodes {
+		for _, n2 := range nodes {
+			n1.update(n2.address)
+		}
+	}
+
+	for key := uint(0); key < 256; key++ {
+		closest := nodes[0]
+		owners := 0
+		for _, node := range nodes {
+			if node.id^key < closest.id^key {
+				closest = node
+			}
+			if inRanges(key, node.ownedRanges()) {
+				owners++
+			}
+		}
+		require.Equal(t, 1, owners, "key %d", key)
+		require.True(t, inRanges(key, closest.ownedRanges()), "key %d", key)
+	}
+}
@@ -1,11 +1,14 @@
 package impl
 
 import (
+	"fmt"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"io"
 	"regexp"
 	"time"
 
+	"go.dedis.ch/cs438/clock/system"
 	"go.dedis.ch/cs438/peer"
 	"go.dedis.ch/cs438/peer/impl/blockchain/block"
 	"go.dedis.ch/cs438/peer/impl/blockchain/blockchain"
@@ -13,10 +16,15 @@ import (
 	"go.dedis.ch/cs438/peer/impl/chord"
 	"go.dedis.ch/cs438/peer/impl/consensus"
 	"go.dedis.ch/cs438/peer/impl/daemon"
+	"go.dedis.ch/cs438/peer/impl/dhash"
+	"go.dedis.ch/cs438/peer/impl/dht"
 	"go.dedis.ch/cs438/peer/impl/fileshare"
+	"go.dedis.ch/cs438/peer/impl/kademlia"
 	"go.dedis.ch/cs438/peer/impl/message"
 	"go.dedis.ch/cs438/peer/impl/passwordcracker"
 	"go.dedis.ch/cs438/transport"
+	"go.dedis.ch/cs438/types"
+	"golang.org/x/xerrors"
 )
 
 // node implements a peer to build a Peerster system
@@ -31,6 +39,8 @@ type node struct {
 	file            *fileshare.File                  // file module, handles file upload download
 	consensus       *consensus.Consensus             // The node's consensus component
 	chord           *chord.Chord                     // The node's chord component (DHT)
+	kademlia        *kademlia.Kademlia               // The node's kademlia component (DHT)
+	dHash           *dhash.DHash                     // The node's key-value store on top of chord
 	Blockchain      *blockchain.Blockchain           // The node's blockchain component (currently exposed for testing)
 	passwordCracker *passwordcracker.PasswordCracker // The node's password cracker
 }
@@ -38,13 +48,29 @@ type node struct {
 // NewPeer creates a new peer. You can change the content and location of this
 // function, but you MUST NOT change its signature and package location.
 func NewPeer(conf peer.Configuration) peer.Peer {
+	if conf.Clock == nil {
+		conf.Clock = system.NewClock()
+	}
+
 	messageMod := message.NewMessage(&conf)
 	daemonMod := daemon.NewDaemon(&conf, messageMod)
 	fileMod := fileshare.NewFile(&conf, messageMod)
 	consensusMod := consensus.NewConsensus(&conf, messageMod)
 	chordMod := chord.NewChord(&conf, messageMod)
+	kademliaMod := kademlia.NewKademlia(&conf, messageMod)
+	dHashMod := dhash.NewDHash(&conf, messageMod, chordMod)
 	blockchainMod := blockchain.NewBlockchain(&conf, messageMod, consensusMod, conf.Storage)
-	passwordCracker := passwordcracker.NewPasswordCracker(&conf, messageMod, chordMod, blockchainMod)
+
+	// The password cracker finds the peer responsible for a salt with the configured DHT. It caches the cracked
+	// passwords in DHash, which stores its entries on the Chord ring, so there is no cache along with Kademlia.
+	var dhtMod dht.DHT = chordMod
+	cache := dHashMod
+	if conf.DHT == peer.KademliaDHT {
+		dhtMod = kademliaMod
+		cache = nil
+	}
+	passwordCracker := passwordcracker.NewPasswordCracker(&conf, messageMod, dhtMod, cache,
+		blockchainMod)
 
 	n := node{
 		address:         conf.Socket.GetAddress(),
@@ -54,6 +80,8 @@ func NewPeer(conf peer.Configuration) peer.Peer {
 		file:            fileMod,
 		consensus:       consensusMod,
 		chord:           chordMod,
+		kademlia:        kademliaMod,
+		dHash:           dHashMod,
 		Blockchain:      blockchainMod,
 		passwordCracker: passwordCracker,
 	}
@@ -66,6 +94,16 @@ func (n *node) Start() error {
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 
 	n.chord.StartDaemon()
+	// Rejoin the Chord ring we were a member of before a restart, if any, without blocking the start
+	go func() {
+		err := n.chord.Rejoin()
+		if err != nil {
+			log.Error().Err(err).Msg(fmt.Sprintf("[%s] Chord Rejoin failed!", n.address))
+		}
+	}()
+	if n.conf.DHT == peer.KademliaDHT {
+		n.kademlia.StartDaemon()
+	}
 	n.Blockchain.Start()
 	return n.daemon.Start()
 }
@@ -73,6 +111,7 @@ func (n *node) Start() error {
 // Stop implements peer.Service
 func (n *node) Stop() error {
 	n.chord.StopDaemon()
+	n.kademlia.StopDaemon()
 	n.Blockchain.Stop()
 	return n.daemon.Stop()
 }
@@ -97,8 +136,17 @@ func (n *node) GetAddr() string {
 	return n.address
 }
 
-// Unicast implements peer.Messaging
+// Unicast implements peer.Messaging. Without any route to the destination, the message is routed through the
+// Chord ring if this peer is a member of one. The delivery through the ring is best-effort: an error is returned
+// if the destination is not a known member of the ring, but the message may still be dropped on the way, e.g., if
+// the destination leaves the ring.
 func (n *node) Unicast(dest string, msg transport.Message) error {
+	// Without any route to the destination, we reach it through the Chord ring if we are a member of one
+	_, ok := n.message.GetRoutingTable()[dest]
+	if !ok && dest != n.address && n.chord.GetState() == peer.ChordMember &&
+		n.chord.GetSuccessor() != "" && n.chord.GetSuccessor() != n.address {
+		return n.chord.RouteTo(dest, msg)
+	}
 	return n.message.Unicast(dest, msg)
 }
 
@@ -158,7 +206,7 @@ func (n *node) GetChordID() uint {
 
 // QueryChordID implements peer.Chord
 func (n *node) QueryChordID(addr string) uint {
-	return n.chord.Name2ID(addr)
+	return n.chord.NodeID(addr)
 }
 
 // GetPredecessor implements peer.Chord
@@ -176,6 +224,16 @@ func (n *node) GetFingerTable() []string {
 	return n.chord.GetFingerTable()
 }
 
+// GetVirtualNodes implements peer.Chord
+func (n *node) GetVirtualNodes() []string {
+	return n.chord.GetVirtualNodes()
+}
+
+// RingSnapshot implements peer.Chord
+func (n *node) RingSnapshot() (peer.RingSnapshot, error) {
+	return n.chord.RingSnapshot()
+}
+
 // JoinChord implements peer.Chord
 func (n *node) JoinChord(remoteNode string) error {
 	return n.chord.Join(remoteNode)
@@ -183,9 +241,58 @@ func (n *node) JoinChord(remoteNode string) error {
 
 // LeaveChord implements peer.Chord
 func (n *node) LeaveChord() error {
+	if n.chord.GetState() != peer.ChordMember {
+		return xerrors.Errorf("[%s] cannot leave the Chord ring while %s", n.address, n.chord.GetState())
+	}
+
+	// Hand over the entries we own before leaving, we still need our successors to do so
+	err := n.dHash.Leave()
+	if err != nil {
+		return err
+	}
 	return n.chord.Leave()
 }
 
+// QueryRange implements peer.Chord
+func (n *node) QueryRange(start uint, end uint) ([]types.ChordRange, error) {
+	return n.chord.QueryRange(start, end)
+}
+
+// RouteToKey implements peer.Chord
+func (n *node) RouteToKey(key uint, msg transport.Message) error {
+	return n.chord.RouteToKey(key, msg)
+}
+
+// GetChordState implements peer.Chord
+func (n *node) GetChordState() peer.ChordState {
+	return n.chord.GetState()
+}
+
+// GetKademliaID implements peer.Kademlia
+func (n *node) GetKademliaID() uint {
+	return n.kademlia.GetID()
+}
+
+// JoinKademlia implements peer.Kademlia
+func (n *node) JoinKademlia(remoteNode string) error {
+	return n.kademlia.Join(remoteNode)
+}
+
+// GetKBuckets implements peer.Kademlia
+func (n *node) GetKBuckets() [][]string {
+	return n.kademlia.GetBuckets()
+}
+
+// Put implements peer.DHash
+func (n *node) Put(key string, value []byte) error {
+	return n.dHash.Put(key, value)
+}
+
+// Get implements peer.DHash
+func (n *node) Get(key string) ([]byte, error) {
+	return n.dHash.Get(key)
+}
+
 // RingLen implements peer.Chord
 func (n *node) RingLen() uint {
 	return n.chord.RingLen()
@@ -232,6 +339,31 @@ func (n *node) GetChain() *block.Chain {
 	return n.Blockchain.GetChain()
 }
 
+// GetTransactionProof implements peer.IBlockchain
+func (n *node) GetTransactionProof(txHash string) (*block.TransactionProof, error) {
+	return n.Blockchain.GetTransactionProof(txHash)
+}
+
+// ProveContractExecution implements peer.IBlockchain
+func (n *node) ProveContractExecution(contractAddr string) (*block.TransactionProof, error) {
+	return n.Blockchain.ProveContractExecution(contractAddr)
+}
+
+// GetAccountProof implements peer.IBlockchain
+func (n *node) GetAccountProof(address string, blockID uint32) (*block.AccountProof, error) {
+	return n.Blockchain.GetAccountProof(address, blockID)
+}
+
+// GetReceipt implements peer.IBlockchain
+func (n *node) GetReceipt(txHash string) (*block.Receipt, error) {
+	return n.Blockchain.GetReceipt(txHash)
+}
+
+// SubscribeReceipts implements peer.IBlockchain
+func (n *node) SubscribeReceipts() (<-chan *block.Receipt, func()) {
+	return n.Blockchain.SubscribeReceipts()
+}
+
 // PasswordSubmitRequest implements peer.PasswordCracker
 func (n *node) PasswordSubmitRequest(hashStr string, saltStr string, reward int, timeout time.Duration) error {
 	return n.passwordCracker.SubmitRequest(hashStr, saltStr, reward, timeout)
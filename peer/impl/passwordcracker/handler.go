@@ -21,13 +21,19 @@ func (p *PasswordCracker) execPasswordCrackerRequestMessage(msg types.Message, p
 
 		password := p.crackPassword(passwordCrackerRequestMsg.Hash, passwordCrackerRequestMsg.Salt)
 
-		// Execute the smart contract to earn the reward
-		if passwordCrackerRequestMsg.ContractAddress.String() != "" && password != "" {
-			_ = p.blockchain.ExecuteContract(password,
+		// Execute the smart contract to earn the reward, once it is executed, our Tasks record in the world state
+		// proves the result
+		hasContract := passwordCrackerRequestMsg.ContractAddress.String() != ""
+		finisher := ""
+		if hasContract && password != "" {
+			err := p.blockchain.ExecuteContract(password,
 				hex.EncodeToString(passwordCrackerRequestMsg.Hash),
 				hex.EncodeToString(passwordCrackerRequestMsg.Salt),
 				passwordCrackerRequestMsg.ContractAddress.String(),
 				time.Second*600)
+			if err == nil {
+				finisher = p.blockchain.GetAccountAddress()
+			}
 		}
 
 		passwordCrackerReplyMsg := types.PasswordCrackerReplyMessage{
@@ -43,6 +49,15 @@ func (p *PasswordCracker) execPasswordCrackerRequestMessage(msg types.Message, p
 		if err != nil {
 			log.Error().Err(err).Msg("execPasswordCrackerRequestMessage SendDirectMsg")
 		}
+
+		// Publish the result in the cache, unless the contract execution failed, then the result is not backed
+		// by the blockchain
+		if password != "" && (!hasContract || finisher != "") {
+			err = p.publishCache(passwordCrackerRequestMsg.Hash, passwordCrackerRequestMsg.Salt, password, finisher)
+			if err != nil {
+				log.Error().Err(err).Msg("execPasswordCrackerRequestMessage publishCache")
+			}
+		}
 	}
 	go crackPasswordAndReply()
 	return nil
@@ -62,16 +77,3 @@ func (p *PasswordCracker) execPasswordCrackerReplyMessage(msg types.Message, pkt
 	p.tasks.Store(taskKey, taskResult)
 	return nil
 }
-
-// execPasswordCrackerUpdDictRangeMessage is the callback function to handle PasswordCrackerUpdDictRangeMessage
-func (p *PasswordCracker) execPasswordCrackerUpdDictRangeMessage(msg types.Message, pkt transport.Packet) error {
-	/* cast the message to its actual type. You assume it is the right type. */
-	passwordCrackerUpdDictRangeMsg, ok := msg.(*types.PasswordCrackerUpdDictRangeMessage)
-	if !ok {
-		return xerrors.Errorf("wrong type: %T", msg)
-	}
-
-	// Update the range
-	p.updDictRange(passwordCrackerUpdDictRangeMsg.Start, passwordCrackerUpdDictRangeMsg.End)
-	return nil
-}
@@ -8,12 +8,12 @@ import (
 	"go.dedis.ch/cs438/peer"
 	"go.dedis.ch/cs438/peer/impl/blockchain/blockchain"
 	"go.dedis.ch/cs438/peer/impl/blockchain/common"
-	"go.dedis.ch/cs438/peer/impl/chord"
+	"go.dedis.ch/cs438/peer/impl/dhash"
+	"go.dedis.ch/cs438/peer/impl/dht"
 	"go.dedis.ch/cs438/peer/impl/message"
 	"go.dedis.ch/cs438/types"
 	"golang.org/x/xerrors"
 	"math/big"
-	"strings"
 	"sync"
 	"time"
 )
@@ -23,14 +23,18 @@ import (
 var defaultDict = [...]string{
 	"apple", "ball", "cat", "doll", "egg"}
 
+// NewPasswordCracker creates the password cracker of the peer, the given DHT finds the peer responsible for a salt,
+// and tells the password cracker which salts the peer is responsible for. The cracked passwords are cached in the
+// given DHash, which runs on Chord: it is nil if the DHT is not Chord, and the passwords are not cached.
 func NewPasswordCracker(conf *peer.Configuration, message *message.Message,
-	chord *chord.Chord, blockchain *blockchain.Blockchain) *PasswordCracker {
+	dht dht.DHT, dHash *dhash.DHash, blockchain *blockchain.Blockchain) *PasswordCracker {
 	var tasks sync.Map
 	passwordCracker := PasswordCracker{
 		address:    conf.Socket.GetAddress(),
 		conf:       conf,
 		message:    message,
-		chord:      chord,
+		dht:        dht,
+		dHash:      dHash,
 		blockchain: blockchain,
 		hashAlgo:   conf.PasswordHashAlgorithm,
 		tasks:      &tasks,
@@ -41,8 +45,9 @@ func NewPasswordCracker(conf *peer.Configuration, message *message.Message,
 		types.PasswordCrackerRequestMessage{}, passwordCracker.execPasswordCrackerRequestMessage)
 	conf.MessageRegistry.RegisterMessageCallback(
 		types.PasswordCrackerReplyMessage{}, passwordCracker.execPasswordCrackerReplyMessage)
-	conf.MessageRegistry.RegisterMessageCallback(
-		types.PasswordCrackerUpdDictRangeMessage{}, passwordCracker.execPasswordCrackerUpdDictRangeMessage)
+
+	// Store the salted dictionaries of the range the peer is responsible for
+	dht.OnRangeChange(passwordCracker.updDictRanges)
 	return &passwordCracker
 }
 
@@ -50,7 +55,8 @@ type PasswordCracker struct {
 	address     string
 	conf        *peer.Configuration    // The configuration contains Socket and MessageRegistry
 	message     *message.Message       // Messaging used to communicate among nodes
-	chord       *chord.Chord           // chord used for find the correct receptor
+	dht         dht.DHT                // DHT used for find the correct receptor
+	dHash       *dhash.DHash           // DHash used to cache the cracked passwords, nil without Chord
 	blockchain  *blockchain.Blockchain // Blockchain used for submit request and execute contract
 	hashAlgo    crypto.Hash            // The algorithm that is used to compute from the password to hash
 	tasks       *sync.Map              // The tasks that this node have published
@@ -68,19 +74,36 @@ func (p *PasswordCracker) SubmitRequest(hashStr string, saltStr string, reward i
 		return err
 	}
 
-	// Query Chord using the salt value as the key
+	// If the same hash and salt have already been cracked, the result is cached on the owner of the salt, we
+	// return it directly instead of spending the cracking work and the reward again
 	saltInt := uint(big.NewInt(0).SetBytes(salt).Uint64())
-	receptor, err := p.chord.QuerySuccessor(p.address, saltInt)
+	taskKey := hex.EncodeToString(append(hash, salt...))
+	password, ok := p.lookupCache(hash, salt, saltInt)
+	if ok {
+		p.tasks.Store(taskKey, map[string]string{"password": password})
+		return nil
+	}
+
+	// Query the DHT using the salt value as the key
+	receptor, err := p.dht.Lookup(saltInt)
 	if err != nil {
 		return err
 	}
 
-	// Propose a password-cracking smart contract to the blockchain
+	// Propose a password-cracking smart contract to the blockchain, the reward goes to the account bound to the
+	// network address of the receptor
 	// It blocks until the ContractDeployTx has been confirmed
-	contractAddr := ""
+	contractAddr := common.Address{}
 	if timeout > 0 {
-		receptorBlockchainAddr := strings.Split(receptor, ":")[1]
-		contractAddr, err = p.blockchain.ProposeContract(hashStr, saltStr, int64(reward), receptorBlockchainAddr, timeout)
+		receptorBlockchainAddr, err := p.blockchain.GetAccountOf(receptor)
+		if err != nil {
+			return err
+		}
+		contract, err := p.blockchain.ProposeContract(hashStr, saltStr, int64(reward), receptorBlockchainAddr, timeout)
+		if err != nil {
+			return err
+		}
+		contractAddr, err = common.ParseAddress(contract)
 		if err != nil {
 			return err
 		}
@@ -90,7 +113,7 @@ func (p *PasswordCracker) SubmitRequest(hashStr string, saltStr string, reward i
 	passwordCrackerReqMsg := types.PasswordCrackerRequestMessage{
 		Hash:            hash,
 		Salt:            salt,
-		ContractAddress: common.StringToAddress(contractAddr),
+		ContractAddress: contractAddr,
 	}
 	passwordCrackerReqMsgTrans, err := p.conf.MessageRegistry.MarshalMessage(passwordCrackerReqMsg)
 	if err != nil {
@@ -99,7 +122,6 @@ func (p *PasswordCracker) SubmitRequest(hashStr string, saltStr string, reward i
 
 	// Store this task into the tasks pool
 	task := map[string]string{"password": ""}
-	taskKey := hex.EncodeToString(append(hash, salt...))
 	p.tasks.Store(taskKey, task)
 
 	// SendDirectMsg to the receptor and return
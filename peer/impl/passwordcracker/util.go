@@ -1,13 +1,19 @@
 package passwordcracker
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"github.com/rs/zerolog/log"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+	"go.dedis.ch/cs438/types"
 	"math"
 	"math/big"
 )
 
+// cachePrefix prefixes the DHash keys of the cracked passwords
+const cachePrefix = "passwordcracker-"
+
 // hashPassword combines password and salt then hash them using the configured hash algorithm and then
 // return the hashed password bytes
 func (p *PasswordCracker) hashPassword(password string, salt []byte) []byte {
@@ -48,11 +54,15 @@ func (p *PasswordCracker) createDictionary(salt uint) {
 
 // deleteDictionary deletes a dictionary entry given a salt value
 func (p *PasswordCracker) deleteDictionary(salt uint) {
+	p.conf.Storage.GetDictionaryStore().Delete(p.saltString(salt))
+}
+
+// saltString returns the key of the dictionary of the given salt inside the dictionary store
+func (p *PasswordCracker) saltString(salt uint) string {
 	// convert salt from uint into bytes array
 	saltBytes := make([]byte, p.conf.ChordBytes)
 	big.NewInt(int64(salt)).FillBytes(saltBytes)
-	saltString := hex.EncodeToString(saltBytes)
-	p.conf.Storage.GetDictionaryStore().Delete(saltString)
+	return hex.EncodeToString(saltBytes)
 }
 
 // crackPassword cracks the password using the given hash and salt value, if it succeeds, it returns the
@@ -78,29 +88,120 @@ func (p *PasswordCracker) crackPassword(hash []byte, salt []byte) string {
 
 // updDictRange updates the range of salted dictionary that this node stores
 func (p *PasswordCracker) updDictRange(start uint, end uint) {
+	p.updDictRanges([]types.SaltRange{{Start: start, End: end}})
+}
+
+// updDictRanges updates the salted dictionaries that this node stores to the union of the given ranges, there
+// is one range per DHT node (virtual or not) hosted by this peer. The dictionaries that are still inside the
+// ranges are kept, e.g., the ones persisted before a restart, only the missing ones are computed.
+func (p *PasswordCracker) updDictRanges(ranges []types.SaltRange) {
 	p.dictUpdLock.Lock()
 	defer p.dictUpdLock.Unlock()
 
+	stored := make(map[string]struct{})
+	p.conf.Storage.GetDictionaryStore().ForEach(func(key string, val []byte) bool {
+		stored[key] = struct{}{}
+		return true
+	})
+
 	upperBound := uint(math.Pow(2, float64(p.conf.ChordBytes)*8))
-	if start < end {
-		for i := uint(0); i <= start; i++ {
-			p.deleteDictionary(i)
-		}
-		for i := start + 1; i <= end; i++ {
-			p.createDictionary(i)
-		}
-		for i := end + 1; i < upperBound; i++ {
-			p.deleteDictionary(i)
-		}
-	} else {
-		for i := uint(0); i <= end; i++ {
-			p.createDictionary(i)
-		}
-		for i := end + 1; i <= start; i++ {
+	for i := uint(0); i < upperBound; i++ {
+		_, ok := stored[p.saltString(i)]
+		if inSaltRanges(i, ranges) {
+			if !ok {
+				p.createDictionary(i)
+			}
+		} else if ok {
 			p.deleteDictionary(i)
 		}
-		for i := start + 1; i < upperBound; i++ {
-			p.createDictionary(i)
+	}
+}
+
+// inSaltRanges checks whether the salt belongs to one of the ranges (Start, End], a range is crossing the
+// upper bound boundary of the ring if Start >= End
+func inSaltRanges(salt uint, ranges []types.SaltRange) bool {
+	for _, r := range ranges {
+		if r.Start < r.End {
+			if r.Start < salt && salt <= r.End {
+				return true
+			}
+		} else if r.Start < salt || salt <= r.End {
+			return true
 		}
 	}
+	return false
+}
+
+// cacheKey returns the DHash key under which the cracked password of the given hash and salt is cached
+func cacheKey(hash []byte, salt []byte) string {
+	return cachePrefix + hex.EncodeToString(append(append([]byte{}, hash...), salt...))
+}
+
+// publishCache publishes the cracked password in the DHash, on the owner of the salt. The finisher is the
+// blockchain account whose Tasks record proves the result, if any. Nothing is published if there is no DHash.
+func (p *PasswordCracker) publishCache(hash []byte, salt []byte, password string, finisher string) error {
+	if p.dHash == nil {
+		return nil
+	}
+
+	entry := types.PasswordCrackerCacheEntry{
+		Hash:     hash,
+		Salt:     salt,
+		Password: password,
+		Finisher: finisher,
+	}
+	entryByte, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	saltInt := uint(big.NewInt(0).SetBytes(salt).Uint64())
+	return p.dHash.PutAt(saltInt, cacheKey(hash, salt), entryByte)
+}
+
+// lookupCache looks up the cracked password of the given hash and salt in the DHash, it returns false if the
+// password is not cached, if the cached entry cannot be verified, or if there is no DHash
+func (p *PasswordCracker) lookupCache(hash []byte, salt []byte, saltInt uint) (string, bool) {
+	if p.dHash == nil {
+		return "", false
+	}
+
+	entryByte, err := p.dHash.GetAt(saltInt, cacheKey(hash, salt))
+	if err != nil {
+		return "", false
+	}
+
+	var entry types.PasswordCrackerCacheEntry
+	err = json.Unmarshal(entryByte, &entry)
+	if err != nil {
+		log.Error().Err(err).Msg("PasswordCracker lookupCache Unmarshal")
+		return "", false
+	}
+
+	worldState := p.blockchain.GetMiner().GetWorldState()
+	if !p.verifyCache(entry, hash, salt, &worldState) {
+		return "", false
+	}
+	return entry.Password, true
+}
+
+// verifyCache verifies a cached entry for the given hash and salt: the password should produce the hash, and
+// if the entry refers to a finisher, its Tasks record in the world state should contain the same result
+func (p *PasswordCracker) verifyCache(entry types.PasswordCrackerCacheEntry, hash []byte, salt []byte,
+	worldState *common.WorldState) bool {
+	if !bytes.Equal(entry.Hash, hash) || !bytes.Equal(entry.Salt, salt) {
+		return false
+	}
+	if !bytes.Equal(p.hashPassword(entry.Password, salt), hash) {
+		return false
+	}
+	if entry.Finisher == "" {
+		return true
+	}
+
+	state, ok := worldState.Get(entry.Finisher)
+	if !ok {
+		return false
+	}
+	task, ok := state.Tasks[hex.EncodeToString(hash)]
+	return ok && task == [2]string{entry.Password, hex.EncodeToString(salt)}
 }
@@ -2,9 +2,12 @@ package passwordcracker
 
 import (
 	"crypto"
+	"encoding/hex"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/cs438/peer"
+	"go.dedis.ch/cs438/peer/impl/blockchain/common"
 	"go.dedis.ch/cs438/storage/inmemory"
+	"go.dedis.ch/cs438/types"
 	"testing"
 )
 
@@ -102,3 +105,71 @@ func Test_Upd_Dict_Range(t *testing.T) {
 	p.updDictRange(77, 1077)
 	require.Equal(t, 1000, p.conf.Storage.GetDictionaryStore().Len())
 }
+
+// Test_Upd_Dict_Ranges tests the updDictRanges function, the node stores the union of the ranges
+func Test_Upd_Dict_Ranges(t *testing.T) {
+	p := PasswordCracker{}
+	p.hashAlgo = crypto.SHA256
+	p.conf = &peer.Configuration{}
+	p.conf.ChordBytes = 1
+	p.conf.Storage = inmemory.NewPersistency()
+
+	// Disjoint ranges, one of them crossing the upper bound boundary
+	p.updDictRanges([]types.SaltRange{{Start: 10, End: 20}, {Start: 250, End: 4}})
+	require.Equal(t, 10+10, p.conf.Storage.GetDictionaryStore().Len())
+	require.True(t, inSaltRanges(0, []types.SaltRange{{Start: 250, End: 4}}))
+	require.False(t, inSaltRanges(10, []types.SaltRange{{Start: 10, End: 20}}))
+	require.True(t, inSaltRanges(20, []types.SaltRange{{Start: 10, End: 20}}))
+
+	// Overlapping ranges are only counted once
+	p.updDictRanges([]types.SaltRange{{Start: 10, End: 20}, {Start: 15, End: 30}})
+	require.Equal(t, 20, p.conf.Storage.GetDictionaryStore().Len())
+
+	// No range, the node is not responsible for any salt
+	p.updDictRanges([]types.SaltRange{})
+	require.Equal(t, 0, p.conf.Storage.GetDictionaryStore().Len())
+}
+
+// Test_Verify_Cache tests the verifyCache function
+func Test_Verify_Cache(t *testing.T) {
+	p := PasswordCracker{}
+	p.hashAlgo = crypto.SHA256
+
+	salt := []byte{0x3c}
+	hash := p.hashPassword("apple", salt)
+	worldState := common.NewWorldState()
+
+	// An entry without finisher is verified by hashing the password
+	entry := types.PasswordCrackerCacheEntry{Hash: hash, Salt: salt, Password: "apple"}
+	require.True(t, p.verifyCache(entry, hash, salt, &worldState))
+
+	// A wrong password, or an entry of another hash and salt, is rejected
+	entry.Password = "egg"
+	require.False(t, p.verifyCache(entry, hash, salt, &worldState))
+	entry.Password = "apple"
+	require.False(t, p.verifyCache(entry, hash, []byte{0x3d}, &worldState))
+
+	// An entry with finisher requires the matching Tasks record in the world state
+	entry.Finisher = "finisher"
+	require.False(t, p.verifyCache(entry, hash, salt, &worldState))
+
+	state := common.State{Tasks: map[string][2]string{hex.EncodeToString(hash): {"apple", "3d"}}}
+	worldState.Set("finisher", state)
+	require.False(t, p.verifyCache(entry, hash, salt, &worldState))
+
+	state.Tasks[hex.EncodeToString(hash)] = [2]string{"apple", "3c"}
+	worldState.Set("finisher", state)
+	require.True(t, p.verifyCache(entry, hash, salt, &worldState))
+}
+
+// Test_Cache_Without_DHash tests that the cracked passwords are not cached when there is no DHash, i.e., when the
+// DHT is not Chord
+func Test_Cache_Without_DHash(t *testing.T) {
+	p := PasswordCracker{}
+
+	hash := []byte{0x1}
+	salt := []byte{0x3c}
+	require.NoError(t, p.publishCache(hash, salt, "apple", ""))
+	_, ok := p.lookupCache(hash, salt, 60)
+	require.False(t, ok)
+}
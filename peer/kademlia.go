@@ -0,0 +1,15 @@
+package peer
+
+// Kademlia defines the functions of the Kademlia DHT of a peer, it is used instead of Chord if the DHT of the
+// configuration is KademliaDHT.
+type Kademlia interface {
+	// GetKademliaID gets the ID of the current node inside the Kademlia key space
+	GetKademliaID() uint
+
+	// JoinKademlia joins the peer to an existing Kademlia network, through the given peer
+	JoinKademlia(string) error
+
+	// GetKBuckets gets the contacts of the current node, the bucket i holds the nodes whose XOR distance to
+	// the node is within [2^i, 2^(i+1))
+	GetKBuckets() [][]string
+}
@@ -2,6 +2,8 @@ package peer
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"go.dedis.ch/cs438/clock"
 	"go.dedis.ch/cs438/peer/impl/blockchain/common"
 	"go.dedis.ch/cs438/registry"
 	"go.dedis.ch/cs438/storage"
@@ -16,6 +18,8 @@ type Peer interface {
 	Messaging
 	DataSharing
 	Chord
+	Kademlia
+	DHash
 	IBlockchain
 	PasswordCracker
 }
@@ -105,13 +109,85 @@ type Configuration struct {
 	// of a finger table entry
 	ChordPingInterval time.Duration
 
-	// BlockchainAccountAddress is the account address used in the DCracker blockchain
+	// ChordVirtualNodes is the number of Chord identities hosted by the peer, each of them has its own
+	// chordID, finger table and range. A value <= 1 means the peer only hosts its primary identity.
+	// Default: 1
+	ChordVirtualNodes int
+
+	// ChordFingerCandidates is the number of candidate nodes a chord node keeps for each finger interval, the
+	// finger table routes through the candidate with the lowest round-trip time. A value <= 1 means the finger
+	// is always the successor of the start of the interval.
+	// Default: 1
+	ChordFingerCandidates int
+
+	// ChordAuthentication enables the authenticated membership: the chordID of a node is derived from its
+	// public key instead of its address, the notify and skip successor messages are signed, and the binding
+	// between the address and the chordID of a node is verified before a routing pointer is updated.
+	// Default: false
+	ChordAuthentication bool
+
+	// ChordKeyDifficulty is the number of leading zero bits of the proof of work over the public key of a
+	// credential, when the authentication is enabled. Each key costs about 2^ChordKeyDifficulty hashes, so that
+	// generating keys until one falls at a chosen chordID is that many times more expensive. It must be the same
+	// for all the peers.
+	// Default: 16
+	ChordKeyDifficulty uint
+
+	// Clock is the source of time of the Chord daemons and timeouts, a virtual clock lets a simulation
+	// drive them without waiting.
+	// Default: the system clock
+	Clock clock.Clock
+
+	// DHT is the distributed hash table the password cracker uses to find the peer responsible for a salt,
+	// and to know the salts the peer is responsible for. The cracked passwords are only cached with ChordDHT,
+	// since the cache is kept in DHash, on the Chord ring.
+	// Default: ChordDHT
+	DHT DHTType
+
+	// KademliaBucketSize is the number of contacts a Kademlia node keeps in each k-bucket, it is also the
+	// number of closest nodes a lookup keeps track of. A value < 1 means 1.
+	// Default: 8
+	KademliaBucketSize int
+
+	// KademliaTimeout is the timeout that a Kademlia node waits for the reply of a remote node, until it
+	// considers the remote node dead and removes it from its k-buckets
+	KademliaTimeout time.Duration
+
+	// KademliaRefreshInterval is the interval at which a Kademlia node looks up a random key in each of its
+	// k-buckets, to discover new nodes and evict the dead ones. 0 means the refresh is disabled.
+	KademliaRefreshInterval time.Duration
+
+	// DHashReplicas is the number of copies of each DHash entry that are stored on the successors
+	// of its owner, in addition to the copy stored by the owner.
+	// Default: 2
+	DHashReplicas uint
+
+	// BlockchainPrivateKey is the private key of the account used in the DCracker blockchain, it signs all
+	// transactions sent by the peer. If it is nil, the key persisted in the blockchain store is used, a new one is
+	// generated and persisted on the first start.
+	BlockchainPrivateKey *ecdsa.PrivateKey
+
+	// BlockchainAccountAddress is the account address used in the DCracker blockchain, it is derived from the
+	// public key of BlockchainPrivateKey and set by the peer, any given value is overwritten
 	BlockchainAccountAddress string
 
-	// BlockchainDifficulty is the proof-of-work difficulty for the DCracker blockchain
+	// BlockchainDifficulty is the proof-of-work difficulty of the first blocks of the DCracker blockchain, as the
+	// number of leading zero bits of their target. The following blocks are retargeted, see
+	// BlockchainRetargetInterval.
 	// Such difficulty MUST BE THE SAME for all participants
 	BlockchainDifficulty uint
 
+	// BlockchainRetargetInterval is the number of blocks after which the difficulty is retargeted from the time it
+	// took to mine them, so that the blocks are mined every BlockchainTargetBlockTime. The difficulty is never
+	// retargeted if it is lower than 2. It MUST BE THE SAME for all participants.
+	// Default: 0
+	BlockchainRetargetInterval uint32
+
+	// BlockchainTargetBlockTime is the time between two blocks that the retargets aim at. It MUST BE THE SAME for
+	// all participants.
+	// Default: 0
+	BlockchainTargetBlockTime time.Duration
+
 	// BlockchainBlockSize is maximum number of transactions one block contains
 	BlockchainBlockSize uint
 
@@ -119,9 +195,37 @@ type Configuration struct {
 	// when #processed_txs >= 1 but < BlockchainBlockSize
 	BlockchainBlockTimeout time.Duration
 
-	// BlockchainInitialState is the initial world state of the blockchain
+	// BlockchainInitialState is the initial world state of the blockchain. The accounts declared later draw
+	// common.FaucetAllowance from the faucet account it allocates, see common.FaucetAllocation.
 	BlockchainInitialState map[string]common.State
 
+	// BlockchainBlockReward is the amount of Cracker paid to the creator of each block, on top of the fees of its
+	// transactions. It must be the same for all the peers.
+	// Default: 0
+	BlockchainBlockReward int64
+
+	// BlockchainTransactionFee is the fee that the peer attaches to the transactions it sends, except the
+	// declaration of its account, it is paid to the creator of the block including the transaction.
+	// Default: 0
+	BlockchainTransactionFee int64
+
+	// BlockchainMempoolSize is the maximum number of pending transactions the miner holds. When it is reached, a
+	// new transaction evicts a pending one of a lower fee. A value of 0 means no limit.
+	// Default: 1000
+	BlockchainMempoolSize uint
+
+	// BlockchainInvalidTxTTL is how long the miner keeps retrying a pending transaction that fails to be executed,
+	// e.g., because its sender can not afford it yet, before dropping it. It is also how long the miner holds a
+	// transaction that waits for a missing nonce of its account, since it was received.
+	// Default: 1min
+	BlockchainInvalidTxTTL time.Duration
+
+	// BlockchainSyncInterval is the interval at which the peer announces the tip of its chain to its neighbors,
+	// so that a lagging neighbor requests the blocks it misses. A value of 0 disables the announcements, a lagging
+	// peer still catches up when it receives a block that does not follow its tip.
+	// Default: 0
+	BlockchainSyncInterval time.Duration
+
 	//// BlockchainAddressToSocket is the mapping from blockchain address to network socket address
 	//BlockchainAddressToSocket map[string]string
 
@@ -129,6 +233,17 @@ type Configuration struct {
 	PasswordHashAlgorithm crypto.Hash
 }
 
+// DHTType is the type of distributed hash table used by a peer
+type DHTType string
+
+const (
+	// ChordDHT is the Chord ring, it is the default DHT
+	ChordDHT DHTType = "chord"
+
+	// KademliaDHT is the Kademlia network, based on the XOR metric
+	KademliaDHT DHTType = "kademlia"
+)
+
 // Backoff describes parameters for a backoff algorithm. The initial time must
 // be multiplied by "factor" a maximum of "retry" time.
 //
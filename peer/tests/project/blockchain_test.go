@@ -1,13 +1,21 @@
 package project
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"github.com/stretchr/testify/require"
 	z "go.dedis.ch/cs438/internal/testing"
+	"go.dedis.ch/cs438/peer/impl/blockchain/block"
 	"go.dedis.ch/cs438/peer/impl/blockchain/common"
+	"go.dedis.ch/cs438/peer/impl/blockchain/transaction"
+	"go.dedis.ch/cs438/storage/inmemory"
+	"go.dedis.ch/cs438/transport"
+	"go.dedis.ch/cs438/types"
 	"math/rand"
 	"os"
-	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -32,14 +40,14 @@ func Test_Blockchain_Create(t *testing.T) {
 }
 
 // Test_Blockchain_Initial_Balance tests if a node could initiate the blockchain with correct initial balance
-// world state has just one account with address == "1" and balance == 10
+// world state has just one account with address == QuickAddress(1) and balance == 10
 func Test_Blockchain_Initial_Balance(t *testing.T) {
 	transp := channelFac()
 
 	worldState := common.QuickWorldState(1, 10)
 
 	node := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-		z.WithBlockchainAccountAddress("1"),
+		z.WithBlockchainPrivateKey(common.QuickKey(1)),
 		z.WithBlockchainInitialState(worldState.GetSimpleMap()))
 
 	defer node.Stop()
@@ -63,7 +71,7 @@ func Test_Blockchain_No_Enough_Balance(t *testing.T) {
 	worldState := common.QuickWorldState(2, 5)
 
 	node := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-		z.WithBlockchainAccountAddress("1"),
+		z.WithBlockchainPrivateKey(common.QuickKey(1)),
 		z.WithBlockchainInitialState(worldState.GetSimpleMap()))
 
 	defer node.Stop()
@@ -78,7 +86,7 @@ func Test_Blockchain_No_Enough_Balance(t *testing.T) {
 	balance := node.GetBalance()
 	require.EqualValues(t, balance, 5)
 
-	err := node.TransferMoney(common.Address{HexString: "2"}, 10, time.Second)
+	err := node.TransferMoney(common.QuickAddress(2), 10, time.Second)
 	require.Error(t, err)
 }
 
@@ -92,17 +100,17 @@ func Test_Blockchain_Success_Transfer(t *testing.T) {
 	worldState := common.QuickWorldState(3, 10)
 
 	node1 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-		z.WithBlockchainAccountAddress("1"),
+		z.WithBlockchainPrivateKey(common.QuickKey(1)),
 		z.WithBlockchainInitialState(worldState.GetSimpleMap()),
 		z.WithBlockchainBlockTimeout(time.Second*3),
 		z.WithTotalPeers(3))
 	node2 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-		z.WithBlockchainAccountAddress("2"),
+		z.WithBlockchainPrivateKey(common.QuickKey(2)),
 		z.WithBlockchainInitialState(worldState.GetSimpleMap()),
 		z.WithBlockchainBlockTimeout(time.Second*3),
 		z.WithTotalPeers(3))
 	node3 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-		z.WithBlockchainAccountAddress("3"),
+		z.WithBlockchainPrivateKey(common.QuickKey(3)),
 		z.WithBlockchainInitialState(worldState.GetSimpleMap()),
 		z.WithBlockchainBlockTimeout(time.Second*3),
 		z.WithTotalPeers(3))
@@ -121,7 +129,7 @@ func Test_Blockchain_Success_Transfer(t *testing.T) {
 	time.Sleep(time.Millisecond * 10)
 
 	// Money transfer should be successful
-	err := node1.TransferMoney(common.Address{HexString: "2"}, 3, time.Second*600)
+	err := node1.TransferMoney(common.QuickAddress(2), 3, time.Second*600)
 	require.NoError(t, err)
 
 	time.Sleep(time.Second * 5)
@@ -141,6 +149,24 @@ func Test_Blockchain_Success_Transfer(t *testing.T) {
 	lastBlockHash := node1.GetChain().GetLastBlock().BlockHash
 	require.Equal(t, node2.GetChain().GetLastBlock().BlockHash, lastBlockHash)
 	require.Equal(t, node3.GetChain().GetLastBlock().BlockHash, lastBlockHash)
+
+	// Every node rebuilds the world state of the block, and can prove the balance of an account at any block
+	difficulty := node3.GetChain().Difficulty.Initial
+	for _, node := range []z.TestNode{node1, node2, node3} {
+		proof, err := node.GetAccountProof(common.QuickAddress(2).String(), 1)
+		require.NoError(t, err)
+		require.Equal(t, lastBlockHash, proof.BlockHash)
+		require.EqualValues(t, 13, proof.Proof.State.Balance)
+		require.NoError(t, proof.Verify(difficulty))
+
+		proof, err = node.GetAccountProof(common.QuickAddress(2).String(), 0)
+		require.NoError(t, err)
+		require.EqualValues(t, 10, proof.Proof.State.Balance)
+		require.NoError(t, proof.Verify(0))
+
+		_, err = node.GetAccountProof(common.QuickAddress(2).String(), 2)
+		require.Error(t, err)
+	}
 }
 
 // Test_Blockchain_Multiple_Transfers tests if several nodes could successfully transfer some money when it has enough balance
@@ -152,19 +178,19 @@ func Test_Blockchain_Multiple_Transfers(t *testing.T) {
 
 	worldState := common.QuickWorldState(3, 10)
 
-	newNode := func(address string) z.TestNode {
+	newNode := func(account int) z.TestNode {
 		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-			z.WithBlockchainAccountAddress(address),
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
 			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
 			z.WithBlockchainBlockTimeout(time.Second*3),
-			z.WithBlockchainDifficulty(3),
+			z.WithBlockchainDifficulty(24),
 			z.WithBlockchainBlockSize(3),
 			z.WithTotalPeers(3))
 	}
 
-	node1 := newNode("1")
-	node2 := newNode("2")
-	node3 := newNode("3")
+	node1 := newNode(1)
+	node2 := newNode(2)
+	node3 := newNode(3)
 
 	defer node1.Stop()
 	defer node2.Stop()
@@ -184,9 +210,9 @@ func Test_Blockchain_Multiple_Transfers(t *testing.T) {
 	// 1 -> 2 : $3
 	// 1 -> 2 : $5
 	go func() {
-		err := node1.TransferMoney(common.Address{HexString: "2"}, 3, time.Second*600)
+		err := node1.TransferMoney(common.QuickAddress(2), 3, time.Second*600)
 		require.NoError(t, err)
-		err = node1.TransferMoney(common.Address{HexString: "2"}, 5, time.Second*600)
+		err = node1.TransferMoney(common.QuickAddress(2), 5, time.Second*600)
 		require.NoError(t, err)
 		close(done1)
 	}()
@@ -194,9 +220,9 @@ func Test_Blockchain_Multiple_Transfers(t *testing.T) {
 	// 2 -> 3 : $6
 	// 2 -> 1 : $1
 	go func() {
-		err := node2.TransferMoney(common.Address{HexString: "3"}, 6, time.Second*600)
+		err := node2.TransferMoney(common.QuickAddress(3), 6, time.Second*600)
 		require.NoError(t, err)
-		err = node2.TransferMoney(common.Address{HexString: "1"}, 1, time.Second*600)
+		err = node2.TransferMoney(common.QuickAddress(1), 1, time.Second*600)
 		require.NoError(t, err)
 		close(done2)
 	}()
@@ -204,9 +230,9 @@ func Test_Blockchain_Multiple_Transfers(t *testing.T) {
 	// 3 -> 1 : $4
 	// 3 -> 2 : $2
 	go func() {
-		err := node3.TransferMoney(common.Address{HexString: "1"}, 4, time.Second*600)
+		err := node3.TransferMoney(common.QuickAddress(1), 4, time.Second*600)
 		require.NoError(t, err)
-		err = node3.TransferMoney(common.Address{HexString: "2"}, 2, time.Second*600)
+		err = node3.TransferMoney(common.QuickAddress(2), 2, time.Second*600)
 		require.NoError(t, err)
 		close(done3)
 	}()
@@ -266,10 +292,10 @@ func Test_Blockchain_Random_Transfers(t *testing.T) {
 
 	newNode := func(i int) z.TestNode {
 		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-			z.WithBlockchainAccountAddress(fmt.Sprintf("%d", i)),
+			z.WithBlockchainPrivateKey(common.QuickKey(i)),
 			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
 			z.WithBlockchainBlockTimeout(time.Second*5),
-			z.WithBlockchainDifficulty(3),
+			z.WithBlockchainDifficulty(24),
 			z.WithBlockchainBlockSize(3),
 			z.WithTotalPeers(uint(numNode)))
 	}
@@ -300,7 +326,7 @@ func Test_Blockchain_Random_Transfers(t *testing.T) {
 			for dst == n+1 {
 				dst = rand.Intn(numNode) + 1
 			}
-			dstAddress := common.Address{HexString: fmt.Sprintf("%d", dst)}
+			dstAddress := common.QuickAddress(dst)
 
 			currNode := n
 			currBalance := nodes[currNode].GetBalance()
@@ -368,10 +394,10 @@ func Test_Blockchain_Stress_Test(t *testing.T) {
 
 	newNode := func(i int) z.TestNode {
 		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-			z.WithBlockchainAccountAddress(fmt.Sprintf("%d", i)),
+			z.WithBlockchainPrivateKey(common.QuickKey(i)),
 			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
 			z.WithBlockchainBlockTimeout(time.Second*5),
-			z.WithBlockchainDifficulty(2),
+			z.WithBlockchainDifficulty(16),
 			z.WithBlockchainBlockSize(10),
 			z.WithTotalPeers(uint(numNode)))
 	}
@@ -405,7 +431,7 @@ func Test_Blockchain_Stress_Test(t *testing.T) {
 				for dst == currNode+1 {
 					dst = rand.Intn(numNode) + 1
 				}
-				dstAddress := common.Address{HexString: fmt.Sprintf("%d", dst)}
+				dstAddress := common.QuickAddress(dst)
 
 				currBalance := nodes[currNode].GetBalance()
 				amount := rand.Int63n(currBalance)
@@ -460,19 +486,19 @@ func Test_Blockchain_Late_Start_Catch_Up(t *testing.T) {
 
 	worldState := common.QuickWorldState(3, 10)
 
-	newNode := func(address string) z.TestNode {
+	newNode := func(account int) z.TestNode {
 		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-			z.WithBlockchainAccountAddress(address),
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
 			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
 			z.WithBlockchainBlockTimeout(time.Second*3),
-			z.WithBlockchainDifficulty(3),
+			z.WithBlockchainDifficulty(24),
 			z.WithBlockchainBlockSize(2),
 			z.WithHeartbeat(time.Second*1),
 			z.WithAntiEntropy(time.Second*1))
 	}
 
-	node1 := newNode("1")
-	node2 := newNode("2")
+	node1 := newNode(1)
+	node2 := newNode(2)
 
 	defer node1.Stop()
 	defer node2.Stop()
@@ -486,9 +512,9 @@ func Test_Blockchain_Late_Start_Catch_Up(t *testing.T) {
 	// 1 -> 2 : $3
 	// 1 -> 2 : $6
 	go func() {
-		err := node1.TransferMoney(common.Address{HexString: "2"}, 3, time.Second*600)
+		err := node1.TransferMoney(common.QuickAddress(2), 3, time.Second*600)
 		require.NoError(t, err)
-		err = node1.TransferMoney(common.Address{HexString: "2"}, 6, time.Second*600)
+		err = node1.TransferMoney(common.QuickAddress(2), 6, time.Second*600)
 		require.NoError(t, err)
 		close(done1)
 	}()
@@ -496,9 +522,9 @@ func Test_Blockchain_Late_Start_Catch_Up(t *testing.T) {
 	// 2 -> 1 : $5
 	// 2 -> 1 : $1
 	go func() {
-		err := node2.TransferMoney(common.Address{HexString: "1"}, 5, time.Second*600)
+		err := node2.TransferMoney(common.QuickAddress(1), 5, time.Second*600)
 		require.NoError(t, err)
-		err = node2.TransferMoney(common.Address{HexString: "1"}, 1, time.Second*600)
+		err = node2.TransferMoney(common.QuickAddress(1), 1, time.Second*600)
 		require.NoError(t, err)
 		close(done2)
 	}()
@@ -508,7 +534,7 @@ func Test_Blockchain_Late_Start_Catch_Up(t *testing.T) {
 	<-done2
 
 	// Node3 starts late
-	node3 := newNode("3")
+	node3 := newNode(3)
 	defer node3.Stop()
 	node1.AddPeer(node3.GetAddr())
 	node2.AddPeer(node3.GetAddr())
@@ -551,25 +577,26 @@ func Test_Blockchain_Late_Start_Catch_Up(t *testing.T) {
 }
 
 // Test_Blockchain_Join tests if a node could join the blockchain network by declaring its account when
-// it is not included in the initial world state.
+// it is not included in the initial world state. Its balance is drawn from the faucet.
 func Test_Blockchain_Join(t *testing.T) {
 	transp := channelFac()
 
 	worldState := common.QuickWorldState(2, 10)
+	worldState.Set(common.FaucetAddress.String(), common.State{Balance: common.FaucetAllowance})
 
-	newNode := func(address string) z.TestNode {
+	newNode := func(account int) z.TestNode {
 		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-			z.WithBlockchainAccountAddress(address),
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
 			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
 			z.WithBlockchainBlockTimeout(time.Second*3),
-			z.WithBlockchainDifficulty(3),
+			z.WithBlockchainDifficulty(24),
 			z.WithBlockchainBlockSize(2),
 			z.WithHeartbeat(time.Second*1),
 			z.WithAntiEntropy(time.Second*1))
 	}
 
-	node1 := newNode("1")
-	node2 := newNode("2")
+	node1 := newNode(1)
+	node2 := newNode(2)
 
 	defer node1.Stop()
 	defer node2.Stop()
@@ -583,9 +610,9 @@ func Test_Blockchain_Join(t *testing.T) {
 	// 1 -> 2 : $3
 	// 1 -> 2 : $6
 	go func() {
-		err := node1.TransferMoney(common.Address{HexString: "2"}, 3, time.Second*600)
+		err := node1.TransferMoney(common.QuickAddress(2), 3, time.Second*600)
 		require.NoError(t, err)
-		err = node1.TransferMoney(common.Address{HexString: "2"}, 6, time.Second*600)
+		err = node1.TransferMoney(common.QuickAddress(2), 6, time.Second*600)
 		require.NoError(t, err)
 		close(done1)
 	}()
@@ -593,9 +620,9 @@ func Test_Blockchain_Join(t *testing.T) {
 	// 2 -> 1 : $1
 	// 2 -> 1 : $5
 	go func() {
-		err := node2.TransferMoney(common.Address{HexString: "1"}, 1, time.Second*600)
+		err := node2.TransferMoney(common.QuickAddress(1), 1, time.Second*600)
 		require.NoError(t, err)
-		err = node2.TransferMoney(common.Address{HexString: "1"}, 5, time.Second*600)
+		err = node2.TransferMoney(common.QuickAddress(1), 5, time.Second*600)
 		require.NoError(t, err)
 		close(done2)
 	}()
@@ -605,7 +632,7 @@ func Test_Blockchain_Join(t *testing.T) {
 	<-done2
 
 	// Node3 starts late
-	node3 := newNode("3")
+	node3 := newNode(3)
 	defer node3.Stop()
 	node1.AddPeer(node3.GetAddr())
 	node2.AddPeer(node3.GetAddr())
@@ -614,15 +641,14 @@ func Test_Blockchain_Join(t *testing.T) {
 
 	time.Sleep(time.Second * 5)
 
-	// Node3 declare its blockchain account with initial balance of 100
-	err := node3.JoinBlockchain(100, time.Second*600)
-	//err := node3.TransferMoney(common.StringToAddress("3"), 100, time.Second*600)
+	// Node3 declares its blockchain account with the allowance of the faucet
+	err := node3.JoinBlockchain(common.FaucetAllowance, time.Second*600)
 	require.NoError(t, err)
 
-	err = node3.TransferMoney(common.StringToAddress("1"), 10, time.Second*600)
+	err = node3.TransferMoney(common.QuickAddress(1), 4, time.Second*600)
 	require.NoError(t, err)
 
-	err = node3.TransferMoney(common.StringToAddress("2"), 10, time.Second*600)
+	err = node3.TransferMoney(common.QuickAddress(2), 6, time.Second*600)
 	require.NoError(t, err)
 
 	// Print the blockchain of each account
@@ -634,9 +660,9 @@ func Test_Blockchain_Join(t *testing.T) {
 	balance1 := node1.GetBalance()
 	balance2 := node2.GetBalance()
 	balance3 := node3.GetBalance()
-	require.EqualValues(t, balance1, 17)
-	require.EqualValues(t, balance2, 23)
-	require.EqualValues(t, balance3, 80)
+	require.EqualValues(t, balance1, 11)
+	require.EqualValues(t, balance2, 19)
+	require.EqualValues(t, balance3, 0)
 
 	// 6 transactions in total
 	// Check blockchain after transfer
@@ -656,36 +682,43 @@ func Test_Blockchain_Join(t *testing.T) {
 	require.NoError(t, node1.GetChain().ValidateChain())
 	require.NoError(t, node2.GetChain().ValidateChain())
 	require.NoError(t, node3.GetChain().ValidateChain())
+
+	// The account of node3 is bound to its network address
+	state3, ok := node1.GetChain().GetLastBlock().State.Get(node3.GetAccountAddress())
+	require.True(t, ok)
+	require.Equal(t, node3.GetAddr(), state3.NetworkAddress)
 }
 
-// Test_Blockchain_All_Join tests if the initial world state is empty and all nodes declare itself by joining
+// Test_Blockchain_All_Join tests if the initial world state only holds the faucet and all nodes declare itself by
+// joining
 func Test_Blockchain_All_Join(t *testing.T) {
 	transp := channelFac()
 
-	newNode := func() z.TestNode {
+	newNode := func(account int) z.TestNode {
 		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-			z.WithBlockchainInitialState(nil),
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
+			z.WithBlockchainInitialState(common.FaucetAllocation(30)),
 			z.WithBlockchainBlockTimeout(time.Second*3),
-			z.WithBlockchainDifficulty(2),
+			z.WithBlockchainDifficulty(16),
 			z.WithBlockchainBlockSize(2),
 			z.WithHeartbeat(time.Second*1),
 			z.WithAntiEntropy(time.Second*1))
 	}
 
 	// Create each node and let them join the blockchain
-	node1 := newNode()
+	node1 := newNode(1)
 	defer node1.Stop()
 	err1 := node1.JoinBlockchain(10, time.Second*600)
 	require.NoError(t, err1)
 
-	node2 := newNode()
+	node2 := newNode(2)
 	defer node2.Stop()
 	node1.AddPeer(node2.GetAddr())
 	node2.AddPeer(node1.GetAddr())
 	err2 := node2.JoinBlockchain(10, time.Second*600)
 	require.NoError(t, err2)
 
-	node3 := newNode()
+	node3 := newNode(3)
 	defer node3.Stop()
 	node1.AddPeer(node3.GetAddr())
 	node2.AddPeer(node3.GetAddr())
@@ -709,9 +742,9 @@ func Test_Blockchain_All_Join(t *testing.T) {
 	require.NoError(t, node2.GetChain().ValidateChain())
 	require.NoError(t, node3.GetChain().ValidateChain())
 
-	// There should be three txs in the blockchain and three accounts in the world state
+	// There should be three txs in the blockchain and three accounts in the world state, besides the emptied faucet
 	require.Equal(t, node1.GetChain().GetTransactionCount(), 3)
-	require.Equal(t, node1.GetChain().GetLastBlock().State.Len(), 3)
+	require.Equal(t, node1.GetChain().GetLastBlock().State.Len(), 4)
 
 	require.EqualValues(t, node1.GetBalance(), 10)
 	require.EqualValues(t, node2.GetBalance(), 10)
@@ -726,9 +759,9 @@ func Test_Blockchain_All_Join(t *testing.T) {
 	// 1 -> 2 : $3
 	// 1 -> 2 : $5
 	go func() {
-		err := node1.TransferMoney(common.Address{HexString: "2"}, 3, time.Second*600)
+		err := node1.TransferMoney(common.QuickAddress(2), 3, time.Second*600)
 		require.NoError(t, err)
-		err = node1.TransferMoney(common.Address{HexString: "2"}, 5, time.Second*600)
+		err = node1.TransferMoney(common.QuickAddress(2), 5, time.Second*600)
 		require.NoError(t, err)
 		close(done1)
 	}()
@@ -736,9 +769,9 @@ func Test_Blockchain_All_Join(t *testing.T) {
 	// 2 -> 3 : $6
 	// 2 -> 1 : $1
 	go func() {
-		err := node2.TransferMoney(common.Address{HexString: "3"}, 6, time.Second*600)
+		err := node2.TransferMoney(common.QuickAddress(3), 6, time.Second*600)
 		require.NoError(t, err)
-		err = node2.TransferMoney(common.Address{HexString: "1"}, 1, time.Second*600)
+		err = node2.TransferMoney(common.QuickAddress(1), 1, time.Second*600)
 		require.NoError(t, err)
 		close(done2)
 	}()
@@ -746,9 +779,9 @@ func Test_Blockchain_All_Join(t *testing.T) {
 	// 3 -> 1 : $4
 	// 3 -> 2 : $2
 	go func() {
-		err := node3.TransferMoney(common.Address{HexString: "1"}, 4, time.Second*600)
+		err := node3.TransferMoney(common.QuickAddress(1), 4, time.Second*600)
 		require.NoError(t, err)
-		err = node3.TransferMoney(common.Address{HexString: "2"}, 2, time.Second*600)
+		err = node3.TransferMoney(common.QuickAddress(2), 2, time.Second*600)
 		require.NoError(t, err)
 		close(done3)
 	}()
@@ -791,7 +824,7 @@ func Test_Blockchain_All_Join(t *testing.T) {
 	require.NoError(t, node3.GetChain().ValidateChain())
 }
 
-// Test_Blockchain_Stress_Test creates many nodes with an empty initial state.
+// Test_Blockchain_Stress_Test creates many nodes with an initial state only holding the faucet.
 // Each node joins by calling JoinBlockchain
 // The difficulty of POW is very low to produce frequent block mining conflicts.
 // It tests, after all these joining, if the blockchain of each account is the same
@@ -801,24 +834,25 @@ func Test_Blockchain_Join_Stress_Test(t *testing.T) {
 	transp := channelFac()
 
 	numNode := 5
-	initBalance := 100
+	initBalance := common.FaucetAllowance
 	txVerifyTimeout := time.Second * 600
 
-	newNode := func(address string) z.TestNode {
-		fullAddr := fmt.Sprintf("127.0.0.1:%s", address)
+	newNode := func(account int) z.TestNode {
+		fullAddr := fmt.Sprintf("127.0.0.1:%d", account)
 		return z.NewTestNode(t, peerFac, transp, fullAddr,
+			z.WithBlockchainInitialState(common.FaucetAllocation(initBalance*int64(numNode))),
 			z.WithBlockchainBlockTimeout(time.Second*3),
-			z.WithBlockchainDifficulty(2),
+			z.WithBlockchainDifficulty(16),
 			z.WithBlockchainBlockSize(2),
 			z.WithHeartbeat(time.Second*1),
 			z.WithAntiEntropy(time.Second*1),
-			z.WithBlockchainAccountAddress(address))
+			z.WithBlockchainPrivateKey(common.QuickKey(account)))
 	}
 
 	// Create nodes
 	nodes := make([]z.TestNode, 0)
 	for i := 0; i < numNode; i++ {
-		nodes = append(nodes, newNode(strconv.Itoa(i+1)))
+		nodes = append(nodes, newNode(i+1))
 		defer nodes[len(nodes)-1].Stop()
 
 		for j := 0; j < i; j++ {
@@ -826,7 +860,7 @@ func Test_Blockchain_Join_Stress_Test(t *testing.T) {
 			nodes[j].AddPeer(nodes[i].GetAddr())
 		}
 
-		err := nodes[i].JoinBlockchain(int64(initBalance), txVerifyTimeout)
+		err := nodes[i].JoinBlockchain(initBalance, txVerifyTimeout)
 		require.NoError(t, err)
 	}
 
@@ -841,7 +875,7 @@ func Test_Blockchain_Join_Stress_Test(t *testing.T) {
 	}
 	//
 	//for n := 0; n < numNode; n++ {
-	//	err := nodes[n].JoinBlockchain(int64(initBalance), txVerifyTimeout)
+	//	err := nodes[n].JoinBlockchain(initBalance, txVerifyTimeout)
 	//	require.NoError(t, err)
 	//}
 
@@ -855,7 +889,7 @@ func Test_Blockchain_Join_Stress_Test(t *testing.T) {
 	for i := 0; i < numNode; i++ {
 		balanceSum += nodes[i].GetBalance()
 	}
-	require.EqualValues(t, initBalance*numNode, balanceSum)
+	require.EqualValues(t, initBalance*int64(numNode), balanceSum)
 
 	// Check blockchain
 	blockCnt := nodes[0].GetChain().GetBlockCount()
@@ -869,7 +903,7 @@ func Test_Blockchain_Join_Stress_Test(t *testing.T) {
 
 	// Check state
 	numAccount := nodes[0].GetChain().GetLastBlock().State.Len()
-	for n := 1; n < numAccount; n++ {
+	for n := 1; n < numNode; n++ {
 		require.Equal(t, numAccount,
 			nodes[n].GetChain().GetLastBlock().State.Len())
 	}
@@ -888,19 +922,19 @@ func Test_Blockchain_Deploy_Contract(t *testing.T) {
 
 	worldState := common.QuickWorldState(2, 10)
 
-	newNode := func(address string) z.TestNode {
+	newNode := func(account int) z.TestNode {
 		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-			z.WithBlockchainAccountAddress(address),
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
 			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
 			z.WithBlockchainBlockTimeout(time.Second*3),
-			z.WithBlockchainDifficulty(3),
+			z.WithBlockchainDifficulty(24),
 			z.WithBlockchainBlockSize(2),
 			z.WithHeartbeat(time.Second*1),
 			z.WithAntiEntropy(time.Second*1))
 	}
 
-	node1 := newNode("1")
-	node2 := newNode("2")
+	node1 := newNode(1)
+	node2 := newNode(2)
 
 	defer node1.Stop()
 	defer node2.Stop()
@@ -910,7 +944,7 @@ func Test_Blockchain_Deploy_Contract(t *testing.T) {
 
 	time.Sleep(time.Millisecond * 10)
 
-	err := node1.ProposeContract("abcdefg", "xxxx", 3, "2", time.Second*600)
+	err := node1.ProposeContract("abcdefg", "xxxx", 3, common.QuickAddress(2).String(), time.Second*600)
 	require.NoError(t, err)
 
 	// Print the blockchain of each miner
@@ -931,7 +965,7 @@ func Test_Blockchain_Deploy_Contract(t *testing.T) {
 	require.EqualValues(t, node1.GetBalance(), 7)
 	require.EqualValues(t, node2.GetBalance(), 10)
 
-	contractState, _ := node1.GetChain().GetLastBlock().State.Get("1_1")
+	contractState, _ := node1.GetChain().GetLastBlock().State.Get(common.ContractAddress(common.QuickAddress(1), 1).String())
 	require.EqualValues(t, contractState.Balance, 3)
 
 }
@@ -942,19 +976,19 @@ func Test_Blockchain_Execute_Contract(t *testing.T) {
 
 	worldState := common.QuickWorldState(2, 10)
 
-	newNode := func(address string) z.TestNode {
+	newNode := func(account int) z.TestNode {
 		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
-			z.WithBlockchainAccountAddress(address),
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
 			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
 			z.WithBlockchainBlockTimeout(time.Second*3),
-			z.WithBlockchainDifficulty(2),
+			z.WithBlockchainDifficulty(16),
 			z.WithBlockchainBlockSize(2),
 			z.WithHeartbeat(time.Second*1),
 			z.WithAntiEntropy(time.Second*1))
 	}
 
-	node1 := newNode("1")
-	node2 := newNode("2")
+	node1 := newNode(1)
+	node2 := newNode(2)
 
 	defer node1.Stop()
 	defer node2.Stop()
@@ -966,12 +1000,13 @@ func Test_Blockchain_Execute_Contract(t *testing.T) {
 
 	// Node1 publishes the contract
 	err := node1.ProposeContract("c612f289f5324c73d96a20ca14cf834e95a359a2b28101401e1bd7daa3bac4e2",
-		"002e", 3, "2", time.Second*600)
+		"002e", 3, common.QuickAddress(2).String(), time.Second*600)
 	require.NoError(t, err)
 
 	// Node2 executes the contract
 	err = node2.ExecuteContract("banana",
-		"c612f289f5324c73d96a20ca14cf834e95a359a2b28101401e1bd7daa3bac4e2", "002e", "1_1", time.Second*600)
+		"c612f289f5324c73d96a20ca14cf834e95a359a2b28101401e1bd7daa3bac4e2", "002e",
+		common.ContractAddress(common.QuickAddress(1), 1).String(), time.Second*600)
 	require.NoError(t, err)
 
 	// Print the blockchain of each miner
@@ -990,6 +1025,671 @@ func Test_Blockchain_Execute_Contract(t *testing.T) {
 	// Check the balance
 	require.EqualValues(t, node1.GetBalance(), 7)
 	require.EqualValues(t, node2.GetBalance(), 13)
-	contractState, _ := node1.GetChain().GetLastBlock().State.Get("1_1")
+	contractState, _ := node1.GetChain().GetLastBlock().State.Get(common.ContractAddress(common.QuickAddress(1), 1).String())
 	require.EqualValues(t, contractState.Balance, 0)
+
+	// Node2 proves to a third party that it has executed the contract
+	proof, err := node2.ProveContractExecution(common.ContractAddress(common.QuickAddress(1), 1).String())
+	require.NoError(t, err)
+	require.NoError(t, proof.Verify(node2.GetChain().Difficulty.Initial))
+	_, err = node1.ProveContractExecution(common.ContractAddress(common.QuickAddress(1), 1).String())
+	require.Error(t, err)
+
+	// The third party checks that the block is on its chain
+	hasBlock := false
+	for _, b := range node1.GetChain().Blocks {
+		hasBlock = hasBlock || b.BlockHash == proof.BlockHash
+	}
+	require.True(t, hasBlock)
+	txProof, err := node1.GetTransactionProof(hex.EncodeToString(proof.TXHash))
+	require.NoError(t, err)
+	require.Equal(t, proof.BlockHash, txProof.BlockHash)
+}
+
+// Test_Blockchain_Forged_Transactions tests that the miners reject transactions that are not signed by the owner
+// of the sender's account. The attacker is not a member of the network, it forges transactions to drain the
+// account of node1, tampers with the value of a transaction, and sends a transaction of a negative value.
+func Test_Blockchain_Forged_Transactions(t *testing.T) {
+	transp := channelFac()
+
+	worldState := common.QuickWorldState(2, 10)
+
+	newNode := func(account int) z.TestNode {
+		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
+			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
+			z.WithBlockchainBlockTimeout(time.Second*3),
+			z.WithBlockchainDifficulty(16),
+			z.WithBlockchainBlockSize(2),
+			z.WithHeartbeat(time.Second*1),
+			z.WithAntiEntropy(time.Second*1))
+	}
+
+	node1 := newNode(1)
+	node2 := newNode(2)
+
+	defer node1.Stop()
+	defer node2.Stop()
+
+	node1.AddPeer(node2.GetAddr())
+	node2.AddPeer(node1.GetAddr())
+
+	time.Sleep(time.Millisecond * 10)
+
+	err := node1.TransferMoney(common.QuickAddress(2), 3, time.Second*600)
+	require.NoError(t, err)
+
+	time.Sleep(time.Second * 2)
+
+	attacker, err := transp.CreateSocket("127.0.0.1:99")
+	require.NoError(t, err)
+	defer attacker.Close()
+
+	attackerKey, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	require.NoError(t, err)
+
+	send := func(signedTx transaction.SignedTransaction) {
+		for _, node := range []z.TestNode{node1, node2} {
+			transpMsg, err := node.GetRegistry().MarshalMessage(types.TransactionMessage{SignedTX: signedTx})
+			require.NoError(t, err)
+			header := transport.NewHeader(attacker.GetAddress(), attacker.GetAddress(), node.GetAddr(), 0)
+			err = attacker.Send(node.GetAddr(), transport.Packet{Header: &header, Msg: &transpMsg}, 0)
+			require.NoError(t, err)
+		}
+	}
+
+	// A transaction from node1 signed by the attacker
+	rawTx := transaction.NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), 7, 2)
+	forged, err := rawTx.Sign(attackerKey)
+	require.NoError(t, err)
+	send(forged)
+
+	// The same transaction without any signature
+	send(transaction.SignedTransaction{TX: rawTx})
+
+	// A transaction from node2 to node1 whose value is changed after the signature
+	rawTx = transaction.NewTransferTX(common.QuickAddress(2), common.QuickAddress(1), 1, 1)
+	tampered, err := rawTx.Sign(attackerKey)
+	require.NoError(t, err)
+	tampered.TX.Value = 13
+	send(tampered)
+
+	// A transaction of a negative value, signed with the key of node1, which would drain the account of node2
+	rawTx = transaction.NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), -13, 2)
+	negative, err := rawTx.Sign(common.QuickKey(1))
+	require.NoError(t, err)
+	send(negative)
+
+	time.Sleep(time.Second * 5)
+
+	// Only the transaction of node1 has been executed
+	require.EqualValues(t, 7, node1.GetBalance())
+	require.EqualValues(t, 13, node2.GetBalance())
+	require.Equal(t, 1, node1.GetChain().GetTransactionCount())
+	require.Equal(t, 1, node2.GetChain().GetTransactionCount())
+	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node2.GetChain().GetLastBlock().BlockHash)
+}
+
+// Test_Blockchain_Account_Address tests that the account address of a node is derived from its key, whatever its
+// network address is
+func Test_Blockchain_Account_Address(t *testing.T) {
+	transp := channelFac()
+
+	node1 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0", z.WithBlockchainPrivateKey(common.QuickKey(1)))
+	defer node1.Stop()
+	node2 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0")
+	defer node2.Stop()
+
+	require.Equal(t, common.QuickAddress(1).String(), node1.GetAccountAddress())
+
+	address2, err := common.ParseAddress(node2.GetAccountAddress())
+	require.NoError(t, err)
+	require.Len(t, address2.Bytes, common.AddressLength)
+	require.NotEqual(t, node1.GetAccountAddress(), node2.GetAccountAddress())
+
+	// The same key on another network address gives the same account
+	node3 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0", z.WithBlockchainPrivateKey(common.QuickKey(1)))
+	defer node3.Stop()
+	require.NotEqual(t, node1.GetAddr(), node3.GetAddr())
+	require.Equal(t, node1.GetAccountAddress(), node3.GetAccountAddress())
+}
+
+// Test_Blockchain_Squatted_Network_Address tests that an account can not take the network address of another node
+// by declaring it first: the miners only accept the declaration once the node at the address proves that it holds
+// the key of the account
+func Test_Blockchain_Squatted_Network_Address(t *testing.T) {
+	transp := channelFac()
+
+	worldState := common.QuickWorldState(2, 10)
+
+	newNode := func(account int) z.TestNode {
+		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
+			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
+			z.WithBlockchainBlockTimeout(time.Second*3),
+			z.WithBlockchainDifficulty(16),
+			z.WithHeartbeat(time.Second*1),
+			z.WithAntiEntropy(time.Second*1))
+	}
+
+	node1 := newNode(1)
+	node2 := newNode(2)
+
+	defer node1.Stop()
+	defer node2.Stop()
+
+	node1.AddPeer(node2.GetAddr())
+	node2.AddPeer(node1.GetAddr())
+
+	attacker, err := transp.CreateSocket("127.0.0.1:99")
+	require.NoError(t, err)
+	defer attacker.Close()
+
+	// A second key declares the network address of node1 before node1 does
+	rawTx := transaction.NewAccountDeclarationTX(common.QuickAddress(3), 0, node1.GetAddr(), 1)
+	squatting, err := rawTx.Sign(common.QuickKey(3))
+	require.NoError(t, err)
+	for _, node := range []z.TestNode{node1, node2} {
+		transpMsg, err := node.GetRegistry().MarshalMessage(types.TransactionMessage{SignedTX: squatting})
+		require.NoError(t, err)
+		header := transport.NewHeader(attacker.GetAddress(), attacker.GetAddress(), node.GetAddr(), 0)
+		err = attacker.Send(node.GetAddr(), transport.Packet{Header: &header, Msg: &transpMsg}, 0)
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second)
+
+	err = node1.JoinBlockchain(0, time.Second*600)
+	require.NoError(t, err)
+
+	// Node1 refuses the challenges of the squatting declaration, the miners drop it
+	time.Sleep(time.Second * 6)
+
+	for _, node := range []z.TestNode{node1, node2} {
+		receipt, err := node.GetReceipt(squatting.HashCode())
+		require.NoError(t, err)
+		require.Equal(t, block.ReceiptDropped, receipt.Status)
+
+		lastState := &node.GetChain().GetLastBlock().State
+		owner, found := lastState.FindNetworkAddress(node1.GetAddr())
+		require.True(t, found)
+		require.Equal(t, common.QuickAddress(1).String(), owner)
+		_, found = lastState.Get(common.QuickAddress(3).String())
+		require.False(t, found)
+	}
+}
+
+// Test_Blockchain_Nonces tests that the transactions of an account are executed in the order of their nonces: a
+// replayed transaction is not executed twice, and a transaction sent ahead of its predecessor is held until the
+// predecessor arrives. The node then continues the sequence of its account from the chain.
+func Test_Blockchain_Nonces(t *testing.T) {
+	transp := channelFac()
+
+	worldState := common.QuickWorldState(2, 10)
+
+	newNode := func(account int) z.TestNode {
+		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
+			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
+			z.WithBlockchainBlockTimeout(time.Second*3),
+			z.WithBlockchainDifficulty(16),
+			z.WithBlockchainBlockSize(2),
+			z.WithHeartbeat(time.Second*1),
+			z.WithAntiEntropy(time.Second*1))
+	}
+
+	node1 := newNode(1)
+	node2 := newNode(2)
+
+	defer node1.Stop()
+	defer node2.Stop()
+
+	node1.AddPeer(node2.GetAddr())
+	node2.AddPeer(node1.GetAddr())
+
+	time.Sleep(time.Millisecond * 10)
+
+	err := node1.TransferMoney(common.QuickAddress(2), 3, time.Second*600)
+	require.NoError(t, err)
+
+	time.Sleep(time.Second * 2)
+
+	sender, err := transp.CreateSocket("127.0.0.1:99")
+	require.NoError(t, err)
+	defer sender.Close()
+
+	send := func(signedTx transaction.SignedTransaction) {
+		for _, node := range []z.TestNode{node1, node2} {
+			transpMsg, err := node.GetRegistry().MarshalMessage(types.TransactionMessage{SignedTX: signedTx})
+			require.NoError(t, err)
+			header := transport.NewHeader(sender.GetAddress(), sender.GetAddress(), node.GetAddr(), 0)
+			err = sender.Send(node.GetAddr(), transport.Packet{Header: &header, Msg: &transpMsg}, 0)
+			require.NoError(t, err)
+		}
+	}
+
+	// The executed transaction is replayed
+	require.Len(t, node1.GetChain().HashToTxs, 1)
+	for _, executed := range node1.GetChain().HashToTxs {
+		send(*executed)
+	}
+
+	// The transactions of node1 with nonces 2 and 3 arrive in the reverse order
+	sign := func(nonce int) transaction.SignedTransaction {
+		rawTx := transaction.NewTransferTX(common.QuickAddress(1), common.QuickAddress(2), 1, nonce)
+		signedTx, err := rawTx.Sign(common.QuickKey(1))
+		require.NoError(t, err)
+		return signedTx
+	}
+	tx3 := sign(3)
+	send(tx3)
+	time.Sleep(time.Second * 2)
+	require.False(t, node1.GetChain().HasTransactionHash(tx3.HashCode()))
+
+	send(sign(2))
+	time.Sleep(time.Second * 5)
+
+	require.EqualValues(t, 5, node1.GetBalance())
+	require.EqualValues(t, 15, node2.GetBalance())
+	require.Equal(t, 3, node1.GetChain().GetTransactionCount())
+	require.Equal(t, 3, node2.GetChain().GetTransactionCount())
+
+	// node1 continues from the nonce of its account on the chain
+	err = node1.TransferMoney(common.QuickAddress(2), 1, time.Second*600)
+	require.NoError(t, err)
+
+	time.Sleep(time.Second * 2)
+
+	state1, _ := node2.GetChain().GetLastBlock().State.Get(common.QuickAddress(1).String())
+	require.EqualValues(t, 4, state1.Nonce)
+	require.EqualValues(t, 4, node1.GetBalance())
+	require.EqualValues(t, 16, node2.GetBalance())
+	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node2.GetChain().GetLastBlock().BlockHash)
+}
+
+// Test_Blockchain_Restart tests that a restarted node reloads its chain from its storage, and recovers the nonce
+// and the balance of its account
+func Test_Blockchain_Restart(t *testing.T) {
+	transp := channelFac()
+
+	worldState := common.QuickWorldState(2, 10)
+	worldState.Set(common.FaucetAddress.String(), common.State{Balance: common.FaucetAllowance})
+	persistency := inmemory.NewPersistency()
+
+	// The key of the account is generated on the first start, and reloaded from the storage
+	newNode := func() z.TestNode {
+		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			z.WithStorage(persistency),
+			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
+			z.WithBlockchainBlockTimeout(time.Second*3),
+			z.WithBlockchainDifficulty(16))
+	}
+
+	node1 := newNode()
+	address := node1.GetAccountAddress()
+
+	err := node1.JoinBlockchain(common.FaucetAllowance, time.Second*600)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		err = node1.TransferMoney(common.QuickAddress(2), 3, time.Second*600)
+		require.NoError(t, err)
+	}
+	time.Sleep(time.Second * 2)
+
+	require.EqualValues(t, 4, node1.GetBalance())
+	lastBlock := node1.GetChain().GetLastBlock()
+	blockCount := node1.GetChain().GetBlockCount()
+	require.Greater(t, blockCount, 1)
+	node1.Stop()
+
+	// The restarted node starts from the stored chain instead of the genesis block
+	node1 = newNode()
+	defer node1.Stop()
+
+	require.Equal(t, address, node1.GetAccountAddress())
+
+	require.Equal(t, blockCount, node1.GetChain().GetBlockCount())
+	require.Equal(t, lastBlock.BlockHash, node1.GetChain().GetLastBlock().BlockHash)
+	require.True(t, lastBlock.State.Equal(&node1.GetChain().GetLastBlock().State))
+	require.NoError(t, node1.GetChain().ValidateChain())
+	require.EqualValues(t, 4, node1.GetBalance())
+
+	// The next transfer uses the next nonce of the account
+	err = node1.TransferMoney(common.QuickAddress(2), 3, time.Second*600)
+	require.NoError(t, err)
+	time.Sleep(time.Second * 2)
+
+	// The declaration used the first nonce
+	state1, _ := node1.GetChain().GetLastBlock().State.Get(address)
+	require.EqualValues(t, 4, state1.Nonce)
+	require.EqualValues(t, 1, node1.GetBalance())
+	require.Equal(t, blockCount+1, node1.GetChain().GetBlockCount())
+}
+
+// Test_Blockchain_Sync_Gap tests that a node that starts late requests the blocks it misses when it receives a
+// block that does not follow the tip of its chain
+func Test_Blockchain_Sync_Gap(t *testing.T) {
+	transp := channelFac()
+
+	worldState := common.QuickWorldState(2, 10)
+
+	newNode := func(account int) z.TestNode {
+		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
+			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
+			z.WithBlockchainBlockTimeout(time.Second*2),
+			z.WithBlockchainDifficulty(16))
+	}
+
+	node1 := newNode(1)
+	defer node1.Stop()
+
+	for i := 0; i < 3; i++ {
+		err := node1.TransferMoney(common.QuickAddress(2), 1, time.Second*600)
+		require.NoError(t, err)
+	}
+	time.Sleep(time.Second)
+
+	// Node2 starts late, without anti-entropy nor chain tip announcements. Node1 does not know it, so that node2
+	// does not receive the past blocks as rumors.
+	node2 := newNode(2)
+	defer node2.Stop()
+	node2.AddPeer(node1.GetAddr())
+
+	time.Sleep(time.Second * 2)
+	require.Equal(t, 1, node2.GetChain().GetBlockCount())
+
+	// The last block of node1 reaches node2 directly, which reveals the gap
+	sender, err := transp.CreateSocket("127.0.0.1:99")
+	require.NoError(t, err)
+	defer sender.Close()
+
+	blockMsg := types.BlockMessage{TransBlock: *node1.GetChain().GetLastBlock().GetTransBlock()}
+	transpMsg, err := node2.GetRegistry().MarshalMessage(blockMsg)
+	require.NoError(t, err)
+	header := transport.NewHeader(node1.GetAddr(), node1.GetAddr(), node2.GetAddr(), 0)
+	err = sender.Send(node2.GetAddr(), transport.Packet{Header: &header, Msg: &transpMsg}, 0)
+	require.NoError(t, err)
+
+	time.Sleep(time.Second * 3)
+
+	require.Equal(t, node1.GetChain().GetBlockCount(), node2.GetChain().GetBlockCount())
+	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node2.GetChain().GetLastBlock().BlockHash)
+	require.Equal(t, 3, node2.GetChain().GetTransactionCount())
+	require.NoError(t, node2.GetChain().ValidateChain())
+	require.EqualValues(t, 13, node2.GetBalance())
+}
+
+// Test_Blockchain_Sync_Tip tests that a node that starts late catches up from the chain tip announced by its
+// neighbor, even if no new block is mined
+func Test_Blockchain_Sync_Tip(t *testing.T) {
+	transp := channelFac()
+
+	worldState := common.QuickWorldState(2, 10)
+
+	newNode := func(account int) z.TestNode {
+		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
+			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
+			z.WithBlockchainBlockTimeout(time.Second*2),
+			z.WithBlockchainDifficulty(16),
+			z.WithBlockchainSyncInterval(time.Millisecond*500))
+	}
+
+	node1 := newNode(1)
+	defer node1.Stop()
+
+	for i := 0; i < 3; i++ {
+		err := node1.TransferMoney(common.QuickAddress(2), 1, time.Second*600)
+		require.NoError(t, err)
+	}
+	time.Sleep(time.Second)
+
+	node2 := newNode(2)
+	defer node2.Stop()
+	node1.AddPeer(node2.GetAddr())
+	node2.AddPeer(node1.GetAddr())
+
+	time.Sleep(time.Second * 3)
+
+	require.Greater(t, node1.GetChain().GetBlockCount(), 1)
+	require.Equal(t, node1.GetChain().GetBlockCount(), node2.GetChain().GetBlockCount())
+	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node2.GetChain().GetLastBlock().BlockHash)
+	require.NoError(t, node2.GetChain().ValidateChain())
+	require.EqualValues(t, 13, node2.GetBalance())
+
+	// Node2 goes on with the synced chain
+	err := node2.TransferMoney(common.QuickAddress(1), 5, time.Second*600)
+	require.NoError(t, err)
+	time.Sleep(time.Second * 3)
+
+	require.EqualValues(t, 8, node2.GetBalance())
+	require.EqualValues(t, 12, node1.GetBalance())
+	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node2.GetChain().GetLastBlock().BlockHash)
+}
+
+// Test_Blockchain_Rewards tests that the creator of a block is paid the block reward and the fees of its
+// transactions, and that a joining node draws its balance from the faucet
+func Test_Blockchain_Rewards(t *testing.T) {
+	transp := channelFac()
+
+	worldState := common.QuickWorldState(2, 10)
+	worldState.Set(common.FaucetAddress.String(), common.State{Balance: common.FaucetAllowance + 5})
+
+	newNode := func(account int) z.TestNode {
+		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
+			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
+			z.WithBlockchainBlockTimeout(time.Second*2),
+			z.WithBlockchainDifficulty(16),
+			z.WithBlockchainBlockReward(5),
+			z.WithBlockchainTransactionFee(1))
+	}
+
+	node1 := newNode(1)
+	defer node1.Stop()
+
+	// The transfer pays a fee of 1 to the miner, which is node1 itself, on top of the reward
+	err := node1.TransferMoney(common.QuickAddress(2), 3, time.Second*600)
+	require.NoError(t, err)
+	time.Sleep(time.Second)
+
+	require.EqualValues(t, 10-3-1+5+1, node1.GetBalance())
+	lastBlock := node1.GetChain().GetLastBlock()
+	state2, _ := lastBlock.State.Get(common.QuickAddress(2).String())
+	require.EqualValues(t, 13, state2.Balance)
+	require.NotNil(t, lastBlock.GetCoinbase())
+	require.Equal(t, 1, node1.GetChain().GetTransactionCount())
+
+	// The balance cannot cover the transfer and its fee
+	err = node1.TransferMoney(common.QuickAddress(2), node1.GetBalance(), time.Second*600)
+	require.Error(t, err)
+
+	// Node3 joins with the allowance drawn from the faucet
+	node3 := newNode(3)
+	defer node3.Stop()
+	node1.AddPeer(node3.GetAddr())
+	node3.AddPeer(node1.GetAddr())
+
+	err = node3.JoinBlockchain(common.FaucetAllowance, time.Second*600)
+	require.NoError(t, err)
+	time.Sleep(time.Second)
+
+	// Node3 may have mined the block of its declaration
+	expected3 := common.FaucetAllowance
+	for _, b := range node3.GetChain().GetBlockRange(1, node3.GetChain().GetLastBlock().ID) {
+		if b.Creator.String() == node3.GetAccountAddress() {
+			expected3 += b.GetCoinbase().TX.Value
+		}
+	}
+	require.EqualValues(t, expected3, node3.GetBalance())
+	faucet, _ := node3.GetChain().GetLastBlock().State.Get(common.FaucetAddress.String())
+	require.EqualValues(t, 5, faucet.Balance)
+
+	// The money supply only grows by the rewards, fees are moved from the senders to the miners
+	supply := int64(0)
+	for _, key := range node3.GetChain().GetLastBlock().State.Keys() {
+		state, _ := node3.GetChain().GetLastBlock().State.Get(key)
+		supply += state.Balance
+	}
+	blockCount := node3.GetChain().GetBlockCount()
+	require.EqualValues(t, 10+10+common.FaucetAllowance+5+5*int64(blockCount-1), supply)
+
+	require.NoError(t, node1.GetChain().ValidateChain())
+	require.NoError(t, node3.GetChain().ValidateChain())
+	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node3.GetChain().GetLastBlock().BlockHash)
+}
+
+// Test_Blockchain_Replace_Stuck_Transaction tests that a transaction that is stuck in the mempool is replaced by
+// the next transaction of the node, which reuses its nonce with a higher fee
+func Test_Blockchain_Replace_Stuck_Transaction(t *testing.T) {
+	transp := channelFac()
+
+	worldState := common.QuickWorldState(2, 10)
+
+	node1 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+		z.WithBlockchainPrivateKey(common.QuickKey(1)),
+		z.WithBlockchainInitialState(worldState.GetSimpleMap()),
+		z.WithBlockchainBlockTimeout(time.Second*2),
+		z.WithBlockchainDifficulty(16))
+	defer node1.Stop()
+
+	// The destination account does not exist, the transaction stays invalid in the mempool
+	err := node1.TransferMoney(common.QuickAddress(5), 3, time.Second*3)
+	require.Error(t, err)
+
+	// The nonce is given back and reused with a higher fee, which is paid to the miner
+	err = node1.TransferMoney(common.QuickAddress(2), 3, time.Second*600)
+	require.NoError(t, err)
+	time.Sleep(time.Second)
+
+	require.Equal(t, 1, node1.GetChain().GetTransactionCount())
+	state1, _ := node1.GetChain().GetLastBlock().State.Get(common.QuickAddress(1).String())
+	require.Equal(t, 1, state1.Nonce)
+	require.EqualValues(t, 10-3-1+1, state1.Balance)
+	state2, _ := node1.GetChain().GetLastBlock().State.Get(common.QuickAddress(2).String())
+	require.EqualValues(t, 13, state2.Balance)
+	require.NoError(t, node1.GetChain().ValidateChain())
+}
+
+// Test_Blockchain_Receipts tests that the receipt of an included transaction holds its block and the balance
+// changes it caused, and that a transaction dropped after failing for longer than the TTL is reported before the
+// timeout
+func Test_Blockchain_Receipts(t *testing.T) {
+	transp := channelFac()
+
+	worldState := common.QuickWorldState(2, 10)
+	addr1 := common.QuickAddress(1).String()
+	addr2 := common.QuickAddress(2).String()
+
+	node1 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+		z.WithBlockchainPrivateKey(common.QuickKey(1)),
+		z.WithBlockchainInitialState(worldState.GetSimpleMap()),
+		z.WithBlockchainBlockTimeout(time.Second),
+		z.WithBlockchainTransactionFee(1),
+		z.WithBlockchainInvalidTxTTL(time.Second),
+		z.WithBlockchainDifficulty(16))
+	defer node1.Stop()
+
+	receipts, unsubscribe := node1.SubscribeReceipts()
+	defer unsubscribe()
+
+	// An included transaction
+	err := node1.TransferMoney(common.QuickAddress(2), 3, time.Second*600)
+	require.NoError(t, err)
+
+	txHash, ok := node1.GetChain().FindTransaction(func(tx *transaction.SignedTransaction) bool {
+		return tx.TX.Dst.String() == addr2
+	})
+	require.True(t, ok)
+	receipt, err := node1.GetReceipt(txHash)
+	require.NoError(t, err)
+	require.Equal(t, block.ReceiptIncluded, receipt.Status)
+	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, receipt.BlockHash)
+	require.Equal(t, map[string]int64{addr1: -4, addr2: 3}, receipt.BalanceChanges)
+
+	delivered := <-receipts
+	require.Equal(t, receipt, delivered)
+
+	// The destination account does not exist, the transaction fails until it is dropped
+	start := time.Now()
+	err = node1.TransferMoney(common.QuickAddress(5), 3, time.Second*600)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "dropped")
+	require.Less(t, time.Since(start), time.Second*30)
+
+	statuses := make([]int, 0)
+	for len(receipts) > 0 {
+		delivered = <-receipts
+		statuses = append(statuses, delivered.Status)
+	}
+	require.Equal(t, []int{block.ReceiptInvalid, block.ReceiptDropped}, statuses)
+	receipt, err = node1.GetReceipt(delivered.TXHash)
+	require.NoError(t, err)
+	require.Equal(t, block.ReceiptDropped, receipt.Status)
+	require.Empty(t, receipt.BalanceChanges)
+
+	_, err = node1.GetReceipt("unknown")
+	require.Error(t, err)
+
+	// The nonce of the dropped transaction is reused
+	err = node1.TransferMoney(common.QuickAddress(2), 1, time.Second*600)
+	require.NoError(t, err)
+	require.Equal(t, 2, node1.GetChain().GetTransactionCount())
+}
+
+// Test_Blockchain_Difficulty_Retarget tests that the difficulty is raised when the blocks are mined faster than the
+// target block time, and that a node syncing the chain validates the retargeted difficulties
+func Test_Blockchain_Difficulty_Retarget(t *testing.T) {
+	transp := channelFac()
+
+	worldState := common.QuickWorldState(2, 10)
+
+	newNode := func(account int) z.TestNode {
+		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			z.WithBlockchainPrivateKey(common.QuickKey(account)),
+			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
+			z.WithBlockchainBlockTimeout(time.Millisecond*100),
+			z.WithBlockchainDifficulty(4),
+			z.WithBlockchainRetarget(2, time.Second*10),
+			z.WithBlockchainSyncInterval(time.Millisecond*500))
+	}
+
+	node1 := newNode(1)
+	defer node1.Stop()
+
+	// Each transfer is mined in its own block, much faster than every 10 seconds
+	for i := 0; i < 6; i++ {
+		err := node1.TransferMoney(common.QuickAddress(2), 1, time.Second*600)
+		require.NoError(t, err)
+	}
+
+	// The difficulty is retargeted after every two blocks from the time between them, it is raised since the
+	// blocks are mined faster
+	blocks := node1.GetChain().GetBlockRange(1, 6)
+	require.Len(t, blocks, 6)
+	require.Equal(t, block.DifficultyOfBits(4), blocks[0].Difficulty)
+	for i := 1; i < len(blocks); i++ {
+		expected := blocks[i-1].Difficulty
+		if i%2 == 0 {
+			span := time.Duration(blocks[i-1].Timestamp-blocks[i-2].Timestamp) * time.Microsecond
+			expected = block.Retarget(blocks[i-1].Difficulty, span, time.Second*10)
+		}
+		require.Equal(t, expected, blocks[i].Difficulty, "block %d", blocks[i].ID)
+	}
+	require.Greater(t, blocks[5].Difficulty, blocks[0].Difficulty)
+	nextDifficulty := node1.GetChain().NextDifficulty()
+	require.Greater(t, nextDifficulty, blocks[5].Difficulty)
+
+	node2 := newNode(2)
+	defer node2.Stop()
+	node1.AddPeer(node2.GetAddr())
+	node2.AddPeer(node1.GetAddr())
+
+	time.Sleep(time.Second * 3)
+
+	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node2.GetChain().GetLastBlock().BlockHash)
+	require.NoError(t, node2.GetChain().ValidateChain())
+	require.Equal(t, nextDifficulty, node2.GetChain().NextDifficulty())
+	require.EqualValues(t, 16, node2.GetBalance())
 }
@@ -1,9 +1,17 @@
 package project
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/require"
 	z "go.dedis.ch/cs438/internal/testing"
+	"go.dedis.ch/cs438/peer"
+	"go.dedis.ch/cs438/storage"
+	"go.dedis.ch/cs438/storage/inmemory"
+	"go.dedis.ch/cs438/transport"
+	"go.dedis.ch/cs438/transport/udp"
+	"go.dedis.ch/cs438/types"
 	"math"
 	"math/rand"
 	"sort"
@@ -585,6 +593,169 @@ func Test_Chord_Leave_Multiple_Node(t *testing.T) {
 	}
 }
 
+// Test_Chord_Leave_Concurrent tests that adjacent nodes can leave at the same time. Right after the leaves, the
+// neighbours of the leaving nodes should point to each other without waiting for the stabilization, and a
+// lookup sent to a node that has just left should still be answered.
+func Test_Chord_Leave_Concurrent(t *testing.T) {
+	numNodes := 8
+	numLeaves := 3
+	transp := channelFac()
+
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		node := z.NewTestNode(t, peerFac, transp, fmt.Sprintf("127.0.0.1:%d", i+1), z.WithChordBytes(1),
+			z.WithChordStabilizeInterval(time.Millisecond*500), z.WithChordFixFingerInterval(time.Millisecond*500),
+			z.WithChordPingInterval(time.Second*30))
+		defer node.Stop()
+		nodes[i] = node
+	}
+
+	for _, n1 := range nodes {
+		for _, n2 := range nodes {
+			n1.AddPeer(n2.GetAddr())
+		}
+	}
+
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinChord(nodes[i-1].GetAddr())
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second * 10)
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].GetChordID() < nodes[j].GetChordID()
+	})
+	for i := 0; i < numNodes; i++ {
+		require.Equal(t, uint(numNodes), nodes[i].RingLen())
+	}
+
+	// Adjacent nodes leave concurrently, they lie between the predecessor and the successor below
+	predecessor, successor := nodes[2], nodes[2+numLeaves+1]
+	leaving := nodes[3 : 3+numLeaves]
+
+	errs := make(chan error, numLeaves)
+	for _, node := range leaving {
+		go func(node z.TestNode) {
+			errs <- node.LeaveChord()
+		}(node)
+	}
+	for range leaving {
+		require.NoError(t, <-errs)
+	}
+
+	require.Equal(t, successor.GetAddr(), predecessor.GetSuccessor())
+	require.Equal(t, predecessor.GetAddr(), successor.GetPredecessor())
+
+	// A lookup still in flight towards a node that has left is forwarded to the node owning its range
+	socket, err := transp.CreateSocket("127.0.0.1:99")
+	require.NoError(t, err)
+	defer socket.Close()
+
+	left := leaving[1]
+	chordQueryMsg := types.ChordQuerySuccessorMessage{
+		RequestID: "in-flight",
+		Source:    socket.GetAddress(),
+		Key:       left.GetChordID(),
+		Target:    left.GetAddr(),
+	}
+	transpMsg, err := left.GetRegistry().MarshalMessage(chordQueryMsg)
+	require.NoError(t, err)
+	header := transport.NewHeader(socket.GetAddress(), socket.GetAddress(), left.GetAddr(), 0)
+	err = socket.Send(left.GetAddr(), transport.Packet{Header: &header, Msg: &transpMsg}, 0)
+	require.NoError(t, err)
+
+	pkt, err := socket.Recv(time.Second * 5)
+	require.NoError(t, err)
+	var chordReplyMsg types.ChordReplySuccessorMessage
+	err = json.Unmarshal(pkt.Msg.Payload, &chordReplyMsg)
+	require.NoError(t, err)
+	require.Equal(t, "in-flight", chordReplyMsg.ReplyPacketID)
+	require.Equal(t, successor.GetAddr(), chordReplyMsg.Successor)
+
+	time.Sleep(time.Second * 5)
+
+	remaining := append(append([]z.TestNode{}, nodes[:3]...), nodes[3+numLeaves:]...)
+	for _, node := range remaining {
+		require.Equal(t, uint(len(remaining)), node.RingLen())
+	}
+	snapshot, err := remaining[0].RingSnapshot()
+	require.NoError(t, err)
+	require.Len(t, snapshot.Nodes, len(remaining))
+	require.True(t, snapshot.Consistent(), snapshot.Inconsistencies)
+}
+
+// Test_Chord_Leave_Rejoin tests that a node that left its ring can join another ring without restarting, its
+// daemons are restarted, so that both rings converge after the move.
+func Test_Chord_Leave_Rejoin(t *testing.T) {
+	transp := channelFac()
+
+	nodes := make([]z.TestNode, 5)
+	for i := range nodes {
+		node := z.NewTestNode(t, peerFac, transp, fmt.Sprintf("127.0.0.1:%d", i+1), z.WithChordBytes(1),
+			z.WithChordStabilizeInterval(time.Millisecond*200), z.WithChordFixFingerInterval(time.Millisecond*200))
+		defer node.Stop()
+		nodes[i] = node
+	}
+
+	for _, n1 := range nodes {
+		for _, n2 := range nodes {
+			n1.AddPeer(n2.GetAddr())
+		}
+	}
+
+	// The first ring is made of nodes 1, 2 and 3, the second ring of nodes 4 and 5
+	ring1, ring2 := nodes[:3], nodes[3:]
+	for _, ring := range [][]z.TestNode{ring1, ring2} {
+		for i := 1; i < len(ring); i++ {
+			err := ring[i].JoinChord(ring[i-1].GetAddr())
+			require.NoError(t, err)
+		}
+	}
+
+	time.Sleep(time.Second * 5)
+
+	require.Equal(t, uint(3), ring1[0].RingLen())
+	require.Equal(t, uint(2), ring2[0].RingLen())
+	for _, node := range nodes {
+		require.Equal(t, peer.ChordMember, node.GetChordState())
+	}
+
+	// A member of a ring cannot join another ring before leaving its own
+	mover := ring1[2]
+	err := mover.JoinChord(ring2[0].GetAddr())
+	require.Error(t, err)
+
+	err = mover.LeaveChord()
+	require.NoError(t, err)
+	require.Equal(t, peer.ChordIdle, mover.GetChordState())
+
+	// An idle node has nothing to leave
+	err = mover.LeaveChord()
+	require.Error(t, err)
+
+	err = mover.JoinChord(ring2[0].GetAddr())
+	require.NoError(t, err)
+	require.Equal(t, peer.ChordMember, mover.GetChordState())
+
+	time.Sleep(time.Second * 5)
+
+	for _, ring := range [][]z.TestNode{ring1[:2], append(ring2, mover)} {
+		for _, node := range ring {
+			require.Equal(t, uint(len(ring)), node.RingLen())
+		}
+		snapshot, err := ring[0].RingSnapshot()
+		require.NoError(t, err)
+		require.Len(t, snapshot.Nodes, len(ring))
+		require.True(t, snapshot.Consistent(), snapshot.Inconsistencies)
+	}
+
+	// The fingers of the moved node are fixed again by its restarted daemon
+	for _, finger := range mover.GetFingerTable() {
+		require.NotEqual(t, "", finger)
+	}
+}
+
 // Test_Chord_Stress tests the Chord functions under stressful environment
 func Test_Chord_Stress(t *testing.T) {
 	numNodes := 32
@@ -642,3 +813,665 @@ func Test_Chord_Stress(t *testing.T) {
 		}
 	}
 }
+
+// Test_Chord_Virtual_Nodes tests a Chord ring formed by peers hosting several virtual nodes. Every virtual node
+// is a member of the ring, and the password cracker of a peer is responsible for the union of the ranges of
+// its virtual nodes
+func Test_Chord_Virtual_Nodes(t *testing.T) {
+	numNodes := 3
+	numVirtualNodes := 3
+	chordBytes := 1
+	transp := channelFac()
+
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		node := z.NewTestNode(t, peerFac, transp, fmt.Sprintf("127.0.0.1:%d", i+1), z.WithChordBytes(chordBytes),
+			z.WithChordVirtualNodes(numVirtualNodes),
+			z.WithChordStabilizeInterval(time.Millisecond*200), z.WithChordFixFingerInterval(time.Millisecond*200))
+		defer node.Stop()
+		nodes[i] = node
+	}
+
+	for _, n1 := range nodes {
+		for _, n2 := range nodes {
+			n1.AddPeer(n2.GetAddr())
+		}
+	}
+
+	// A single peer already forms a ring with its virtual nodes
+	require.Len(t, nodes[0].GetVirtualNodes(), numVirtualNodes)
+	require.Equal(t, nodes[0].GetAddr(), nodes[0].GetVirtualNodes()[0])
+	require.Equal(t, uint(numVirtualNodes), nodes[0].RingLen())
+
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinChord(nodes[i-1].GetAddr())
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second * 10)
+
+	// Every virtual node is a member of the ring
+	for i := 0; i < numNodes; i++ {
+		require.Equal(t, uint(numNodes*numVirtualNodes), nodes[i].RingLen())
+	}
+
+	// The ring should be ordered by the chordID of the virtual nodes
+	type vnode struct {
+		address string
+		chordID uint
+	}
+	vnodes := make([]vnode, 0, numNodes*numVirtualNodes)
+	for _, node := range nodes {
+		for _, address := range node.GetVirtualNodes() {
+			vnodes = append(vnodes, vnode{address: address, chordID: node.QueryChordID(address)})
+		}
+	}
+	sort.Slice(vnodes, func(i, j int) bool {
+		return vnodes[i].chordID < vnodes[j].chordID
+	})
+	for i := 0; i < len(vnodes)-1; i++ {
+		// IDs are distinct for the addresses used in this test
+		require.NotEqual(t, vnodes[i].chordID, vnodes[i+1].chordID)
+	}
+	for i, node := range vnodes {
+		if node.address == nodes[0].GetAddr() {
+			require.Equal(t, vnodes[(i-1+len(vnodes))%len(vnodes)].address, nodes[0].GetPredecessor())
+			require.Equal(t, vnodes[(i+1)%len(vnodes)].address, nodes[0].GetSuccessor())
+		}
+	}
+
+	// Every salt is stored by exactly one peer
+	totEntries := 0
+	for _, node := range nodes {
+		totEntries += node.GetStorage().GetDictionaryStore().Len()
+	}
+	require.Equal(t, int(math.Pow(2, float64(chordBytes)*8)), totEntries)
+
+	// The request reaches the peer hosting the virtual node responsible for the salt
+	hashStr := "1cfcd196cf51b7a1d44159875452ba2dca8898d675f3d33d610ab9cb0031d7b2"
+	saltStr := "3c"
+	err := nodes[0].PasswordSubmitRequest(hashStr, saltStr, 0, 0)
+	require.NoError(t, err)
+	time.Sleep(time.Second)
+	require.Equal(t, "apple", nodes[0].PasswordReceiveResult(hashStr, saltStr))
+}
+
+// Test_Chord_Ring_Snapshot tests the ring snapshot, it should list all nodes of a stabilized ring along the
+// successors, without any inconsistency, and it should be exportable as JSON and graphviz
+func Test_Chord_Ring_Snapshot(t *testing.T) {
+	numNodes := 5
+	transp := channelFac()
+
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		node := z.NewTestNode(t, peerFac, transp, fmt.Sprintf("127.0.0.1:%d", i+1), z.WithChordBytes(1),
+			z.WithChordStabilizeInterval(time.Millisecond*200), z.WithChordFixFingerInterval(time.Millisecond*200))
+		defer node.Stop()
+		nodes[i] = node
+	}
+
+	for _, n1 := range nodes {
+		for _, n2 := range nodes {
+			n1.AddPeer(n2.GetAddr())
+		}
+	}
+
+	// A single node owns the whole ring
+	snapshot, err := nodes[0].RingSnapshot()
+	require.NoError(t, err)
+	require.Len(t, snapshot.Nodes, 1)
+	require.True(t, snapshot.Consistent())
+
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinChord(nodes[0].GetAddr())
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second * 5)
+
+	snapshot, err = nodes[2].RingSnapshot()
+	require.NoError(t, err)
+	require.Len(t, snapshot.Nodes, numNodes)
+	require.True(t, snapshot.Consistent(), snapshot.Inconsistencies)
+
+	// The walk starts from the node taking the snapshot and follows the successors
+	require.Equal(t, nodes[2].GetAddr(), snapshot.Nodes[0].Address)
+	for i, info := range snapshot.Nodes {
+		require.Equal(t, snapshot.Nodes[(i+1)%numNodes].Address, info.Successor)
+		require.Equal(t, snapshot.Nodes[(i-1+numNodes)%numNodes].ChordID, info.RangeStart)
+		require.Equal(t, info.ChordID, info.RangeEnd)
+	}
+
+	// Export as JSON and graphviz
+	data, err := snapshot.JSON()
+	require.NoError(t, err)
+	var decoded struct {
+		Nodes []struct{ Address string }
+	}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Len(t, decoded.Nodes, numNodes)
+
+	out := new(bytes.Buffer)
+	snapshot.DisplayGraph(out)
+	for _, node := range nodes {
+		require.Contains(t, out.String(), fmt.Sprintf("\"%s\" -> ", node.GetAddr()))
+	}
+}
+
+// Test_Chord_Query_Range tests that a range query returns the owners of all keys of the range, in the order
+// of the ring, including ranges crossing the boundary of the ring
+func Test_Chord_Query_Range(t *testing.T) {
+	numNodes := 5
+	transp := channelFac()
+
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		node := z.NewTestNode(t, peerFac, transp, fmt.Sprintf("127.0.0.1:%d", i+1), z.WithChordBytes(1),
+			z.WithChordStabilizeInterval(time.Millisecond*200), z.WithChordFixFingerInterval(time.Millisecond*200))
+		defer node.Stop()
+		nodes[i] = node
+	}
+
+	for _, n1 := range nodes {
+		for _, n2 := range nodes {
+			n1.AddPeer(n2.GetAddr())
+		}
+	}
+
+	// A single node owns the whole range
+	ranges, err := nodes[0].QueryRange(200, 10)
+	require.NoError(t, err)
+	require.Equal(t, []types.ChordRange{{Node: nodes[0].GetAddr(), Start: 200, End: 10}}, ranges)
+
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinChord(nodes[0].GetAddr())
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second * 5)
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].GetChordID() < nodes[j].GetChordID()
+	})
+	owner := func(key uint) string {
+		for _, node := range nodes {
+			if key <= node.GetChordID() {
+				return node.GetAddr()
+			}
+		}
+		return nodes[0].GetAddr()
+	}
+
+	queries := [][2]uint{{10, 100}, {200, 20}, {0, 255}, {42, 42}, {nodes[1].GetChordID(), nodes[3].GetChordID()},
+		{nodes[4].GetChordID() + 1, nodes[0].GetChordID()}}
+	for _, query := range queries {
+		ranges, err := nodes[2].QueryRange(query[0], query[1])
+		require.NoError(t, err)
+		require.NotEmpty(t, ranges)
+
+		// The subranges are contiguous, they cover the range from its start to its end
+		require.Equal(t, query[0], ranges[0].Start)
+		require.Equal(t, query[1], ranges[len(ranges)-1].End)
+		for i := 1; i < len(ranges); i++ {
+			require.Equal(t, (ranges[i-1].End+1)%256, ranges[i].Start)
+		}
+
+		// Every key of a subrange is owned by the node of the subrange
+		for _, r := range ranges {
+			for key := r.Start; ; key = (key + 1) % 256 {
+				require.Equal(t, owner(key), r.Node, "key %d of %v", key, query)
+				if key == r.End {
+					break
+				}
+			}
+		}
+	}
+
+	// The keys outside the ring are rejected
+	_, err = nodes[0].QueryRange(0, 256)
+	require.Error(t, err)
+}
+
+// Test_Chord_Proximity_Fingers tests that a chord node routes through the closest candidate of each finger
+// interval. The links from the first node to half of the other nodes are slowed down, every finger interval
+// that contains a fast node should use one of them.
+func Test_Chord_Proximity_Fingers(t *testing.T) {
+	numNodes := 8
+	chordBytes := 1
+	transp := udpFac().(*udp.UDP)
+
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		node := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0", z.WithChordBytes(chordBytes),
+			z.WithChordFingerCandidates(numNodes), z.WithChordPingInterval(time.Second*2),
+			z.WithChordStabilizeInterval(time.Millisecond*200), z.WithChordFixFingerInterval(time.Millisecond*200))
+		defer node.Stop()
+		nodes[i] = node
+	}
+
+	seen := make(map[uint]struct{})
+	for _, node := range nodes {
+		if _, ok := seen[node.GetChordID()]; ok {
+			// Unlikely to happen, but if it happens, there is no correctness guarantee
+			return
+		}
+		seen[node.GetChordID()] = struct{}{}
+	}
+
+	for _, n1 := range nodes {
+		for _, n2 := range nodes {
+			n1.AddPeer(n2.GetAddr())
+		}
+	}
+
+	// The odd nodes are far away from the first node
+	fast := make(map[string]bool)
+	for i := 1; i < numNodes; i++ {
+		if i%2 == 1 {
+			transp.SetLinkDelay(nodes[0].GetAddr(), nodes[i].GetAddr(), time.Millisecond*200)
+		} else {
+			fast[nodes[i].GetAddr()] = true
+		}
+	}
+
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinChord(nodes[i-1].GetAddr())
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second * 15)
+
+	// Proximity does not break the lookups
+	require.Equal(t, uint(numNodes), nodes[0].RingLen())
+
+	upperBound := uint(math.Pow(2, float64(chordBytes*8)))
+	chordID := nodes[0].GetChordID()
+	fingers := nodes[0].GetFingerTable()
+	for i := 1; i < len(fingers); i++ {
+		start := (chordID + uint(math.Pow(2, float64(i)))) % upperBound
+		size := uint(math.Pow(2, float64(i)))
+
+		hasFast := false
+		for _, node := range nodes[1:] {
+			if fast[node.GetAddr()] && (node.GetChordID()+upperBound-start)%upperBound < size {
+				hasFast = true
+			}
+		}
+		if hasFast {
+			require.True(t, fast[fingers[i]], "finger %d is %s", i, fingers[i])
+		}
+	}
+}
+
+// Test_Chord_Authentication tests a Chord ring with authenticated membership. The ring should be formed as usual,
+// forged notify and skip successor messages should not change any routing pointer, and a routed message should
+// only be processed if it is signed by its source.
+func Test_Chord_Authentication(t *testing.T) {
+	numNodes := 4
+	transp := channelFac()
+
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		node := z.NewTestNode(t, peerFac, transp, fmt.Sprintf("127.0.0.1:%d", i+1), z.WithChordBytes(1),
+			z.WithChordAuthentication(true),
+			z.WithChordStabilizeInterval(time.Millisecond*200), z.WithChordFixFingerInterval(time.Millisecond*200))
+		defer node.Stop()
+		nodes[i] = node
+	}
+
+	for _, n1 := range nodes {
+		for _, n2 := range nodes {
+			n1.AddPeer(n2.GetAddr())
+		}
+	}
+
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinChord(nodes[i-1].GetAddr())
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second * 5)
+
+	snapshot, err := nodes[0].RingSnapshot()
+	require.NoError(t, err)
+	if len(snapshot.Nodes) != numNodes {
+		// The IDs are derived from random keys, two nodes may collide, there is no correctness guarantee
+		return
+	}
+	require.True(t, snapshot.Consistent(), snapshot.Inconsistencies)
+
+	// The IDs of the other nodes are the ones derived from their keys
+	for _, n1 := range nodes {
+		for _, n2 := range nodes {
+			if n1.GetPredecessor() == n2.GetAddr() {
+				require.Equal(t, n2.GetChordID(), n1.QueryChordID(n2.GetAddr()))
+			}
+		}
+	}
+
+	// The attacker is not a member of the ring, it forges messages to become the predecessor of every node,
+	// and to replace their successors
+	attacker, err := transp.CreateSocket("127.0.0.1:99")
+	require.NoError(t, err)
+	defer attacker.Close()
+
+	send := func(dest string, msg types.Message) {
+		transpMsg, err := nodes[0].GetRegistry().MarshalMessage(msg)
+		require.NoError(t, err)
+		header := transport.NewHeader(attacker.GetAddress(), attacker.GetAddress(), dest, 0)
+		err = attacker.Send(dest, transport.Packet{Header: &header, Msg: &transpMsg}, 0)
+		require.NoError(t, err)
+	}
+
+	chatMessage := func(text string) transport.Message {
+		data, err := json.Marshal(&types.ChatMessage{Message: text})
+		require.NoError(t, err)
+		return transport.Message{Type: types.ChatMessage{}.Name(), Payload: data}
+	}
+	forgedChat := chatMessage("forged")
+	signedChat := chatMessage("signed")
+
+	for _, node := range nodes {
+		// A notify without any credential
+		send(node.GetAddr(), types.ChordNotifyMessage{
+			Source: attacker.GetAddress(),
+			Target: node.GetAddr(),
+		})
+		// A skip successor pretending to come from the successor of the node, without its signature
+		send(node.GetAddr(), types.ChordSkipSuccessorMessage{
+			Successor: attacker.GetAddress(),
+			Source:    node.GetSuccessor(),
+			Target:    node.GetAddr(),
+		})
+		// A chat message routed to the node, pretending to come from its predecessor, without its signature
+		send(node.GetAddr(), types.ChordRouteMessage{
+			Source:     node.GetPredecessor(),
+			Key:        node.GetChordID(),
+			Target:     node.GetAddr(),
+			Final:      true,
+			Msg:        &forgedChat,
+			Credential: types.ChordCredential{Address: node.GetPredecessor()},
+		})
+	}
+
+	// A chat message routed by a member is signed by it
+	err = nodes[0].RouteToKey(nodes[2].GetChordID(), signedChat)
+	require.NoError(t, err)
+
+	time.Sleep(time.Second * 2)
+
+	for _, node := range nodes {
+		require.NotEqual(t, attacker.GetAddress(), node.GetPredecessor())
+		require.NotEqual(t, attacker.GetAddress(), node.GetSuccessor())
+		for _, msg := range node.GetChatMsgs() {
+			require.NotEqual(t, "forged", msg.Message)
+		}
+	}
+	chatMsgs := nodes[2].GetChatMsgs()
+	require.NotEmpty(t, chatMsgs)
+	require.Equal(t, "signed", chatMsgs[len(chatMsgs)-1].Message)
+
+	// The attacker is not a verified member, it can not be reached through the ring
+	err = nodes[0].Unicast(attacker.GetAddress(), signedChat)
+	require.Error(t, err)
+	snapshot, err = nodes[0].RingSnapshot()
+	require.NoError(t, err)
+	require.Len(t, snapshot.Nodes, numNodes)
+	require.True(t, snapshot.Consistent(), snapshot.Inconsistencies)
+}
+
+// Test_Chord_Route_To_Key tests that the nodes of a ring reach each other without any routing entry. A message
+// routed to a key is processed by the owner of the key, and a unicast message to a member without any route is
+// routed through the ring to the member.
+func Test_Chord_Route_To_Key(t *testing.T) {
+	numNodes := 8
+	chordBytes := 2
+	transp := channelFac()
+
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		node := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0", z.WithChordBytes(chordBytes),
+			z.WithChordStabilizeInterval(time.Millisecond*200), z.WithChordFixFingerInterval(time.Millisecond*100))
+		defer node.Stop()
+		nodes[i] = node
+	}
+
+	seen := make(map[uint]struct{})
+	for _, node := range nodes {
+		if _, ok := seen[node.GetChordID()]; ok {
+			// Unlikely to happen, but if it happens, there is no correctness guarantee
+			return
+		}
+		seen[node.GetChordID()] = struct{}{}
+	}
+
+	// No routing entry is added between the nodes, they only know each other through the ring
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinChord(nodes[0].GetAddr())
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second * 5)
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].GetChordID() < nodes[j].GetChordID()
+	})
+	owner := func(key uint) string {
+		for _, node := range nodes {
+			if key <= node.GetChordID() {
+				return node.GetAddr()
+			}
+		}
+		return nodes[0].GetAddr()
+	}
+
+	upperBound := uint(math.Pow(2, float64(chordBytes*8)))
+	keys := []uint{0, upperBound - 1, nodes[3].GetChordID(), nodes[5].GetChordID() + 1}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, uint(rand.Intn(int(upperBound))))
+	}
+
+	for i, key := range keys {
+		chat := types.ChatMessage{Message: fmt.Sprintf("key %d", key)}
+		data, err := json.Marshal(&chat)
+		require.NoError(t, err)
+
+		sender := nodes[i%numNodes]
+		err = sender.RouteToKey(key, transport.Message{Type: chat.Name(), Payload: data})
+		require.NoError(t, err)
+
+		time.Sleep(time.Millisecond * 500)
+
+		// > Only the owner of the key has processed the message
+		for _, node := range nodes {
+			processed := false
+			for _, msg := range node.GetChatMsgs() {
+				if msg.Message == chat.Message {
+					processed = true
+				}
+			}
+			require.Equal(t, node.GetAddr() == owner(key), processed, "key %d on %s", key, node.GetAddr())
+		}
+	}
+
+	// The keys outside the ring are rejected
+	err := nodes[0].RouteToKey(upperBound, transport.Message{})
+	require.Error(t, err)
+
+	// > Unicast reaches a member without any route to it
+	src, dest := nodes[1], nodes[6]
+	require.NotContains(t, src.GetRoutingTable(), dest.GetAddr())
+
+	chat := types.ChatMessage{Message: "unicast through the ring"}
+	data, err := json.Marshal(&chat)
+	require.NoError(t, err)
+	err = src.Unicast(dest.GetAddr(), transport.Message{Type: chat.Name(), Payload: data})
+	require.NoError(t, err)
+
+	time.Sleep(time.Millisecond * 500)
+
+	chatMsgs := dest.GetChatMsgs()
+	require.NotEmpty(t, chatMsgs)
+	require.Equal(t, chat.Message, chatMsgs[len(chatMsgs)-1].Message)
+
+	// > Unicast fails for a peer that is not a member, rather than routing it to the owner of its chordID
+	err = src.Unicast("127.0.0.1:99", transport.Message{Type: chat.Name(), Payload: data})
+	require.Error(t, err)
+}
+
+// Test_Chord_Rejoin_After_Restart tests that a peer restarted with the storage of a previous run rejoins its
+// ring by itself, through the contacts it persisted, and keeps the dictionaries of the salts it still owns. A
+// peer that has left its ring does not rejoin it after a restart.
+func Test_Chord_Rejoin_After_Restart(t *testing.T) {
+	numNodes := 4
+	transp := channelFac()
+
+	opts := []z.Option{z.WithChordBytes(1), z.WithChordStabilizeInterval(time.Millisecond * 200),
+		z.WithChordFixFingerInterval(time.Millisecond * 100)}
+
+	storages := make([]storage.Storage, numNodes)
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		storages[i] = inmemory.NewPersistency()
+		nodes[i] = z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			append(opts, z.WithStorage(storages[i]))...)
+	}
+
+	seen := make(map[uint]struct{})
+	for _, node := range nodes {
+		if _, ok := seen[node.GetChordID()]; ok {
+			// Unlikely to happen, but if it happens, there is no correctness guarantee
+			return
+		}
+		seen[node.GetChordID()] = struct{}{}
+	}
+
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinChord(nodes[0].GetAddr())
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second * 3)
+
+	// Mark the dictionaries of the peer we restart, the ones it still owns after the restart are kept
+	dictionaries := storages[1].GetDictionaryStore()
+	require.NotZero(t, dictionaries.Len())
+	marked := make(map[string]struct{})
+	dictionaries.ForEach(func(key string, val []byte) bool {
+		marked[key] = struct{}{}
+		return true
+	})
+	for key := range marked {
+		dictionaries.Set(key, []byte("{}"))
+	}
+
+	// > The restarted peer rejoins the ring by itself
+	addr := nodes[1].GetAddr()
+	nodes[1].StopAll()
+	nodes[1] = z.NewTestNode(t, peerFac, transp, addr, append(opts, z.WithStorage(storages[1]))...)
+
+	time.Sleep(time.Second * 3)
+
+	require.Equal(t, uint(numNodes), nodes[0].RingLen())
+	snapshot, err := nodes[1].RingSnapshot()
+	require.NoError(t, err)
+	require.True(t, snapshot.Consistent(), snapshot.Inconsistencies)
+	require.Len(t, snapshot.Nodes, numNodes)
+
+	require.Equal(t, len(marked), dictionaries.Len())
+	dictionaries.ForEach(func(key string, val []byte) bool {
+		require.Contains(t, marked, key)
+		require.Equal(t, []byte("{}"), val)
+		return true
+	})
+
+	// > A peer that has left its ring stays alone after a restart
+	err = nodes[2].LeaveChord()
+	require.NoError(t, err)
+
+	addr = nodes[2].GetAddr()
+	nodes[2].StopAll()
+	nodes[2] = z.NewTestNode(t, peerFac, transp, addr, append(opts, z.WithStorage(storages[2]))...)
+
+	time.Sleep(time.Second * 3)
+
+	require.Equal(t, peer.ChordMember, nodes[2].GetChordState())
+	require.Equal(t, "", nodes[2].GetSuccessor())
+	require.Equal(t, uint(numNodes-1), nodes[0].RingLen())
+
+	for _, node := range nodes {
+		node.Stop()
+	}
+}
+
+// Test_Chord_Rejoin_After_Restart_Authenticated tests that a peer of an authenticated ring keeps its key and its
+// chordID across a restart with the storage of its previous run, so that its former neighbours accept it back,
+// and that a peer restarted without its storage after it left is accepted with its new key.
+func Test_Chord_Rejoin_After_Restart_Authenticated(t *testing.T) {
+	numNodes := 4
+	transp := channelFac()
+
+	opts := []z.Option{z.WithChordBytes(2), z.WithChordAuthentication(true),
+		z.WithChordStabilizeInterval(time.Millisecond * 200), z.WithChordFixFingerInterval(time.Millisecond * 100)}
+
+	storages := make([]storage.Storage, numNodes)
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		storages[i] = inmemory.NewPersistency()
+		nodes[i] = z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			append(opts, z.WithStorage(storages[i]))...)
+	}
+
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinChord(nodes[0].GetAddr())
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second * 3)
+
+	snapshot, err := nodes[0].RingSnapshot()
+	require.NoError(t, err)
+	if len(snapshot.Nodes) != numNodes {
+		// The IDs are derived from random keys, two nodes may collide, there is no correctness guarantee
+		return
+	}
+
+	// > The restarted peer keeps its chordID and rejoins the ring by itself
+	chordID := nodes[1].GetChordID()
+	addr := nodes[1].GetAddr()
+	nodes[1].StopAll()
+	nodes[1] = z.NewTestNode(t, peerFac, transp, addr, append(opts, z.WithStorage(storages[1]))...)
+	require.Equal(t, chordID, nodes[1].GetChordID())
+
+	time.Sleep(time.Second * 3)
+
+	snapshot, err = nodes[1].RingSnapshot()
+	require.NoError(t, err)
+	require.True(t, snapshot.Consistent(), snapshot.Inconsistencies)
+	require.Len(t, snapshot.Nodes, numNodes)
+
+	// > A peer that has left and is restarted without its storage has a new key, it is accepted once it joins
+	// again
+	err = nodes[2].LeaveChord()
+	require.NoError(t, err)
+	addr = nodes[2].GetAddr()
+	nodes[2].StopAll()
+
+	time.Sleep(time.Second)
+
+	nodes[2] = z.NewTestNode(t, peerFac, transp, addr, opts...)
+	err = nodes[2].JoinChord(nodes[0].GetAddr())
+	require.NoError(t, err)
+
+	time.Sleep(time.Second * 3)
+
+	snapshot, err = nodes[2].RingSnapshot()
+	require.NoError(t, err)
+	require.True(t, snapshot.Consistent(), snapshot.Inconsistencies)
+	require.Len(t, snapshot.Nodes, numNodes)
+	require.Equal(t, nodes[2].GetChordID(), nodes[0].QueryChordID(addr))
+
+	for _, node := range nodes {
+		node.Stop()
+	}
+}
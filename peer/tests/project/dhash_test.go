@@ -0,0 +1,126 @@
+package project
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	z "go.dedis.ch/cs438/internal/testing"
+	"testing"
+	"time"
+)
+
+// Test_DHash_Put_Get tests that a value put by any node can be retrieved by any other node, and that each
+// entry is stored by its owner and replicated on its successors
+func Test_DHash_Put_Get(t *testing.T) {
+	numNodes := 5
+	numKeys := 20
+	replicas := uint(2)
+	transp := channelFac()
+
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		node := z.NewTestNode(t, peerFac, transp, fmt.Sprintf("127.0.0.1:%d", i+1), z.WithChordBytes(1),
+			z.WithDHashReplicas(replicas),
+			z.WithChordStabilizeInterval(time.Millisecond*200), z.WithChordFixFingerInterval(time.Millisecond*200))
+		defer node.Stop()
+		nodes[i] = node
+	}
+
+	for _, n1 := range nodes {
+		for _, n2 := range nodes {
+			n1.AddPeer(n2.GetAddr())
+		}
+	}
+
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinChord(nodes[0].GetAddr())
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second * 5)
+
+	for i := 0; i < numKeys; i++ {
+		err := nodes[i%numNodes].Put(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second)
+
+	for i := 0; i < numKeys; i++ {
+		value, err := nodes[(i+2)%numNodes].Get(fmt.Sprintf("key%d", i))
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("value%d", i)), value)
+	}
+
+	_, err := nodes[0].Get("unknown")
+	require.Error(t, err)
+
+	// Every entry is stored by its owner and its replicas
+	totEntries := 0
+	for _, node := range nodes {
+		totEntries += node.GetStorage().GetDHashStore().Len()
+	}
+	require.Equal(t, numKeys*int(replicas+1), totEntries)
+}
+
+// Test_DHash_Join_Leave tests that the entries are moved to the new owner when a node joins the ring, and to
+// the successor of the owner when it leaves the ring
+func Test_DHash_Join_Leave(t *testing.T) {
+	numNodes := 4
+	numKeys := 20
+	transp := channelFac()
+
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		node := z.NewTestNode(t, peerFac, transp, fmt.Sprintf("127.0.0.1:%d", i+1), z.WithChordBytes(1),
+			z.WithDHashReplicas(0),
+			z.WithChordStabilizeInterval(time.Millisecond*200), z.WithChordFixFingerInterval(time.Millisecond*200))
+		defer node.Stop()
+		nodes[i] = node
+	}
+
+	for _, n1 := range nodes {
+		for _, n2 := range nodes {
+			n1.AddPeer(n2.GetAddr())
+		}
+	}
+
+	// All entries are put while the first node is alone in the ring
+	for i := 0; i < numKeys; i++ {
+		err := nodes[0].Put(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+		require.NoError(t, err)
+	}
+	require.Equal(t, numKeys, nodes[0].GetStorage().GetDHashStore().Len())
+
+	// The other nodes join, they should receive the entries they own
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinChord(nodes[0].GetAddr())
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second * 5)
+
+	// With ChordBytes = 1, the nodes have IDs 97, 100, 58 and 6, the second node owns (97, 100] which does not
+	// contain any of the keys
+	require.Zero(t, nodes[1].GetStorage().GetDHashStore().Len())
+	for i := 2; i < numNodes; i++ {
+		require.NotZero(t, nodes[i].GetStorage().GetDHashStore().Len())
+	}
+	for i := 0; i < numKeys; i++ {
+		value, err := nodes[i%numNodes].Get(fmt.Sprintf("key%d", i))
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("value%d", i)), value)
+	}
+
+	// Two nodes leave, the remaining nodes should still serve all entries
+	for i := 2; i < numNodes; i++ {
+		err := nodes[i].LeaveChord()
+		require.NoError(t, err)
+		time.Sleep(time.Second * 2)
+	}
+
+	for i := 0; i < numKeys; i++ {
+		value, err := nodes[i%2].Get(fmt.Sprintf("key%d", i))
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("value%d", i)), value)
+	}
+}
@@ -3,7 +3,6 @@ package project
 import (
 	"fmt"
 	"os"
-	"strconv"
 	"testing"
 	"time"
 
@@ -13,6 +12,24 @@ import (
 	"golang.org/x/xerrors"
 )
 
+// boundWorldState creates a QuickWorldState whose i-th account is bound to the network address 127.0.0.1:i
+func boundWorldState(accounts int, balance int64) *common.WorldState {
+	worldState := common.QuickWorldState(accounts, balance)
+	for i := 1; i <= accounts; i++ {
+		state, _ := worldState.Get(common.QuickAddress(i).String())
+		state.NetworkAddress = fmt.Sprintf("127.0.0.1:%d", i)
+		worldState.Set(common.QuickAddress(i).String(), state)
+	}
+	return worldState
+}
+
+// contractAddress returns the address of the n-th contract published by the account of the node
+func contractAddress(t *testing.T, node z.TestNode, n int) string {
+	publisher, err := common.ParseAddress(node.GetAccountAddress())
+	require.NoError(t, err)
+	return common.ContractAddress(publisher, n).String()
+}
+
 // Test_Full_Three_Nodes_One_Task_1B_Salt tests a simple scenario
 // where one node submit a password cracking request
 // and another node executes the request to earn the reward
@@ -22,8 +39,9 @@ func Test_Full_Three_Nodes_One_Task_1B_Salt(t *testing.T) {
 
 	newNode := func() z.TestNode {
 		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			z.WithBlockchainInitialState(common.FaucetAllocation(30)),
 			z.WithBlockchainBlockTimeout(time.Second*3),
-			z.WithBlockchainDifficulty(2),
+			z.WithBlockchainDifficulty(16),
 			z.WithBlockchainBlockSize(2),
 			z.WithHeartbeat(time.Second*1),
 			z.WithAntiEntropy(time.Second*1),
@@ -97,9 +115,9 @@ func Test_Full_Three_Nodes_One_Task_1B_Salt(t *testing.T) {
 	require.Equal(t, node1.GetChain().GetBlockCount(), node2.GetChain().GetBlockCount())
 	require.Equal(t, node1.GetChain().GetBlockCount(), node3.GetChain().GetBlockCount())
 
-	require.Equal(t, 4, node1.GetChain().GetLastBlock().State.Len())
-	require.Equal(t, 4, node2.GetChain().GetLastBlock().State.Len())
-	require.Equal(t, 4, node3.GetChain().GetLastBlock().State.Len())
+	require.Equal(t, 5, node1.GetChain().GetLastBlock().State.Len())
+	require.Equal(t, 5, node2.GetChain().GetLastBlock().State.Len())
+	require.Equal(t, 5, node3.GetChain().GetLastBlock().State.Len())
 
 	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node2.GetChain().GetLastBlock().BlockHash)
 	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node3.GetChain().GetLastBlock().BlockHash)
@@ -111,7 +129,7 @@ func Test_Full_Three_Nodes_One_Task_1B_Salt(t *testing.T) {
 	// The contract account should transfer node1's deposit to node2
 	// Check the balance
 	require.EqualValues(t, 30, node1.GetBalance()+node2.GetBalance()+node3.GetBalance())
-	contractState, _ := node1.GetChain().GetLastBlock().State.Get("1_1")
+	contractState, _ := node1.GetChain().GetLastBlock().State.Get(contractAddress(t, node1, 1))
 	require.EqualValues(t, 0, contractState.Balance)
 
 }
@@ -125,8 +143,9 @@ func Test_Full_Three_Nodes_Two_Tasks_2B_Salt(t *testing.T) {
 
 	newNode := func() z.TestNode {
 		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			z.WithBlockchainInitialState(common.FaucetAllocation(30)),
 			z.WithBlockchainBlockTimeout(time.Second*3),
-			z.WithBlockchainDifficulty(2),
+			z.WithBlockchainDifficulty(16),
 			z.WithBlockchainBlockSize(2),
 			z.WithHeartbeat(time.Second*1),
 			z.WithAntiEntropy(time.Second*1),
@@ -225,9 +244,9 @@ func Test_Full_Three_Nodes_Two_Tasks_2B_Salt(t *testing.T) {
 
 	// 3 block for the node themselves
 	// 1_1 and 1_2 are two blocks for smartAccount correspond to the 2 tasks
-	require.Equal(t, 5, node1.GetChain().GetLastBlock().State.Len())
-	require.Equal(t, 5, node2.GetChain().GetLastBlock().State.Len())
-	require.Equal(t, 5, node3.GetChain().GetLastBlock().State.Len())
+	require.Equal(t, 6, node1.GetChain().GetLastBlock().State.Len())
+	require.Equal(t, 6, node2.GetChain().GetLastBlock().State.Len())
+	require.Equal(t, 6, node3.GetChain().GetLastBlock().State.Len())
 
 	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node2.GetChain().GetLastBlock().BlockHash)
 	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node3.GetChain().GetLastBlock().BlockHash)
@@ -241,12 +260,12 @@ func Test_Full_Three_Nodes_Two_Tasks_2B_Salt(t *testing.T) {
 	require.EqualValues(t, 30, node1.GetBalance()+node2.GetBalance()+node3.GetBalance())
 	// The first cracking task is correct,
 	// smartAccount should transfer money to finisher
-	contractState, _ := node1.GetChain().GetLastBlock().State.Get("1_1")
+	contractState, _ := node1.GetChain().GetLastBlock().State.Get(contractAddress(t, node1, 1))
 	require.EqualValues(t, 0, contractState.Balance)
 
 	// The second cracking task is correct,
 	// smartAccount should transfer money to finisher
-	contractState2, _ := node1.GetChain().GetLastBlock().State.Get("1_2")
+	contractState2, _ := node1.GetChain().GetLastBlock().State.Get(contractAddress(t, node1, 2))
 	require.EqualValues(t, 0, contractState2.Balance)
 
 }
@@ -262,8 +281,9 @@ func Test_Full_Three_Nodes_Two_Tasks_2B_Salt_No_Enough_Balance(t *testing.T) {
 
 	newNode := func() z.TestNode {
 		return z.NewTestNode(t, peerFac, transp, "127.0.0.1:0",
+			z.WithBlockchainInitialState(common.FaucetAllocation(30)),
 			z.WithBlockchainBlockTimeout(time.Second*3),
-			z.WithBlockchainDifficulty(2),
+			z.WithBlockchainDifficulty(16),
 			z.WithBlockchainBlockSize(2),
 			z.WithHeartbeat(time.Second*1),
 			z.WithAntiEntropy(time.Second*1),
@@ -355,9 +375,9 @@ func Test_Full_Three_Nodes_Two_Tasks_2B_Salt_No_Enough_Balance(t *testing.T) {
 	// 3 block for the node themselves
 	// 1_1 is the block for smartAccount correspond to the first task
 	// The second task has no enough balance, therefore no block 1_2 established
-	require.Equal(t, 4, node1.GetChain().GetLastBlock().State.Len())
-	require.Equal(t, 4, node2.GetChain().GetLastBlock().State.Len())
-	require.Equal(t, 4, node3.GetChain().GetLastBlock().State.Len())
+	require.Equal(t, 5, node1.GetChain().GetLastBlock().State.Len())
+	require.Equal(t, 5, node2.GetChain().GetLastBlock().State.Len())
+	require.Equal(t, 5, node3.GetChain().GetLastBlock().State.Len())
 
 	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node2.GetChain().GetLastBlock().BlockHash)
 	require.Equal(t, node1.GetChain().GetLastBlock().BlockHash, node3.GetChain().GetLastBlock().BlockHash)
@@ -370,7 +390,7 @@ func Test_Full_Three_Nodes_Two_Tasks_2B_Salt_No_Enough_Balance(t *testing.T) {
 	require.EqualValues(t, 30, node1.GetBalance()+node2.GetBalance()+node3.GetBalance())
 	// The first cracking task is correct,
 	// smartAccount should transfer money to finisher
-	contractState, _ := node1.GetChain().GetLastBlock().State.Get("1_1")
+	contractState, _ := node1.GetChain().GetLastBlock().State.Get(contractAddress(t, node1, 1))
 	require.EqualValues(t, 0, contractState.Balance)
 	// The second task has no enough balance, therefore no block 1_2 established
 
@@ -384,13 +404,13 @@ func Test_Full_Many_Nodes_One_Task_2B_Salt(t *testing.T) {
 	transp := channelFac()
 	nodeNum := 8
 
-	worldState := common.QuickWorldState(nodeNum, 10)
+	worldState := boundWorldState(nodeNum, 10)
 
-	newNode := func(address string) z.TestNode {
-		fullAddr := fmt.Sprintf("127.0.0.1:%s", address)
+	newNode := func(account int) z.TestNode {
+		fullAddr := fmt.Sprintf("127.0.0.1:%d", account)
 		return z.NewTestNode(t, peerFac, transp, fullAddr,
 			z.WithBlockchainBlockTimeout(time.Second*3),
-			z.WithBlockchainDifficulty(2),
+			z.WithBlockchainDifficulty(16),
 			z.WithBlockchainBlockSize(1),
 			z.WithHeartbeat(time.Second*1),
 			z.WithAntiEntropy(time.Second*1),
@@ -398,7 +418,7 @@ func Test_Full_Many_Nodes_One_Task_2B_Salt(t *testing.T) {
 			z.WithChordStabilizeInterval(time.Millisecond*200),
 			z.WithChordFixFingerInterval(time.Millisecond*200),
 			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
-			z.WithBlockchainAccountAddress(address))
+			z.WithBlockchainPrivateKey(common.QuickKey(account)))
 
 	}
 
@@ -406,7 +426,7 @@ func Test_Full_Many_Nodes_One_Task_2B_Salt(t *testing.T) {
 
 	// creating 8 nodes
 	for i := 0; i < nodeNum; i++ {
-		testNode[i] = newNode(strconv.Itoa(i + 1))
+		testNode[i] = newNode(i + 1)
 		defer testNode[i].Stop()
 	}
 
@@ -475,7 +495,7 @@ func Test_Full_Many_Nodes_One_Task_2B_Salt(t *testing.T) {
 	require.EqualValues(t, nodeNum*10, totalBalance)
 	// The cracking task is correct,
 	// smartAccount should transfer money to finisher
-	contractState, _ := testNode[0].GetChain().GetLastBlock().State.Get("1_1")
+	contractState, _ := testNode[0].GetChain().GetLastBlock().State.Get(contractAddress(t, testNode[0], 1))
 	require.EqualValues(t, 0, contractState.Balance)
 
 }
@@ -488,13 +508,13 @@ func Test_Full_Many_Nodes_Many_Task_2B_Salt(t *testing.T) {
 	transp := channelFac()
 	nodeNum := 8
 
-	worldState := common.QuickWorldState(nodeNum, 20)
+	worldState := boundWorldState(nodeNum, 20)
 
-	newNode := func(address string) z.TestNode {
-		fullAddr := fmt.Sprintf("127.0.0.1:%s", address)
+	newNode := func(account int) z.TestNode {
+		fullAddr := fmt.Sprintf("127.0.0.1:%d", account)
 		return z.NewTestNode(t, peerFac, transp, fullAddr,
 			z.WithBlockchainBlockTimeout(time.Second*3),
-			z.WithBlockchainDifficulty(2),
+			z.WithBlockchainDifficulty(16),
 			z.WithBlockchainBlockSize(2),
 			z.WithHeartbeat(time.Second),
 			z.WithAntiEntropy(time.Second),
@@ -502,14 +522,14 @@ func Test_Full_Many_Nodes_Many_Task_2B_Salt(t *testing.T) {
 			z.WithChordStabilizeInterval(time.Second),
 			z.WithChordFixFingerInterval(time.Second),
 			z.WithBlockchainInitialState(worldState.GetSimpleMap()),
-			z.WithBlockchainAccountAddress(address))
+			z.WithBlockchainPrivateKey(common.QuickKey(account)))
 	}
 
 	testNode := make([]z.TestNode, nodeNum)
 
 	// create 16 nodes
 	for i := 0; i < nodeNum; i++ {
-		testNode[i] = newNode(strconv.Itoa(i + 1))
+		testNode[i] = newNode(i + 1)
 		defer testNode[i].Stop()
 	}
 
@@ -591,8 +611,7 @@ func Test_Full_Many_Nodes_Many_Task_2B_Salt(t *testing.T) {
 
 		// The cracking task is correct,
 		// smartAccount should transfer money to finisher
-		blockNum := fmt.Sprintf("%d_1", i)
-		contractState, _ := testNode[i].GetChain().GetLastBlock().State.Get(blockNum)
+		contractState, _ := testNode[i].GetChain().GetLastBlock().State.Get(contractAddress(t, testNode[i], 1))
 		require.EqualValues(t, 0, contractState.Balance)
 	}
 
@@ -0,0 +1,66 @@
+package project
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	z "go.dedis.ch/cs438/internal/testing"
+	"go.dedis.ch/cs438/peer"
+	"math/bits"
+	"testing"
+	"time"
+)
+
+// Test_Kademlia_Join tests that the nodes joining a Kademlia network through the same node discover each other,
+// each contact is in the k-bucket of its XOR distance
+func Test_Kademlia_Join(t *testing.T) {
+	numNodes := 4
+	transp := channelFac()
+
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		node := z.NewTestNode(t, peerFac, transp, fmt.Sprintf("127.0.0.1:%d", i+1), z.WithChordBytes(2),
+			z.WithDHT(peer.KademliaDHT), z.WithKademliaRefreshInterval(time.Millisecond*500))
+		defer node.Stop()
+		nodes[i] = node
+	}
+
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinKademlia(nodes[0].GetAddr())
+		require.NoError(t, err)
+	}
+
+	// Joining through ourselves is not possible
+	require.Error(t, nodes[0].JoinKademlia(nodes[0].GetAddr()))
+
+	time.Sleep(time.Second * 2)
+
+	for _, n1 := range nodes {
+		buckets := n1.GetKBuckets()
+		require.Len(t, buckets, 16)
+		for _, n2 := range nodes {
+			if n1.GetAddr() == n2.GetAddr() {
+				continue
+			}
+			idx := bits.Len(n1.GetKademliaID()^n2.GetKademliaID()) - 1
+			require.Contains(t, buckets[idx], n2.GetAddr())
+		}
+	}
+}
+
+// Test_Kademlia_Join_Unreachable tests that joining through a node that does not answer fails
+func Test_Kademlia_Join_Unreachable(t *testing.T) {
+	transp := channelFac()
+
+	node1 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:1", z.WithChordBytes(2),
+		z.WithDHT(peer.KademliaDHT), z.WithKademliaTimeout(time.Millisecond*500))
+	defer node1.Stop()
+
+	node2 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:2", z.WithChordBytes(2),
+		z.WithDHT(peer.KademliaDHT), z.WithKademliaTimeout(time.Millisecond*500))
+	node2.Stop()
+
+	require.Error(t, node1.JoinKademlia(node2.GetAddr()))
+	for _, bucket := range node1.GetKBuckets() {
+		require.Empty(t, bucket)
+	}
+}
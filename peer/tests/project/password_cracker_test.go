@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/require"
 	z "go.dedis.ch/cs438/internal/testing"
+	"go.dedis.ch/cs438/peer"
 	"math"
 	"math/rand"
 	"sort"
@@ -262,3 +263,171 @@ func Test_Password_Cracker_Multiple_With_Leave(t *testing.T) {
 		require.Equal(t, "apple", nodes[randomIdx].PasswordReceiveResult(hashStrs[i], saltStrs[i]))
 	}
 }
+
+// Test_Password_Cracker_Cache tests that a cracked password is cached in the DHash, a second request for the same
+// hash and salt is answered from the cache without cracking again
+func Test_Password_Cracker_Cache(t *testing.T) {
+	transp := udpFac()
+	node1 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0", z.WithChordBytes(1),
+		z.WithChordStabilizeInterval(time.Millisecond*200), z.WithChordFixFingerInterval(time.Millisecond*200))
+	defer node1.Stop()
+
+	node2 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0", z.WithChordBytes(1),
+		z.WithChordStabilizeInterval(time.Millisecond*200), z.WithChordFixFingerInterval(time.Millisecond*200))
+	defer node2.Stop()
+
+	node1.AddPeer(node2.GetAddr())
+	node2.AddPeer(node1.GetAddr())
+
+	err := node1.JoinChord(node2.GetAddr())
+	require.NoError(t, err)
+
+	time.Sleep(time.Second * 2)
+
+	// TEST 1, node 1 submit a password request, the password is cracked and cached
+	hashStr := "1cfcd196cf51b7a1d44159875452ba2dca8898d675f3d33d610ab9cb0031d7b2"
+	saltStr := "3c"
+	err = node1.PasswordSubmitRequest(hashStr, saltStr, 0, 0)
+	require.NoError(t, err)
+	time.Sleep(time.Second)
+	require.Equal(t, "apple", node1.PasswordReceiveResult(hashStr, saltStr))
+	require.Less(t, 0, node1.GetStorage().GetDHashStore().Len()+node2.GetStorage().GetDHashStore().Len())
+
+	// TEST 2, node 2 submit the same request, the result is available as soon as the request returns
+	err = node2.PasswordSubmitRequest(hashStr, saltStr, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, "apple", node2.PasswordReceiveResult(hashStr, saltStr))
+
+	// TEST 3, a password that is not found is not cached
+	hashStr = "349e4662785588a6cd0ebbd9dbb6cea0bbdbc71159d78901e33f758fafaf6a88"
+	saltStr = "7f"
+	err = node2.PasswordSubmitRequest(hashStr, saltStr, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, "", node2.PasswordReceiveResult(hashStr, saltStr))
+	time.Sleep(time.Second)
+	require.Equal(t, "", node2.PasswordReceiveResult(hashStr, saltStr))
+	err = node1.PasswordSubmitRequest(hashStr, saltStr, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, "", node1.PasswordReceiveResult(hashStr, saltStr))
+}
+
+// kademliaOwned returns the number of salts owned by each node of a Kademlia network, i.e., the salts whose
+// XOR distance to the node is the smallest. It returns false if two nodes share the same ID.
+func kademliaOwned(nodes []z.TestNode, numSalts uint) ([]int, bool) {
+	ids := make(map[uint]bool)
+	for _, node := range nodes {
+		if ids[node.GetKademliaID()] {
+			return nil, false
+		}
+		ids[node.GetKademliaID()] = true
+	}
+
+	owned := make([]int, len(nodes))
+	for salt := uint(0); salt < numSalts; salt++ {
+		closest := 0
+		for i, node := range nodes {
+			if node.GetKademliaID()^salt < nodes[closest].GetKademliaID()^salt {
+				closest = i
+			}
+		}
+		owned[closest]++
+	}
+	return owned, true
+}
+
+// Test_Password_Cracker_Kademlia_Simple tests a Kademlia network formed by 2 nodes, each node should have the
+// dictionary of the salts that are closer to it than to the other node, and the cracked passwords are not cached
+func Test_Password_Cracker_Kademlia_Simple(t *testing.T) {
+	transp := udpFac()
+	node1 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0", z.WithChordBytes(1),
+		z.WithDHT(peer.KademliaDHT), z.WithKademliaRefreshInterval(time.Millisecond*200))
+	defer node1.Stop()
+
+	node2 := z.NewTestNode(t, peerFac, transp, "127.0.0.1:0", z.WithChordBytes(1),
+		z.WithDHT(peer.KademliaDHT), z.WithKademliaRefreshInterval(time.Millisecond*200))
+	defer node2.Stop()
+
+	err := node1.JoinKademlia(node2.GetAddr())
+	require.NoError(t, err)
+
+	time.Sleep(time.Second * 2)
+
+	nodes := []z.TestNode{node1, node2}
+	owned, ok := kademliaOwned(nodes, 256)
+	if !ok {
+		// Unlikely to happen, but if it happens, there is no correctness guarantee
+		return
+	}
+	require.Equal(t, owned[0], node1.GetStorage().GetDictionaryStore().Len())
+	require.Equal(t, owned[1], node2.GetStorage().GetDictionaryStore().Len())
+
+	// TEST 1, node 1 submit a password request, it has a corresponding password inside the dictionary
+	hashStr := "1cfcd196cf51b7a1d44159875452ba2dca8898d675f3d33d610ab9cb0031d7b2"
+	saltStr := "3c"
+	err = node1.PasswordSubmitRequest(hashStr, saltStr, 0, 0)
+	require.NoError(t, err)
+	time.Sleep(time.Second)
+	require.Equal(t, "apple", node1.PasswordReceiveResult(hashStr, saltStr))
+
+	// TEST 2, node 2 submit a password request, it has a corresponding password inside the dictionary
+	hashStr = "49c13df5ec8821b2ec6973a83e077b5ca35ed93a55dc398aa3cb614ebae33d0f"
+	saltStr = "dd"
+	err = node2.PasswordSubmitRequest(hashStr, saltStr, 0, 0)
+	require.NoError(t, err)
+	time.Sleep(time.Second)
+	require.Equal(t, "egg", node2.PasswordReceiveResult(hashStr, saltStr))
+
+	// The cache of the cracked passwords is kept on the Chord ring, there is none along with Kademlia
+	require.Zero(t, node1.GetStorage().GetDHashStore().Len())
+	require.Zero(t, node2.GetStorage().GetDHashStore().Len())
+}
+
+// Test_Password_Cracker_Kademlia_Multiple tests a Kademlia network formed by multiple nodes, the salts should be
+// split among the nodes by XOR distance, and any node can crack any password through the network
+func Test_Password_Cracker_Kademlia_Multiple(t *testing.T) {
+	numNodes := 16
+	transp := channelFac()
+
+	nodes := make([]z.TestNode, numNodes)
+	for i := range nodes {
+		node := z.NewTestNode(t, peerFac, transp, fmt.Sprintf("127.0.0.1:%d", i+1), z.WithChordBytes(1),
+			z.WithDHT(peer.KademliaDHT), z.WithKademliaRefreshInterval(time.Millisecond*500))
+		defer node.Stop()
+		nodes[i] = node
+	}
+
+	// Every node joins through the first one, the refresh lets the first nodes discover the next ones
+	for i := 1; i < numNodes; i++ {
+		err := nodes[i].JoinKademlia(nodes[0].GetAddr())
+		require.NoError(t, err)
+	}
+
+	time.Sleep(time.Second * 5)
+
+	owned, ok := kademliaOwned(nodes, 256)
+	require.True(t, ok)
+	for i, node := range nodes {
+		require.Equal(t, owned[i], node.GetStorage().GetDictionaryStore().Len())
+	}
+
+	// All following hash and salt pairs corresponds to "apple" in the dictionary
+	hashStrs := []string{
+		"1bd15226960ce500e8dbaabbd523b9356ec69ff1bdf2aeef6c5dbe272971986a",
+		"2ea455a6c36bf264a0d933c2e9fa75e9962ceec80a55e118340d62c5b92cd930",
+		"2ae367b9a8585e19e96f301bb3cb020941cd29a3925bb05c9dd12ac47c5757d6",
+		"24a77708057aab975813079ab86b9b84ae300fd738f13fd6b425df0f8895b907",
+		"a4ac87eb7080ed009b324a931235b27439f6e8f4ba51e2ed5c3c47f6962064d4",
+		"4b446b30d876ca954a6d0a24f9d96db7b6a652465b28599d974f15033e87893f",
+		"10d962ff38d51f366f7a0ffc2ab2f6497898230fb4b1c85bf1e03ff3226bfffa",
+		"25b8005ff00096894f3d0dd7287efebef4f3d4ec45a19cc04159197368fa6ce1",
+	}
+	saltStrs := []string{"0f", "1f", "2f", "3f", "4f", "5f", "6f", "7f"}
+
+	for i := 0; i < len(hashStrs); i++ {
+		randomIdx := rand.Intn(len(nodes))
+		err := nodes[randomIdx].PasswordSubmitRequest(hashStrs[i], saltStrs[i], 0, 0)
+		require.NoError(t, err)
+		time.Sleep(time.Second)
+		require.Equal(t, "apple", nodes[randomIdx].PasswordReceiveResult(hashStrs[i], saltStrs[i]))
+	}
+}
@@ -14,6 +14,8 @@ const (
 	naming     = "naming"
 	blockchain = "blockchain"
 	dictionary = "dictionary"
+	dhash      = "dhash"
+	chord      = "chord"
 )
 
 // NewPersistency return a new initialized file-based storage. Opeartions are
@@ -44,12 +46,24 @@ func NewPersistency(folderPath string) (storage.Storage, error) {
 		return nil, xerrors.Errorf("failed to create dictionaryStore: %v", err)
 	}
 
+	dhashStore, err := newStore(filepath.Join(folderPath, dhash))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create dhashStore: %v", err)
+	}
+
+	chordStore, err := newStore(filepath.Join(folderPath, chord))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create chordStore: %v", err)
+	}
+
 	return Storage{
 		folderPath: folderPath,
 		blob:       blobStore,
 		naming:     namingStore,
 		blockchain: blockchainStore,
 		dictionary: dictionaryStore,
+		dhash:      dhashStore,
+		chord:      chordStore,
 	}, nil
 }
 
@@ -63,6 +77,8 @@ type Storage struct {
 	naming     storage.Store
 	blockchain storage.Store
 	dictionary storage.Store
+	dhash      storage.Store
+	chord      storage.Store
 }
 
 // GetFolderPath returns the folder path
@@ -90,6 +106,16 @@ func (s Storage) GetDictionaryStore() storage.Store {
 	return s.dictionary
 }
 
+// GetDHashStore implements storage.Storage
+func (s Storage) GetDHashStore() storage.Store {
+	return s.dhash
+}
+
+// GetChordStore implements storage.Storage
+func (s Storage) GetChordStore() storage.Store {
+	return s.chord
+}
+
 func newStore(folderPath string) (*store, error) {
 	err := os.MkdirAll(folderPath, os.ModePerm)
 	if err != nil {
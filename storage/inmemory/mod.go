@@ -14,6 +14,8 @@ func NewPersistency() storage.Storage {
 		naming:     newStore(),
 		blockchain: newStore(),
 		dictionary: newStore(),
+		dhash:      newStore(),
+		chord:      newStore(),
 	}
 }
 
@@ -25,6 +27,8 @@ type Storage struct {
 	naming     storage.Store
 	blockchain storage.Store
 	dictionary storage.Store
+	dhash      storage.Store
+	chord      storage.Store
 }
 
 // GetDataBlobStore implements storage.Storage
@@ -47,6 +51,16 @@ func (s Storage) GetDictionaryStore() storage.Store {
 	return s.dictionary
 }
 
+// GetDHashStore implements storage.Storage
+func (s Storage) GetDHashStore() storage.Store {
+	return s.dhash
+}
+
+// GetChordStore implements storage.Storage
+func (s Storage) GetChordStore() storage.Store {
+	return s.chord
+}
+
 func newStore() *store {
 	return &store{
 		data: make(map[string][]byte),
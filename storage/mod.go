@@ -19,6 +19,14 @@ type Storage interface {
 
 	// GetDictionaryStore returns a storage to store the dictionary for password cracker
 	GetDictionaryStore() Store
+
+	// GetDHashStore returns a storage to store the key-value pairs of the
+	// distributed hash table built on top of Chord
+	GetDHashStore() Store
+
+	// GetChordStore returns a storage to store the state of the Chord node
+	// that allows it to rejoin its ring after a restart
+	GetChordStore() Store
 }
 
 // Store describes the primitives of a simple storage.
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/clock/virtual"
 	"go.dedis.ch/cs438/transport"
 )
 
@@ -66,3 +67,57 @@ func TestScenario(t *testing.T) {
 
 	require.Equal(t, "msgB2", pkt.Msg.Type)
 }
+
+func TestSimulation(t *testing.T) {
+
+	clock := virtual.NewClock(time.Unix(0, 0))
+	net := NewSimulation(clock, time.Millisecond*10)
+
+	sock1, err := net.CreateSocket("A")
+	require.NoError(t, err)
+
+	sock2, err := net.CreateSocket("B")
+	require.NoError(t, err)
+
+	// B answers each packet of A
+	received := make(chan time.Time, 10)
+	net.Handle("B", func(pkt transport.Packet) {
+		received <- clock.Now()
+		sock2.Send("A", transport.Packet{
+			Header: &transport.Header{},
+			Msg: &transport.Message{
+				Type: "reply",
+			},
+		}, 0)
+	})
+
+	err = sock1.Send("B", transport.Packet{
+		Header: &transport.Header{},
+		Msg: &transport.Message{
+			Type: "msgA1",
+		},
+	}, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, net.InFlight())
+
+	// Nothing is delivered until the simulation runs
+	require.Len(t, received, 0)
+
+	net.Run(time.Millisecond * 15)
+	require.Equal(t, time.Unix(0, 0).Add(time.Millisecond*10), <-received)
+	require.Equal(t, 1, net.InFlight())
+
+	net.Run(time.Millisecond * 5)
+	require.Equal(t, 0, net.InFlight())
+
+	pkt, err := sock1.Recv(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "reply", pkt.Msg.Type)
+
+	// The packets to an unknown address are rejected
+	err = sock1.Send("C", transport.Packet{
+		Header: &transport.Header{},
+		Msg:    &transport.Message{},
+	}, 0)
+	require.Error(t, err)
+}
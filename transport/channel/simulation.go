@@ -0,0 +1,300 @@
+package channel
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.dedis.ch/cs438/clock/virtual"
+	"go.dedis.ch/cs438/transport"
+	"golang.org/x/xerrors"
+)
+
+// settleRounds is the number of consecutive observations without any new packet and without any change of
+// the running handlers after which the simulation considers that the goroutines woken up are done
+const settleRounds = 3
+
+// settlePause is the real time the simulation waits between two observations, so that the goroutines woken
+// up by the clock or by a packet can run
+const settlePause = time.Microsecond * 50
+
+// NewSimulation returns a channel-based transport whose packets are delivered in the virtual time of the given
+// clock, once the latency has elapsed. Nothing happens until the simulation is run: it delivers the packets and
+// advances the clock from one event to the next one, so that the daemons driven by the clock run without any
+// real wait.
+func NewSimulation(clock *virtual.Clock, latency time.Duration) *Simulation {
+	return &Simulation{
+		clock:     clock,
+		latency:   latency,
+		queue:     packetHeap{},
+		handlers:  make(map[string]func(transport.Packet)),
+		incomings: make(map[string]chan transport.Packet),
+	}
+}
+
+// Simulation is a channel-based transport driven by a virtual clock
+//
+// - implements transport.Transport
+type Simulation struct {
+	sync.Mutex
+	clock     *virtual.Clock
+	latency   time.Duration
+	seq       uint64                            // Orders the packets sent at the same virtual time
+	queue     packetHeap                        // The packets in flight, ordered by delivery time
+	handlers  map[string]func(transport.Packet) // The sockets whose packets are passed to a handler
+	incomings map[string]chan transport.Packet  // The sockets whose packets are read with Recv
+	running   atomic.Int32                      // The number of handlers that have not returned yet
+}
+
+// CreateSocket implements transport.Transport
+func (s *Simulation) CreateSocket(address string) (transport.ClosableSocket, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if strings.HasSuffix(address, ":0") {
+		address = address[:len(address)-2]
+		port := atomic.AddUint32(&counter, 1)
+		address = fmt.Sprintf("%s:%d", address, port)
+	}
+	s.incomings[address] = make(chan transport.Packet, 100)
+
+	return &SimulationSocket{
+		Simulation: s,
+		myAddr:     address,
+	}, nil
+}
+
+// Handle passes the packets sent to the given address to the handler, instead of queuing them for Recv. The
+// handler is called in its own goroutine, as the listen daemon of a peer does.
+func (s *Simulation) Handle(address string, handler func(transport.Packet)) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.handlers[address] = handler
+}
+
+// Run runs the simulation for the given virtual duration
+func (s *Simulation) Run(d time.Duration) {
+	s.RunUntil(func() bool { return false }, d)
+}
+
+// RunUntil runs the simulation until the condition holds, or until the given virtual duration has elapsed. The
+// condition is checked each time the simulation is about to advance the clock. It returns whether the
+// condition holds.
+func (s *Simulation) RunUntil(cond func() bool, limit time.Duration) bool {
+	end := s.clock.Now().Add(limit)
+	for {
+		s.deliverDue()
+		if cond() {
+			return true
+		}
+
+		next, ok := s.next()
+		if !ok || next.After(end) {
+			s.clock.AdvanceTo(end)
+			s.deliverDue()
+			return cond()
+		}
+		s.clock.AdvanceTo(next)
+	}
+}
+
+// InFlight returns the number of packets that have been sent but not delivered yet
+func (s *Simulation) InFlight() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return len(s.queue)
+}
+
+// next returns the time of the next event, either the delivery of a packet or the deadline of a timer
+func (s *Simulation) next() (time.Time, bool) {
+	next, ok := s.clock.Next()
+
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.queue) > 0 && (!ok || s.queue[0].at.Before(next)) {
+		return s.queue[0].at, true
+	}
+	return next, ok
+}
+
+// deliverDue delivers the packets whose delivery time is reached, including the packets sent in reaction to
+// them at the same virtual time
+func (s *Simulation) deliverDue() {
+	for {
+		s.settle()
+
+		now := s.clock.Now()
+		s.Lock()
+		due := make([]*inFlight, 0)
+		for len(s.queue) > 0 && !s.queue[0].at.After(now) {
+			due = append(due, heap.Pop(&s.queue).(*inFlight))
+		}
+		s.Unlock()
+
+		if len(due) == 0 {
+			return
+		}
+		for _, p := range due {
+			s.deliver(p)
+		}
+	}
+}
+
+// deliver passes the packet to the handler of its destination, or queues it for Recv
+func (s *Simulation) deliver(p *inFlight) {
+	s.Lock()
+	handler, ok := s.handlers[p.dest]
+	incoming, listening := s.incomings[p.dest]
+	s.Unlock()
+
+	if ok {
+		s.running.Add(1)
+		go func() {
+			defer s.running.Add(-1)
+			handler(p.pkt)
+		}()
+		return
+	}
+	if listening {
+		select {
+		case incoming <- p.pkt:
+		default:
+			// Nobody reads the socket, the packet is lost as on a real network
+		}
+	}
+}
+
+// settle waits until the goroutines woken up by the clock or by a packet are done, i.e., until they neither send
+// packets nor return from a handler anymore
+func (s *Simulation) settle() {
+	last, lastRunning := -1, int32(-1)
+	for stable := 0; stable < settleRounds; {
+		time.Sleep(settlePause)
+
+		inFlight, running := s.InFlight(), s.running.Load()
+		if inFlight == last && running == lastRunning {
+			stable++
+		} else {
+			stable = 0
+		}
+		last, lastRunning = inFlight, running
+	}
+}
+
+// SimulationSocket provide a network layer whose packets are delivered in virtual time. Since a simulation
+// exchanges a large number of packets, they are not recorded.
+//
+// - implements transport.ClosableSocket
+type SimulationSocket struct {
+	*Simulation
+	myAddr string
+}
+
+// Close implements transport.Socket
+func (s *SimulationSocket) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.incomings, s.myAddr)
+	delete(s.handlers, s.myAddr)
+
+	return nil
+}
+
+// Send implements transport.Socket. The packet is delivered once the latency has elapsed in virtual time, the
+// call never blocks.
+func (s *SimulationSocket) Send(dest string, pkt transport.Packet, timeout time.Duration) error {
+	s.Lock()
+	_, handled := s.handlers[dest]
+	_, listening := s.incomings[dest]
+	if !handled && !listening {
+		s.Unlock()
+		return xerrors.Errorf("%s is not listening", dest)
+	}
+
+	heap.Push(&s.queue, &inFlight{
+		at:   s.clock.Now().Add(s.latency),
+		seq:  s.seq,
+		dest: dest,
+		pkt:  pkt.Copy(),
+	})
+	s.seq++
+	s.Unlock()
+
+	return nil
+}
+
+// Recv implements transport.Socket. The timeout is measured in virtual time.
+func (s *SimulationSocket) Recv(timeout time.Duration) (transport.Packet, error) {
+	s.Lock()
+	myChan := s.incomings[s.myAddr]
+	s.Unlock()
+
+	select {
+	case <-s.clock.After(timeout):
+		return transport.Packet{}, transport.TimeoutError(timeout)
+	case pkt := <-myChan:
+		return pkt, nil
+	}
+}
+
+// GetAddress implements transport.Socket.
+func (s *SimulationSocket) GetAddress() string {
+	return s.myAddr
+}
+
+// GetIns implements transport.Socket, the packets are not recorded
+func (s *SimulationSocket) GetIns() []transport.Packet {
+	return []transport.Packet{}
+}
+
+// GetOuts implements transport.Socket, the packets are not recorded
+func (s *SimulationSocket) GetOuts() []transport.Packet {
+	return []transport.Packet{}
+}
+
+// inFlight is a packet sent in the simulation, that is delivered at a given virtual time
+type inFlight struct {
+	at   time.Time
+	seq  uint64
+	dest string
+	pkt  transport.Packet
+}
+
+// packetHeap orders the packets in flight by delivery time, and then by sending order
+//
+// - implements heap.Interface
+type packetHeap []*inFlight
+
+func (h packetHeap) Len() int {
+	return len(h)
+}
+
+func (h packetHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h packetHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *packetHeap) Push(x interface{}) {
+	*h = append(*h, x.(*inFlight))
+}
+
+func (h *packetHeap) Pop() interface{} {
+	old := *h
+	p := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return p
+}
@@ -21,7 +21,34 @@ func NewUDP() transport.Transport {
 // UDP implements a transport layer using UDP
 //
 // - implements transport.Transport
-type UDP struct{}
+type UDP struct {
+	delays sync.Map // The delays injected on the links between sockets, keyed by link
+}
+
+// link is a directed link from the socket bound to src to the dest address
+type link struct {
+	src  string
+	dest string
+}
+
+// SetLinkDelay injects a delay on the link from the socket bound to src to dest: every packet sent on the link
+// is written to the network after the delay. It is meant for testing, a zero delay removes the injected delay.
+func (n *UDP) SetLinkDelay(src string, dest string, delay time.Duration) {
+	if delay == 0 {
+		n.delays.Delete(link{src: src, dest: dest})
+		return
+	}
+	n.delays.Store(link{src: src, dest: dest}, delay)
+}
+
+// linkDelay returns the delay injected on the link from src to dest, if any
+func (n *UDP) linkDelay(src string, dest string) time.Duration {
+	delay, ok := n.delays.Load(link{src: src, dest: dest})
+	if !ok {
+		return 0
+	}
+	return delay.(time.Duration)
+}
 
 // CreateSocket implements transport.Transport
 func (n *UDP) CreateSocket(address string) (transport.ClosableSocket, error) {
@@ -79,6 +106,16 @@ func (s *Socket) Send(dest string, pkt transport.Packet, timeout time.Duration)
 		return err
 	}
 
+	// If a delay is injected on the link, the packet is written later without blocking the sender
+	delay := s.linkDelay(s.GetAddress(), dest)
+	if delay > 0 {
+		time.AfterFunc(delay, func() {
+			_, _ = s.conn.WriteTo(data, udpAddr)
+		})
+		s.outs.add(pkt)
+		return nil
+	}
+
 	// Send the packet out with the specified timeout
 	err = s.conn.SetWriteDeadline(time.Now().Add(timeout))
 	if err != nil {
@@ -0,0 +1,74 @@
+package udp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/transport"
+)
+
+func TestLinkDelay(t *testing.T) {
+
+	net := NewUDP().(*UDP)
+
+	sock1, err := net.CreateSocket("127.0.0.1:0")
+	require.NoError(t, err)
+	defer sock1.Close()
+
+	sock2, err := net.CreateSocket("127.0.0.1:0")
+	require.NoError(t, err)
+	defer sock2.Close()
+
+	net.SetLinkDelay(sock1.GetAddress(), sock2.GetAddress(), time.Millisecond*300)
+
+	// The delay only applies on the link from sock1 to sock2
+	start := time.Now()
+	err = sock1.Send(sock2.GetAddress(), transport.Packet{
+		Header: &transport.Header{},
+		Msg: &transport.Message{
+			Type: "msgA1",
+		},
+	}, 0)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), time.Millisecond*300)
+
+	_, err = sock2.Recv(time.Millisecond * 100)
+	require.Error(t, err)
+
+	pkt, err := sock2.Recv(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "msgA1", pkt.Msg.Type)
+	require.GreaterOrEqual(t, time.Since(start), time.Millisecond*300)
+
+	start = time.Now()
+	err = sock2.Send(sock1.GetAddress(), transport.Packet{
+		Header: &transport.Header{},
+		Msg: &transport.Message{
+			Type: "msgB1",
+		},
+	}, 0)
+	require.NoError(t, err)
+
+	pkt, err = sock1.Recv(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "msgB1", pkt.Msg.Type)
+	require.Less(t, time.Since(start), time.Millisecond*300)
+
+	// Removing the delay restores the direct delivery
+	net.SetLinkDelay(sock1.GetAddress(), sock2.GetAddress(), 0)
+
+	start = time.Now()
+	err = sock1.Send(sock2.GetAddress(), transport.Packet{
+		Header: &transport.Header{},
+		Msg: &transport.Message{
+			Type: "msgA2",
+		},
+	}, 0)
+	require.NoError(t, err)
+
+	pkt, err = sock2.Recv(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "msgA2", pkt.Msg.Type)
+	require.Less(t, time.Since(start), time.Millisecond*300)
+}
@@ -1,5 +1,7 @@
 package types
 
+import "fmt"
+
 // NewEmpty implements types.Message.
 func (c TransactionMessage) NewEmpty() Message {
 	return &TransactionMessage{}
@@ -39,3 +41,118 @@ func (c BlockMessage) String() string {
 func (c BlockMessage) HTML() string {
 	return c.String()
 }
+
+// -----------------------------------------------------------------------------
+// ChainTipMessage
+
+// NewEmpty implements types.Message.
+func (c ChainTipMessage) NewEmpty() Message {
+	return &ChainTipMessage{}
+}
+
+// Name implements types.Message.
+func (c ChainTipMessage) Name() string {
+	return "chain tip message"
+}
+
+// String implements types.Message.
+func (c ChainTipMessage) String() string {
+	return fmt.Sprintf("chain tip {height %d, hash %s}", c.Height, c.Hash)
+}
+
+// HTML implements types.Message.
+func (c ChainTipMessage) HTML() string {
+	return c.String()
+}
+
+// -----------------------------------------------------------------------------
+// BlockRangeRequestMessage
+
+// NewEmpty implements types.Message.
+func (c BlockRangeRequestMessage) NewEmpty() Message {
+	return &BlockRangeRequestMessage{}
+}
+
+// Name implements types.Message.
+func (c BlockRangeRequestMessage) Name() string {
+	return "block range request message"
+}
+
+// String implements types.Message.
+func (c BlockRangeRequestMessage) String() string {
+	return fmt.Sprintf("block range request {%d - %d}", c.From, c.To)
+}
+
+// HTML implements types.Message.
+func (c BlockRangeRequestMessage) HTML() string {
+	return c.String()
+}
+
+// -----------------------------------------------------------------------------
+// BlockRangeReplyMessage
+
+// NewEmpty implements types.Message.
+func (c BlockRangeReplyMessage) NewEmpty() Message {
+	return &BlockRangeReplyMessage{}
+}
+
+// Name implements types.Message.
+func (c BlockRangeReplyMessage) Name() string {
+	return "block range reply message"
+}
+
+// String implements types.Message.
+func (c BlockRangeReplyMessage) String() string {
+	return fmt.Sprintf("block range reply {%d blocks}", len(c.TransBlocks))
+}
+
+// HTML implements types.Message.
+func (c BlockRangeReplyMessage) HTML() string {
+	return c.String()
+}
+
+// -----------------------------------------------------------------------------
+// DeclarationChallengeMessage
+
+// NewEmpty implements types.Message.
+func (c DeclarationChallengeMessage) NewEmpty() Message {
+	return &DeclarationChallengeMessage{}
+}
+
+// Name implements types.Message.
+func (c DeclarationChallengeMessage) Name() string {
+	return "declaration challenge message"
+}
+
+// String implements types.Message.
+func (c DeclarationChallengeMessage) String() string {
+	return fmt.Sprintf("declaration challenge {%s, account %s}", c.RequestID, c.Account)
+}
+
+// HTML implements types.Message.
+func (c DeclarationChallengeMessage) HTML() string {
+	return c.String()
+}
+
+// -----------------------------------------------------------------------------
+// DeclarationChallengeReplyMessage
+
+// NewEmpty implements types.Message.
+func (c DeclarationChallengeReplyMessage) NewEmpty() Message {
+	return &DeclarationChallengeReplyMessage{}
+}
+
+// Name implements types.Message.
+func (c DeclarationChallengeReplyMessage) Name() string {
+	return "declaration challenge reply message"
+}
+
+// String implements types.Message.
+func (c DeclarationChallengeReplyMessage) String() string {
+	return fmt.Sprintf("declaration challenge reply {%s}", c.RequestID)
+}
+
+// HTML implements types.Message.
+func (c DeclarationChallengeReplyMessage) HTML() string {
+	return c.String()
+}
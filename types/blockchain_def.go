@@ -17,3 +17,49 @@ type BlockMessage struct {
 	//Block block.Block
 	TransBlock block.TransBlock
 }
+
+// ChainTipMessage describes a message that announces the tip of the chain of a peer to its neighbors, so that a
+// lagging neighbor requests the blocks it misses
+// - implements types.Message
+type ChainTipMessage struct {
+	// Height is the ID of the last block of the chain
+	Height uint32
+	Hash   string
+}
+
+// BlockRangeRequestMessage describes a message that requests the blocks of IDs From to To, both included, on the
+// chain of a peer
+// - implements types.Message
+type BlockRangeRequestMessage struct {
+	From uint32
+	To   uint32
+}
+
+// BlockRangeReplyMessage describes a message that replies to a BlockRangeRequestMessage with the requested blocks
+// the peer has, in the order of their IDs
+// - implements types.Message
+type BlockRangeReplyMessage struct {
+	TransBlocks []block.TransBlock
+}
+
+// DeclarationChallengeMessage challenges the peer at the network address bound by an account join declaration to
+// prove that it holds the private key of the declared account
+// - implements types.Message
+type DeclarationChallengeMessage struct {
+	// RequestID must be a unique identifier. Use xid.New().String() to generate it.
+	RequestID string
+
+	// Account is the address of the declared account
+	Account string
+
+	// Nonce is the random value the challenged peer should sign
+	Nonce []byte
+}
+
+// DeclarationChallengeReplyMessage replies to a DeclarationChallengeMessage with the signature of the nonce by the
+// private key of the account
+// - implements types.Message
+type DeclarationChallengeReplyMessage struct {
+	RequestID string
+	Signature []byte
+}
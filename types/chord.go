@@ -155,7 +155,7 @@ func (c ChordClearPredecessorMessage) Name() string {
 
 // String implements types.Message.
 func (c ChordClearPredecessorMessage) String() string {
-	return "{chordclearpred}"
+	return fmt.Sprintf("{chordclearpred with new pred %s}", c.Predecessor)
 }
 
 // HTML implements types.Message.
@@ -186,6 +186,29 @@ func (c ChordSkipSuccessorMessage) HTML() string {
 	return c.String()
 }
 
+// -----------------------------------------------------------------------------
+// ChordLeaveReplyMessage
+
+// NewEmpty implements types.Message.
+func (c ChordLeaveReplyMessage) NewEmpty() Message {
+	return &ChordLeaveReplyMessage{}
+}
+
+// Name implements types.Message.
+func (c ChordLeaveReplyMessage) Name() string {
+	return "chordleavereply"
+}
+
+// String implements types.Message.
+func (c ChordLeaveReplyMessage) String() string {
+	return fmt.Sprintf("{chordleavereply %s accepted %t}", c.ReplyPacketID, c.Accepted)
+}
+
+// HTML implements types.Message.
+func (c ChordLeaveReplyMessage) HTML() string {
+	return c.String()
+}
+
 // -----------------------------------------------------------------------------
 // ChordPingMessage
 
@@ -231,3 +254,142 @@ func (c ChordPingReplyMessage) String() string {
 func (c ChordPingReplyMessage) HTML() string {
 	return c.String()
 }
+
+// -----------------------------------------------------------------------------
+// ChordRingSnapshotMessage
+
+// NewEmpty implements types.Message.
+func (c ChordRingSnapshotMessage) NewEmpty() Message {
+	return &ChordRingSnapshotMessage{}
+}
+
+// Name implements types.Message.
+func (c ChordRingSnapshotMessage) Name() string {
+	return "chordringsnapshot"
+}
+
+// String implements types.Message.
+func (c ChordRingSnapshotMessage) String() string {
+	return fmt.Sprintf("{chordringsnapshot from %s with %d nodes}", c.Source, len(c.Nodes))
+}
+
+// HTML implements types.Message.
+func (c ChordRingSnapshotMessage) HTML() string {
+	return c.String()
+}
+
+// -----------------------------------------------------------------------------
+// ChordQueryRangeMessage
+
+// NewEmpty implements types.Message.
+func (c ChordQueryRangeMessage) NewEmpty() Message {
+	return &ChordQueryRangeMessage{}
+}
+
+// Name implements types.Message.
+func (c ChordQueryRangeMessage) Name() string {
+	return "chordqueryrange"
+}
+
+// String implements types.Message.
+func (c ChordQueryRangeMessage) String() string {
+	return fmt.Sprintf("{chordqueryrange from %s for [%d, %d] with %d subranges}", c.Source, c.Start, c.End,
+		len(c.Ranges))
+}
+
+// HTML implements types.Message.
+func (c ChordQueryRangeMessage) HTML() string {
+	return c.String()
+}
+
+// -----------------------------------------------------------------------------
+// ChordReplyRangeMessage
+
+// NewEmpty implements types.Message.
+func (c ChordReplyRangeMessage) NewEmpty() Message {
+	return &ChordReplyRangeMessage{}
+}
+
+// Name implements types.Message.
+func (c ChordReplyRangeMessage) Name() string {
+	return "chordreplyrange"
+}
+
+// String implements types.Message.
+func (c ChordReplyRangeMessage) String() string {
+	return fmt.Sprintf("{chordreplyrange %s with %d subranges}", c.ReplyPacketID, len(c.Ranges))
+}
+
+// HTML implements types.Message.
+func (c ChordReplyRangeMessage) HTML() string {
+	return c.String()
+}
+
+// -----------------------------------------------------------------------------
+// ChordChallengeMessage
+
+// NewEmpty implements types.Message.
+func (c ChordChallengeMessage) NewEmpty() Message {
+	return &ChordChallengeMessage{}
+}
+
+// Name implements types.Message.
+func (c ChordChallengeMessage) Name() string {
+	return "chordchallenge"
+}
+
+// String implements types.Message.
+func (c ChordChallengeMessage) String() string {
+	return fmt.Sprintf("{chordchallenge %s to %s}", c.RequestID, c.Target)
+}
+
+// HTML implements types.Message.
+func (c ChordChallengeMessage) HTML() string {
+	return c.String()
+}
+
+// -----------------------------------------------------------------------------
+// ChordChallengeReplyMessage
+
+// NewEmpty implements types.Message.
+func (c ChordChallengeReplyMessage) NewEmpty() Message {
+	return &ChordChallengeReplyMessage{}
+}
+
+// Name implements types.Message.
+func (c ChordChallengeReplyMessage) Name() string {
+	return "chordchallengereply"
+}
+
+// String implements types.Message.
+func (c ChordChallengeReplyMessage) String() string {
+	return fmt.Sprintf("{chordchallengereply %s}", c.ReplyPacketID)
+}
+
+// HTML implements types.Message.
+func (c ChordChallengeReplyMessage) HTML() string {
+	return c.String()
+}
+
+// -----------------------------------------------------------------------------
+// ChordRouteMessage
+
+// NewEmpty implements types.Message.
+func (c ChordRouteMessage) NewEmpty() Message {
+	return &ChordRouteMessage{}
+}
+
+// Name implements types.Message.
+func (c ChordRouteMessage) Name() string {
+	return "chordroute"
+}
+
+// String implements types.Message.
+func (c ChordRouteMessage) String() string {
+	return fmt.Sprintf("{chordroute to key %d from %s}", c.Key, c.Source)
+}
+
+// HTML implements types.Message.
+func (c ChordRouteMessage) HTML() string {
+	return c.String()
+}
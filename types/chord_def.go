@@ -1,5 +1,7 @@
 package types
 
+import "go.dedis.ch/cs438/transport"
+
 // ChordQuerySuccessorMessage describes a message sent to request the successor of a key.
 //
 // - implements types.Message
@@ -13,6 +15,10 @@ type ChordQuerySuccessorMessage struct {
 
 	// Key is the key to query
 	Key uint
+
+	// Target is the Chord node that should process the query, it can be a virtual node of the
+	// receiving peer. An empty target designates the primary node of the receiving peer
+	Target string
 }
 
 // ChordReplySuccessorMessage describes a reply message to the ChordQuerySuccessorMessage, it includes
@@ -25,12 +31,21 @@ type ChordReplySuccessorMessage struct {
 
 	// Successor is the answer to the query, i.e., which successor the query key belongs to
 	Successor string
+
+	// Credential is the credential of the successor, it is only set if the authentication is enabled
+	Credential ChordCredential
 }
 
 // ChordQueryPredecessorMessage describes a message sent to request the predecessor of the node
 //
 // - implements types.Message
-type ChordQueryPredecessorMessage struct{}
+type ChordQueryPredecessorMessage struct {
+	// Source is the Chord node that initiates the query
+	Source string
+
+	// Target is the Chord node whose predecessor is queried
+	Target string
+}
 
 // ChordReplyPredecessorMessage describes a reply message to the ChordQueryPredecessorMessage
 //
@@ -38,13 +53,31 @@ type ChordQueryPredecessorMessage struct{}
 type ChordReplyPredecessorMessage struct {
 	// Predecessor is the answer to the query, i.e., which predecessor the node is storing
 	Predecessor string
+
+	// Credential is the credential of the predecessor, it is only set if the authentication is enabled
+	Credential ChordCredential
+
+	// Target is the Chord node that initiated the query
+	Target string
 }
 
 // ChordNotifyMessage describes a notifyMessage in the case that we believe that we should
 // be the predecessor of another node
 //
 // - implements types.Message
-type ChordNotifyMessage struct{}
+type ChordNotifyMessage struct {
+	// Source is the Chord node that believes it is the predecessor of the target
+	Source string
+
+	// Target is the Chord node that is notified
+	Target string
+
+	// Credential is the credential of the source, it is only set if the authentication is enabled
+	Credential ChordCredential
+
+	// Signature is the signature of the message by the source, it is only set if the authentication is enabled
+	Signature []byte
+}
 
 // ChordRingLenMessage describes a query message to find out the total number of nodes inside
 // a Chord ring. It is initiated by Source and Length is the cumulative length.
@@ -60,21 +93,88 @@ type ChordRingLenMessage struct {
 
 	// Length is the current length of the ring
 	Length uint
+
+	// Target is the Chord node the message is passed to
+	Target string
 }
 
-// ChordClearPredecessorMessage instructs our successor to remove us from its predecessor field,
-// this message is used when some nodes leave the system
+// ChordClearPredecessorMessage instructs our successor to replace us by our predecessor in its predecessor
+// field, this message is used when some nodes leave the system. It is acknowledged by a ChordLeaveReplyMessage.
 //
 // - implements types.Message
-type ChordClearPredecessorMessage struct{}
+type ChordClearPredecessorMessage struct {
+	// RequestID must be a unique identifier. Use xid.New().String() to generate
+	// it.
+	RequestID string
+
+	// Predecessor is the new predecessor that our successor should use, empty if it is unknown
+	Predecessor string
+
+	// Source is the Chord node that leaves the ring
+	Source string
+
+	// Target is the successor of the leaving Chord node
+	Target string
+
+	// Credential is the credential of the new predecessor, it is only set if the authentication is enabled
+	Credential ChordCredential
+
+	// Signature is the signature of the message by the source, it is only set if the authentication is enabled
+	Signature []byte
+}
 
 // ChordSkipSuccessorMessage instructs our predecessor to remove us from its successor field, this
-// message is used when some nodes leave the system
+// message is used when some nodes leave the system. It is acknowledged by a ChordLeaveReplyMessage, the
+// predecessor refuses it if it is leaving as well, or if we are not its successor.
 //
 // - implements types.Message
 type ChordSkipSuccessorMessage struct {
+	// RequestID must be a unique identifier. Use xid.New().String() to generate
+	// it.
+	RequestID string
+
 	// The new successor that our predecessor should use
 	Successor string
+
+	// Source is the Chord node that leaves the ring
+	Source string
+
+	// Target is the predecessor of the leaving Chord node
+	Target string
+
+	// Credential is the credential of the new successor, it is only set if the authentication is enabled
+	Credential ChordCredential
+
+	// Signature is the signature of the message by the source, it is only set if the authentication is enabled
+	Signature []byte
+}
+
+// ChordCredential binds the address of a Chord node to its public key. The chordID of the node is derived
+// from the public key, so that a node cannot choose its position inside the ring by choosing its address.
+type ChordCredential struct {
+	// Address is the address of the Chord node
+	Address string
+
+	// PublicKey is the public key of the Chord node, in PKIX, ASN.1 DER form
+	PublicKey []byte
+
+	// Signature is the signature of the address by the private key of the Chord node
+	Signature []byte
+
+	// Nonce is the proof of work over the public key: the hash of the public key and the nonce has
+	// ChordKeyDifficulty leading zero bits
+	Nonce uint64
+}
+
+// ChordLeaveReplyMessage acknowledges a ChordClearPredecessorMessage or a ChordSkipSuccessorMessage
+//
+// - implements types.Message
+type ChordLeaveReplyMessage struct {
+	// ReplyPacketID is the PacketID this reply is for
+	ReplyPacketID string
+
+	// Accepted is true if the neighbour updated its pointer, false if it refused to
+	Accepted bool
 }
 
 // ChordPingMessage pings a chord peer, and check for its liveliness
@@ -91,3 +191,158 @@ type ChordPingReplyMessage struct {
 	// ReplyPacketID is the PacketID this reply is for
 	ReplyPacketID string
 }
+
+// ChordNodeInfo describes the state of a Chord node, as it is collected during a ring snapshot
+type ChordNodeInfo struct {
+	// Address is the address of the Chord node
+	Address string
+
+	// ChordID is the ID of the Chord node inside the ring
+	ChordID uint
+
+	// Predecessor is the predecessor of the Chord node, empty if it does not have any
+	Predecessor string
+
+	// Successor is the successor of the Chord node, empty if it does not have any
+	Successor string
+
+	// RangeStart is the start of the key range (RangeStart, RangeEnd] owned by the Chord node, it is
+	// the ID of the predecessor. If the node has no predecessor, RangeStart == RangeEnd
+	RangeStart uint
+
+	// RangeEnd is the end of the key range owned by the Chord node, i.e., its own ChordID
+	RangeEnd uint
+}
+
+// ChordRingSnapshotMessage describes a message passed around the ring to collect the state of every
+// node inside the ring. It is initiated by Source and Nodes is the cumulative list of nodes visited.
+//
+// - implements types.Message
+type ChordRingSnapshotMessage struct {
+	// RequestID must be a unique identifier. Use xid.New().String() to generate
+	// it.
+	RequestID string
+
+	// Source is the source who initiate the request
+	Source string
+
+	// Nodes are the nodes visited so far, in the order of the walk
+	Nodes []ChordNodeInfo
+
+	// Target is the Chord node the message is passed to
+	Target string
+}
+
+// ChordRange describes a subrange of keys [Start, End] owned by a Chord node, the subrange is crossing the
+// boundary of the ring if Start > End
+type ChordRange struct {
+	// Node is the address of the Chord node that owns the keys
+	Node string
+
+	// Start is the first key of the subrange
+	Start uint
+
+	// End is the last key of the subrange
+	End uint
+}
+
+// ChordQueryRangeMessage describes a message passed along the successors to find the owners of the keys
+// [Start, End], starting from the owner of Start. It is initiated by Source and Ranges is the cumulative list of
+// subranges covered so far. The last node of the walk replies with a ChordReplyRangeMessage.
+//
+// - implements types.Message
+type ChordQueryRangeMessage struct {
+	// RequestID must be a unique identifier. Use xid.New().String() to generate
+	// it.
+	RequestID string
+
+	// Source is the source who initiate the request
+	Source string
+
+	// Start is the first key of the queried range
+	Start uint
+
+	// End is the last key of the queried range, the range is crossing the boundary of the ring if Start > End
+	End uint
+
+	// Ranges are the subranges covered so far, in the order of the walk
+	Ranges []ChordRange
+
+	// Target is the Chord node the message is passed to
+	Target string
+}
+
+// ChordReplyRangeMessage replies the owners of a queried range
+//
+// - implements types.Message
+type ChordReplyRangeMessage struct {
+	// ReplyPacketID is the PacketID this reply is for
+	ReplyPacketID string
+
+	// Ranges are the subranges covering the queried range, in the order of the ring
+	Ranges []ChordRange
+}
+
+// ChordChallengeMessage challenges a Chord node to prove that it holds the private key of the credential it
+// presents for its address
+//
+// - implements types.Message
+type ChordChallengeMessage struct {
+	// RequestID must be a unique identifier. Use xid.New().String() to generate
+	// it.
+	RequestID string
+
+	// Nonce is the random value the challenged node should sign
+	Nonce []byte
+
+	// Target is the Chord node that is challenged
+	Target string
+}
+
+// ChordChallengeReplyMessage replies a challenge message
+//
+// - implements types.Message
+type ChordChallengeReplyMessage struct {
+	// ReplyPacketID is the PacketID this reply is for
+	ReplyPacketID string
+
+	// Signature is the signature of the nonce by the challenged node
+	Signature []byte
+}
+
+// ChordRouteMessage carries a message to the Chord node owning a key, it is forwarded hop by hop along the
+// finger tables, so that the sender does not need a routing entry for the owner
+//
+// - implements types.Message
+type ChordRouteMessage struct {
+	// Source is the address of the peer that sends the message, the payload is processed as if it had been
+	// sent directly by it
+	Source string
+
+	// Destination is the peer the message is for, it should own the key. It is empty if the message is for
+	// whichever node owns the key
+	Destination string
+
+	// Key is the key whose owner receives the message
+	Key uint
+
+	// Target is the Chord node that should process the message, it can be a virtual node of the receiving
+	// peer
+	Target string
+
+	// Final is set by the predecessor of the key, the target is then the owner of the key
+	Final bool
+
+	// TTL is the number of hops left before the message is dropped
+	TTL uint
+
+	// Msg is the payload to deliver to the owner of the key
+	Msg *transport.Message
+
+	// Credential is the credential of the source, it is only set if the authentication is enabled
+	Credential ChordCredential
+
+	// Signature is the signature of the payload, its key and its destination by the source, it is only set if the
+	// authentication is enabled
+	Signature []byte
+}
@@ -0,0 +1,141 @@
+package types
+
+import "fmt"
+
+// -----------------------------------------------------------------------------
+// DHashPutMessage
+
+// NewEmpty implements types.Message.
+func (d DHashPutMessage) NewEmpty() Message {
+	return &DHashPutMessage{}
+}
+
+// Name implements types.Message.
+func (d DHashPutMessage) Name() string {
+	return "dhashput"
+}
+
+// String implements types.Message.
+func (d DHashPutMessage) String() string {
+	return fmt.Sprintf("{dhashput %s from %s}", d.Entry.Key, d.Source)
+}
+
+// HTML implements types.Message.
+func (d DHashPutMessage) HTML() string {
+	return d.String()
+}
+
+// -----------------------------------------------------------------------------
+// DHashPutReplyMessage
+
+// NewEmpty implements types.Message.
+func (d DHashPutReplyMessage) NewEmpty() Message {
+	return &DHashPutReplyMessage{}
+}
+
+// Name implements types.Message.
+func (d DHashPutReplyMessage) Name() string {
+	return "dhashputreply"
+}
+
+// String implements types.Message.
+func (d DHashPutReplyMessage) String() string {
+	return fmt.Sprintf("{dhashputreply for packet: %s}", d.ReplyPacketID)
+}
+
+// HTML implements types.Message.
+func (d DHashPutReplyMessage) HTML() string {
+	return d.String()
+}
+
+// -----------------------------------------------------------------------------
+// DHashGetMessage
+
+// NewEmpty implements types.Message.
+func (d DHashGetMessage) NewEmpty() Message {
+	return &DHashGetMessage{}
+}
+
+// Name implements types.Message.
+func (d DHashGetMessage) Name() string {
+	return "dhashget"
+}
+
+// String implements types.Message.
+func (d DHashGetMessage) String() string {
+	return fmt.Sprintf("{dhashget %s from %s}", d.Key, d.Source)
+}
+
+// HTML implements types.Message.
+func (d DHashGetMessage) HTML() string {
+	return d.String()
+}
+
+// -----------------------------------------------------------------------------
+// DHashGetReplyMessage
+
+// NewEmpty implements types.Message.
+func (d DHashGetReplyMessage) NewEmpty() Message {
+	return &DHashGetReplyMessage{}
+}
+
+// Name implements types.Message.
+func (d DHashGetReplyMessage) Name() string {
+	return "dhashgetreply"
+}
+
+// String implements types.Message.
+func (d DHashGetReplyMessage) String() string {
+	return fmt.Sprintf("{dhashgetreply for packet: %s, found %t}", d.ReplyPacketID, d.Found)
+}
+
+// HTML implements types.Message.
+func (d DHashGetReplyMessage) HTML() string {
+	return d.String()
+}
+
+// -----------------------------------------------------------------------------
+// DHashStoreMessage
+
+// NewEmpty implements types.Message.
+func (d DHashStoreMessage) NewEmpty() Message {
+	return &DHashStoreMessage{}
+}
+
+// Name implements types.Message.
+func (d DHashStoreMessage) Name() string {
+	return "dhashstore"
+}
+
+// String implements types.Message.
+func (d DHashStoreMessage) String() string {
+	return fmt.Sprintf("{dhashstore %d entries to %s, %d replicas}", len(d.Entries), d.Target, d.Replicas)
+}
+
+// HTML implements types.Message.
+func (d DHashStoreMessage) HTML() string {
+	return d.String()
+}
+
+// -----------------------------------------------------------------------------
+// DHashUpdRangeMessage
+
+// NewEmpty implements types.Message.
+func (d DHashUpdRangeMessage) NewEmpty() Message {
+	return &DHashUpdRangeMessage{}
+}
+
+// Name implements types.Message.
+func (d DHashUpdRangeMessage) Name() string {
+	return "dhashupdrange"
+}
+
+// String implements types.Message.
+func (d DHashUpdRangeMessage) String() string {
+	return fmt.Sprintf("{dhashupdrange %s from %s to %s}", d.Node, d.OldPredecessor, d.NewPredecessor)
+}
+
+// HTML implements types.Message.
+func (d DHashUpdRangeMessage) HTML() string {
+	return d.String()
+}
@@ -0,0 +1,102 @@
+package types
+
+// DHashEntry is a key-value pair stored inside the distributed hash table
+type DHashEntry struct {
+	// Key is the key of the entry
+	Key string
+
+	// ID is the position of the key inside the Chord ring, the entry is owned by the successor of ID
+	ID uint
+
+	// Value is the value of the entry
+	Value []byte
+}
+
+// DHashPutMessage requests the owner of a key to store the entry
+//
+// - implements types.Message
+type DHashPutMessage struct {
+	// RequestID must be a unique identifier. Use xid.New().String() to generate
+	// it.
+	RequestID string
+
+	// Source is the peer that initiates the request
+	Source string
+
+	// Target is the Chord node that owns the key, it can be a virtual node of the receiving peer
+	Target string
+
+	// Entry is the entry to store
+	Entry DHashEntry
+}
+
+// DHashPutReplyMessage acknowledges a DHashPutMessage, once the owner has stored the entry
+//
+// - implements types.Message
+type DHashPutReplyMessage struct {
+	// ReplyPacketID is the PacketID this reply is for
+	ReplyPacketID string
+}
+
+// DHashGetMessage requests the owner of a key to return the value of the key
+//
+// - implements types.Message
+type DHashGetMessage struct {
+	// RequestID must be a unique identifier. Use xid.New().String() to generate
+	// it.
+	RequestID string
+
+	// Source is the peer that initiates the request
+	Source string
+
+	// Key is the key to look up
+	Key string
+}
+
+// DHashGetReplyMessage replies to a DHashGetMessage
+//
+// - implements types.Message
+type DHashGetReplyMessage struct {
+	// ReplyPacketID is the PacketID this reply is for
+	ReplyPacketID string
+
+	// Found tells whether the owner stores the key
+	Found bool
+
+	// Value is the value of the key, if it is found
+	Value []byte
+}
+
+// DHashStoreMessage hands over entries to another Chord node, it is used to replicate entries on the
+// successors of the owner, and to move entries when nodes join or leave the ring
+//
+// - implements types.Message
+type DHashStoreMessage struct {
+	// Origin is the peer that initiates the hand-over, the replication stops before reaching it again
+	Origin string
+
+	// Target is the Chord node that receives the entries, it can be a virtual node of the receiving peer
+	Target string
+
+	// Entries are the entries to store
+	Entries []DHashEntry
+
+	// Replicas is the number of copies that should be stored, starting from the target and following
+	// the successors
+	Replicas uint
+}
+
+// DHashUpdRangeMessage is sent by the Chord component to the DHash component when a Chord node hosted
+// by the peer changes its predecessor, i.e., when the range of keys it owns changes
+//
+// - implements types.Message
+type DHashUpdRangeMessage struct {
+	// Node is the Chord node whose predecessor changed
+	Node string
+
+	// OldPredecessor is the previous predecessor of the node, empty if it had none
+	OldPredecessor string
+
+	// NewPredecessor is the new predecessor of the node
+	NewPredecessor string
+}
@@ -0,0 +1,49 @@
+package types
+
+import "fmt"
+
+// -----------------------------------------------------------------------------
+// KademliaFindNodeMessage
+
+// NewEmpty implements types.Message.
+func (c KademliaFindNodeMessage) NewEmpty() Message {
+	return &KademliaFindNodeMessage{}
+}
+
+// Name implements types.Message.
+func (c KademliaFindNodeMessage) Name() string {
+	return "kademliafindnode"
+}
+
+// String implements types.Message.
+func (c KademliaFindNodeMessage) String() string {
+	return fmt.Sprintf("{kademliafindnode %d}", c.Key)
+}
+
+// HTML implements types.Message.
+func (c KademliaFindNodeMessage) HTML() string {
+	return c.String()
+}
+
+// -----------------------------------------------------------------------------
+// KademliaFindNodeReplyMessage
+
+// NewEmpty implements types.Message.
+func (c KademliaFindNodeReplyMessage) NewEmpty() Message {
+	return &KademliaFindNodeReplyMessage{}
+}
+
+// Name implements types.Message.
+func (c KademliaFindNodeReplyMessage) Name() string {
+	return "kademliafindnodereply"
+}
+
+// String implements types.Message.
+func (c KademliaFindNodeReplyMessage) String() string {
+	return fmt.Sprintf("{kademliafindnodereply %v}", c.Contacts)
+}
+
+// HTML implements types.Message.
+func (c KademliaFindNodeReplyMessage) HTML() string {
+	return c.String()
+}
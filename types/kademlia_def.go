@@ -0,0 +1,26 @@
+package types
+
+// KademliaFindNodeMessage describes a message sent to request the contacts of a Kademlia node that are the
+// closest to a key
+//
+// - implements types.Message
+type KademliaFindNodeMessage struct {
+	// RequestID must be a unique identifier. Use xid.New().String() to generate
+	// it.
+	RequestID string
+
+	// Key is the key to query
+	Key uint
+}
+
+// KademliaFindNodeReplyMessage describes a reply message to the KademliaFindNodeMessage
+//
+// - implements types.Message
+type KademliaFindNodeReplyMessage struct {
+	// ReplyPacketID is the RequestID this reply is for
+	ReplyPacketID string
+
+	// Contacts are the addresses of the nodes known by the replying node that are the closest to the key,
+	// including itself, sorted by distance
+	Contacts []string
+}
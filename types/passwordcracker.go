@@ -47,26 +47,3 @@ func (c PasswordCrackerReplyMessage) String() string {
 func (c PasswordCrackerReplyMessage) HTML() string {
 	return c.String()
 }
-
-// -----------------------------------------------------------------------------
-// PasswordCrackerUpdDictRangeMessage
-
-// NewEmpty implements types.Message.
-func (c PasswordCrackerUpdDictRangeMessage) NewEmpty() Message {
-	return &PasswordCrackerUpdDictRangeMessage{}
-}
-
-// Name implements types.Message.
-func (c PasswordCrackerUpdDictRangeMessage) Name() string {
-	return "passwordcrackerupddictrange"
-}
-
-// String implements types.Message.
-func (c PasswordCrackerUpdDictRangeMessage) String() string {
-	return fmt.Sprintf("{passwordcrackerupddictrange from %d to %d}", c.Start, c.End)
-}
-
-// HTML implements types.Message.
-func (c PasswordCrackerUpdDictRangeMessage) HTML() string {
-	return c.String()
-}
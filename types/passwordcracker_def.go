@@ -30,12 +30,29 @@ type PasswordCrackerReplyMessage struct {
 	Password string
 }
 
-// PasswordCrackerUpdDictRangeMessage is sent by the Chord component to update about the salt range that the
-// node is responsible for the password cracker
-type PasswordCrackerUpdDictRangeMessage struct {
-	// Start range of the salt value
+// SaltRange describes the salt range (Start, End] owned by a DHT node, if Start == End, the range covers
+// the whole key space
+type SaltRange struct {
+	// Start range of the salt value, exclusive
 	Start uint
 
-	// End range of the salt value
+	// End range of the salt value, inclusive
 	End uint
 }
+
+// PasswordCrackerCacheEntry is a cracked password published in the DHT, on the owner of the salt, so that the
+// same hash and salt do not have to be cracked twice
+type PasswordCrackerCacheEntry struct {
+	// Hash is the cracked hash
+	Hash []byte
+
+	// Salt is the salt used to compute the hash
+	Salt []byte
+
+	// Password is the cracked password
+	Password string
+
+	// Finisher is the blockchain account that executed the password-cracking contract, its Tasks record
+	// in the world state proves the result. It is empty if the task was submitted without a contract
+	Finisher string
+}